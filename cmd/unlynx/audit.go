@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ldsec/unlynx/services"
+	"github.com/urfave/cli"
+)
+
+// BEGIN AUDIT ----------
+func runAudit(c *cli.Context) error {
+	surveyID := c.String(optionSurvey)
+	proofsDir := c.String(optionProofs)
+	if surveyID == "" || proofsDir == "" {
+		return fmt.Errorf("the survey and proofs options are mandatory")
+	}
+
+	// the proofs are verified against the key of the servers, not the one written in the archive
+	el, err := openGroupToml(c.String(optionGroupFile))
+	if err != nil {
+		return fmt.Errorf("could not open group toml: %v", err)
+	}
+	collectiveKey, err := parseCollectiveKey(el, c.String(optionCollectiveKey))
+	if err != nil {
+		return err
+	}
+
+	verdicts, err := servicesunlynx.AuditProofsArchive(proofsDir, servicesunlynx.SurveyID(surveyID), collectiveKey)
+	if err != nil {
+		return err
+	}
+
+	wrong := 0
+	for _, v := range verdicts {
+		verdict := "OK"
+		if len(v.Failed) > 0 {
+			verdict = "FAILED (" + strings.Join(v.Failed, ", ") + ")"
+			wrong++
+		}
+		fmt.Fprintf(c.App.Writer, "%-15s %-30s %3d publication(s)  %s\n", v.Phase, v.Server, v.Publications, verdict)
+	}
+
+	if wrong > 0 {
+		return fmt.Errorf("%d server(s) published wrong proofs for survey %s", wrong, surveyID)
+	}
+	return nil
+}
+
+// AUDIT END ----------
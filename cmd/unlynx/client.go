@@ -1,23 +1,37 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
-	"os"
+	"io/ioutil"
+	"math"
 	"regexp"
 	"strconv"
 	"strings"
 
+	"github.com/BurntSushi/toml"
 	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/lib/differential_privacy"
+	"github.com/ldsec/unlynx/lib/range"
 	"github.com/ldsec/unlynx/services"
 	"github.com/urfave/cli"
+	"go.dedis.ch/kyber/v3"
 	"go.dedis.ch/onet/v3"
 	"go.dedis.ch/onet/v3/app"
 	"go.dedis.ch/onet/v3/log"
 )
 
 // BEGIN CLIENT: QUERIER ----------
-func startQuery(el *onet.Roster, proofs bool, sum []string, count bool, whereQueryValues []libunlynx.WhereQueryAttribute, predicate string, groupBy []string) error {
+func startQuery(el *onet.Roster, keyFile string, proofs bool, sum []string, count bool, whereQueryValues []libunlynx.WhereQueryAttribute, predicate string, groupBy []string, options servicesunlynx.SurveyOptions) error {
+	// the querier is identified by its long-term key (a random key if it has none)
 	client := servicesunlynx.NewUnLynxClient(el.List[0], strconv.Itoa(0))
+	if keyFile != "" {
+		keys, err := readKeyPair(keyFile)
+		if err != nil {
+			return err
+		}
+		client = servicesunlynx.NewUnLynxClientWithKeys(el.List[0], strconv.Itoa(0), keys)
+	}
 
 	nbrDPs := make(map[string]int64)
 	//how many data providers for each server
@@ -25,22 +39,21 @@ func startQuery(el *onet.Roster, proofs bool, sum []string, count bool, whereQue
 		nbrDPs[server.String()] = 1 // 1 DP for each server
 	}
 
-	surveyID, err := client.SendSurveyCreationQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofs, true, sum, count, whereQueryValues, predicate, groupBy)
+	surveyID, err := client.SendSurveyCreationQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofs, true, sum, count, whereQueryValues, predicate, groupBy, options)
 	if err != nil {
 		return err
 	}
 
-	grp, aggr, err := client.SendSurveyResultsQuery(*surveyID)
+	results, err := client.SendSurveyTypedResultsQuery(*surveyID)
 	if err != nil {
 		return fmt.Errorf("service could not output the results: %v", err)
 	}
 
 	// Print Output
-	log.Lvl1("Service output:")
-	var tabVerify [][]int64
-	tabVerify = *grp
-	for i := range tabVerify {
-		log.Lvl1(i, ")", (*grp)[i], "->", (*aggr)[i])
+	log.Lvl1("Service output (", results.Participants, "data providers):")
+	log.Lvl1(results.Columns, results.Operations)
+	for i := range results.GroupBy {
+		log.Lvl1(i, ")", results.GroupBy[i], "->", results.Aggregates[i], results.Statistics[i])
 	}
 	return nil
 }
@@ -51,27 +64,112 @@ func runUnLynx(c *cli.Context) {
 	proofs := c.Bool("proofs")
 
 	// query parameters
+	dataset := c.String("dataset")
+	query := c.String(optionQuery)
 	sum := c.String("sum")
 	count := c.Bool("count")
 	whereQueryValues := c.String("where")
 	predicate := c.String("predicate")
+	ranges := c.String(optionRange)
+	rangeBits := c.Int64(optionRangeBits)
 	groupBy := c.String("groupBy")
+	types := c.String(optionTypes)
+	aggregate := c.String(optionAggregate)
+
+	// differential privacy parameters
+	diffPri := libunlynxdiffprivacy.Params{
+		Epsilon:       c.Float64(optionEpsilon),
+		Sensitivity:   c.Float64(optionSensitivity),
+		NoiseListSize: c.Int64(optionNoiseSize),
+		Quanta:        c.Float64(optionQuanta),
+		Scale:         c.Float64(optionScale),
+		Limit:         c.Float64(optionLimit),
+	}
+	err := diffPri.Validate()
+	log.ErrFatal(err, "Wrong differential privacy parameters.")
 
 	el, err := openGroupToml(tomlFileName)
 	log.ErrFatal(err, "Could not open group toml.")
 
-	sumFinal, countFinal, whereFinal, predicateFinal, groupByFinal, err := parseQuery(el, sum, count, whereQueryValues, predicate, groupBy)
+	typesFinal, err := parseTypes(types)
+	log.ErrFatal(err)
+
+	boundsFinal, err := parseBounds(c.String(optionBounds))
+	log.ErrFatal(err)
 
-	err = startQuery(el, proofs, sumFinal, countFinal, whereFinal, predicateFinal, groupByFinal)
+	collectiveKey, err := parseCollectiveKey(el, c.String(optionCollectiveKey))
+	log.ErrFatal(err)
+
+	var sumFinal, groupByFinal []string
+	var countFinal bool
+	var whereFinal []libunlynx.WhereQueryAttribute
+	var rangesFinal []libunlynx.WhereQueryRange
+	var predicateFinal string
+	var operationsFinal []libunlynx.Operation
+	if query != "" {
+		scq, err := servicesunlynx.ParseQueryWithKey(el, collectiveKey, query, rangeBits)
+		log.ErrFatal(err, "Could not parse the query.")
+
+		if scq.Dataset != "" {
+			dataset = scq.Dataset
+		}
+		sumFinal, countFinal, whereFinal, rangesFinal, predicateFinal, groupByFinal, operationsFinal = scq.Sum, scq.Count, scq.Where, scq.WhereRange, scq.Predicate, scq.GroupBy, scq.Operations
+	} else {
+		sumFinal, countFinal, whereFinal, predicateFinal, groupByFinal, err = parseQuery(collectiveKey, sum, count, whereQueryValues, ranges != "", predicate, groupBy)
+		log.ErrFatal(err)
+
+		rangesFinal, err = parseRanges(collectiveKey, ranges, rangeBits)
+		log.ErrFatal(err)
+
+		operationsFinal, err = parseOperations(aggregate)
+		log.ErrFatal(err)
+		if len(sumFinal) == 0 && len(operationsFinal) == 0 {
+			log.Fatal("wrong query! please give the sum or the aggregate parameters")
+		}
+	}
+
+	// the surveys with the aggregate key of the group do not carry it
+	if !c.IsSet(optionCollectiveKey) {
+		collectiveKey = nil
+	}
+	options := servicesunlynx.SurveyOptions{
+		Dataset:       dataset,
+		WhereRange:    rangesFinal,
+		Operations:    operationsFinal,
+		Types:         typesFinal,
+		Bounds:        boundsFinal,
+		Deadline:      c.Duration(optionDeadline),
+		Quorum:        c.Int64(optionQuorum),
+		ExpectedRows:  c.Int64(optionRows),
+		CollectiveKey: collectiveKey,
+		DiffPri:       diffPri,
+	}
+	err = startQuery(el, c.String(optionKey), proofs, sumFinal, countFinal, whereFinal, predicateFinal, groupByFinal, options)
 	log.ErrFatal(err)
 }
 
+// openGroupToml reads the roster of a group file, the suite of its servers becomes the one of the library
 func openGroupToml(tomlFileName string) (*onet.Roster, error) {
-	f, err := os.Open(tomlFileName)
+	content, err := ioutil.ReadFile(tomlFileName)
 	if err != nil {
 		return nil, err
 	}
-	el, err := app.ReadGroupDescToml(f)
+	group := &app.GroupToml{}
+	if _, err := toml.Decode(string(content), group); err != nil {
+		return nil, err
+	}
+	suite := ""
+	for i, s := range group.Servers {
+		if i > 0 && !strings.EqualFold(s.Suite, suite) {
+			return nil, fmt.Errorf("the servers of group file %s use different suites", tomlFileName)
+		}
+		suite = s.Suite
+	}
+	if err := libunlynx.SetSuite(suite); err != nil {
+		return nil, err
+	}
+
+	el, err := app.ReadGroupDescToml(bytes.NewReader(content))
 	if err != nil {
 		return nil, err
 	}
@@ -88,9 +186,9 @@ func checkRegex(input, expression string) bool {
 	return aux.MatchString(input)
 }
 
-func parseQuery(el *onet.Roster, sum string, count bool, where, predicate, groupBy string) ([]string, bool, []libunlynx.WhereQueryAttribute, string, []string, error) {
+func parseQuery(collectiveKey kyber.Point, sum string, count bool, where string, ranges bool, predicate, groupBy string) ([]string, bool, []libunlynx.WhereQueryAttribute, string, []string, error) {
 
-	if sum == "" || (where != "" && predicate == "") || (where == "" && predicate != "") {
+	if ((where != "" || ranges) && predicate == "") || (where == "" && !ranges && predicate != "") {
 		return nil, false, nil, "", nil, fmt.Errorf("wrong query! please check the sum, where and the predicate parameters")
 	}
 
@@ -98,13 +196,17 @@ func parseQuery(el *onet.Roster, sum string, count bool, where, predicate, group
 	whereRegex := "{(w[0-9]+(,\\s*[0-9]+))*(,\\s*w[0-9]+(,\\s*[0-9]+))*}"
 	groupByRegex := "{g[0-9]+(,\\s*g[0-9]+)*}"
 
-	if !checkRegex(sum, sumRegex) {
-		return nil, false, nil, "", nil, fmt.Errorf("error parsing the sum parameter(s)")
+	// the sum can be empty if the query has aggregate operations
+	var sumFinal []string
+	if sum != "" {
+		if !checkRegex(sum, sumRegex) {
+			return nil, false, nil, "", nil, fmt.Errorf("error parsing the sum parameter(s)")
+		}
+		sum = strings.Replace(sum, " ", "", -1)
+		sum = strings.Replace(sum, "{", "", -1)
+		sum = strings.Replace(sum, "}", "", -1)
+		sumFinal = strings.Split(sum, ",")
 	}
-	sum = strings.Replace(sum, " ", "", -1)
-	sum = strings.Replace(sum, "{", "", -1)
-	sum = strings.Replace(sum, "}", "", -1)
-	sumFinal := strings.Split(sum, ",")
 
 	if count {
 		check := false
@@ -140,7 +242,7 @@ func parseQuery(el *onet.Roster, sum string, count bool, where, predicate, group
 				return nil, false, nil, "", nil, err
 			}
 
-			whereFinal = append(whereFinal, libunlynx.WhereQueryAttribute{Name: variable, Value: *libunlynx.EncryptInt(el.Aggregate, int64(value))})
+			whereFinal = append(whereFinal, libunlynx.WhereQueryAttribute{Name: variable, Value: *libunlynx.EncryptInt(collectiveKey, int64(value))})
 		}
 	}
 
@@ -155,4 +257,125 @@ func parseQuery(el *onet.Roster, sum string, count bool, where, predicate, group
 	return sumFinal, count, whereFinal, predicate, groupByFinal, nil
 }
 
+func parseTypes(types string) (map[string]libunlynx.AttributeType, error) {
+	typesFinal := make(map[string]libunlynx.AttributeType)
+	types = strings.Replace(types, " ", "", -1)
+	types = strings.Replace(types, "{", "", -1)
+	types = strings.Replace(types, "}", "", -1)
+	if types == "" {
+		return typesFinal, nil
+	}
+
+	for _, token := range strings.Split(types, ",") {
+		tokens := strings.SplitN(token, "=", 2)
+		if len(tokens) != 2 || !checkRegex(tokens[0], "^s[0-9]+$") {
+			return nil, fmt.Errorf("error parsing the types parameter(s)")
+		}
+		at, err := libunlynx.ParseAttributeType(tokens[1])
+		if err != nil {
+			return nil, err
+		}
+		typesFinal[tokens[0]] = at
+	}
+	return typesFinal, nil
+}
+
+func parseBounds(bounds string) ([]libunlynxrange.Bound, error) {
+	bounds = strings.Replace(bounds, " ", "", -1)
+	bounds = strings.Replace(bounds, "{", "", -1)
+	bounds = strings.Replace(bounds, "}", "", -1)
+	if bounds == "" {
+		return nil, nil
+	}
+
+	boundRegex := regexp.MustCompile("^(s[0-9]+)=(-?[0-9]+):(-?[0-9]+)$")
+	var boundsFinal []libunlynxrange.Bound
+	for _, token := range strings.Split(bounds, ",") {
+		tokens := boundRegex.FindStringSubmatch(token)
+		if tokens == nil {
+			return nil, fmt.Errorf("error parsing the bounds parameter %s", token)
+		}
+		min, err := strconv.ParseInt(tokens[2], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		max, err := strconv.ParseInt(tokens[3], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		b := libunlynxrange.Bound{Attribute: tokens[1], Min: min, Max: max}
+		if err := b.Validate(); err != nil {
+			return nil, err
+		}
+		boundsFinal = append(boundsFinal, b)
+	}
+	return boundsFinal, nil
+}
+
+func parseRanges(collectiveKey kyber.Point, ranges string, bits int64) ([]libunlynx.WhereQueryRange, error) {
+	ranges = strings.Replace(ranges, " ", "", -1)
+	ranges = strings.Replace(ranges, "{", "", -1)
+	ranges = strings.Replace(ranges, "}", "", -1)
+	if ranges == "" {
+		return nil, nil
+	}
+
+	rangeRegex := regexp.MustCompile("^(w[0-9]+)(<=|>=|<|>|=)([0-9]+)(:([0-9]+))?$")
+	var rangesFinal []libunlynx.WhereQueryRange
+	for _, token := range strings.Split(ranges, ",") {
+		tokens := rangeRegex.FindStringSubmatch(token)
+		if tokens == nil || (tokens[2] == "=") != (tokens[4] != "") {
+			return nil, fmt.Errorf("error parsing the range parameter %s", token)
+		}
+		value, err := strconv.ParseInt(tokens[3], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		lower, upper := int64(0), int64(math.MaxInt64)
+		switch tokens[2] {
+		case "<=":
+			upper = value
+		case "<":
+			upper = value - 1
+		case ">=":
+			lower = value
+		case ">":
+			lower = value + 1
+		case "=":
+			lower = value
+			upper, err = strconv.ParseInt(tokens[5], 10, 64)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		wr, err := libunlynx.NewWhereQueryRange(tokens[1], bits, lower, upper, collectiveKey)
+		if err != nil {
+			return nil, err
+		}
+		rangesFinal = append(rangesFinal, wr)
+	}
+	return rangesFinal, nil
+}
+
+func parseOperations(aggregate string) ([]libunlynx.Operation, error) {
+	aggregate = strings.Replace(aggregate, " ", "", -1)
+	aggregate = strings.Replace(aggregate, "{", "", -1)
+	aggregate = strings.Replace(aggregate, "}", "", -1)
+	if aggregate == "" {
+		return nil, nil
+	}
+
+	var operationsFinal []libunlynx.Operation
+	for _, token := range strings.Split(aggregate, ",") {
+		op, err := libunlynx.ParseOperation(token)
+		if err != nil {
+			return nil, err
+		}
+		operationsFinal = append(operationsFinal, op)
+	}
+	return operationsFinal, nil
+}
+
 // CLIENT END: QUERIER ----------
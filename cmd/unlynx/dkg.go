@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/services"
+	"github.com/urfave/cli"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/util/encoding"
+	"go.dedis.ch/onet/v3"
+)
+
+// BEGIN CLIENT: DKG ----------
+
+// runDKG asks the servers of the group to generate a collective key shared among them, the key is printed to be given
+// to the surveys (collectiveKey option)
+func runDKG(c *cli.Context) error {
+	el, err := openGroupToml(c.String(optionGroupFile))
+	if err != nil {
+		return fmt.Errorf("could not open group toml: %v", err)
+	}
+	threshold := c.Int64(optionThreshold)
+	if threshold == 0 {
+		threshold = int64(len(el.List))
+	}
+
+	client := servicesunlynx.NewUnLynxClient(el.List[0], "dkg")
+	collectiveKey, err := client.SendDKGQuery(el, threshold)
+	if err != nil {
+		return err
+	}
+	public, err := encoding.PointToStringHex(libunlynx.SuiTe, collectiveKey)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(c.App.Writer, public)
+	return nil
+}
+
+// parseCollectiveKey reads a collective key (hex) generated by runDKG, it is the aggregate key of the roster if it is
+// empty
+func parseCollectiveKey(el *onet.Roster, collectiveKey string) (kyber.Point, error) {
+	if collectiveKey == "" {
+		return el.Aggregate, nil
+	}
+	point, err := encoding.StringHexToPoint(libunlynx.SuiTe, strings.TrimSpace(collectiveKey))
+	if err != nil {
+		return nil, fmt.Errorf("could not read the collective key: %v", err)
+	}
+	return point, nil
+}
+
+// CLIENT END: DKG ----------
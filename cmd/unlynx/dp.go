@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/ldsec/unlynx/data"
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/services"
+	"github.com/urfave/cli"
+	"go.dedis.ch/kyber/v3/util/encoding"
+	"go.dedis.ch/kyber/v3/util/key"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+)
+
+// BEGIN CLIENT: DATA PROVIDER ----------
+
+// readDpData reads the group file and the responses of a data provider from a CSV file mapped by a schema
+func readDpData(c *cli.Context) (*onet.Roster, *dataunlynx.Schema, []libunlynx.DpClearResponse, error) {
+	el, err := openGroupToml(c.String(optionGroupFile))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("could not open group toml: %v", err)
+	}
+	if c.String(optionData) == "" || c.String(optionSchema) == "" {
+		return nil, nil, nil, fmt.Errorf("the data and schema options are mandatory")
+	}
+	schema, err := dataunlynx.LoadSchema(c.String(optionSchema))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("could not load the schema: %v", err)
+	}
+	responses, err := schema.ReadCSVFile(c.String(optionData))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("could not read the data: %v", err)
+	}
+	return el, schema, responses, nil
+}
+
+// dpClient returns the client of a data provider connected to the server of the roster chosen with the server option,
+// it signs the submissions with the long-term key read from the key option (a random key if it is not set)
+func dpClient(c *cli.Context, el *onet.Roster) (*servicesunlynx.API, error) {
+	server := c.Int(optionServer)
+	if server < 0 || server >= len(el.List) {
+		return nil, fmt.Errorf("there is no server %d in the group", server)
+	}
+	if c.String(optionKey) == "" {
+		return servicesunlynx.NewUnLynxClient(el.List[server], "dp-"+strconv.Itoa(server)), nil
+	}
+	keys, err := readKeyPair(c.String(optionKey))
+	if err != nil {
+		return nil, err
+	}
+	return servicesunlynx.NewUnLynxClientWithKeys(el.List[server], "dp-"+strconv.Itoa(server), keys), nil
+}
+
+// readKeyPair reads a long-term key pair from a file containing the private key (hex)
+func readKeyPair(filename string) (*key.Pair, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	private, err := encoding.StringHexToScalar(libunlynx.SuiTe, strings.TrimSpace(string(content)))
+	if err != nil {
+		return nil, fmt.Errorf("could not read the private key: %v", err)
+	}
+	return &key.Pair{Public: libunlynx.SuiTe.Point().Mul(private, nil), Private: private}, nil
+}
+
+// runDpKeygen generates the long-term key pair of a data provider (or a querier): the private key is written to a file
+// and the public key is printed, to be added to the allowlist (DPAllowlist) or the policy (QuerierPolicy) in the configuration of the servers
+func runDpKeygen(c *cli.Context) error {
+	out := c.String(optionOut)
+	if out == "" {
+		return fmt.Errorf("the out option is mandatory")
+	}
+	keys := key.NewKeyPair(libunlynx.SuiTe)
+	private, err := encoding.ScalarToStringHex(libunlynx.SuiTe, keys.Private)
+	if err != nil {
+		return err
+	}
+	public, err := encoding.PointToStringHex(libunlynx.SuiTe, keys.Public)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(out, []byte(private+"\n"), 0600); err != nil {
+		return err
+	}
+	fmt.Fprintln(c.App.Writer, public)
+	return nil
+}
+
+// runDpPush sends the responses of a data provider to a survey: they are read from a CSV file and encrypted as the
+// survey requires, or read from a bundle written by runDpEncrypt.
+func runDpPush(c *cli.Context) error {
+	surveyID := servicesunlynx.SurveyID(c.String(optionSurvey))
+
+	if bundle := c.String(optionBundle); bundle != "" {
+		el, err := openGroupToml(c.String(optionGroupFile))
+		if err != nil {
+			return fmt.Errorf("could not open group toml: %v", err)
+		}
+		s, err := servicesunlynx.LoadSurveyResponseQuery(bundle)
+		if err != nil {
+			return err
+		}
+		if surveyID != "" && surveyID != s.SurveyID {
+			return fmt.Errorf("the bundle contains responses to survey %s", s.SurveyID)
+		}
+		client, err := dpClient(c, el)
+		if err != nil {
+			return err
+		}
+		log.Lvl1(client, " sends", len(s.Responses), "response(s) to survey", s.SurveyID)
+		return client.SendEncryptedSurveyResponseQuery(s)
+	}
+
+	if surveyID == "" {
+		return fmt.Errorf("the survey option is mandatory")
+	}
+	el, _, responses, err := readDpData(c)
+	if err != nil {
+		return err
+	}
+	client, err := dpClient(c, el)
+	if err != nil {
+		return err
+	}
+
+	// the responses are encoded with the types, operations and ranges of the survey
+	status, err := client.SendSurveyDpStatusQuery(surveyID)
+	if err != nil {
+		return err
+	}
+	return client.SendSurveyResponseQuery(surveyID, responses, status.CollectiveKey, 1, status.Count, status.TypesByName(), status.Operations, status.RangeBits, status.Bounds)
+}
+
+// runDpEncrypt encrypts offline the responses of a data provider to a survey and writes them to a bundle, that is sent
+// later with runDpPush. The responses are encoded with the types and ranges of the schema and the aggregate options, the
+// bounded attributes are sent with range proofs.
+func runDpEncrypt(c *cli.Context) error {
+	surveyID := servicesunlynx.SurveyID(c.String(optionSurvey))
+	out := c.String(optionOut)
+	if surveyID == "" || out == "" {
+		return fmt.Errorf("the survey and out options are mandatory")
+	}
+	el, schema, responses, err := readDpData(c)
+	if err != nil {
+		return err
+	}
+	operations, err := parseOperations(c.String(optionAggregate))
+	if err != nil {
+		return err
+	}
+
+	bounds, err := parseBounds(c.String(optionBounds))
+	if err != nil {
+		return err
+	}
+
+	collectiveKey, err := parseCollectiveKey(el, c.String(optionCollectiveKey))
+	if err != nil {
+		return err
+	}
+
+	sum, count := libunlynx.OperationColumns(nil, c.Bool(optionCount), operations)
+
+	s, err := servicesunlynx.EncryptDataToSurvey("dp", surveyID, responses, collectiveKey, 1, count, schema.Types(), operations, schema.RangeBits(), servicesunlynx.EffectiveBounds(bounds, sum, count))
+	if err != nil {
+		return err
+	}
+	if err := servicesunlynx.SaveSurveyResponseQuery(out, s); err != nil {
+		return err
+	}
+	log.Lvl1("Encrypted", len(s.Responses), "response(s) to survey", surveyID, "in", out)
+	return nil
+}
+
+// CLIENT END: DATA PROVIDER ------------
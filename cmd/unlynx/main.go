@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/ldsec/unlynx/lib"
 	"github.com/urfave/cli"
@@ -31,6 +32,11 @@ const (
 
 	// query flags
 
+	optionDataset = "dataset"
+
+	optionQuery      = "query"
+	optionQueryShort = "q"
+
 	optionSum      = "sum"
 	optionSumShort = "s"
 
@@ -45,6 +51,56 @@ const (
 
 	optionGroupBy      = "groupBy"
 	optionGroupByShort = "g"
+
+	optionRange     = "range"
+	optionRangeBits = "rangeBits"
+
+	optionTypes  = "types"
+	optionBounds = "bounds"
+
+	optionAggregate      = "aggregate"
+	optionAggregateShort = "a"
+
+	optionDeadline = "deadline"
+	optionQuorum   = "quorum"
+	optionRows     = "rows"
+
+	optionCollectiveKey = "collectiveKey"
+
+	// differential privacy flags
+
+	optionEpsilon     = "epsilon"
+	optionSensitivity = "sensitivity"
+	optionNoiseSize   = "noiseSize"
+	optionQuanta      = "quanta"
+	optionScale       = "scale"
+	optionLimit       = "limit"
+
+	// audit flags
+
+	optionSurvey = "survey"
+
+	// data provider flags
+
+	optionData   = "data"
+	optionSchema = "schema"
+	optionBundle = "bundle"
+	optionOut    = "out"
+	optionServer = "server"
+	optionKey    = "key"
+
+	// dkg flags
+
+	optionThreshold = "threshold"
+
+	// roster change flags
+
+	optionAdd    = "add"
+	optionRemove = "remove"
+
+	// server setup flags
+
+	optionSuite = "suite"
 )
 
 func main() {
@@ -71,9 +127,21 @@ func main() {
 			Name:  optionProofs,
 			Usage: "With proofs",
 		},
+		cli.StringFlag{
+			Name:  optionKey,
+			Usage: "File with the long-term private key of the querier (written by 'dp keygen') signing the queries",
+		},
 
 		// query flags
 
+		cli.StringFlag{
+			Name:  optionDataset,
+			Usage: "Dataset queried (its privacy budget is charged for differentially private queries)",
+		},
+		cli.StringFlag{
+			Name:  optionQuery + ", " + optionQueryShort,
+			Usage: "SQL-like query replacing the other query flags -> \"SELECT SUM(s1), COUNT(*) FROM dataset WHERE w1 = 1 AND (w2 = 27 OR w3 > 4) GROUP BY g1\"",
+		},
 		cli.StringFlag{
 			Name:  optionSum + ", " + optionSumShort,
 			Usage: "SELECT s1, s2 -> {s1, s2}",
@@ -88,23 +156,259 @@ func main() {
 		},
 		cli.StringFlag{
 			Name:  optionPredicate + ", " + optionPredicateShort,
-			Usage: "WHERE x AND y OR z (predicate) -> (v0 == v1 || v2 == v3) && v4 == v5",
+			Usage: "WHERE x AND y OR z (predicate) -> (w1 == :w1 || w2 IN (:w2, :w2[1])) && NOT w3 == :w3 && range(w4) (:w is the value of w in the where parameter)",
+		},
+		cli.StringFlag{
+			Name:  optionRange,
+			Usage: "WHERE w1 >= 40 AND w2 BETWEEN 5 AND 9 (ranges) -> {w1>=40, w2=5:9}",
+		},
+		cli.Int64Flag{
+			Name:  optionRangeBits,
+			Value: 32,
+			Usage: "Number of bits of the values of the where attributes compared with ranges",
 		},
 		cli.StringFlag{
 			Name:  optionGroupBy + ", " + optionGroupByShort,
 			Usage: "GROUP BY g1, g2, g3 -> {g1, g2, g3}",
 		},
+		cli.StringFlag{
+			Name:  optionTypes,
+			Usage: "Types of the sum attributes (uint by default, int or fixed:<decimals>) -> {s1=int, s2=fixed:2}",
+		},
+		cli.StringFlag{
+			Name:  optionBounds,
+			Usage: "Bounds of the (encoded) sum attributes proven by the data providers -> {s1=0:120, s2=-500:500}",
+		},
+		cli.StringFlag{
+			Name:  optionAggregate + ", " + optionAggregateShort,
+			Usage: "SELECT AVG(s1), VARIANCE(s2) ... -> {mean(s1), variance(s2)} (sum, count, mean, sumsq, variance, stddev)",
+		},
+		cli.DurationFlag{
+			Name:  optionDeadline,
+			Usage: "Time after which the servers stop collecting data (e.g. 10m), they wait for all the data providers if it is not set",
+		},
+		cli.Int64Flag{
+			Name:  optionQuorum,
+			Usage: "Minimum number of data providers that must have sent their data by the deadline",
+		},
+		cli.Int64Flag{
+			Name:  optionRows,
+			Usage: "Number of response rows the data providers are expected to send, the servers precompute the values to shuffle them",
+		},
+		cli.StringFlag{
+			Name:  optionCollectiveKey,
+			Usage: "Collective key generated by the servers (written by 'dkg'), the aggregate key of the group is used if it is not set",
+		},
+
+		// differential privacy flags
+
+		cli.Float64Flag{
+			Name:  optionEpsilon,
+			Value: 1,
+			Usage: "Differential privacy: epsilon",
+		},
+		cli.Float64Flag{
+			Name:  optionSensitivity,
+			Value: 1,
+			Usage: "Differential privacy: sensitivity of the query",
+		},
+		cli.Int64Flag{
+			Name:  optionNoiseSize,
+			Value: 0,
+			Usage: "Differential privacy: size of the list of noise values (0 disables the differential privacy)",
+		},
+		cli.Float64Flag{
+			Name:  optionQuanta,
+			Value: 0.1,
+			Usage: "Differential privacy: quanta of the noise distribution",
+		},
+		cli.Float64Flag{
+			Name:  optionScale,
+			Value: 1,
+			Usage: "Differential privacy: scale of the noise values",
+		},
+		cli.Float64Flag{
+			Name:  optionLimit,
+			Value: 0,
+			Usage: "Differential privacy: limit of the noise values (used if the quanta is 0)",
+		},
+	}
+
+	auditFlags := []cli.Flag{
+		cli.StringFlag{
+			Name:  optionGroupFile + ", " + optionGroupFileShort,
+			Value: DefaultGroupFile,
+			Usage: "UnLynx group definition file (of the servers of the survey)",
+		},
+		cli.StringFlag{
+			Name:  optionSurvey,
+			Usage: "ID of the survey to audit",
+		},
+		cli.StringFlag{
+			Name:  optionProofs,
+			Usage: "Directory of the proofs archive (with the files of all the servers of the survey)",
+		},
+		cli.StringFlag{
+			Name:  optionCollectiveKey,
+			Usage: "Collective key of the survey (written by 'dkg'), the aggregate key of the group is used if it is not set",
+		},
+	}
+
+	dpFlags := []cli.Flag{
+		cli.StringFlag{
+			Name:  optionGroupFile + ", " + optionGroupFileShort,
+			Value: DefaultGroupFile,
+			Usage: "UnLynx group definition file",
+		},
+		cli.StringFlag{
+			Name:  optionSurvey,
+			Usage: "Survey to which the data is sent",
+		},
+		cli.StringFlag{
+			Name:  optionData,
+			Usage: "CSV file with the data (one response per line, the first line names the columns)",
+		},
+		cli.StringFlag{
+			Name:  optionSchema,
+			Usage: "TOML file mapping the columns of the CSV file to the attributes (role, encrypted, type...)",
+		},
+		cli.IntFlag{
+			Name:  optionServer,
+			Usage: "Index in the group of the server to which the data is sent",
+		},
+		cli.StringFlag{
+			Name:  optionKey,
+			Usage: "File with the long-term private key of the data provider (written by 'dp keygen') signing the data",
+		},
+	}
+
+	dpPushFlags := append([]cli.Flag{
+		cli.StringFlag{
+			Name:  optionBundle,
+			Usage: "Encrypted bundle (written by 'dp encrypt') sent instead of the data",
+		},
+	}, dpFlags...)
+
+	dpEncryptFlags := append([]cli.Flag{
+		cli.StringFlag{
+			Name:  optionOut + ", o",
+			Usage: "File to which the encrypted bundle is written",
+		},
+		cli.BoolFlag{
+			Name:  optionCount + ", " + optionCountShort,
+			Usage: "Add the count of the responses (for a count query)",
+		},
+		cli.StringFlag{
+			Name:  optionAggregate + ", " + optionAggregateShort,
+			Usage: "Aggregate operations of the survey -> {mean(s1), variance(s2)}",
+		},
+		cli.StringFlag{
+			Name:  optionBounds,
+			Usage: "Bounds of the survey (the values are sent with range proofs) -> {s1=0:120, s2=-500:500}",
+		},
+		cli.StringFlag{
+			Name:  optionCollectiveKey,
+			Usage: "Collective key of the survey (written by 'dkg'), the aggregate key of the group is used if it is not set",
+		},
+	}, dpFlags...)
+
+	schemaFlags := []cli.Flag{
+		cli.StringFlag{
+			Name:  optionGroupFile + ", " + optionGroupFileShort,
+			Value: DefaultGroupFile,
+			Usage: "UnLynx group definition file",
+		},
+		cli.StringFlag{
+			Name:  optionSchema,
+			Usage: "TOML file with the schema of the dataset (register)",
+		},
+		cli.StringFlag{
+			Name:  optionDataset,
+			Usage: "Dataset whose schema is printed (get)",
+		},
+		cli.StringFlag{
+			Name:  optionKey,
+			Usage: "File with the long-term private key of an administrator of the servers (written by 'dp keygen') signing the schema (register)",
+		},
+		cli.IntFlag{
+			Name:  optionServer,
+			Usage: "Index in the group of the server asked for the schema (get)",
+		},
+	}
+
+	dkgFlags := []cli.Flag{
+		cli.StringFlag{
+			Name:  optionGroupFile + ", " + optionGroupFileShort,
+			Value: DefaultGroupFile,
+			Usage: "UnLynx group definition file",
+		},
+		cli.Int64Flag{
+			Name:  optionThreshold,
+			Usage: "Number of servers needed to switch the results of a survey (all the servers if it is not set)",
+		},
+	}
+
+	rosterFlags := []cli.Flag{
+		cli.StringFlag{
+			Name:  optionGroupFile + ", " + optionGroupFileShort,
+			Value: DefaultGroupFile,
+			Usage: "UnLynx group definition file (the current roster of the surveys)",
+		},
+		cli.StringFlag{
+			Name:  optionConfig + ", " + optionConfigShort,
+			Usage: "Configuration file of the server added or removed (its private key signs the change)",
+		},
+		cli.BoolFlag{
+			Name:  optionAdd,
+			Usage: "Add the server to the roster",
+		},
+		cli.BoolFlag{
+			Name:  optionRemove,
+			Usage: "Remove the server from the roster",
+		},
+		cli.StringFlag{
+			Name:  optionKey,
+			Usage: "File with the long-term private key of an administrator of the servers (written by 'dp keygen') signing the change",
+		},
 	}
 
 	serverFlags := []cli.Flag{
 		cli.StringFlag{
 			Name:  optionConfig + ", " + optionConfigShort,
-			Usage: "Configuration file of the server",
+			Usage: "Configuration file of the server (the settings of the unlynx service are in its [UnLynx] table)",
 		},
 	}
 	cliApp.Commands = []cli.Command{
 		// BEGIN CLIENT: DATA PROVIDER ----------
-
+		{
+			Name:  "dp",
+			Usage: "Send the data of a data provider to a survey",
+			Subcommands: []cli.Command{
+				{
+					Name:   "push",
+					Usage:  "Encrypt the data of a CSV file and send it to a survey (or send an encrypted bundle)",
+					Action: runDpPush,
+					Flags:  dpPushFlags,
+				},
+				{
+					Name:   "encrypt",
+					Usage:  "Encrypt offline the data of a CSV file in a bundle to send later with 'dp push'",
+					Action: runDpEncrypt,
+					Flags:  dpEncryptFlags,
+				},
+				{
+					Name:   "keygen",
+					Usage:  "Generate a long-term key pair of a data provider or a querier (the public key is printed for the allowlist or the policy of the servers)",
+					Action: runDpKeygen,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  optionOut + ", o",
+							Usage: "File to which the private key is written",
+						},
+					},
+				},
+			},
+		},
 		// CLIENT END: DATA PROVIDER ------------
 
 		// BEGIN CLIENT: QUERIER ----------
@@ -117,6 +421,45 @@ func main() {
 		},
 		// CLIENT END: QUERIER ----------
 
+		// BEGIN CLIENT: DKG ----------
+		{
+			Name:   "dkg",
+			Usage:  "Generate a collective key shared among the servers of the group (the key is printed)",
+			Action: runDKG,
+			Flags:  dkgFlags,
+		},
+		// CLIENT END: DKG ----------
+
+		// BEGIN AUDIT ----------
+		{
+			Name:   "audit",
+			Usage:  "Verify offline the proofs archived for a survey",
+			Action: runAudit,
+			Flags:  auditFlags,
+		},
+		// AUDIT END ----------
+
+		// BEGIN SCHEMA ----------
+		{
+			Name:  "schema",
+			Usage: "Manage the schemas of the datasets registered on the servers",
+			Subcommands: []cli.Command{
+				{
+					Name:   "register",
+					Usage:  "Register (or replace) the schema of a dataset on all the servers",
+					Action: runSchemaRegister,
+					Flags:  schemaFlags,
+				},
+				{
+					Name:   "get",
+					Usage:  "Print the schema of a dataset",
+					Action: runSchemaGet,
+					Flags:  schemaFlags,
+				},
+			},
+		},
+		// SCHEMA END ----------
+
 		// BEGIN SERVER --------
 		{
 			Name:  "server",
@@ -140,9 +483,25 @@ func main() {
 						if c.GlobalIsSet("debug") {
 							return fmt.Errorf("[-] debug option cannot be used for the 'setup' command")
 						}
+						if err := libunlynx.SetSuite(c.String(optionSuite)); err != nil {
+							return err
+						}
 						app.InteractiveConfig(libunlynx.SuiTe, BinaryName)
 						return nil
 					},
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  optionSuite,
+							Value: libunlynx.DefaultSuite,
+							Usage: "Suite of the keys of the server (" + strings.Join(libunlynx.SupportedSuites, ", ") + "), all the servers of a group must use the same",
+						},
+					},
+				},
+				{
+					Name:   "roster",
+					Usage:  "Add the server to (or remove it from) the roster of the surveys collecting data, their data is re-encrypted under the new collective key (printed)",
+					Action: runRosterChange,
+					Flags:  rosterFlags,
 				},
 			},
 		},
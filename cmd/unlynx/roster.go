@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/services"
+	"github.com/urfave/cli"
+	"go.dedis.ch/kyber/v3/util/encoding"
+	"go.dedis.ch/onet/v3/app"
+)
+
+// BEGIN SERVER: ROSTER CHANGE ----------
+
+// runRosterChange adds the server of a configuration file to (or removes it from) the roster of the group, signed with
+// the key of an administrator, the new collective key of the surveys is printed (the group file has to be updated with
+// the new roster)
+func runRosterChange(c *cli.Context) error {
+	el, err := openGroupToml(c.String(optionGroupFile))
+	if err != nil {
+		return fmt.Errorf("could not open group toml: %v", err)
+	}
+	if c.Bool(optionAdd) == c.Bool(optionRemove) {
+		return fmt.Errorf("one of the add and remove options is mandatory")
+	}
+	if c.String(optionConfig) == "" {
+		return fmt.Errorf("the config option is mandatory")
+	}
+	conf, err := app.LoadCothority(c.String(optionConfig))
+	if err != nil {
+		return err
+	}
+	if err := libunlynx.CheckSuite(conf.Suite); err != nil {
+		return fmt.Errorf("the server does not use the suite of the group: %v", err)
+	}
+	si, err := conf.GetServerIdentity()
+	if err != nil {
+		return err
+	}
+
+	// the change is authorized by an administrator of the servers
+	if c.String(optionKey) == "" {
+		return fmt.Errorf("the key option is mandatory")
+	}
+	keys, err := readKeyPair(c.String(optionKey))
+	if err != nil {
+		return err
+	}
+
+	client := servicesunlynx.NewUnLynxClientWithKeys(si, "admin", keys)
+	roster, err := client.SendRosterChangeQuery(el, si.GetPrivate(), c.Bool(optionAdd))
+	if err != nil {
+		return err
+	}
+	public, err := encoding.PointToStringHex(libunlynx.SuiTe, roster.Aggregate)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(c.App.Writer, public)
+	return nil
+}
+
+// SERVER END: ROSTER CHANGE ----------
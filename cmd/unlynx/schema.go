@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/BurntSushi/toml"
+	"github.com/ldsec/unlynx/data"
+	"github.com/ldsec/unlynx/services"
+	"github.com/urfave/cli"
+)
+
+// BEGIN SCHEMA ----------
+
+// runSchemaRegister registers the schema of a dataset on all the servers of the group, signed with the key of an
+// administrator
+func runSchemaRegister(c *cli.Context) error {
+	el, err := openGroupToml(c.String(optionGroupFile))
+	if err != nil {
+		return fmt.Errorf("could not open group toml: %v", err)
+	}
+	if c.String(optionSchema) == "" {
+		return fmt.Errorf("the schema option is mandatory")
+	}
+	schema, err := dataunlynx.LoadSchema(c.String(optionSchema))
+	if err != nil {
+		return err
+	}
+	// the schemas are registered by an administrator of the servers
+	if c.String(optionKey) == "" {
+		return fmt.Errorf("the key option is mandatory")
+	}
+	keys, err := readKeyPair(c.String(optionKey))
+	if err != nil {
+		return err
+	}
+	client := servicesunlynx.NewUnLynxClientWithKeys(el.List[0], "schema", keys)
+	return client.SendSchemaRegistration(el, *schema)
+}
+
+// runSchemaGet prints the schema of a dataset registered on a server of the group
+func runSchemaGet(c *cli.Context) error {
+	el, err := openGroupToml(c.String(optionGroupFile))
+	if err != nil {
+		return fmt.Errorf("could not open group toml: %v", err)
+	}
+	client, err := dpClient(c, el)
+	if err != nil {
+		return err
+	}
+	schema, err := client.SendSchemaQuery(c.String(optionDataset))
+	if err != nil {
+		return err
+	}
+	return toml.NewEncoder(c.App.Writer).Encode(schema)
+}
+
+// SCHEMA END ----------
@@ -1,6 +1,10 @@
 package main
 
 import (
+	"fmt"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/services"
 	"github.com/urfave/cli"
 	"go.dedis.ch/onet/v3/app"
 
@@ -12,6 +16,22 @@ import (
 func runServer(ctx *cli.Context) error {
 	// first check the options
 	config := ctx.String("config")
+	// the library uses the suite of the keys of the server
+	conf, err := app.LoadCothority(config)
+	if err != nil {
+		return err
+	}
+	if err := libunlynx.SetSuite(conf.Suite); err != nil {
+		return fmt.Errorf("could not use the suite of the server: %v", err)
+	}
+	// the settings of the unlynx service are in the same file
+	unlynxConf, err := servicesunlynx.LoadServerConfig(config)
+	if err != nil {
+		return err
+	}
+	if err := unlynxConf.Apply(); err != nil {
+		return fmt.Errorf("wrong configuration of the unlynx service: %v", err)
+	}
 	app.RunServer(config)
 	return nil
 }
@@ -0,0 +1,260 @@
+package dataunlynx
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/ldsec/unlynx/lib"
+)
+
+// Roles of the attributes of a dataset
+const (
+	RoleGroupBy   = "group"
+	RoleWhere     = "where"
+	RoleAggregate = "aggregate"
+)
+
+// SchemaAttribute describes an attribute of a dataset and the column of the CSV files holding its values.
+type SchemaAttribute struct {
+	Name        string // name of the attribute in the queries
+	Column      string // column of the CSV files (Name if it is empty)
+	Role        string // RoleGroupBy, RoleWhere or RoleAggregate
+	Encrypted   bool
+	Type        string  // type of an aggregating attribute (see libunlynx.ParseAttributeType), uint if it is empty
+	Bits        int64   // number of bits of the values of a where attribute compared with ranges (0 if it is not)
+	Domain      []int64 // [min, max] interval of the values (not bounded if it is empty)
+	Sensitive   bool    // a sensitive attribute must be encrypted
+	Description string
+}
+
+// Schema describes the attributes of a dataset, it is written in TOML:
+//
+//	dataset = "patients"
+//
+//	[[attribute]]
+//	name = "g1"
+//	column = "sex"
+//	role = "group"
+//	encrypted = true
+//	domain = [0, 1]
+//	description = "sex of the patient"
+type Schema struct {
+	Dataset    string
+	Attributes []SchemaAttribute `toml:"attribute"`
+}
+
+// LoadSchema reads and validates a schema from a TOML file
+func LoadSchema(filename string) (*Schema, error) {
+	schema := &Schema{}
+	if _, err := toml.DecodeFile(filename, schema); err != nil {
+		return nil, err
+	}
+	if err := schema.Validate(); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+// column returns the column of the CSV files holding the values of the attribute
+func (sa SchemaAttribute) column() string {
+	if sa.Column == "" {
+		return sa.Name
+	}
+	return sa.Column
+}
+
+// AttributeType returns the type of the values of the attribute
+func (sa SchemaAttribute) AttributeType() (libunlynx.AttributeType, error) {
+	if sa.Type == "" {
+		return libunlynx.AttributeType{}, nil
+	}
+	return libunlynx.ParseAttributeType(sa.Type)
+}
+
+// InDomain checks if a (decoded) value is in the domain of the attribute
+func (sa SchemaAttribute) InDomain(v float64) bool {
+	return len(sa.Domain) != 2 || (float64(sa.Domain[0]) <= v && v <= float64(sa.Domain[1]))
+}
+
+// Attribute returns the attribute of the schema with a given name
+func (s *Schema) Attribute(name string) (SchemaAttribute, bool) {
+	for _, sa := range s.Attributes {
+		if sa.Name == name {
+			return sa, true
+		}
+	}
+	return SchemaAttribute{}, false
+}
+
+// Validate checks the names, roles, types and domains of the attributes of a schema
+func (s *Schema) Validate() error {
+	names := make(map[string]bool, len(s.Attributes))
+	for _, sa := range s.Attributes {
+		if sa.Name == "" {
+			return fmt.Errorf("attribute without name in the schema")
+		}
+		if names[sa.Name] {
+			return fmt.Errorf("attribute %s is defined twice in the schema", sa.Name)
+		}
+		names[sa.Name] = true
+
+		switch sa.Role {
+		case RoleGroupBy, RoleWhere, RoleAggregate:
+		default:
+			return fmt.Errorf("attribute %s has the unknown role %s", sa.Name, sa.Role)
+		}
+
+		at, err := sa.AttributeType()
+		if err != nil {
+			return fmt.Errorf("attribute %s: %v", sa.Name, err)
+		}
+		if at != (libunlynx.AttributeType{}) && sa.Role != RoleAggregate {
+			return fmt.Errorf("only the aggregating attributes have a type, not %s", sa.Name)
+		}
+		if at.Kind == libunlynx.TypeFixed && !sa.Encrypted {
+			return fmt.Errorf("the fixed-point attribute %s must be encrypted", sa.Name)
+		}
+		if sa.Bits != 0 && (sa.Role != RoleWhere || sa.Bits < 0 || sa.Bits > libunlynx.MaxRangeBits) {
+			return fmt.Errorf("wrong number of bits for attribute %s", sa.Name)
+		}
+		if len(sa.Domain) != 0 && (len(sa.Domain) != 2 || sa.Domain[0] > sa.Domain[1]) {
+			return fmt.Errorf("the domain of attribute %s must be an interval [min, max]", sa.Name)
+		}
+		if sa.Sensitive && !sa.Encrypted {
+			return fmt.Errorf("the sensitive attribute %s must be encrypted", sa.Name)
+		}
+	}
+	return nil
+}
+
+// Types returns the types of the aggregating attributes
+func (s *Schema) Types() map[string]libunlynx.AttributeType {
+	types := make(map[string]libunlynx.AttributeType)
+	for _, sa := range s.Attributes {
+		if at, err := sa.AttributeType(); err == nil && sa.Role == RoleAggregate && at != (libunlynx.AttributeType{}) {
+			types[sa.Name] = at
+		}
+	}
+	return types
+}
+
+// RangeBits returns the number of bits of the where attributes compared with ranges
+func (s *Schema) RangeBits() map[string]int64 {
+	bits := make(map[string]int64)
+	for _, sa := range s.Attributes {
+		if sa.Bits > 0 {
+			bits[sa.Name] = sa.Bits
+		}
+	}
+	return bits
+}
+
+// ReadCSV reads the responses of a data provider from a CSV file whose first line names the columns, each attribute of
+// the schema is read from its column (the other columns are ignored).
+func (s *Schema) ReadCSV(reader io.Reader) ([]libunlynx.DpClearResponse, error) {
+	r := csv.NewReader(reader)
+	r.TrimLeadingSpace = true
+
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("could not read the header of the CSV file: %v", err)
+	}
+	indexes := make([]int, len(s.Attributes))
+	for i, sa := range s.Attributes {
+		indexes[i] = -1
+		for j, column := range header {
+			if strings.TrimSpace(column) == sa.column() {
+				indexes[i] = j
+			}
+		}
+		if indexes[i] < 0 {
+			return nil, fmt.Errorf("no column %s in the CSV file for attribute %s", sa.column(), sa.Name)
+		}
+	}
+
+	var responses []libunlynx.DpClearResponse
+	for line := 2; ; line++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		dcr := libunlynx.DpClearResponse{}
+		for i, sa := range s.Attributes {
+			value := strings.TrimSpace(record[indexes[i]])
+			if err := setValue(&dcr, sa, value); err != nil {
+				return nil, fmt.Errorf("line %d, column %s: %v", line, sa.column(), err)
+			}
+		}
+		responses = append(responses, dcr)
+	}
+	return responses, nil
+}
+
+// ReadCSVFile reads the responses of a data provider from a CSV file (see ReadCSV)
+func (s *Schema) ReadCSVFile(filename string) ([]libunlynx.DpClearResponse, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return s.ReadCSV(f)
+}
+
+// setValue parses the value of an attribute and sets it in the corresponding map of a response
+func setValue(dcr *libunlynx.DpClearResponse, sa SchemaAttribute, value string) error {
+	at, err := sa.AttributeType()
+	if err != nil {
+		return err
+	}
+	if at.Kind == libunlynx.TypeFixed {
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("wrong decimal value %s", value)
+		}
+		if !sa.InDomain(v) {
+			return fmt.Errorf("value %s is out of the domain of the attribute", value)
+		}
+		if dcr.AggregatingAttributesDec == nil {
+			dcr.AggregatingAttributesDec = make(map[string]float64)
+		}
+		dcr.AggregatingAttributesDec[sa.Name] = v
+		return nil
+	}
+
+	v, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return fmt.Errorf("wrong integer value %s", value)
+	}
+	if !sa.InDomain(float64(v)) {
+		return fmt.Errorf("value %s is out of the domain of the attribute", value)
+	}
+	var dest *map[string]int64
+	switch {
+	case sa.Role == RoleGroupBy && sa.Encrypted:
+		dest = &dcr.GroupByEnc
+	case sa.Role == RoleGroupBy:
+		dest = &dcr.GroupByClear
+	case sa.Role == RoleWhere && sa.Encrypted:
+		dest = &dcr.WhereEnc
+	case sa.Role == RoleWhere:
+		dest = &dcr.WhereClear
+	case sa.Encrypted:
+		dest = &dcr.AggregatingAttributesEnc
+	default:
+		dest = &dcr.AggregatingAttributesClear
+	}
+	if *dest == nil {
+		*dest = make(map[string]int64)
+	}
+	(*dest)[sa.Name] = v
+	return nil
+}
@@ -0,0 +1,101 @@
+package dataunlynx_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ldsec/unlynx/data"
+	"github.com/ldsec/unlynx/lib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSchema = `
+dataset = "patients"
+
+[[attribute]]
+name = "g1"
+column = "sex"
+role = "group"
+encrypted = true
+
+[[attribute]]
+name = "w1"
+column = "age"
+role = "where"
+encrypted = true
+bits = 8
+
+[[attribute]]
+name = "w2"
+role = "where"
+domain = [0, 9]
+
+[[attribute]]
+name = "s1"
+column = "weight"
+role = "aggregate"
+encrypted = true
+type = "fixed:1"
+
+[[attribute]]
+name = "s2"
+role = "aggregate"
+`
+
+// TestLoadSchema tests the reading of a schema and the mapping of the columns of a CSV file.
+func TestLoadSchema(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unlynx")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "schema.toml")
+	require.NoError(t, ioutil.WriteFile(filename, []byte(testSchema), 0600))
+
+	schema, err := dataunlynx.LoadSchema(filename)
+	require.NoError(t, err)
+	assert.Equal(t, "patients", schema.Dataset)
+	assert.Len(t, schema.Attributes, 5)
+	assert.Equal(t, map[string]libunlynx.AttributeType{"s1": {Kind: libunlynx.TypeFixed, Scale: 1}}, schema.Types())
+	assert.Equal(t, map[string]int64{"w1": 8}, schema.RangeBits())
+
+	responses, err := schema.ReadCSV(strings.NewReader("id, sex, age, w2, weight, s2\n1, 0, 42, 3, 71.5, 1\n2, 1, 27, 4, 64, 0\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []libunlynx.DpClearResponse{
+		{GroupByEnc: map[string]int64{"g1": 0}, WhereEnc: map[string]int64{"w1": 42}, WhereClear: map[string]int64{"w2": 3},
+			AggregatingAttributesDec: map[string]float64{"s1": 71.5}, AggregatingAttributesClear: map[string]int64{"s2": 1}},
+		{GroupByEnc: map[string]int64{"g1": 1}, WhereEnc: map[string]int64{"w1": 27}, WhereClear: map[string]int64{"w2": 4},
+			AggregatingAttributesDec: map[string]float64{"s1": 64}, AggregatingAttributesClear: map[string]int64{"s2": 0}},
+	}, responses)
+
+	// missing column and wrong values
+	_, err = schema.ReadCSV(strings.NewReader("sex, age, w2, s2\n0, 42, 3, 1\n"))
+	assert.Error(t, err)
+	_, err = schema.ReadCSV(strings.NewReader("sex, age, w2, weight, s2\n0, 42.5, 3, 71.5, 1\n"))
+	assert.Error(t, err)
+	// value out of the domain
+	_, err = schema.ReadCSV(strings.NewReader("sex, age, w2, weight, s2\n0, 42, 10, 71.5, 1\n"))
+	assert.Error(t, err)
+}
+
+// TestSchemaValidate tests the rejection of the wrong schemas.
+func TestSchemaValidate(t *testing.T) {
+	for _, attributes := range [][]dataunlynx.SchemaAttribute{
+		{{Name: "", Role: dataunlynx.RoleWhere}},
+		{{Name: "w1", Role: dataunlynx.RoleWhere}, {Name: "w1", Role: dataunlynx.RoleGroupBy}},
+		{{Name: "w1", Role: "select"}},
+		{{Name: "w1", Role: dataunlynx.RoleWhere, Type: "int"}},
+		{{Name: "s1", Role: dataunlynx.RoleAggregate, Type: "fixed:2"}},
+		{{Name: "s1", Role: dataunlynx.RoleAggregate, Type: "float", Encrypted: true}},
+		{{Name: "s1", Role: dataunlynx.RoleAggregate, Bits: 8}},
+		{{Name: "w1", Role: dataunlynx.RoleWhere, Bits: libunlynx.MaxRangeBits + 1}},
+		{{Name: "w1", Role: dataunlynx.RoleWhere, Domain: []int64{1}}},
+		{{Name: "w1", Role: dataunlynx.RoleWhere, Domain: []int64{9, 0}}},
+		{{Name: "w1", Role: dataunlynx.RoleWhere, Sensitive: true}},
+	} {
+		schema := dataunlynx.Schema{Attributes: attributes}
+		assert.Error(t, schema.Validate())
+	}
+}
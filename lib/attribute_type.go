@@ -0,0 +1,144 @@
+package libunlynx
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"go.dedis.ch/kyber/v3"
+)
+
+// Kinds of values of the aggregating attributes
+const (
+	// TypeUnsigned is the default kind: non-negative integers
+	TypeUnsigned = "uint"
+	// TypeSigned are integers that can be negative
+	TypeSigned = "int"
+	// TypeFixed are (signed) decimals with a fixed number of decimal digits
+	TypeFixed = "fixed"
+)
+
+// MaxScale is the greatest number of decimal digits of a fixed-point attribute
+const MaxScale = 15
+
+// Attribute types
+//______________________________________________________________________________________________________________________
+
+// AttributeType is the type of the values of an aggregating attribute. The values are encoded as integers before being
+// encrypted: a fixed-point value v is encoded as round(v*10^Scale), so that the aggregates are exact.
+type AttributeType struct {
+	Kind  string // TypeUnsigned (or ""), TypeSigned or TypeFixed
+	Scale int64  // number of decimal digits of a TypeFixed value
+}
+
+// ParseAttributeType parses a type written as "uint", "int" or "fixed:<scale>" (e.g. "fixed:2").
+func ParseAttributeType(str string) (AttributeType, error) {
+	str = strings.TrimSpace(str)
+	at := AttributeType{Kind: str}
+	if i := strings.Index(str, ":"); i >= 0 {
+		scale, err := strconv.ParseInt(str[i+1:], 10, 64)
+		if err != nil {
+			return AttributeType{}, fmt.Errorf("wrong scale in the attribute type %s", str)
+		}
+		at = AttributeType{Kind: str[:i], Scale: scale}
+	}
+	return at, at.Validate()
+}
+
+// String returns the representation of an attribute type parsed by ParseAttributeType
+func (at AttributeType) String() string {
+	if at.Kind == TypeFixed {
+		return TypeFixed + ":" + strconv.FormatInt(at.Scale, 10)
+	}
+	if at.Kind == "" {
+		return TypeUnsigned
+	}
+	return at.Kind
+}
+
+// Validate checks the kind and the scale of an attribute type
+func (at AttributeType) Validate() error {
+	switch at.Kind {
+	case "", TypeUnsigned, TypeSigned:
+		if at.Scale != 0 {
+			return fmt.Errorf("only the fixed-point attributes have a scale")
+		}
+	case TypeFixed:
+		if at.Scale < 0 || at.Scale > MaxScale {
+			return fmt.Errorf("the scale of a fixed-point attribute must be between 0 and %d", MaxScale)
+		}
+	default:
+		return fmt.Errorf("unknown attribute type %s", at.Kind)
+	}
+	return nil
+}
+
+// Signed returns true if the (aggregated) values of the attribute can be negative
+func (at AttributeType) Signed() bool {
+	return at.Kind == TypeSigned || at.Kind == TypeFixed
+}
+
+// factor returns 10^Scale
+func (at AttributeType) factor() int64 {
+	f := int64(1)
+	if at.Kind == TypeFixed {
+		for i := int64(0); i < at.Scale; i++ {
+			f *= 10
+		}
+	}
+	return f
+}
+
+// EncodeInt encodes an integer value of the attribute
+func (at AttributeType) EncodeInt(v int64) (int64, error) {
+	if v < 0 && !at.Signed() {
+		return 0, fmt.Errorf("negative value %d for an unsigned attribute", v)
+	}
+	f := at.factor()
+	if v > math.MaxInt64/f || v < math.MinInt64/f {
+		return 0, fmt.Errorf("value %d is too large for the attribute type %s", v, at.String())
+	}
+	return v * f, nil
+}
+
+// Encode encodes a (decimal) value of the attribute, only fixed-point attributes can have a fractional part.
+func (at AttributeType) Encode(v float64) (int64, error) {
+	encoded := math.Round(v * float64(at.factor()))
+	if at.Kind != TypeFixed && encoded != v {
+		return 0, fmt.Errorf("decimal value %s for the integer attribute type %s", strconv.FormatFloat(v, 'f', -1, 64), at.String())
+	}
+	if v < 0 && !at.Signed() {
+		return 0, fmt.Errorf("negative value %s for an unsigned attribute", strconv.FormatFloat(v, 'f', -1, 64))
+	}
+	if math.IsNaN(encoded) || encoded >= math.MaxInt64 || encoded <= math.MinInt64 {
+		return 0, fmt.Errorf("value %s is too large for the attribute type %s", strconv.FormatFloat(v, 'f', -1, 64), at.String())
+	}
+	return int64(encoded), nil
+}
+
+// Decode decodes an (aggregated) encoded value of the attribute
+func (at AttributeType) Decode(v int64) float64 {
+	if at.Kind != TypeFixed {
+		return float64(v)
+	}
+	return float64(v) / float64(at.factor())
+}
+
+// DecryptAttributes decrypts a vector of aggregating attributes, given the type of each attribute (the unsigned type
+// if types is shorter than the vector), and returns the encoded (integer) values.
+func DecryptAttributes(prikey kyber.Scalar, cipherVector *CipherVector, types []AttributeType) ([]int64, error) {
+	result := make([]int64, len(*cipherVector))
+	for i, c := range *cipherVector {
+		var err error
+		if i < len(types) && types[i].Signed() {
+			result[i], err = DecryptIntWithNeg(prikey, c)
+		} else {
+			result[i], err = DecryptInt(prikey, c)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
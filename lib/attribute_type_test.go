@@ -0,0 +1,50 @@
+package libunlynx_test
+
+import (
+	"testing"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestAttributeType tests the parsing of the attribute types and the encoding of their values.
+func TestAttributeType(t *testing.T) {
+	for _, str := range []string{"uint", "int", "fixed:0", "fixed:3"} {
+		at, err := libunlynx.ParseAttributeType(str)
+		assert.NoError(t, err)
+		assert.Equal(t, str, at.String())
+	}
+	for _, str := range []string{"float", "int:2", "fixed:-1", "fixed:16", "fixed:a"} {
+		_, err := libunlynx.ParseAttributeType(str)
+		assert.Error(t, err)
+	}
+	assert.Equal(t, "uint", libunlynx.AttributeType{}.String())
+
+	fixed := libunlynx.AttributeType{Kind: libunlynx.TypeFixed, Scale: 3}
+	v, err := fixed.Encode(-12.3456)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-12346), v)
+	assert.Equal(t, -12.346, fixed.Decode(v))
+	v, err = fixed.EncodeInt(42)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42000), v)
+	_, err = fixed.EncodeInt(1 << 62)
+	assert.Error(t, err)
+	_, err = fixed.Encode(1e18)
+	assert.Error(t, err)
+
+	signed := libunlynx.AttributeType{Kind: libunlynx.TypeSigned}
+	v, err = signed.Encode(-4)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-4), v)
+	_, err = signed.Encode(0.5)
+	assert.Error(t, err)
+
+	unsigned := libunlynx.AttributeType{}
+	assert.False(t, unsigned.Signed())
+	_, err = unsigned.EncodeInt(-1)
+	assert.Error(t, err)
+	v, err = unsigned.EncodeInt(5)
+	assert.NoError(t, err)
+	assert.Equal(t, 5.0, unsigned.Decode(v))
+}
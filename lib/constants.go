@@ -27,9 +27,6 @@ var TIME = false
 // VPARALLELIZE allows to choose the level of parallelization in the vector computations
 const VPARALLELIZE = 100
 
-// DIFFPRI enables the DRO protocol (Distributed Results Obfuscation)
-const DIFFPRI = false
-
 // TIMEOUT ddefines the default channel timeout
 var TIMEOUT = 10 * time.Minute
 
@@ -8,23 +8,16 @@ import (
 	"strings"
 	"sync"
 
-	"github.com/fanliao/go-concurrentMap"
 	"github.com/ldsec/unlynx/lib/tools"
 	"go.dedis.ch/kyber/v3"
 	"go.dedis.ch/kyber/v3/util/key"
 	"go.dedis.ch/kyber/v3/util/random"
-	"go.dedis.ch/onet/v3/log"
 )
 
-// MaxHomomorphicInt is upper bound for integers used in messages, a failed decryption will return this value.
+// MaxHomomorphicInt is the default upper bound for the (absolute value of the) integers that can be decrypted (see
+// DiscreteLogTable).
 const MaxHomomorphicInt int64 = 100000
 
-// PointToInt creates a map between EC points and integers.
-var PointToInt = concurrent.NewConcurrentMap()
-var currentGreatestM kyber.Point
-var currentGreatestInt int64
-var mutex = sync.Mutex{}
-
 // PublishedSimpleAdditionProof contains the two added ciphervectors and the resulting ciphervector
 type PublishedSimpleAdditionProof struct {
 	C1       CipherVector
@@ -94,6 +87,7 @@ func NewDeterministicCipherVector(length int) *DeterministCipherVector {
 
 // GenKey generate an ElGamal public/private key pair.
 func GenKey() (kyber.Scalar, kyber.Point) {
+	FreezeSuite()
 	keys := key.NewKeyPair(SuiTe)
 	return keys.Private, keys.Public
 }
@@ -261,42 +255,44 @@ func decryptPoint(prikey kyber.Scalar, c CipherText) kyber.Point {
 	return M
 }
 
-// DecryptInt decrypts an integer from an ElGamal cipher text where integer are encoded in the exponent.
-func DecryptInt(prikey kyber.Scalar, cipher CipherText) int64 {
+// DecryptInt decrypts an integer from an ElGamal cipher text where integer are encoded in the exponent, an error is
+// returned if it is out of the bound of the discrete logarithm table.
+func DecryptInt(prikey kyber.Scalar, cipher CipherText) (int64, error) {
 	M := decryptPoint(prikey, cipher)
-	v, err := discreteLog(M, false)
-	if err != nil {
-		return 0
-	}
-	return v
+	return discreteLog(M, false)
 }
 
-// DecryptIntWithNeg decrypts an integer from an ElGamal cipher text where integer are encoded in the exponent.
-func DecryptIntWithNeg(prikey kyber.Scalar, cipher CipherText) int64 {
+// DecryptIntWithNeg decrypts an integer (possibly negative) from an ElGamal cipher text where integer are encoded in the
+// exponent, an error is returned if it is out of the bound of the discrete logarithm table.
+func DecryptIntWithNeg(prikey kyber.Scalar, cipher CipherText) (int64, error) {
 	M := decryptPoint(prikey, cipher)
-	v, err := discreteLog(M, true)
-	if err != nil {
-		return 0
-	}
-	return v
+	return discreteLog(M, true)
 }
 
 // DecryptIntVector decrypts a cipherVector.
-func DecryptIntVector(prikey kyber.Scalar, cipherVector *CipherVector) []int64 {
+func DecryptIntVector(prikey kyber.Scalar, cipherVector *CipherVector) ([]int64, error) {
 	result := make([]int64, len(*cipherVector))
 	for i, c := range *cipherVector {
-		result[i] = DecryptInt(prikey, c)
+		v, err := DecryptInt(prikey, c)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = v
 	}
-	return result
+	return result, nil
 }
 
 // DecryptIntVectorWithNeg decrypts a cipherVector.
-func DecryptIntVectorWithNeg(prikey kyber.Scalar, cipherVector *CipherVector) []int64 {
+func DecryptIntVectorWithNeg(prikey kyber.Scalar, cipherVector *CipherVector) ([]int64, error) {
 	result := make([]int64, len(*cipherVector))
 	for i, c := range *cipherVector {
-		result[i] = DecryptIntWithNeg(prikey, c)
+		v, err := DecryptIntWithNeg(prikey, c)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = v
 	}
-	return result
+	return result, nil
 }
 
 // DecryptCheckZero check if the encrypted value is a 0. Does not do the complete decryption
@@ -318,76 +314,18 @@ func DecryptCheckZeroVector(prikey kyber.Scalar, cipherVector *CipherVector) []i
 	return result
 }
 
-// Brute-Forces the discrete log for integer decoding.
-func discreteLog(P kyber.Point, checkNeg bool) (int64, error) {
-	B := SuiTe.Point().Base()
-
-	//check if the point is already in the table
-	mutex.Lock()
-	decrypted, ok := PointToInt.Get(P.String())
-	if ok == nil && decrypted != nil {
-		mutex.Unlock()
-		return decrypted.(int64), nil
-	}
-
-	//otherwise, we complete/create the table while decrypting
-	//initialise
-	if currentGreatestInt == 0 {
-		currentGreatestM = SuiTe.Point().Null()
-	}
-	foundPos := false
-	foundNeg := false
-	guess := currentGreatestM
-	guessInt := currentGreatestInt
-	guessNeg := SuiTe.Point().Null()
-	guessIntMinus := int64(0)
-
-	start := true
-	for i := guessInt; i < MaxHomomorphicInt && !foundPos && !foundNeg; i = i + 1 {
-		// check for 0 first
-		if !start {
-			guess = SuiTe.Point().Add(guess, B)
-		}
-		start = false
-
-		guessInt = i
-		if _, err := PointToInt.Put(guess.String(), guessInt); err != nil {
-			return -1, err
-		}
-		if checkNeg {
-			guessIntMinus = -guessInt
-			guessNeg = SuiTe.Point().Mul(SuiTe.Scalar().SetInt64(guessIntMinus), B)
-			if _, err := PointToInt.Put(guessNeg.String(), guessIntMinus); err != nil {
-				return -1, err
-			}
-
-			if guessNeg.Equal(P) {
-				foundNeg = true
-			}
-		}
-		if !foundNeg && guess.Equal(P) {
-			foundPos = true
-		}
+// CreateDecryptionTable creates and sets the table used to decrypt all the integers in [-limit, limit], unless the
+// current table is already large enough (see SetDiscreteLogTable).
+func CreateDecryptionTable(limit int64) error {
+	if getDiscreteLogTable().Bound() >= limit {
+		return nil
 	}
-	currentGreatestM = guess
-	currentGreatestInt = guessInt
-	mutex.Unlock()
-
-	if !foundPos && !foundNeg {
-		log.Error("out of bound encryption, bound is ", MaxHomomorphicInt)
-		return 0, nil
-	}
-
-	if foundNeg {
-		return guessIntMinus, nil
+	table, err := NewDiscreteLogTable(limit, 0)
+	if err != nil {
+		return err
 	}
-	return guessInt, nil
-}
-
-// CreateDecryptionTable generated the lookup table for decryption of all the integers in [-limit, limit]
-func CreateDecryptionTable(limit int64, pubKey kyber.Point, secKey kyber.Scalar) {
-	dummy := EncryptInt(pubKey, int64(limit))
-	DecryptIntWithNeg(secKey, *dummy)
+	SetDiscreteLogTable(table)
+	return nil
 }
 
 // Homomorphic Operations
@@ -467,6 +405,16 @@ func (cv *CipherVector) Acum() CipherText {
 	return acum
 }
 
+// SimpleAdditionProofVerification verifies that C1PlusC2 is the homomorphic addition of C1 and C2
+func SimpleAdditionProofVerification(psap PublishedSimpleAdditionProof) bool {
+	if len(psap.C1) != len(psap.C2) {
+		return false
+	}
+	expected := NewCipherVector(len(psap.C1))
+	expected.Add(psap.C1, psap.C2)
+	return expected.Equal(&psap.C1PlusC2)
+}
+
 // Representation
 //______________________________________________________________________________________________________________________
 
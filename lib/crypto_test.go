@@ -17,7 +17,8 @@ func TestNullCipherText(t *testing.T) {
 	secKey, pubKey := libunlynx.GenKey()
 
 	nullEnc := libunlynx.EncryptInt(pubKey, 0)
-	nullDec := libunlynx.DecryptInt(secKey, *nullEnc)
+	nullDec, err := libunlynx.DecryptInt(secKey, *nullEnc)
+	assert.NoError(t, err)
 
 	if 0 != nullDec {
 		t.Fatal("Decryption of encryption of 0 should be 0, got", nullDec)
@@ -25,9 +26,10 @@ func TestNullCipherText(t *testing.T) {
 
 	var twoTimesNullEnc = libunlynx.CipherText{K: libunlynx.SuiTe.Point().Null(), C: libunlynx.SuiTe.Point().Null()}
 	twoTimesNullEnc.Add(*nullEnc, *nullEnc)
-	twoTimesNullDec := libunlynx.DecryptInt(secKey, twoTimesNullEnc)
+	twoTimesNullDec, err := libunlynx.DecryptInt(secKey, twoTimesNullEnc)
+	assert.NoError(t, err)
 
-	if 0 != nullDec {
+	if 0 != twoTimesNullDec {
 		t.Fatal("Decryption of encryption of 0+0 should be 0, got", twoTimesNullDec)
 	}
 
@@ -76,7 +78,8 @@ func TestDecryptionConcurrent(t *testing.T) {
 		wg.Done()
 		go func() {
 			ct := libunlynx.EncryptInt(pubKey, 0)
-			val := libunlynx.DecryptInt(secKey, *ct)
+			val, err := libunlynx.DecryptInt(secKey, *ct)
+			assert.NoError(t, err)
 			assert.Equal(t, val, int64(0))
 		}()
 	}
@@ -96,16 +99,23 @@ func TestDecryptionNegConcurrent(t *testing.T) {
 			wg.Done()
 
 			ct := libunlynx.EncryptInt(pubKey, 3)
-			val := libunlynx.DecryptIntWithNeg(secKey, *ct)
+			val, err := libunlynx.DecryptIntWithNeg(secKey, *ct)
+			assert.NoError(t, err)
 			assert.Equal(t, val, int64(3))
 
 			ct = libunlynx.EncryptInt(pubKey, 3)
-			val = libunlynx.DecryptInt(secKey, *ct)
+			val, err = libunlynx.DecryptInt(secKey, *ct)
+			assert.NoError(t, err)
 			assert.Equal(t, val, int64(3))
 
 			ct = libunlynx.EncryptInt(pubKey, -3)
-			val = libunlynx.DecryptIntWithNeg(secKey, *ct)
+			val, err = libunlynx.DecryptIntWithNeg(secKey, *ct)
+			assert.NoError(t, err)
 			assert.Equal(t, val, int64(-3))
+
+			// negative values are out of the bound without checkNeg
+			_, err = libunlynx.DecryptInt(secKey, *ct)
+			assert.Error(t, err)
 		}()
 	}
 	libunlynx.EndParallelize(wg)
@@ -116,7 +126,8 @@ func TestNullCipherVector(t *testing.T) {
 	secKey, pubKey := libunlynx.GenKey()
 
 	nullVectEnc := *libunlynx.NullCipherVector(10, pubKey)
-	nullVectDec := libunlynx.DecryptIntVector(secKey, &nullVectEnc)
+	nullVectDec, err := libunlynx.DecryptIntVector(secKey, &nullVectEnc)
+	assert.NoError(t, err)
 
 	target := []int64{0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
 	if !reflect.DeepEqual(nullVectDec, target) {
@@ -125,7 +136,8 @@ func TestNullCipherVector(t *testing.T) {
 
 	twoTimesNullEnc := libunlynx.NewCipherVector(10)
 	twoTimesNullEnc.Add(nullVectEnc, nullVectEnc)
-	twoTimesNullDec := libunlynx.DecryptIntVector(secKey, twoTimesNullEnc)
+	twoTimesNullDec, err := libunlynx.DecryptIntVector(secKey, twoTimesNullEnc)
+	assert.NoError(t, err)
 
 	if !reflect.DeepEqual(twoTimesNullDec, target) {
 		t.Fatal("Null vector + Null vector should be ", target, "got", twoTimesNullDec)
@@ -149,15 +161,31 @@ func TestHomomorphicOpp(t *testing.T) {
 	cv5 := libunlynx.EncryptInt(pubKey, 2)
 	cv5.MulCipherTextbyScalar(*cv5, libunlynx.SuiTe.Scalar().SetInt64(2))
 
-	pAdd := libunlynx.DecryptIntVector(secKey, cv3)
-	pSub := libunlynx.DecryptIntVector(secKey, cv4)
-	pMul := libunlynx.DecryptInt(secKey, *cv5)
+	pAdd, err := libunlynx.DecryptIntVector(secKey, cv3)
+	assert.NoError(t, err)
+	pSub, err := libunlynx.DecryptIntVector(secKey, cv4)
+	assert.NoError(t, err)
+	pMul, err := libunlynx.DecryptInt(secKey, *cv5)
+	assert.NoError(t, err)
 
 	assert.Equal(t, targetAdd, pAdd)
 	assert.Equal(t, targetSub, pSub)
 	assert.Equal(t, targetMul, pMul)
 }
 
+func TestSimpleAdditionProofVerification(t *testing.T) {
+	_, pubKey := libunlynx.GenKey()
+
+	cv1 := libunlynx.EncryptIntVector(pubKey, []int64{1, 2})
+	cv2 := libunlynx.EncryptIntVector(pubKey, []int64{3, 4})
+	sum := libunlynx.NewCipherVector(2)
+	sum.Add(*cv1, *cv2)
+
+	assert.True(t, libunlynx.SimpleAdditionProofVerification(libunlynx.PublishedSimpleAdditionProof{C1: *cv1, C2: *cv2, C1PlusC2: *sum}))
+	assert.False(t, libunlynx.SimpleAdditionProofVerification(libunlynx.PublishedSimpleAdditionProof{C1: *cv1, C2: *cv1, C1PlusC2: *sum}))
+	assert.False(t, libunlynx.SimpleAdditionProofVerification(libunlynx.PublishedSimpleAdditionProof{C1: *cv1, C2: (*cv2)[:1], C1PlusC2: *sum}))
+}
+
 // TestEqualDeterministCipherText tests equality between deterministic ciphertexts.
 func TestEqualDeterministCipherText(t *testing.T) {
 	dcv1 := libunlynx.DeterministCipherVector{libunlynx.DeterministCipherText{Point: libunlynx.SuiTe.Point().Base()}, libunlynx.DeterministCipherText{Point: libunlynx.SuiTe.Point().Null()}}
@@ -220,7 +248,8 @@ func TestCiphertextConverter(t *testing.T) {
 	err = newCT.FromBytes(ctb)
 	assert.NoError(t, err)
 
-	p := libunlynx.DecryptInt(secKey, newCT)
+	p, err := libunlynx.DecryptInt(secKey, newCT)
+	assert.NoError(t, err)
 
 	assert.Equal(t, target, p)
 }
@@ -239,7 +268,8 @@ func TestCipherVectorConverter(t *testing.T) {
 	err = newCV.FromBytes(cvb, length)
 	assert.NoError(t, err)
 
-	p := libunlynx.DecryptIntVector(secKey, &newCV)
+	p, err := libunlynx.DecryptIntVector(secKey, &newCV)
+	assert.NoError(t, err)
 
 	assert.Equal(t, target, p)
 }
@@ -274,7 +304,8 @@ func TestB64Serialization(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
-		decVal := libunlynx.DecryptInt(secKey, *ctDeserialized)
+		decVal, err := libunlynx.DecryptInt(secKey, *ctDeserialized)
+		assert.NoError(t, err)
 		assert.Equal(t, target[i], decVal)
 
 		// with deserialize
@@ -282,7 +313,8 @@ func TestB64Serialization(t *testing.T) {
 		if err = ctDeserializedBis.Deserialize(ctSerialized); err != nil {
 			t.Fatal(err)
 		}
-		decValBis := libunlynx.DecryptInt(secKey, *ctDeserializedBis)
+		decValBis, err := libunlynx.DecryptInt(secKey, *ctDeserializedBis)
+		assert.NoError(t, err)
 		assert.Equal(t, target[i], decValBis)
 		assert.Equal(t, decVal, decValBis)
 	}
@@ -295,7 +327,9 @@ func TestEncryptScalar(t *testing.T) {
 	scal := libunlynx.SuiTe.Scalar().SetInt64(target)
 
 	ct := *libunlynx.EncryptScalar(pubKey, scal)
-	assert.Equal(t, libunlynx.DecryptInt(secKey, ct), target)
+	decrypted, err := libunlynx.DecryptInt(secKey, ct)
+	assert.NoError(t, err)
+	assert.Equal(t, decrypted, target)
 }
 
 func TestEncryptScalarVector(t *testing.T) {
@@ -310,7 +344,9 @@ func TestEncryptScalarVector(t *testing.T) {
 	cv := *libunlynx.EncryptScalarVector(pubKey, targetScal)
 
 	for i, v := range cv {
-		assert.Equal(t, libunlynx.DecryptInt(secKey, v), target[i])
+		decrypted, err := libunlynx.DecryptInt(secKey, v)
+		assert.NoError(t, err)
+		assert.Equal(t, decrypted, target[i])
 	}
 }
 
@@ -320,7 +356,8 @@ func TestDecryptIntVectorWithNeg(t *testing.T) {
 	target := []int64{0, -1, -3, -103, -103}
 	cv := libunlynx.EncryptIntVector(pubKey, target)
 
-	results := libunlynx.DecryptIntVectorWithNeg(secKey, cv)
+	results, err := libunlynx.DecryptIntVectorWithNeg(secKey, cv)
+	assert.NoError(t, err)
 	for i, v := range results {
 		assert.Equal(t, target[i], v)
 	}
@@ -361,7 +398,9 @@ func TestNewDeterministicCipherText(t *testing.T) {
 		C: dt2.Point,
 	}
 
-	assert.Equal(t, libunlynx.DecryptInt(secKey, ctTest), int64(0))
+	decrypted, err := libunlynx.DecryptInt(secKey, ctTest)
+	assert.NoError(t, err)
+	assert.Equal(t, decrypted, int64(0))
 }
 
 func TestNewDeterministicCipherVector(t *testing.T) {
@@ -379,7 +418,8 @@ func TestNewDeterministicCipherVector(t *testing.T) {
 		}
 	}
 
-	test := libunlynx.DecryptIntVector(secKey, &cv)
+	test, err := libunlynx.DecryptIntVector(secKey, &cv)
+	assert.NoError(t, err)
 	for _, v := range test {
 		assert.Equal(t, v, int64(0))
 	}
@@ -420,7 +460,9 @@ func TestSerializePoint(t *testing.T) {
 	ct.C = pointC
 	ct.K = pointK
 
-	assert.Equal(t, target, libunlynx.DecryptInt(secKey, ct))
+	decrypted, err := libunlynx.DecryptInt(secKey, ct)
+	assert.NoError(t, err)
+	assert.Equal(t, target, decrypted)
 }
 
 func TestSerializeScalar(t *testing.T) {
@@ -99,4 +99,11 @@ func TestDeterministicTaggingAdditionProof(t *testing.T) {
 	prfList, err := libunlynxdetertag.DeterministicTagAdditionListProofCreation([]kyber.Point{cipherOne.C, cipherOne.C}, []kyber.Scalar{secKey, secKey}, []kyber.Point{toAdd, toAdd}, []kyber.Point{tmp, tmp})
 	assert.NoError(t, err)
 	assert.True(t, libunlynxdetertag.DeterministicTagAdditionListProofVerification(prfList, 1.0))
+
+	// different ciphertexts in the same list
+	cipherTwo := *libunlynx.EncryptInt(pubKey, 20)
+	tmpTwo := libunlynx.SuiTe.Point().Add(cipherTwo.C, toAdd)
+	prfList, err = libunlynxdetertag.DeterministicTagAdditionListProofCreation([]kyber.Point{cipherOne.C, cipherTwo.C}, []kyber.Scalar{secKey, secKey}, []kyber.Point{toAdd, toAdd}, []kyber.Point{tmp, tmpTwo})
+	assert.NoError(t, err)
+	assert.True(t, libunlynxdetertag.DeterministicTagAdditionListProofVerification(prfList, 1.0))
 }
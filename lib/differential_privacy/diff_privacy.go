@@ -1,6 +1,7 @@
 package libunlynxdiffprivacy
 
 import (
+	"fmt"
 	"math"
 
 	"github.com/r0fls/gostats"
@@ -60,3 +61,72 @@ func GenerateNoiseValuesScale(n int64, mean, b, quanta, scale, limit float64) []
 	}
 	return noise[:n]
 }
+
+// Params are the differential privacy parameters of a query: the results are obfuscated with a noise value drawn from
+// a list of NoiseListSize values following a Laplace distribution of scale Sensitivity/Epsilon (see
+// GenerateNoiseValuesScale for Quanta, Scale and Limit). The differential privacy is disabled if NoiseListSize is 0.
+type Params struct {
+	Epsilon       float64
+	Sensitivity   float64
+	NoiseListSize int64
+	Quanta        float64
+	Scale         float64
+	Limit         float64
+}
+
+// MaxNoiseListSize is the largest size of the list of noise values of a query: the noise values are encrypted,
+// shuffled and proved by every server of the roster, a larger list would be as costly as a denial of service.
+var MaxNoiseListSize int64 = 10000
+
+// Enabled returns true if the differential privacy is used
+func (p Params) Enabled() bool {
+	return p.NoiseListSize > 0
+}
+
+// Validate checks that the parameters can be used to generate the noise values
+func (p Params) Validate() error {
+	if p.NoiseListSize < 0 {
+		return fmt.Errorf("the size of the noise list cannot be negative")
+	}
+	if p.NoiseListSize > MaxNoiseListSize {
+		return fmt.Errorf("the size of the noise list cannot be larger than %d", MaxNoiseListSize)
+	}
+	if !p.Enabled() {
+		return nil
+	}
+	if p.Epsilon <= 0 {
+		return fmt.Errorf("epsilon must be positive")
+	}
+	if p.Sensitivity <= 0 {
+		return fmt.Errorf("the sensitivity must be positive")
+	}
+	if p.Scale <= 0 {
+		return fmt.Errorf("the scale must be positive")
+	}
+	if p.Quanta < 0 || p.Limit < 0 {
+		return fmt.Errorf("the quanta and the limit cannot be negative")
+	}
+	if p.Quanta == 0 && p.Limit == 0 {
+		return fmt.Errorf("either the quanta or the limit must be defined")
+	}
+	return nil
+}
+
+// GenerateNoise generates the list of noise values defined by the parameters
+func (p Params) GenerateNoise() []float64 {
+	return GenerateNoiseValuesScale(p.NoiseListSize, 0, p.Sensitivity/p.Epsilon, p.Quanta, p.Scale, p.Limit)
+}
+
+// GenerateNoiseFor generates the list of noise values from which a noise value is drawn for each of a number of
+// aggregated values (cells): NoiseListSize values, or one per aggregated value if there are more, up to
+// MaxNoiseListSize.
+func (p Params) GenerateNoiseFor(cells int) ([]float64, error) {
+	size := p.NoiseListSize
+	if int64(cells) > size {
+		size = int64(cells)
+	}
+	if size > MaxNoiseListSize {
+		return nil, fmt.Errorf("%d aggregated values need more than %d noise values", cells, MaxNoiseListSize)
+	}
+	return GenerateNoiseValuesScale(size, 0, p.Sensitivity/p.Epsilon, p.Quanta, p.Scale, p.Limit), nil
+}
@@ -31,3 +31,40 @@ func TestGenerateNoiseValues(t *testing.T) {
 
 	aux = GenerateNoiseValuesScale(500, 0, 1, 0.005, 100, 60)
 }
+
+func TestParams(t *testing.T) {
+	params := Params{}
+	assert.False(t, params.Enabled())
+	assert.NoError(t, params.Validate())
+
+	params = Params{Epsilon: 1, Sensitivity: 1, NoiseListSize: 500, Quanta: 0.005, Scale: 1}
+	assert.True(t, params.Enabled())
+	assert.NoError(t, params.Validate())
+	assert.Equal(t, GenerateNoiseValues(500, 0, 1, 0.005, 0), params.GenerateNoise())
+
+	// one noise value per aggregated value if there are more aggregated values than noise values
+	noise, err := params.GenerateNoiseFor(10)
+	assert.NoError(t, err)
+	assert.Equal(t, params.GenerateNoise(), noise)
+	noise, err = params.GenerateNoiseFor(600)
+	assert.NoError(t, err)
+	assert.Len(t, noise, 600)
+	_, err = params.GenerateNoiseFor(int(MaxNoiseListSize) + 1)
+	assert.Error(t, err)
+
+	// a smaller epsilon gives more noise
+	params.Epsilon = 0.1
+	assert.NotEqual(t, GenerateNoiseValues(500, 0, 1, 0.005, 0), params.GenerateNoise())
+
+	for _, wrong := range []Params{
+		{Epsilon: 1, Sensitivity: 1, NoiseListSize: -1, Quanta: 0.005, Scale: 1},
+		{Epsilon: 1, Sensitivity: 1, NoiseListSize: MaxNoiseListSize + 1, Quanta: 0.005, Scale: 1},
+		{Epsilon: 0, Sensitivity: 1, NoiseListSize: 500, Quanta: 0.005, Scale: 1},
+		{Epsilon: 1, Sensitivity: -1, NoiseListSize: 500, Quanta: 0.005, Scale: 1},
+		{Epsilon: 1, Sensitivity: 1, NoiseListSize: 500, Quanta: 0.005, Scale: 0},
+		{Epsilon: 1, Sensitivity: 1, NoiseListSize: 500, Quanta: -0.005, Scale: 1},
+		{Epsilon: 1, Sensitivity: 1, NoiseListSize: 500, Scale: 1},
+	} {
+		assert.Error(t, wrong.Validate())
+	}
+}
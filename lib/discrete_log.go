@@ -0,0 +1,268 @@
+package libunlynx
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sync"
+
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/onet/v3/log"
+)
+
+// discreteLogMagic identifies the files in which a DiscreteLogTable is saved
+const discreteLogMagic = "UNLYNXDL"
+
+// discreteLogTables are the tables used to decode the integers, by suite (see SetDiscreteLogTable)
+var (
+	discreteLogTablesMutex sync.RWMutex
+	discreteLogTables      = make(map[string]*DiscreteLogTable)
+)
+
+// Discrete logarithm
+//______________________________________________________________________________________________________________________
+
+// DiscreteLogTable is a precomputed baby-step giant-step table to decode the integers encoded in the exponent of points
+// (iB). It decodes the integers in [0, bound] (or [-bound, bound]) with at most bound/babySteps point additions. Once
+// created it is only read, so it can be used concurrently.
+type DiscreteLogTable struct {
+	bound     int64
+	babySteps int64
+
+	// baby steps: jB -> j, for j in [0, babySteps)
+	baby map[string]int64
+	// giant step: -babySteps*B
+	giant kyber.Point
+}
+
+// NewDiscreteLogTable computes a table that decodes the integers in [-bound, bound] with babySteps precomputed points
+// (the size of the table in memory), if babySteps is 0 it is sqrt(bound).
+func NewDiscreteLogTable(bound, babySteps int64) (*DiscreteLogTable, error) {
+	if bound <= 0 {
+		return nil, fmt.Errorf("the bound of the discrete logarithm must be positive")
+	}
+	if babySteps <= 0 {
+		babySteps = int64(math.Ceil(math.Sqrt(float64(bound))))
+	}
+	if babySteps > bound+1 {
+		babySteps = bound + 1
+	}
+
+	table := &DiscreteLogTable{bound: bound, babySteps: babySteps, baby: make(map[string]int64, babySteps)}
+	B := SuiTe.Point().Base()
+	P := SuiTe.Point().Null()
+	for j := int64(0); j < babySteps; j++ {
+		key, err := P.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		table.baby[string(key)] = j
+		P = SuiTe.Point().Add(P, B)
+	}
+	table.giant = SuiTe.Point().Neg(P)
+	return table, nil
+}
+
+// Bound returns the greatest (absolute) integer decoded by the table
+func (t *DiscreteLogTable) Bound() int64 {
+	return t.bound
+}
+
+// search looks for x in [0, bound] such that P = xB
+func (t *DiscreteLogTable) search(P kyber.Point) (int64, bool) {
+	Q := SuiTe.Point().Set(P)
+	for i := int64(0); i*t.babySteps <= t.bound; i++ {
+		key, err := Q.MarshalBinary()
+		if err != nil {
+			return 0, false
+		}
+		if j, ok := t.baby[string(key)]; ok && i*t.babySteps+j <= t.bound {
+			return i*t.babySteps + j, true
+		}
+		Q = Q.Add(Q, t.giant)
+	}
+	return 0, false
+}
+
+// Log returns the integer x such that P = xB, if checkNeg is set x can also be negative. An error is returned if x is
+// out of the bound of the table.
+func (t *DiscreteLogTable) Log(P kyber.Point, checkNeg bool) (int64, error) {
+	if x, ok := t.search(P); ok {
+		return x, nil
+	}
+	if checkNeg {
+		if x, ok := t.search(SuiTe.Point().Neg(P)); ok {
+			return -x, nil
+		}
+	}
+	return 0, fmt.Errorf("out of bound encryption, bound is %d", t.bound)
+}
+
+// Save writes the table in a file (the baby steps in order, after the bound and their number)
+func (t *DiscreteLogTable) Save(path string) error {
+	points := make([][]byte, t.babySteps)
+	for k, j := range t.baby {
+		points[j] = []byte(k)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	header := make([]byte, len(discreteLogMagic)+16)
+	copy(header, discreteLogMagic)
+	binary.BigEndian.PutUint64(header[len(discreteLogMagic):], uint64(t.bound))
+	binary.BigEndian.PutUint64(header[len(discreteLogMagic)+8:], uint64(t.babySteps))
+	if _, err := w.Write(header); err != nil {
+		f.Close()
+		return err
+	}
+	for _, p := range points {
+		if _, err := w.Write(p); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// LoadDiscreteLogTable reads a table saved in a file, its first and last baby steps are checked.
+func LoadDiscreteLogTable(path string) (*DiscreteLogTable, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+
+	header := make([]byte, len(discreteLogMagic)+16)
+	if _, err := io.ReadFull(r, header); err != nil || string(header[:len(discreteLogMagic)]) != discreteLogMagic {
+		return nil, fmt.Errorf("%s is not a discrete logarithm table", path)
+	}
+	table := &DiscreteLogTable{
+		bound:     int64(binary.BigEndian.Uint64(header[len(discreteLogMagic):])),
+		babySteps: int64(binary.BigEndian.Uint64(header[len(discreteLogMagic)+8:])),
+	}
+	if table.bound <= 0 || table.babySteps <= 0 || table.babySteps > table.bound+1 {
+		return nil, fmt.Errorf("wrong parameters in the discrete logarithm table %s", path)
+	}
+
+	table.baby = make(map[string]int64, table.babySteps)
+	pointLen := SuiTe.PointLen()
+	last := SuiTe.Point()
+	for j := int64(0); j < table.babySteps; j++ {
+		buf := make([]byte, pointLen)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, fmt.Errorf("truncated discrete logarithm table %s", path)
+		}
+		table.baby[string(buf)] = j
+		if j == table.babySteps-1 {
+			if err := last.UnmarshalBinary(buf); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	first, err := SuiTe.Point().Null().MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	expectedLast := SuiTe.Point().Mul(SuiTe.Scalar().SetInt64(table.babySteps-1), SuiTe.Point().Base())
+	if j, ok := table.baby[string(first)]; !ok || j != 0 || !last.Equal(expectedLast) || int64(len(table.baby)) != table.babySteps {
+		return nil, fmt.Errorf("corrupted discrete logarithm table %s", path)
+	}
+	table.giant = SuiTe.Point().Neg(SuiTe.Point().Add(last, SuiTe.Point().Base()))
+	return table, nil
+}
+
+// SetDiscreteLogTable sets the table used to decrypt the integers of the suite (e.g. to decode larger integers).
+func SetDiscreteLogTable(table *DiscreteLogTable) {
+	discreteLogTablesMutex.Lock()
+	defer discreteLogTablesMutex.Unlock()
+	discreteLogTables[SuiTe.String()] = table
+}
+
+// currentDiscreteLogTable returns the table used to decrypt the integers of the suite, nil if it is not created yet
+func currentDiscreteLogTable() *DiscreteLogTable {
+	discreteLogTablesMutex.RLock()
+	defer discreteLogTablesMutex.RUnlock()
+	return discreteLogTables[SuiTe.String()]
+}
+
+// DiscreteLogBound is the bound of the table created by default to decrypt the integers (MaxHomomorphicInt if it is not
+// positive) and DiscreteLogTableFile the file from which this table is loaded, or in which it is saved if it does not
+// exist (the table is only kept in memory if it is empty). They are set before the table is first used (e.g. by the
+// configuration of a server).
+var (
+	DiscreteLogBound     int64
+	DiscreteLogTableFile string
+)
+
+// DecryptionBound returns the bound of the (absolute value of the) integers that can be decrypted: the bound of the
+// table set by SetDiscreteLogTable or, if it is not set yet, the bound of the table created by default.
+func DecryptionBound() int64 {
+	if table := currentDiscreteLogTable(); table != nil {
+		return table.Bound()
+	}
+	if DiscreteLogBound > 0 {
+		return DiscreteLogBound
+	}
+	return MaxHomomorphicInt
+}
+
+// getDiscreteLogTable returns the table used to decrypt the integers. By default, it is created the first time it is
+// used, with DiscreteLogBound and DiscreteLogTableFile.
+func getDiscreteLogTable() *DiscreteLogTable {
+	FreezeSuite()
+	if table := currentDiscreteLogTable(); table != nil {
+		return table
+	}
+
+	discreteLogTablesMutex.Lock()
+	defer discreteLogTablesMutex.Unlock()
+	suite := SuiTe.String()
+	if table, ok := discreteLogTables[suite]; ok {
+		return table
+	}
+	bound := MaxHomomorphicInt
+	if DiscreteLogBound > 0 {
+		bound = DiscreteLogBound
+	}
+	path := DiscreteLogTableFile
+
+	if path != "" {
+		table, err := LoadDiscreteLogTable(path)
+		if err == nil && table.Bound() >= bound {
+			discreteLogTables[suite] = table
+			return table
+		}
+		if err != nil && !os.IsNotExist(err) {
+			log.Warn("Couldn't load the discrete logarithm table: ", err)
+		}
+	}
+
+	table, err := NewDiscreteLogTable(bound, 0)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if path != "" {
+		if err := table.Save(path); err != nil {
+			log.Warn("Couldn't save the discrete logarithm table: ", err)
+		}
+	}
+	discreteLogTables[suite] = table
+	return table
+}
+
+// discreteLog decodes an integer encoded in the exponent of a point with the current table.
+func discreteLog(P kyber.Point, checkNeg bool) (int64, error) {
+	return getDiscreteLogTable().Log(P, checkNeg)
+}
@@ -0,0 +1,130 @@
+package libunlynx_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestDiscreteLogTable tests the decoding of integers with a baby-step giant-step table.
+func TestDiscreteLogTable(t *testing.T) {
+	bound := int64(1 << 30)
+	table, err := libunlynx.NewDiscreteLogTable(bound, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, bound, table.Bound())
+
+	B := libunlynx.SuiTe.Point().Base()
+	for _, x := range []int64{0, 1, 32767, 32768, 123456789, bound} {
+		P := libunlynx.SuiTe.Point().Mul(libunlynx.SuiTe.Scalar().SetInt64(x), B)
+		res, err := table.Log(P, false)
+		assert.NoError(t, err)
+		assert.Equal(t, x, res)
+
+		res, err = table.Log(libunlynx.SuiTe.Point().Neg(P), true)
+		assert.NoError(t, err)
+		assert.Equal(t, -x, res)
+	}
+
+	// out of the bound of the table
+	P := libunlynx.SuiTe.Point().Mul(libunlynx.SuiTe.Scalar().SetInt64(bound+1), B)
+	_, err = table.Log(P, true)
+	assert.Error(t, err)
+	_, err = table.Log(libunlynx.SuiTe.Point().Neg(B), false)
+	assert.Error(t, err)
+
+	_, err = libunlynx.NewDiscreteLogTable(0, 0)
+	assert.Error(t, err)
+}
+
+// TestDiscreteLogTableSaveLoad tests that a table can be saved in a file and loaded back.
+func TestDiscreteLogTableSaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unlynx_dlog")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dlog.table")
+
+	table, err := libunlynx.NewDiscreteLogTable(1000000, 0)
+	assert.NoError(t, err)
+	assert.NoError(t, table.Save(path))
+
+	loaded, err := libunlynx.LoadDiscreteLogTable(path)
+	assert.NoError(t, err)
+	assert.Equal(t, table.Bound(), loaded.Bound())
+
+	P := libunlynx.SuiTe.Point().Mul(libunlynx.SuiTe.Scalar().SetInt64(-987654), libunlynx.SuiTe.Point().Base())
+	res, err := loaded.Log(P, true)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-987654), res)
+
+	// corrupted and truncated files are rejected
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	data[len(data)-1] ^= 0xff
+	assert.NoError(t, ioutil.WriteFile(path, data, 0600))
+	_, err = libunlynx.LoadDiscreteLogTable(path)
+	assert.Error(t, err)
+
+	assert.NoError(t, ioutil.WriteFile(path, data[:len(data)/2], 0600))
+	_, err = libunlynx.LoadDiscreteLogTable(path)
+	assert.Error(t, err)
+
+	_, err = libunlynx.LoadDiscreteLogTable(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
+
+// TestSetDiscreteLogTable tests the decryption of large integers with a larger table.
+func TestSetDiscreteLogTable(t *testing.T) {
+	secKey, pubKey := libunlynx.GenKey()
+	ct := libunlynx.EncryptInt(pubKey, 1<<31)
+
+	_, err := libunlynx.DecryptInt(secKey, *ct)
+	assert.Error(t, err)
+
+	table, err := libunlynx.NewDiscreteLogTable(1<<32, 0)
+	assert.NoError(t, err)
+	defaultTable, err := libunlynx.NewDiscreteLogTable(libunlynx.MaxHomomorphicInt, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, libunlynx.MaxHomomorphicInt, libunlynx.DecryptionBound())
+	libunlynx.SetDiscreteLogTable(table)
+	defer libunlynx.SetDiscreteLogTable(defaultTable)
+	assert.Equal(t, int64(1<<32), libunlynx.DecryptionBound())
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := libunlynx.DecryptInt(secKey, *ct)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(1<<31), res)
+		}()
+	}
+	wg.Wait()
+}
+
+// TestCreateDecryptionTable tests that the decryption table is only replaced by a larger one.
+func TestCreateDecryptionTable(t *testing.T) {
+	secKey, pubKey := libunlynx.GenKey()
+	ct := libunlynx.EncryptInt(pubKey, -(1 << 20))
+
+	defaultTable, err := libunlynx.NewDiscreteLogTable(libunlynx.MaxHomomorphicInt, 0)
+	assert.NoError(t, err)
+	libunlynx.SetDiscreteLogTable(defaultTable)
+	defer libunlynx.SetDiscreteLogTable(defaultTable)
+
+	assert.NoError(t, libunlynx.CreateDecryptionTable(10))
+	assert.Equal(t, libunlynx.MaxHomomorphicInt, libunlynx.DecryptionBound())
+	_, err = libunlynx.DecryptIntWithNeg(secKey, *ct)
+	assert.Error(t, err)
+
+	assert.NoError(t, libunlynx.CreateDecryptionTable(1<<20))
+	assert.Equal(t, int64(1<<20), libunlynx.DecryptionBound())
+	res, err := libunlynx.DecryptIntWithNeg(secKey, *ct)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-(1 << 20)), res)
+}
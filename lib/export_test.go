@@ -0,0 +1,8 @@
+package libunlynx
+
+import "sync/atomic"
+
+// UnfreezeSuite allows the tests to change the suite again (see FreezeSuite)
+func UnfreezeSuite() {
+	atomic.StoreInt32(&suiteFrozen, 0)
+}
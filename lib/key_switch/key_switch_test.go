@@ -24,7 +24,8 @@ func TestKeySwitchSequence(t *testing.T) {
 	cv, _, _, _ := libunlynxkeyswitch.KeySwitchSequence(keysTarget.Public, rBs, keys.Private)
 	cv[0].C.Add(cv[0].C, ct1.C)
 	cv[1].C.Add(cv[1].C, ct2.C)
-	result := libunlynx.DecryptIntVector(keysTarget.Private, &cv)
+	result, err := libunlynx.DecryptIntVector(keysTarget.Private, &cv)
+	assert.NoError(t, err)
 
 	assert.Equal(t, int64(1), result[0])
 	assert.Equal(t, int64(2), result[1])
@@ -0,0 +1,54 @@
+package libunlynxkeyswitch
+
+import (
+	"fmt"
+
+	"github.com/ldsec/unlynx/lib"
+	"go.dedis.ch/kyber/v3"
+)
+
+// LagrangeCoefficient returns the Lagrange coefficient (at 0) of the share of index i (evaluated at i + 1, like the
+// shares of kyber/share) for the set of shares indices: a secret shared with a polynomial is the sum of the
+// shares multiplied by their coefficient, if there are at least as many shares as the threshold.
+func LagrangeCoefficient(i int, indices []int) kyber.Scalar {
+	xi := libunlynx.SuiTe.Scalar().SetInt64(int64(i) + 1)
+	num := libunlynx.SuiTe.Scalar().One()
+	den := libunlynx.SuiTe.Scalar().One()
+	for _, j := range indices {
+		if j == i {
+			continue
+		}
+		xj := libunlynx.SuiTe.Scalar().SetInt64(int64(j) + 1)
+		num.Mul(num, xj)
+		den.Mul(den, libunlynx.SuiTe.Scalar().Sub(xj, xi))
+	}
+	return num.Div(num, den)
+}
+
+// ThresholdKeySwitchCombination combines the key switching contributions of servers holding shares of the secret key
+// to which the target ciphertexts are encrypted (see KeySwitchSequence, the contributions are computed with the shares
+// instead of the secret keys). The contributions are indexed by share index and there must be at least as many as the
+// threshold of the sharing.
+func ThresholdKeySwitchCombination(target libunlynx.CipherVector, contributions map[int]libunlynx.CipherVector) (libunlynx.CipherVector, error) {
+	indices := make([]int, 0, len(contributions))
+	for i, cv := range contributions {
+		if len(cv) != len(target) {
+			return nil, fmt.Errorf("wrong number of ciphertexts in the contribution of share %d", i)
+		}
+		indices = append(indices, i)
+	}
+
+	result := *libunlynx.NewCipherVector(len(target))
+	for k := range result {
+		result[k].K = libunlynx.SuiTe.Point().Null()
+		result[k].C = libunlynx.SuiTe.Point().Set(target[k].C)
+	}
+	for _, i := range indices {
+		lambda := LagrangeCoefficient(i, indices)
+		for k, ct := range contributions[i] {
+			result[k].K.Add(result[k].K, libunlynx.SuiTe.Point().Mul(lambda, ct.K))
+			result[k].C.Add(result[k].C, libunlynx.SuiTe.Point().Mul(lambda, ct.C))
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,51 @@
+package libunlynxkeyswitch_test
+
+import (
+	"testing"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/lib/key_switch"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/share"
+	"go.dedis.ch/kyber/v3/util/key"
+)
+
+// TestThresholdKeySwitch tests the key switching of ciphertexts encrypted under a key shared among 5 servers, any 3 of
+// them can switch them
+func TestThresholdKeySwitch(t *testing.T) {
+	secret := libunlynx.SuiTe.Scalar().Pick(libunlynx.SuiTe.RandomStream())
+	shares := share.NewPriPoly(libunlynx.SuiTe, 3, secret, libunlynx.SuiTe.RandomStream()).Shares(5)
+	public := libunlynx.SuiTe.Point().Mul(secret, nil)
+	keysTarget := key.NewKeyPair(libunlynx.SuiTe)
+
+	target := libunlynx.CipherVector{*libunlynx.EncryptInt(public, 1), *libunlynx.EncryptInt(public, 2)}
+	rBs := []kyber.Point{target[0].K, target[1].K}
+
+	contributions := make(map[int]libunlynx.CipherVector)
+	for _, i := range []int{4, 1, 2} {
+		cv, _, _, _ := libunlynxkeyswitch.KeySwitchSequence(keysTarget.Public, rBs, shares[i].V)
+		contributions[shares[i].I] = cv
+	}
+	result, err := libunlynxkeyswitch.ThresholdKeySwitchCombination(target, contributions)
+	require.NoError(t, err)
+	values, err := libunlynx.DecryptIntVector(keysTarget.Private, &result)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 2}, values)
+
+	// the shares of less servers than the threshold cannot switch the ciphertexts
+	delete(contributions, 4)
+	result, err = libunlynxkeyswitch.ThresholdKeySwitchCombination(target, contributions)
+	require.NoError(t, err)
+	values, err = libunlynx.DecryptIntVector(keysTarget.Private, &result)
+	assert.True(t, err != nil || values[0] != 1)
+
+	// the secret is the sum of the shares multiplied by their Lagrange coefficients
+	indices := []int{0, 1, 2, 3, 4}
+	sum := libunlynx.SuiTe.Scalar().Zero()
+	for _, s := range shares {
+		sum.Add(sum, libunlynx.SuiTe.Scalar().Mul(libunlynxkeyswitch.LagrangeCoefficient(s.I, indices), s.V))
+	}
+	assert.True(t, sum.Equal(secret))
+}
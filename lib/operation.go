@@ -0,0 +1,199 @@
+package libunlynx
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// Aggregate operators
+const (
+	OpSum        = "sum"
+	OpCount      = "count"
+	OpMean       = "mean"
+	OpSumSquares = "sumsq"
+	OpVariance   = "variance"
+	OpStdDev     = "stddev"
+)
+
+// CountAttribute is the aggregating attribute in which the data providers count their responses
+const CountAttribute = "count"
+
+// squareSuffix is appended to the name of an attribute to get the name of the column aggregating its square
+const squareSuffix = "^2"
+
+// Aggregate operations
+//______________________________________________________________________________________________________________________
+
+// Operation is an aggregate operator applied on an aggregating attribute of a query (the attribute of OpCount is
+// ignored). The statistics are computed by the querier from the sums of derived columns: the values of the attribute,
+// their squares and the count of responses.
+type Operation struct {
+	Op        string
+	Attribute string
+}
+
+var operationRegex = regexp.MustCompile(`^(\w+)\((\w*)\)$`)
+
+// ParseOperation parses an operation written as "op(attribute)" (e.g. "mean(s1)", "avg" being an alias of "mean") or
+// "count".
+func ParseOperation(str string) (Operation, error) {
+	str = strings.Replace(str, " ", "", -1)
+	if str == OpCount || str == OpCount+"()" {
+		return Operation{Op: OpCount}, nil
+	}
+	tokens := operationRegex.FindStringSubmatch(str)
+	if tokens == nil {
+		return Operation{}, fmt.Errorf("wrong aggregate operation %s", str)
+	}
+	op := Operation{Op: strings.ToLower(tokens[1]), Attribute: tokens[2]}
+	if op.Op == "avg" {
+		op.Op = OpMean
+	}
+	return op, op.Validate()
+}
+
+// String returns the representation of an operation parsed by ParseOperation
+func (op Operation) String() string {
+	if op.Op == OpCount {
+		return OpCount
+	}
+	return op.Op + "(" + op.Attribute + ")"
+}
+
+// Validate checks the operator and the attribute of an operation
+func (op Operation) Validate() error {
+	switch op.Op {
+	case OpCount:
+		return nil
+	case OpSum, OpMean, OpSumSquares, OpVariance, OpStdDev:
+		if op.Attribute == "" || op.Attribute == CountAttribute || strings.HasSuffix(op.Attribute, squareSuffix) {
+			return fmt.Errorf("wrong attribute for the aggregate operation %s", op.String())
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown aggregate operator %s", op.Op)
+	}
+}
+
+// needsSquares returns true if the operation needs the sum of the squares of its attribute
+func (op Operation) needsSquares() bool {
+	return op.Op == OpSumSquares || op.Op == OpVariance || op.Op == OpStdDev
+}
+
+// needsCount returns true if the operation needs the count of responses
+func (op Operation) needsCount() bool {
+	return op.Op == OpCount || op.Op == OpMean || op.Op == OpVariance || op.Op == OpStdDev
+}
+
+// SquareAttribute returns the name of the column in which the squares of an attribute are aggregated
+func SquareAttribute(attribute string) string {
+	return attribute + squareSuffix
+}
+
+// SquareOf returns the attribute whose squares are aggregated in a column, if it is such a column
+func SquareOf(column string) (string, bool) {
+	if !strings.HasSuffix(column, squareSuffix) {
+		return "", false
+	}
+	return strings.TrimSuffix(column, squareSuffix), true
+}
+
+// SquareType returns the type of the squares of an attribute (fixed-point squares have twice the decimals)
+func SquareType(at AttributeType) AttributeType {
+	if at.Kind == TypeFixed {
+		return AttributeType{Kind: TypeFixed, Scale: 2 * at.Scale}
+	}
+	return AttributeType{Kind: TypeUnsigned}
+}
+
+// OperationColumns returns the aggregating attributes (columns) needed to compute some operations, in addition to the
+// ones in sum, and whether the responses must be counted.
+func OperationColumns(sum []string, count bool, operations []Operation) ([]string, bool) {
+	columns := append([]string{}, sum...)
+	add := func(name string) {
+		for _, v := range columns {
+			if v == name {
+				return
+			}
+		}
+		columns = append(columns, name)
+	}
+
+	for _, op := range operations {
+		if op.Op != OpCount {
+			add(op.Attribute)
+		}
+		if op.needsSquares() {
+			add(SquareAttribute(op.Attribute))
+		}
+		if op.needsCount() {
+			count = true
+		}
+	}
+	if count {
+		add(CountAttribute)
+	}
+	return columns, count
+}
+
+// squaredAttributes returns the attributes whose squares are needed by some operations
+func squaredAttributes(operations []Operation) map[string]bool {
+	squares := make(map[string]bool)
+	for _, op := range operations {
+		if op.needsSquares() {
+			squares[op.Attribute] = true
+		}
+	}
+	return squares
+}
+
+// Evaluate computes the result of an operation from the (decoded) sums of the columns of a group. The variance is the
+// population variance, it is 0 if the noise (differential privacy) makes it negative.
+func (op Operation) Evaluate(columns map[string]float64) (float64, error) {
+	get := func(name string) (float64, error) {
+		v, ok := columns[name]
+		if !ok {
+			return 0, fmt.Errorf("no column %s to compute %s", name, op.String())
+		}
+		return v, nil
+	}
+
+	if op.Op == OpCount {
+		return get(CountAttribute)
+	}
+	sum, err := get(op.Attribute)
+	if err != nil {
+		return 0, err
+	}
+	if op.Op == OpSum {
+		return sum, nil
+	}
+
+	var sumSquares, count float64
+	if op.needsSquares() {
+		if sumSquares, err = get(SquareAttribute(op.Attribute)); err != nil {
+			return 0, err
+		}
+		if op.Op == OpSumSquares {
+			return sumSquares, nil
+		}
+	}
+	if count, err = get(CountAttribute); err != nil {
+		return 0, err
+	}
+	if count <= 0 {
+		return math.NaN(), nil
+	}
+
+	mean := sum / count
+	if op.Op == OpMean {
+		return mean, nil
+	}
+	variance := math.Max(sumSquares/count-mean*mean, 0)
+	if op.Op == OpVariance {
+		return variance, nil
+	}
+	return math.Sqrt(variance), nil
+}
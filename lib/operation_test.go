@@ -0,0 +1,69 @@
+package libunlynx_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseOperation tests the parsing of the aggregate operations.
+func TestParseOperation(t *testing.T) {
+	for str, expected := range map[string]libunlynx.Operation{
+		"count":        {Op: libunlynx.OpCount},
+		"sum(s1)":      {Op: libunlynx.OpSum, Attribute: "s1"},
+		"AVG(s2)":      {Op: libunlynx.OpMean, Attribute: "s2"},
+		"variance(s3)": {Op: libunlynx.OpVariance, Attribute: "s3"},
+		"stddev( s3 )": {Op: libunlynx.OpStdDev, Attribute: "s3"},
+	} {
+		op, err := libunlynx.ParseOperation(str)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, op)
+	}
+	for _, str := range []string{"median(s1)", "mean()", "mean(count)", "mean", "sum(s1"} {
+		_, err := libunlynx.ParseOperation(str)
+		assert.Error(t, err)
+	}
+}
+
+// TestOperationColumns tests the derived columns needed by the aggregate operations.
+func TestOperationColumns(t *testing.T) {
+	operations := []libunlynx.Operation{{Op: libunlynx.OpMean, Attribute: "s1"}, {Op: libunlynx.OpStdDev, Attribute: "s2"},
+		{Op: libunlynx.OpVariance, Attribute: "s2"}}
+	columns, count := libunlynx.OperationColumns([]string{"s3", "s1"}, false, operations)
+	assert.Equal(t, []string{"s3", "s1", "s2", "s2^2", "count"}, columns)
+	assert.True(t, count)
+
+	columns, count = libunlynx.OperationColumns([]string{"s1"}, false, []libunlynx.Operation{{Op: libunlynx.OpSum, Attribute: "s1"}})
+	assert.Equal(t, []string{"s1"}, columns)
+	assert.False(t, count)
+
+	attribute, ok := libunlynx.SquareOf("s2^2")
+	assert.True(t, ok)
+	assert.Equal(t, "s2", attribute)
+	_, ok = libunlynx.SquareOf("s2")
+	assert.False(t, ok)
+	assert.Equal(t, libunlynx.AttributeType{Kind: libunlynx.TypeFixed, Scale: 4}, libunlynx.SquareType(libunlynx.AttributeType{Kind: libunlynx.TypeFixed, Scale: 2}))
+	assert.Equal(t, libunlynx.AttributeType{Kind: libunlynx.TypeUnsigned}, libunlynx.SquareType(libunlynx.AttributeType{Kind: libunlynx.TypeSigned}))
+}
+
+// TestOperationEvaluate tests the computation of the statistics from the sums of the columns.
+func TestOperationEvaluate(t *testing.T) {
+	// values 1, 2, 3, 6
+	columns := map[string]float64{"s1": 12, "s1^2": 50, "count": 4}
+	for op, expected := range map[string]float64{"count": 4, "sum(s1)": 12, "mean(s1)": 3, "sumsq(s1)": 50,
+		"variance(s1)": 3.5, "stddev(s1)": math.Sqrt(3.5)} {
+		operation, err := libunlynx.ParseOperation(op)
+		assert.NoError(t, err)
+		result, err := operation.Evaluate(columns)
+		assert.NoError(t, err)
+		assert.InDelta(t, expected, result, 1e-9)
+	}
+
+	_, err := libunlynx.Operation{Op: libunlynx.OpVariance, Attribute: "s2"}.Evaluate(columns)
+	assert.Error(t, err)
+	result, err := libunlynx.Operation{Op: libunlynx.OpMean, Attribute: "s1"}.Evaluate(map[string]float64{"s1": 0, "count": 0})
+	assert.NoError(t, err)
+	assert.True(t, math.IsNaN(result))
+}
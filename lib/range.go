@@ -0,0 +1,119 @@
+package libunlynx
+
+import (
+	"fmt"
+	"strconv"
+
+	"go.dedis.ch/kyber/v3"
+)
+
+// MaxRangeBits is the greatest number of bits of the values of a where attribute compared with a range
+const MaxRangeBits = 48
+
+// levelBits is the number of bits used to encode the level of a prefix
+const levelBits = 6
+
+// dummyLevel is the level of the prefixes used to pad the covers, it never matches the prefix of a value
+const dummyLevel = 1<<levelBits - 1
+
+// Range predicates
+//______________________________________________________________________________________________________________________
+
+// WhereQueryRange is a range condition (Lower <= value <= Upper) on a where attribute whose values are in
+// [0, 2^Bits). The data providers add the prefixes of the values of the attribute (one per level, see RangePrefixes) to
+// their where attributes and the range is sent as the prefixes of the dyadic intervals covering it (see RangeCover), so
+// that the condition holds iff one of the deterministic tags of the prefixes is in the tags of the cover.
+type WhereQueryRange struct {
+	Name  string
+	Bits  int64
+	Cover CipherVector
+}
+
+// WhereQueryRangeTagged is a WhereQueryRange deterministically tagged
+type WhereQueryRangeTagged struct {
+	Name  string
+	Cover []GroupingKey
+}
+
+// NewWhereQueryRange creates the range condition lower <= value <= upper on an attribute, the cover is encrypted with
+// the collective key. The bounds are clamped to [0, 2^bits), e.g. value >= 40 is NewWhereQueryRange(name, bits, 40,
+// math.MaxInt64, key).
+func NewWhereQueryRange(name string, bits, lower, upper int64, key kyber.Point) (WhereQueryRange, error) {
+	cover, err := RangeCover(bits, lower, upper)
+	if err != nil {
+		return WhereQueryRange{}, err
+	}
+	return WhereQueryRange{Name: name, Bits: bits, Cover: *EncryptIntVector(key, cover)}, nil
+}
+
+// Columns returns the names of the where attributes holding the prefixes of the attribute of the range
+func (wr WhereQueryRange) Columns() []string {
+	columns := make([]string, wr.Bits+1)
+	for level := range columns {
+		columns[level] = RangeColumn(wr.Name, int64(level))
+	}
+	return columns
+}
+
+// RangeColumn returns the name of the where attribute holding the prefix of a given level of an attribute
+func RangeColumn(name string, level int64) string {
+	return name + "#" + strconv.FormatInt(level, 10)
+}
+
+// encodePrefix encodes a prefix and its level as an integer
+func encodePrefix(prefix, level int64) int64 {
+	return prefix<<levelBits | level
+}
+
+// checkRangeBits checks the number of bits of the values of an attribute compared with a range
+func checkRangeBits(bits int64) error {
+	if bits <= 0 || bits > MaxRangeBits {
+		return fmt.Errorf("the number of bits of a range attribute must be between 1 and %d", MaxRangeBits)
+	}
+	return nil
+}
+
+// RangePrefixes returns the encoded prefixes of a value in [0, 2^bits): value >> level for each level from 0 to bits.
+func RangePrefixes(bits, value int64) ([]int64, error) {
+	if err := checkRangeBits(bits); err != nil {
+		return nil, err
+	}
+	if value < 0 || value >= 1<<uint(bits) {
+		return nil, fmt.Errorf("value %d is out of the range of %d bits", value, bits)
+	}
+
+	prefixes := make([]int64, bits+1)
+	for level := range prefixes {
+		prefixes[level] = encodePrefix(value>>uint(level), int64(level))
+	}
+	return prefixes, nil
+}
+
+// RangeCover returns the encoded prefixes of the dyadic intervals covering [lower, upper] (clamped to [0, 2^bits)). It
+// is padded with dummy prefixes to 2*bits values so that its size does not depend on the range.
+func RangeCover(bits, lower, upper int64) ([]int64, error) {
+	if err := checkRangeBits(bits); err != nil {
+		return nil, err
+	}
+	if lower < 0 {
+		lower = 0
+	}
+	if max := int64(1)<<uint(bits) - 1; upper > max {
+		upper = max
+	}
+
+	cover := make([]int64, 0, 2*bits)
+	for lower <= upper {
+		// largest interval starting at lower and included in the range
+		level := int64(0)
+		for level < bits && lower%(1<<uint(level+1)) == 0 && lower+(1<<uint(level+1))-1 <= upper {
+			level++
+		}
+		cover = append(cover, encodePrefix(lower>>uint(level), level))
+		lower += 1 << uint(level)
+	}
+	for i := int64(len(cover)); i < 2*bits; i++ {
+		cover = append(cover, encodePrefix(i, dummyLevel))
+	}
+	return cover, nil
+}
@@ -0,0 +1,254 @@
+package libunlynxrange
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+
+	"github.com/ldsec/unlynx/lib"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/proof"
+	"go.dedis.ch/onet/v3/log"
+)
+
+// Structs
+//______________________________________________________________________________________________________________________
+
+// Bound is the interval [Min, Max] declared for the (encoded) values of an aggregating attribute, e.g. the scaled
+// values of a fixed-point attribute
+type Bound struct {
+	Attribute string
+	Min       int64
+	Max       int64
+}
+
+// PublishedBitProof contains the encryption of a bit and the proof that it encrypts 0 or 1
+type PublishedBitProof struct {
+	Bit   libunlynx.CipherText
+	Proof []byte
+}
+
+// PublishedRangeProof proves that a ciphertext encrypts a value v in [Min, Max]: Lower are the encrypted bits of
+// v - Min and Upper the ones of Max - v, both in [0, 2^n) where n is the number of bits of Max - Min. The bits add up
+// (homomorphically) to the ciphertext, which the verifier checks.
+type PublishedRangeProof struct {
+	Min   int64
+	Max   int64
+	Lower []PublishedBitProof
+	Upper []PublishedBitProof
+}
+
+// Validate checks that a bound is an interval whose width fits in an int64
+func (b Bound) Validate() error {
+	if b.Min > b.Max || b.Max-b.Min < 0 {
+		return fmt.Errorf("wrong bound [%d, %d] for attribute %s", b.Min, b.Max, b.Attribute)
+	}
+	return nil
+}
+
+// Contains checks if a value is in the bound
+func (b Bound) Contains(v int64) bool {
+	return b.Min <= v && v <= b.Max
+}
+
+// nbrBits returns the number of bits needed to write the values of [0, max - min] (at least 1)
+func nbrBits(min, max int64) int {
+	n := bits.Len64(uint64(max - min))
+	if n == 0 {
+		return 1
+	}
+	return n
+}
+
+// RANGE proofs
+//______________________________________________________________________________________________________________________
+
+// createPredicateBit creates the predicate of a bit proof: (K = r0B and C = r0Q) or (K = r1B and C - B = r1Q)
+func createPredicateBit() proof.Predicate {
+	zero := proof.And(proof.Rep("K", "r0", "B"), proof.Rep("C", "r0", "Q"))
+	one := proof.And(proof.Rep("K", "r1", "B"), proof.Rep("CB", "r1", "Q"))
+	return proof.Or(zero, one)
+}
+
+// bitPoints returns the public points of a bit proof
+func bitPoints(pubKey kyber.Point, bit libunlynx.CipherText) map[string]kyber.Point {
+	cb := libunlynx.SuiTe.Point().Sub(bit.C, libunlynx.SuiTe.Point().Base())
+	return map[string]kyber.Point{"B": libunlynx.SuiTe.Point().Base(), "Q": pubKey, "K": bit.K, "C": bit.C, "CB": cb}
+}
+
+// bitsProofCreation encrypts the n bits of x (encrypted with randomness r) and proves that each one is 0 or 1. The
+// randomness of the bits adds up to r so that the encrypted bits add up to the encryption of x.
+func bitsProofCreation(pubKey kyber.Point, x uint64, r kyber.Scalar, n int) ([]PublishedBitProof, error) {
+	rs := make([]kyber.Scalar, n)
+	r0 := libunlynx.SuiTe.Scalar().Set(r)
+	for i := 1; i < n; i++ {
+		rs[i] = libunlynx.SuiTe.Scalar().Pick(libunlynx.SuiTe.RandomStream())
+		r0.Sub(r0, libunlynx.SuiTe.Scalar().Mul(rs[i], powerOfTwo(i)))
+	}
+	rs[0] = r0
+
+	proofs := make([]PublishedBitProof, n)
+	for i := 0; i < n; i++ {
+		b := int64((x >> uint(i)) & 1)
+		bit := libunlynx.CipherText{
+			K: libunlynx.SuiTe.Point().Mul(rs[i], nil),
+			C: libunlynx.SuiTe.Point().Add(libunlynx.IntToPoint(b), libunlynx.SuiTe.Point().Mul(rs[i], pubKey)),
+		}
+
+		predicate := createPredicateBit()
+		sval := map[string]kyber.Scalar{"r0": rs[i], "r1": rs[i]}
+		choice := map[proof.Predicate]int{predicate: int(b)}
+		prover := predicate.Prover(libunlynx.SuiTe, sval, bitPoints(pubKey, bit), choice)
+		proofBit, err := proof.HashProve(libunlynx.SuiTe, "rangeProof", prover)
+		if err != nil {
+			return nil, fmt.Errorf("---------prover: %v", err)
+		}
+		proofs[i] = PublishedBitProof{Bit: bit, Proof: proofBit}
+	}
+	return proofs, nil
+}
+
+// bitsProofVerification verifies the proofs of the encrypted bits and that they add up to ct
+func bitsProofVerification(pubKey kyber.Point, ct libunlynx.CipherText, proofs []PublishedBitProof) bool {
+	sum := libunlynx.CipherText{K: libunlynx.SuiTe.Point().Null(), C: libunlynx.SuiTe.Point().Null()}
+	for i, pbp := range proofs {
+		if pbp.Bit.K == nil || pbp.Bit.C == nil {
+			log.Error("---------Verifier: missing encrypted bit")
+			return false
+		}
+		verifier := createPredicateBit().Verifier(libunlynx.SuiTe, bitPoints(pubKey, pbp.Bit))
+		if err := proof.HashVerify(libunlynx.SuiTe, "rangeProof", verifier, pbp.Proof); err != nil {
+			log.Error("---------Verifier:", err.Error())
+			return false
+		}
+		sum.K.Add(sum.K, libunlynx.SuiTe.Point().Mul(powerOfTwo(i), pbp.Bit.K))
+		sum.C.Add(sum.C, libunlynx.SuiTe.Point().Mul(powerOfTwo(i), pbp.Bit.C))
+	}
+	if !sum.Equal(&ct) {
+		log.Error("---------Verifier: the encrypted bits do not add up to the ciphertext")
+		return false
+	}
+	return true
+}
+
+// powerOfTwo returns 2^i as a scalar
+func powerOfTwo(i int) kyber.Scalar {
+	return libunlynx.SuiTe.Scalar().SetInt64(int64(1) << uint(i))
+}
+
+// lowerCipherText returns the encryption of v - min (same randomness as ct)
+func lowerCipherText(ct libunlynx.CipherText, min int64) libunlynx.CipherText {
+	return libunlynx.CipherText{K: ct.K, C: libunlynx.SuiTe.Point().Sub(ct.C, libunlynx.IntToPoint(min))}
+}
+
+// upperCipherText returns the encryption of max - v (opposite randomness of ct)
+func upperCipherText(ct libunlynx.CipherText, max int64) libunlynx.CipherText {
+	return libunlynx.CipherText{K: libunlynx.SuiTe.Point().Neg(ct.K), C: libunlynx.SuiTe.Point().Sub(libunlynx.IntToPoint(max), ct.C)}
+}
+
+// RangeProofCreation creates the proof that ct, the encryption of v with randomness r under pubKey, encrypts a value in
+// [min, max]
+func RangeProofCreation(pubKey kyber.Point, ct libunlynx.CipherText, v int64, r kyber.Scalar, min, max int64) (PublishedRangeProof, error) {
+	bound := Bound{Min: min, Max: max}
+	if err := bound.Validate(); err != nil {
+		return PublishedRangeProof{}, err
+	}
+	if !bound.Contains(v) {
+		return PublishedRangeProof{}, fmt.Errorf("value %d is out of [%d, %d]", v, min, max)
+	}
+
+	n := nbrBits(min, max)
+	lower, err := bitsProofCreation(pubKey, uint64(v-min), r, n)
+	if err != nil {
+		return PublishedRangeProof{}, err
+	}
+	upper, err := bitsProofCreation(pubKey, uint64(max-v), libunlynx.SuiTe.Scalar().Neg(r), n)
+	if err != nil {
+		return PublishedRangeProof{}, err
+	}
+	return PublishedRangeProof{Min: min, Max: max, Lower: lower, Upper: upper}, nil
+}
+
+// EncryptIntWithRangeProof encrypts v under pubKey and proves that it is in [min, max]
+func EncryptIntWithRangeProof(pubKey kyber.Point, v, min, max int64) (*libunlynx.CipherText, PublishedRangeProof, error) {
+	ct, r := libunlynx.EncryptIntGetR(pubKey, v)
+	prp, err := RangeProofCreation(pubKey, *ct, v, r, min, max)
+	if err != nil {
+		return nil, PublishedRangeProof{}, err
+	}
+	return ct, prp, nil
+}
+
+// RangeProofVerification verifies that ct encrypts (under pubKey) a value in the interval of the proof
+func RangeProofVerification(pubKey kyber.Point, ct libunlynx.CipherText, prp PublishedRangeProof) bool {
+	if err := (Bound{Min: prp.Min, Max: prp.Max}).Validate(); err != nil {
+		log.Error("---------Verifier:", err.Error())
+		return false
+	}
+	n := nbrBits(prp.Min, prp.Max)
+	if len(prp.Lower) != n || len(prp.Upper) != n {
+		log.Error("---------Verifier: wrong number of encrypted bits")
+		return false
+	}
+	return bitsProofVerification(pubKey, lowerCipherText(ct, prp.Min), prp.Lower) &&
+		bitsProofVerification(pubKey, upperCipherText(ct, prp.Max), prp.Upper)
+}
+
+// Serialization
+//______________________________________________________________________________________________________________________
+
+// ToBytes converts a PublishedRangeProof to a byte array
+func (prp *PublishedRangeProof) ToBytes() ([]byte, error) {
+	b := make([]byte, 16)
+	binary.BigEndian.PutUint64(b[:8], uint64(prp.Min))
+	binary.BigEndian.PutUint64(b[8:], uint64(prp.Max))
+	for _, pbp := range append(append([]PublishedBitProof{}, prp.Lower...), prp.Upper...) {
+		bit, err := pbp.Bit.ToBytes()
+		if err != nil {
+			return nil, err
+		}
+		length := make([]byte, 4)
+		binary.BigEndian.PutUint32(length, uint32(len(pbp.Proof)))
+		b = append(b, bit...)
+		b = append(b, length...)
+		b = append(b, pbp.Proof...)
+	}
+	return b, nil
+}
+
+// FromBytes converts a byte array to a PublishedRangeProof. Note that you need to create the (empty) object beforehand.
+func (prp *PublishedRangeProof) FromBytes(data []byte) error {
+	if len(data) < 16 {
+		return fmt.Errorf("range proof too short")
+	}
+	prp.Min = int64(binary.BigEndian.Uint64(data[:8]))
+	prp.Max = int64(binary.BigEndian.Uint64(data[8:16]))
+	if err := (Bound{Min: prp.Min, Max: prp.Max}).Validate(); err != nil {
+		return err
+	}
+	n := nbrBits(prp.Min, prp.Max)
+
+	ctLength := 2 * libunlynx.SuiTe.PointLen()
+	proofs := make([]PublishedBitProof, 2*n)
+	data = data[16:]
+	for i := range proofs {
+		if len(data) < ctLength+4 {
+			return fmt.Errorf("range proof too short")
+		}
+		if err := proofs[i].Bit.FromBytes(data[:ctLength]); err != nil {
+			return err
+		}
+		length := int(binary.BigEndian.Uint32(data[ctLength : ctLength+4]))
+		data = data[ctLength+4:]
+		if len(data) < length {
+			return fmt.Errorf("range proof too short")
+		}
+		proofs[i].Proof = data[:length]
+		data = data[length:]
+	}
+	if len(data) != 0 {
+		return fmt.Errorf("range proof too long")
+	}
+	prp.Lower, prp.Upper = proofs[:n], proofs[n:]
+	return nil
+}
@@ -0,0 +1,61 @@
+package libunlynxrange_test
+
+import (
+	"testing"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/lib/range"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRangeProof(t *testing.T) {
+	_, pubKey := libunlynx.GenKey()
+
+	for _, test := range []struct {
+		v, min, max int64
+	}{
+		{0, 0, 1}, {1, 0, 1}, {1, 1, 1}, {42, 0, 100}, {-5, -10, 10}, {100, 0, 100}, {1 << 40, 0, 1 << 41},
+	} {
+		ct, prp, err := libunlynxrange.EncryptIntWithRangeProof(pubKey, test.v, test.min, test.max)
+		require.NoError(t, err)
+		assert.True(t, libunlynxrange.RangeProofVerification(pubKey, *ct, prp), test)
+
+		// serialization
+		data, err := prp.ToBytes()
+		require.NoError(t, err)
+		decoded := libunlynxrange.PublishedRangeProof{}
+		require.NoError(t, decoded.FromBytes(data))
+		assert.True(t, libunlynxrange.RangeProofVerification(pubKey, *ct, decoded))
+		assert.Error(t, decoded.FromBytes(data[:len(data)-1]))
+
+		// the proof is bound to the ciphertext, its interval and the key
+		other := libunlynx.EncryptInt(pubKey, test.v)
+		assert.False(t, libunlynxrange.RangeProofVerification(pubKey, *other, prp))
+		shifted := prp
+		shifted.Min, shifted.Max = prp.Min+1, prp.Max+1
+		assert.False(t, libunlynxrange.RangeProofVerification(pubKey, *ct, shifted))
+		_, otherKey := libunlynx.GenKey()
+		assert.False(t, libunlynxrange.RangeProofVerification(otherKey, *ct, prp))
+	}
+
+	// the value must be in the interval
+	_, _, err := libunlynxrange.EncryptIntWithRangeProof(pubKey, 101, 0, 100)
+	assert.Error(t, err)
+	_, _, err = libunlynxrange.EncryptIntWithRangeProof(pubKey, 0, 1, 0)
+	assert.Error(t, err)
+
+	// a proof of the bits of a value out of the interval cannot be forged from a valid one
+	ct, prp, err := libunlynxrange.EncryptIntWithRangeProof(pubKey, 1000, 0, 1023)
+	require.NoError(t, err)
+	prp.Max = 100
+	assert.False(t, libunlynxrange.RangeProofVerification(pubKey, *ct, prp))
+}
+
+func TestBound(t *testing.T) {
+	assert.NoError(t, libunlynxrange.Bound{Attribute: "s1", Min: -1, Max: 1}.Validate())
+	assert.Error(t, libunlynxrange.Bound{Attribute: "s1", Min: 1, Max: -1}.Validate())
+	assert.Error(t, libunlynxrange.Bound{Attribute: "s1", Min: -1 << 63, Max: 1}.Validate())
+	assert.True(t, libunlynxrange.Bound{Min: 0, Max: 10}.Contains(10))
+	assert.False(t, libunlynxrange.Bound{Min: 0, Max: 10}.Contains(-1))
+}
@@ -0,0 +1,67 @@
+package libunlynx_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRangeCover checks, for every range and every value of a small domain, that a value is in the range iff one of
+// its prefixes is in the cover of the range.
+func TestRangeCover(t *testing.T) {
+	bits := int64(5)
+	for lower := int64(-1); lower <= 1<<uint(bits); lower++ {
+		for upper := lower; upper <= 1<<uint(bits); upper++ {
+			cover, err := libunlynx.RangeCover(bits, lower, upper)
+			require.NoError(t, err)
+			assert.Len(t, cover, int(2*bits))
+
+			coverSet := make(map[int64]bool)
+			for _, c := range cover {
+				coverSet[c] = true
+			}
+			for value := int64(0); value < 1<<uint(bits); value++ {
+				prefixes, err := libunlynx.RangePrefixes(bits, value)
+				require.NoError(t, err)
+				assert.Len(t, prefixes, int(bits+1))
+
+				matches := 0
+				for _, p := range prefixes {
+					if coverSet[p] {
+						matches++
+					}
+				}
+				if lower <= value && value <= upper {
+					assert.Equal(t, 1, matches, "value %d in [%d, %d]", value, lower, upper)
+				} else {
+					assert.Equal(t, 0, matches, "value %d not in [%d, %d]", value, lower, upper)
+				}
+			}
+		}
+	}
+
+	// open ranges are clamped to the domain of the attribute
+	cover, err := libunlynx.RangeCover(libunlynx.MaxRangeBits, 40, math.MaxInt64)
+	assert.NoError(t, err)
+	assert.Len(t, cover, 2*libunlynx.MaxRangeBits)
+}
+
+// TestRangeErrors tests the wrong number of bits and the values out of the domain of the attribute.
+func TestRangeErrors(t *testing.T) {
+	_, err := libunlynx.RangeCover(0, 0, 1)
+	assert.Error(t, err)
+	_, err = libunlynx.RangeCover(libunlynx.MaxRangeBits+1, 0, 1)
+	assert.Error(t, err)
+	_, err = libunlynx.RangePrefixes(4, 16)
+	assert.Error(t, err)
+	_, err = libunlynx.RangePrefixes(4, -1)
+	assert.Error(t, err)
+
+	wr, err := libunlynx.NewWhereQueryRange("w1", 4, 3, 12, libunlynx.SuiTe.Point().Base())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"w1#0", "w1#1", "w1#2", "w1#3", "w1#4"}, wr.Columns())
+	assert.Len(t, wr.Cover, 8)
+}
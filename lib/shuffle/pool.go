@@ -0,0 +1,452 @@
+package libunlynxshuffle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/lib/tools"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/onet/v3/log"
+)
+
+// poolFileExtension is the extension of the files in which the precomputed values of a pool are saved
+const poolFileExtension = ".precomputed"
+
+// PoolBatch is the number of lines precomputed at once by the background worker of a pool (each batch is saved in its
+// own segment file)
+var PoolBatch = 16
+
+// Precomputation pool
+//______________________________________________________________________________________________________________________
+
+// PrecomputationPool keeps the precomputed values for shuffling of a server, by collective key and line size: they are
+// computed in advance by a background worker, up to the number of rows the surveys are expected to shuffle (see
+// Reserve), and each line is used to rerandomize a single row (see Take). The pool is saved in a directory (if it is
+// not empty) so that the lines are not lost, nor used twice, when the server restarts: each batch of lines is saved in
+// a segment file, which is deleted once its lines are taken, and the pools that are not reserved anymore are removed
+// (see Collect).
+type PrecomputationPool struct {
+	dir string
+
+	mutex        sync.Mutex
+	pools        map[string]*precomputations
+	reservations map[string]reservation
+
+	// running is set while a background worker precomputes the missing lines (see start)
+	running bool
+	closed  bool
+	stop    chan struct{}
+	workers sync.WaitGroup
+}
+
+// precomputations are the lines precomputed for a collective key and a line size, by segment (in the order in which
+// they are computed)
+type precomputations struct {
+	collectiveKey kyber.Point
+	lineSize      int
+	segments      []segment
+	// next is the number of the next segment
+	next uint64
+}
+
+// segment is a batch of lines saved in the same file
+type segment struct {
+	number uint64
+	lines  []CipherVectorScalar
+}
+
+// reservation is the number of rows a survey is expected to shuffle with the lines of a pool
+type reservation struct {
+	pool string
+	rows int
+}
+
+// poolFile is the content of a file in which a segment of a pool is saved, Checksum is the hash of all the other fields
+// (see checksum)
+type poolFile struct {
+	CollectiveKey []byte
+	LineSize      int64
+	Lines         []CipherVectorScalarBytes
+	Checksum      []byte
+}
+
+// NewPrecomputationPool creates a pool saved in a directory (created if needed), the segments already saved in it are
+// checked and loaded, or an empty pool only kept in memory if dir is empty. Its background worker only runs while
+// lines are missing, it is stopped by Close.
+func NewPrecomputationPool(dir string) (*PrecomputationPool, error) {
+	pp := &PrecomputationPool{
+		dir:          dir,
+		pools:        make(map[string]*precomputations),
+		reservations: make(map[string]reservation),
+		stop:         make(chan struct{}),
+	}
+
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, err
+		}
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			if f.IsDir() || !strings.HasSuffix(f.Name(), poolFileExtension) {
+				continue
+			}
+			path := filepath.Join(dir, f.Name())
+			id, pc, err := loadSegment(path)
+			if err != nil {
+				// a corrupted file is discarded, its lines could be wrong or already used
+				log.Warn("Discarding the precomputations of ", path, ": ", err)
+				if err := os.Remove(path); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if loaded, ok := pp.pools[id]; ok {
+				loaded.segments = append(loaded.segments, pc.segments...)
+			} else {
+				pp.pools[id] = pc
+			}
+		}
+		for _, pc := range pp.pools {
+			sort.Slice(pc.segments, func(i, j int) bool { return pc.segments[i].number < pc.segments[j].number })
+			pc.next = pc.segments[len(pc.segments)-1].number + 1
+		}
+	}
+
+	return pp, nil
+}
+
+// poolID identifies the pool of a collective key and a line size
+func poolID(collectiveKey kyber.Point, lineSize int) string {
+	h := sha256.New()
+	h.Write([]byte(collectiveKey.String()))
+	binary.Write(h, binary.BigEndian, int64(lineSize))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// size returns the number of lines of a pool
+func (pc *precomputations) size() int {
+	n := 0
+	for _, seg := range pc.segments {
+		n += len(seg.lines)
+	}
+	return n
+}
+
+// pool returns the pool of a collective key and a line size, it is created if it does not exist (the caller holds the
+// mutex)
+func (pp *PrecomputationPool) pool(collectiveKey kyber.Point, lineSize int) (string, *precomputations) {
+	id := poolID(collectiveKey, lineSize)
+	pc, ok := pp.pools[id]
+	if !ok {
+		pc = &precomputations{collectiveKey: collectiveKey, lineSize: lineSize}
+		pp.pools[id] = pc
+	}
+	return id, pc
+}
+
+// Reserve declares that a survey (id) is expected to shuffle rows of lineSize elements encrypted under a collective
+// key, the background worker precomputes the missing lines. A new reservation of the survey replaces the previous one
+// (e.g. if its collective key changes), the pool of the previous one is removed if it is not reserved anymore.
+func (pp *PrecomputationPool) Reserve(id string, collectiveKey kyber.Point, lineSize, rows int) {
+	pp.mutex.Lock()
+	pool, _ := pp.pool(collectiveKey, lineSize)
+	previous, replaced := pp.reservations[id]
+	pp.reservations[id] = reservation{pool: pool, rows: rows}
+	if replaced && previous.pool != pool {
+		pp.collect(previous.pool)
+	}
+	pp.start()
+	pp.mutex.Unlock()
+}
+
+// Release cancels the reservation of a survey (e.g. if it is removed before being shuffled), its pool is removed if it
+// is not reserved anymore
+func (pp *PrecomputationPool) Release(id string) {
+	pp.mutex.Lock()
+	defer pp.mutex.Unlock()
+	if r, ok := pp.reservations[id]; ok {
+		delete(pp.reservations, id)
+		pp.collect(r.pool)
+	}
+}
+
+// Collect removes the pools that are not reserved (e.g. the ones of a collective key that is not used anymore), it is
+// called once the reservations of the surveys are restored
+func (pp *PrecomputationPool) Collect() {
+	pp.mutex.Lock()
+	defer pp.mutex.Unlock()
+	for id := range pp.pools {
+		pp.collect(id)
+	}
+}
+
+// collect removes a pool, and its files, if it is not reserved (the caller holds the mutex)
+func (pp *PrecomputationPool) collect(id string) {
+	for _, r := range pp.reservations {
+		if r.pool == id {
+			return
+		}
+	}
+	pc, ok := pp.pools[id]
+	if !ok {
+		return
+	}
+	for len(pc.segments) > 0 {
+		if err := pp.remove(pc, pc.segments[0]); err != nil {
+			log.Error("Couldn't remove the precomputations: ", err)
+			return
+		}
+		pc.segments = pc.segments[1:]
+	}
+	delete(pp.pools, id)
+}
+
+// Available returns the number of lines precomputed for a collective key and a line size
+func (pp *PrecomputationPool) Available(collectiveKey kyber.Point, lineSize int) int {
+	pp.mutex.Lock()
+	defer pp.mutex.Unlock()
+	if pc, ok := pp.pools[poolID(collectiveKey, lineSize)]; ok {
+		return pc.size()
+	}
+	return 0
+}
+
+// Take removes lines from the pool to shuffle rows encrypted under a collective key, one line per row: they are never
+// given again: the segments whose lines are all taken are deleted and the last segment taken is saved again with the
+// lines left. The lines missing in the pool are computed right away. The reservation of the survey (id) ends.
+func (pp *PrecomputationPool) Take(id string, collectiveKey kyber.Point, lineSize, rows int) ([]CipherVectorScalar, error) {
+	pp.mutex.Lock()
+	delete(pp.reservations, id)
+	pool, pc := pp.pool(collectiveKey, lineSize)
+	taken := make([]CipherVectorScalar, 0, rows)
+	var err error
+	for len(taken) < rows && len(pc.segments) > 0 {
+		last := &pc.segments[len(pc.segments)-1]
+		n := rows - len(taken)
+		if n >= len(last.lines) {
+			if err = pp.remove(pc, *last); err != nil {
+				break
+			}
+			taken = append(taken, last.lines...)
+			pc.segments = pc.segments[:len(pc.segments)-1]
+			continue
+		}
+		left := segment{number: last.number, lines: last.lines[:len(last.lines)-n]}
+		if err = pp.save(pc, left); err != nil {
+			break
+		}
+		taken = append(taken, last.lines[len(left.lines):]...)
+		*last = left
+	}
+	pp.collect(pool)
+	pp.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if missing := rows - len(taken); missing > 0 {
+		log.Lvl2("The precomputation pool is missing ", missing, " lines, they are computed now")
+		taken = append(taken, CreatePrecomputedRandomize(libunlynx.SuiTe.Point().Base(), collectiveKey, libunlynx.SuiTe.RandomStream(), lineSize, missing)...)
+	}
+	return taken, nil
+}
+
+// Close stops the background worker, the lines are not precomputed anymore
+func (pp *PrecomputationPool) Close() {
+	pp.mutex.Lock()
+	if !pp.closed {
+		pp.closed = true
+		close(pp.stop)
+	}
+	pp.mutex.Unlock()
+	pp.workers.Wait()
+}
+
+// start starts the background worker if it is not running (the caller holds the lock of the pool)
+func (pp *PrecomputationPool) start() {
+	if pp.running || pp.closed {
+		return
+	}
+	pp.running = true
+	pp.workers.Add(1)
+	go pp.refill()
+}
+
+// missing returns a pool that has less lines than the rows reserved for it, and the number of lines missing (the
+// caller holds the lock of the pool)
+func (pp *PrecomputationPool) missing() (*precomputations, int) {
+	reserved := make(map[string]int)
+	for _, r := range pp.reservations {
+		reserved[r.pool] += r.rows
+	}
+	for id, rows := range reserved {
+		if pc := pp.pools[id]; pc.size() < rows {
+			return pc, rows - pc.size()
+		}
+	}
+	return nil, 0
+}
+
+// refill is the background worker: it precomputes the lines missing in the pools, batch by batch, until none is
+// missing or it is stopped
+func (pp *PrecomputationPool) refill() {
+	defer pp.workers.Done()
+	for {
+		select {
+		case <-pp.stop:
+			return
+		default:
+		}
+
+		pp.mutex.Lock()
+		pc, missing := pp.missing()
+		if pc == nil {
+			pp.running = false
+			pp.mutex.Unlock()
+			return
+		}
+		pp.mutex.Unlock()
+		if missing > PoolBatch {
+			missing = PoolBatch
+		}
+		lines := CreatePrecomputedRandomize(libunlynx.SuiTe.Point().Base(), pc.collectiveKey, libunlynx.SuiTe.RandomStream(), pc.lineSize, missing)
+
+		pp.mutex.Lock()
+		if pp.pools[poolID(pc.collectiveKey, pc.lineSize)] != pc {
+			// the pool was removed in the meantime
+			pp.mutex.Unlock()
+			continue
+		}
+		seg := segment{number: pc.next, lines: lines}
+		pc.next++
+		pc.segments = append(pc.segments, seg)
+		err := pp.save(pc, seg)
+		pp.mutex.Unlock()
+		if err != nil {
+			log.Error("Couldn't save the precomputations: ", err)
+		}
+	}
+}
+
+// Persistence
+//______________________________________________________________________________________________________________________
+
+// checksum returns the hash of the content of a pool file
+func (pf *poolFile) checksum() []byte {
+	h := sha256.New()
+	h.Write(pf.CollectiveKey)
+	binary.Write(h, binary.BigEndian, pf.LineSize)
+	binary.Write(h, binary.BigEndian, int64(len(pf.Lines)))
+	for _, line := range pf.Lines {
+		for _, s := range line.S {
+			h.Write(s)
+		}
+		for _, ct := range line.CipherV {
+			for _, p := range ct {
+				h.Write(p)
+			}
+		}
+	}
+	return h.Sum(nil)
+}
+
+// segmentFile returns the path of the file of a segment of a pool
+func (pp *PrecomputationPool) segmentFile(pc *precomputations, seg segment) string {
+	return filepath.Join(pp.dir, segmentFileName(poolID(pc.collectiveKey, pc.lineSize), seg.number))
+}
+
+// segmentFileName returns the name of the file of a segment of a pool (id)
+func segmentFileName(id string, number uint64) string {
+	return id + "-" + strconv.FormatUint(number, 10) + poolFileExtension
+}
+
+// save writes the lines of a segment of a pool in its file, replaced atomically (the caller holds the mutex)
+func (pp *PrecomputationPool) save(pc *precomputations, seg segment) error {
+	if pp.dir == "" {
+		return nil
+	}
+
+	key, err := pc.collectiveKey.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	lines, err := EncodeCipherVectorScalar(seg.lines)
+	if err != nil {
+		return err
+	}
+	pf := poolFile{CollectiveKey: key, LineSize: int64(pc.lineSize), Lines: lines}
+	pf.Checksum = pf.checksum()
+
+	path := pp.segmentFile(pc, seg)
+	if err := libunlynxtools.WriteToGobFile(path+".tmp", pf); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// remove deletes the file of a segment of a pool (the caller holds the mutex)
+func (pp *PrecomputationPool) remove(pc *precomputations, seg segment) error {
+	if pp.dir == "" {
+		return nil
+	}
+	if err := os.Remove(pp.segmentFile(pc, seg)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// loadSegment reads the lines saved in a segment file and returns the pool (and its id) made of this segment, its
+// checksum is checked as well as the size of its lines and the values of one of them
+func loadSegment(path string) (string, *precomputations, error) {
+	pf := poolFile{}
+	if err := libunlynxtools.ReadFromGobFile(path, &pf); err != nil {
+		return "", nil, err
+	}
+	if !bytes.Equal(pf.checksum(), pf.Checksum) {
+		return "", nil, fmt.Errorf("wrong checksum")
+	}
+
+	pc := &precomputations{collectiveKey: libunlynx.SuiTe.Point(), lineSize: int(pf.LineSize)}
+	if err := pc.collectiveKey.UnmarshalBinary(pf.CollectiveKey); err != nil {
+		return "", nil, err
+	}
+	id := poolID(pc.collectiveKey, pc.lineSize)
+	number, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), id+"-"), poolFileExtension), 10, 64)
+	if err != nil || filepath.Base(path) != segmentFileName(id, number) {
+		return "", nil, fmt.Errorf("the file does not match its collective key and line size")
+	}
+	lines, err := DecodeCipherVectorScalar(pf.Lines)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(lines) == 0 {
+		return "", nil, fmt.Errorf("empty segment")
+	}
+	for _, line := range lines {
+		if len(line.S) != pc.lineSize || len(line.CipherV) != pc.lineSize {
+			return "", nil, fmt.Errorf("wrong size of the lines")
+		}
+	}
+	line := lines[len(lines)-1]
+	for i, s := range line.S {
+		if !line.CipherV[i].K.Equal(libunlynx.SuiTe.Point().Mul(s, nil)) || !line.CipherV[i].C.Equal(libunlynx.SuiTe.Point().Mul(s, pc.collectiveKey)) {
+			return "", nil, fmt.Errorf("wrong precomputed values")
+		}
+	}
+	pc.segments = []segment{{number: number, lines: lines}}
+	return id, pc, nil
+}
@@ -0,0 +1,170 @@
+package libunlynxshuffle_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/lib/shuffle"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3"
+)
+
+// waitAvailable waits (at most 10s) until a pool has a number of lines for a key and a line size
+func waitAvailable(pool *libunlynxshuffle.PrecomputationPool, key kyber.Point, lineSize, lines int) {
+	for i := 0; i < 200 && pool.Available(key, lineSize) < lines; i++ {
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestPrecomputationPool(t *testing.T) {
+	secKey, pubKey := libunlynx.GenKey()
+	lineSize := 4
+
+	dir, err := ioutil.TempDir("", "precomputations")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	pool, err := libunlynxshuffle.NewPrecomputationPool(dir)
+	require.NoError(t, err)
+
+	// the lines reserved are computed in the background
+	pool.Reserve("s1", pubKey, lineSize, 20)
+	pool.Reserve("s2", pubKey, lineSize, 5)
+	waitAvailable(pool, pubKey, lineSize, 25)
+	require.Equal(t, 25, pool.Available(pubKey, lineSize))
+	assert.Equal(t, 0, pool.Available(pubKey, lineSize+1))
+
+	lines, err := pool.Take("s1", pubKey, lineSize, 20)
+	require.NoError(t, err)
+	assert.Equal(t, 20, len(lines))
+	assert.Equal(t, 5, pool.Available(pubKey, lineSize))
+	for _, line := range lines {
+		require.Equal(t, lineSize, len(line.CipherV))
+		for i, s := range line.S {
+			assert.True(t, line.CipherV[i].K.Equal(libunlynx.SuiTe.Point().Mul(s, nil)))
+			assert.True(t, line.CipherV[i].C.Equal(libunlynx.SuiTe.Point().Mul(s, pubKey)))
+		}
+	}
+
+	// the lines are used to shuffle, one per row
+	rows := make([]libunlynx.CipherVector, len(lines))
+	for i := range rows {
+		rows[i] = *libunlynx.EncryptIntVector(pubKey, []int64{int64(i), 1})
+	}
+	shuffled, pi, beta := libunlynxshuffle.ShuffleSequence(rows, libunlynx.SuiTe.Point().Base(), pubKey, lines)
+	for i := range shuffled {
+		decrypted, err := libunlynx.DecryptIntVector(secKey, &shuffled[i])
+		require.NoError(t, err)
+		assert.Equal(t, []int64{int64(pi[i]), 1}, decrypted)
+		assert.Equal(t, lines[i].S[:2], beta[i])
+	}
+
+	// the lines taken are not saved anymore
+	pool.Close()
+	pool, err = libunlynxshuffle.NewPrecomputationPool(dir)
+	require.NoError(t, err)
+	assert.Equal(t, 5, pool.Available(pubKey, lineSize))
+
+	// the missing lines are computed when they are taken
+	lines, err = pool.Take("s2", pubKey, lineSize, 8)
+	require.NoError(t, err)
+	assert.Equal(t, 8, len(lines))
+	assert.Equal(t, 0, pool.Available(pubKey, lineSize))
+
+	pool.Close()
+
+	// a corrupted file is discarded
+	pool, err = libunlynxshuffle.NewPrecomputationPool(dir)
+	require.NoError(t, err)
+	pool.Reserve("s4", pubKey, lineSize, 3)
+	waitAvailable(pool, pubKey, lineSize, 3)
+	pool.Close()
+	files, err := filepath.Glob(filepath.Join(dir, "*.precomputed"))
+	require.NoError(t, err)
+	require.Equal(t, 1, len(files))
+	content, err := ioutil.ReadFile(files[0])
+	require.NoError(t, err)
+	content[len(content)/2] ^= 1
+	require.NoError(t, ioutil.WriteFile(files[0], content, 0600))
+
+	pool, err = libunlynxshuffle.NewPrecomputationPool(dir)
+	require.NoError(t, err)
+	defer pool.Close()
+	assert.Equal(t, 0, pool.Available(pubKey, lineSize))
+	_, err = os.Stat(files[0])
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestPrecomputationPoolSegments(t *testing.T) {
+	_, pubKey := libunlynx.GenKey()
+	_, newKey := libunlynx.GenKey()
+	lineSize := 2
+
+	dir, err := ioutil.TempDir("", "precomputations")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	batch := libunlynxshuffle.PoolBatch
+	defer func() { libunlynxshuffle.PoolBatch = batch }()
+	libunlynxshuffle.PoolBatch = 4
+	segments := func() int {
+		files, err := filepath.Glob(filepath.Join(dir, "*.precomputed"))
+		require.NoError(t, err)
+		return len(files)
+	}
+
+	// each batch is saved in its own segment, only the segments whose lines are taken are changed
+	pool, err := libunlynxshuffle.NewPrecomputationPool(dir)
+	require.NoError(t, err)
+	pool.Reserve("s1", pubKey, lineSize, 10)
+	pool.Reserve("s2", pubKey, lineSize, 1)
+	waitAvailable(pool, pubKey, lineSize, 11)
+	assert.Equal(t, 3, segments())
+	lines, err := pool.Take("s1", pubKey, lineSize, 5)
+	require.NoError(t, err)
+	assert.Equal(t, 5, len(lines))
+	assert.Equal(t, 6, pool.Available(pubKey, lineSize))
+	assert.Equal(t, 2, segments())
+	pool.Close()
+
+	pool, err = libunlynxshuffle.NewPrecomputationPool(dir)
+	require.NoError(t, err)
+	assert.Equal(t, 6, pool.Available(pubKey, lineSize))
+
+	// the pools that are not reserved are removed, e.g. when the collective key of a survey changes
+	pool.Reserve("s2", pubKey, lineSize, 1)
+	pool.Reserve("s2", newKey, lineSize, 1)
+	assert.Equal(t, 0, pool.Available(pubKey, lineSize))
+	waitAvailable(pool, newKey, lineSize, 1)
+	assert.Equal(t, 1, segments())
+	pool.Close()
+
+	// or when no survey reserves them once the server restarts
+	pool, err = libunlynxshuffle.NewPrecomputationPool(dir)
+	require.NoError(t, err)
+	defer pool.Close()
+	assert.Equal(t, 1, pool.Available(newKey, lineSize))
+	pool.Collect()
+	assert.Equal(t, 0, pool.Available(newKey, lineSize))
+	assert.Equal(t, 0, segments())
+}
+
+func TestPrecomputationPoolMemory(t *testing.T) {
+	_, pubKey := libunlynx.GenKey()
+	pool, err := libunlynxshuffle.NewPrecomputationPool("")
+	require.NoError(t, err)
+	defer pool.Close()
+
+	pool.Reserve("s1", pubKey, 2, 3)
+	waitAvailable(pool, pubKey, 2, 3)
+	assert.Equal(t, 3, pool.Available(pubKey, 2))
+	lines, err := pool.Take("s1", pubKey, 2, 3)
+	require.NoError(t, err)
+	assert.Equal(t, 3, len(lines))
+	assert.Equal(t, 0, pool.Available(pubKey, 2))
+}
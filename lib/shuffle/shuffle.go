@@ -13,7 +13,8 @@ import (
 	"go.dedis.ch/onet/v3/log"
 )
 
-// ShuffleSequence applies shuffling to a ciphervector
+// ShuffleSequence applies shuffling to a ciphervector. If there are at least as many precomputed lines as rows, each
+// row is rerandomized with its own line, otherwise the lines are picked at random (and possibly used more than once).
 func ShuffleSequence(inputList []libunlynx.CipherVector, g, h kyber.Point, precomputed []CipherVectorScalar) ([]libunlynx.CipherVector, []int, [][]kyber.Scalar) {
 	maxUint := ^uint(0)
 	maxInt := int(maxUint >> 1)
@@ -29,6 +30,9 @@ func ShuffleSequence(inputList []libunlynx.CipherVector, g, h kyber.Point, preco
 	for i := 0; i < k; i++ {
 		if precomputed == nil {
 			beta[i] = libunlynx.RandomScalarSlice(NQ)
+		} else if len(precomputed) >= k {
+			beta[i] = precomputed[i].S[0:NQ]
+			precomputedPoints[i] = precomputed[i].CipherV[0:NQ]
 		} else {
 			randInt := random.Int(big.NewInt(int64(maxInt)), rand)
 
@@ -40,8 +40,12 @@ func TestPublishedShufflingProof_ToBytes(t *testing.T) {
 	err = converted.FromBytes(pspb)
 	assert.NoError(t, err)
 
-	assert.Equal(t, tab, libunlynx.DecryptIntVector(keys.Private, &converted.OriginalList[0]))
-	assert.Equal(t, tab, libunlynx.DecryptIntVector(keys.Private, &converted.ShuffledList[0]))
+	decrypted, err := libunlynx.DecryptIntVector(keys.Private, &converted.OriginalList[0])
+	assert.NoError(t, err)
+	assert.Equal(t, tab, decrypted)
+	decrypted, err = libunlynx.DecryptIntVector(keys.Private, &converted.ShuffledList[0])
+	assert.NoError(t, err)
+	assert.Equal(t, tab, decrypted)
 	assert.Equal(t, psp.HashProof, converted.HashProof)
 	assert.True(t, psp.G.Equal(converted.G))
 	assert.True(t, psp.H.Equal(converted.H))
@@ -42,7 +42,8 @@ func TestShuffleSequence(t *testing.T) {
 
 	for i := 0; i < k; i++ {
 		for iii := range inputList[0] {
-			decrypted := libunlynx.DecryptInt(collectivePrivKey, outputlist[piinv[i]][iii])
+			decrypted, err := libunlynx.DecryptInt(collectivePrivKey, outputlist[piinv[i]][iii])
+			assert.NoError(t, err)
 			assert.Equal(t, int64(i+1), decrypted)
 		}
 	}
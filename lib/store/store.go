@@ -1,6 +1,8 @@
 package libunlynxstore
 
 import (
+	"fmt"
+	"sort"
 	"sync"
 
 	"github.com/ldsec/unlynx/lib"
@@ -64,8 +66,9 @@ func proccessParameters(data []string, clear map[string]int64, encrypted map[str
 	return containerClear, containerEnc
 }
 
-// InsertDpResponse handles the local storage of a new DP response in aggregation or grouping cases.
-func (s *Store) InsertDpResponse(cr libunlynx.DpResponse, proofsB bool, groupBy, sum []string, where []libunlynx.WhereQueryAttribute) {
+// InsertDpResponse handles the local storage of a new DP response in aggregation or grouping cases. If the response is
+// added to an already stored one and proofsB is set, the proof of this addition is returned.
+func (s *Store) InsertDpResponse(cr libunlynx.DpResponse, proofsB bool, groupBy, sum []string, where []libunlynx.WhereQueryAttribute) *libunlynx.PublishedSimpleAdditionProof {
 	newResp := libunlynx.ProcessResponse{}
 	clearGrp := make([]int64, 0)
 	clearWhr := make([]int64, 0)
@@ -92,7 +95,7 @@ func (s *Store) InsertDpResponse(cr libunlynx.DpResponse, proofsB bool, groupBy,
 			s.DpResponsesAggr[GroupingKeyTuple{libunlynx.Key(clearGrp), libunlynx.Key(clearWhr)}] = mapValue
 
 			if proofsB {
-				_ = libunlynx.PublishedSimpleAdditionProof{C1: value.AggregatingAttributes, C2: newResp.AggregatingAttributes, C1PlusC2: mapValue.AggregatingAttributes}
+				return &libunlynx.PublishedSimpleAdditionProof{C1: value.AggregatingAttributes, C2: newResp.AggregatingAttributes, C1PlusC2: mapValue.AggregatingAttributes}
 			}
 
 		} else {
@@ -100,6 +103,7 @@ func (s *Store) InsertDpResponse(cr libunlynx.DpResponse, proofsB bool, groupBy,
 		}
 
 	}
+	return nil
 }
 
 // HasNextDpResponse permits to verify if there are new DP responses to be processed.
@@ -117,6 +121,57 @@ func (s *Store) PullDpResponses() []libunlynx.ProcessResponse {
 	return result
 }
 
+// NbrPendingDpResponses returns the number of DP responses that are not processed yet (see PendingDpResponses)
+func (s *Store) NbrPendingDpResponses() int {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	return len(s.DpResponses) + len(s.DpResponsesAggr)
+}
+
+// PendingDpResponses returns a copy of the DP responses that are not processed yet: the responses followed by the
+// pre-aggregated ones (in the order of their grouping keys)
+func (s *Store) PendingDpResponses() []libunlynx.ProcessResponse {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+
+	result := append([]libunlynx.ProcessResponse{}, s.DpResponses...)
+	for _, k := range s.aggrKeys() {
+		result = append(result, s.DpResponsesAggr[k])
+	}
+	return result
+}
+
+// SetPendingDpResponses replaces the DP responses that are not processed yet, in the order of PendingDpResponses (e.g.
+// with the responses re-encrypted under another key)
+func (s *Store) SetPendingDpResponses(responses []libunlynx.ProcessResponse) error {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+
+	if len(responses) != len(s.DpResponses)+len(s.DpResponsesAggr) {
+		return fmt.Errorf("wrong number of responses for the %d pending responses", len(s.DpResponses)+len(s.DpResponsesAggr))
+	}
+	copy(s.DpResponses, responses)
+	for i, k := range s.aggrKeys() {
+		s.DpResponsesAggr[k] = responses[len(s.DpResponses)+i]
+	}
+	return nil
+}
+
+// aggrKeys returns the keys of the pre-aggregated DP responses in order
+func (s *Store) aggrKeys() []GroupingKeyTuple {
+	keys := make([]GroupingKeyTuple, 0, len(s.DpResponsesAggr))
+	for k := range s.DpResponsesAggr {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].gkt1 != keys[j].gkt1 {
+			return keys[i].gkt1 < keys[j].gkt1
+		}
+		return keys[i].gkt2 < keys[j].gkt2
+	})
+	return keys
+}
+
 // PushShuffledProcessResponses stores shuffled responses
 func (s *Store) PushShuffledProcessResponses(newShuffledProcessResponses []libunlynx.ProcessResponse) {
 	s.ShuffledProcessResponses = append(s.ShuffledProcessResponses, newShuffledProcessResponses...)
@@ -129,8 +184,9 @@ func (s *Store) PullShuffledProcessResponses() []libunlynx.ProcessResponse {
 	return result
 }
 
-// PushDeterministicFilteredResponses permits to store results of deterministic tagging
-func (s *Store) PushDeterministicFilteredResponses(detFilteredResponses []libunlynx.FilteredResponseDet, serverName string, proofsB bool) {
+// PushDeterministicFilteredResponses permits to store results of deterministic tagging. If proofsB is set, it returns
+// the proofs of the local aggregation.
+func (s *Store) PushDeterministicFilteredResponses(detFilteredResponses []libunlynx.FilteredResponseDet, serverName string, proofsB bool) []libunlynxaggr.PublishedAggregationListProof {
 
 	round := libunlynx.StartTimer(serverName + "_ServerLocalAggregation")
 
@@ -145,13 +201,15 @@ func (s *Store) PushDeterministicFilteredResponses(detFilteredResponses []libunl
 		}
 
 	}
+	proofs := make([]libunlynxaggr.PublishedAggregationListProof, 0)
 	if proofsB {
 		for k, v := range cvMap {
-			libunlynxaggr.AggregationListProofCreation(v, s.LocAggregatedProcessResponse[k].AggregatingAttributes)
+			proofs = append(proofs, libunlynxaggr.AggregationListProofCreation(v, s.LocAggregatedProcessResponse[k].AggregatingAttributes))
 		}
 	}
 
 	libunlynx.EndTimer(round)
+	return proofs
 }
 
 // HasNextAggregatedResponse verifies the presence of locally aggregated results.
@@ -258,8 +316,42 @@ func (s *Store) HasNextAggregatedFilteredResponses() bool {
 	return len(s.GroupedDeterministicFilteredResponses) > 0
 }
 
-// PullCothorityAggregatedFilteredResponses returns the local results of the grouping.
-func (s *Store) PullCothorityAggregatedFilteredResponses(diffPri bool, noise libunlynx.CipherText) []libunlynx.FilteredResponse {
+// NbrAggregatedCells returns the number of aggregated values (groups times aggregating attributes) in the local results
+// of the grouping.
+func (s *Store) NbrAggregatedCells() int {
+	cells := 0
+	for _, v := range s.GroupedDeterministicFilteredResponses {
+		cells += len(v.AggregatingAttributes)
+	}
+	return cells
+}
+
+// checkNoise checks that there is a noise value for each aggregated value of the results, a noise value is never reused
+func checkNoise(results []libunlynx.FilteredResponse, noise libunlynx.CipherVector) error {
+	cells := 0
+	for _, v := range results {
+		cells += len(v.AggregatingAttributes)
+	}
+	if cells > len(noise) {
+		return fmt.Errorf("%d noise values for %d aggregated values", len(noise), cells)
+	}
+	return nil
+}
+
+// addNoise adds a noise value to each aggregated value of the results (see checkNoise)
+func addNoise(results []libunlynx.FilteredResponse, noise libunlynx.CipherVector) {
+	count := 0
+	for _, v := range results {
+		for i := range v.AggregatingAttributes {
+			v.AggregatingAttributes[i].Add(v.AggregatingAttributes[i], noise[count])
+			count++
+		}
+	}
+}
+
+// PullCothorityAggregatedFilteredResponses returns the local results of the grouping (with one noise value added to each
+// aggregated value if diffPri is set, there must be enough noise values).
+func (s *Store) PullCothorityAggregatedFilteredResponses(diffPri bool, noise libunlynx.CipherVector) ([]libunlynx.FilteredResponse, error) {
 	aggregatedResults := make([]libunlynx.FilteredResponse, len(s.GroupedDeterministicFilteredResponses))
 	aggregatedGrps := make([]libunlynx.GroupingKey, len(s.GroupedDeterministicFilteredResponses))
 	count := 0
@@ -269,18 +361,19 @@ func (s *Store) PullCothorityAggregatedFilteredResponses(diffPri bool, noise lib
 		aggregatedGrps[count] = i
 		count++
 	}
+	if diffPri {
+		if err := checkNoise(aggregatedResults, noise); err != nil {
+			return nil, err
+		}
+	}
 
 	s.GroupedDeterministicFilteredResponses = make(map[libunlynx.GroupingKey]libunlynx.FilteredResponse)
 
 	if diffPri {
-		for _, v := range aggregatedResults {
-			for _, aggr := range v.AggregatingAttributes {
-				aggr.Add(aggr, noise)
-			}
-		}
+		addNoise(aggregatedResults, noise)
 	}
 
-	return aggregatedResults
+	return aggregatedResults, nil
 }
 
 // PushQuerierKeyEncryptedResponses handles the reception of the key switched (for the querier) results.
@@ -288,20 +381,22 @@ func (s *Store) PushQuerierKeyEncryptedResponses(keySwitchedResponse []libunlynx
 	s.DeliverableResults = keySwitchedResponse
 }
 
-// PullDeliverableResults gets the results.
-func (s *Store) PullDeliverableResults(diffPri bool, noise libunlynx.CipherText) []libunlynx.FilteredResponse {
+// PullDeliverableResults gets the results (with one noise value added to each aggregated value if diffPri is set, there
+// must be enough noise values).
+func (s *Store) PullDeliverableResults(diffPri bool, noise libunlynx.CipherVector) ([]libunlynx.FilteredResponse, error) {
 	results := s.DeliverableResults
+	if diffPri {
+		if err := checkNoise(results, noise); err != nil {
+			return nil, err
+		}
+	}
 	s.DeliverableResults = s.DeliverableResults[:0]
 
 	if diffPri {
-		for _, v := range results {
-			for _, aggr := range v.AggregatingAttributes {
-				aggr.Add(aggr, noise)
-			}
-		}
+		addNoise(results, noise)
 	}
 
-	return results
+	return results, nil
 }
 
 // DisplayResults shows results and is useful for debugging.
@@ -310,3 +405,78 @@ func (s *Store) DisplayResults() {
 		log.Lvl1("[ ", v.GroupByEnc, " ] : ", v.AggregatingAttributes, ")")
 	}
 }
+
+// Snapshot
+//______________________________________________________________________________________________________________________
+
+// AggregatedResponseEntry is an entry of the (clear) pre-aggregated DP responses map in a serializable form
+type AggregatedResponseEntry struct {
+	GroupByKey libunlynx.GroupingKey
+	WhereKey   libunlynx.GroupingKey
+	Response   libunlynx.ProcessResponse
+}
+
+// FilteredResponseEntry is an entry of a grouping key -> filtered response map in a serializable form
+type FilteredResponseEntry struct {
+	Key      libunlynx.GroupingKey
+	Response libunlynx.FilteredResponse
+}
+
+// StoreSnapshot is a serializable copy of a Store (e.g. to persist it to disk)
+type StoreSnapshot struct {
+	DpResponses              []libunlynx.ProcessResponse
+	DeliverableResults       []libunlynx.FilteredResponse
+	ShuffledProcessResponses []libunlynx.ProcessResponse
+
+	DpResponsesAggr                       []AggregatedResponseEntry
+	LocAggregatedProcessResponse          []FilteredResponseEntry
+	GroupedDeterministicFilteredResponses []FilteredResponseEntry
+
+	LastID uint64
+}
+
+// Snapshot returns a serializable copy of the store content
+func (s *Store) Snapshot() StoreSnapshot {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+
+	snap := StoreSnapshot{
+		DpResponses:              append([]libunlynx.ProcessResponse{}, s.DpResponses...),
+		DeliverableResults:       append([]libunlynx.FilteredResponse{}, s.DeliverableResults...),
+		ShuffledProcessResponses: append([]libunlynx.ProcessResponse{}, s.ShuffledProcessResponses...),
+		LastID:                   s.lastID,
+	}
+	for k, v := range s.DpResponsesAggr {
+		snap.DpResponsesAggr = append(snap.DpResponsesAggr, AggregatedResponseEntry{GroupByKey: k.gkt1, WhereKey: k.gkt2, Response: v})
+	}
+	snap.LocAggregatedProcessResponse = mapToEntries(s.LocAggregatedProcessResponse)
+	snap.GroupedDeterministicFilteredResponses = mapToEntries(s.GroupedDeterministicFilteredResponses)
+	return snap
+}
+
+// NewStoreFromSnapshot rebuilds a store from a snapshot
+func NewStoreFromSnapshot(snap StoreSnapshot) *Store {
+	s := NewStore()
+	s.DpResponses = snap.DpResponses
+	s.DeliverableResults = snap.DeliverableResults
+	s.ShuffledProcessResponses = snap.ShuffledProcessResponses
+	s.lastID = snap.LastID
+	for _, v := range snap.DpResponsesAggr {
+		s.DpResponsesAggr[GroupingKeyTuple{v.GroupByKey, v.WhereKey}] = v.Response
+	}
+	for _, v := range snap.LocAggregatedProcessResponse {
+		s.LocAggregatedProcessResponse[v.Key] = v.Response
+	}
+	for _, v := range snap.GroupedDeterministicFilteredResponses {
+		s.GroupedDeterministicFilteredResponses[v.Key] = v.Response
+	}
+	return s
+}
+
+func mapToEntries(m map[libunlynx.GroupingKey]libunlynx.FilteredResponse) []FilteredResponseEntry {
+	entries := make([]FilteredResponseEntry, 0, len(m))
+	for k, v := range m {
+		entries = append(entries, FilteredResponseEntry{Key: k, Response: v})
+	}
+	return entries
+}
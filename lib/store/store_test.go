@@ -2,6 +2,7 @@ package libunlynxstore_test
 
 import (
 	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/lib/aggregation"
 	. "github.com/ldsec/unlynx/lib/store"
 	"github.com/ldsec/unlynx/lib/tools"
 	"github.com/ldsec/unlynx/protocols"
@@ -67,9 +68,13 @@ func TestStoring(t *testing.T) {
 	assert.Empty(t, storage.DpResponses)
 
 	// (2) Test Insert and Pull multiple DpResponses to check aggregation
-	storage.InsertDpResponse(libunlynx.DpResponse{GroupByClear: testClearMap, WhereClear: testClearMap, AggregatingAttributesEnc: testAggrMap2}, true, groupBy, sum, where)
-	storage.InsertDpResponse(libunlynx.DpResponse{GroupByClear: testClearMap, WhereClear: testClearMap, AggregatingAttributesEnc: testAggrMap2}, true, groupBy, sum, where)
-	storage.InsertDpResponse(libunlynx.DpResponse{GroupByClear: testClearMap, WhereClear: testClearMap, AggregatingAttributesEnc: testAggrMap2}, true, groupBy, sum, where)
+	assert.Nil(t, storage.InsertDpResponse(libunlynx.DpResponse{GroupByClear: testClearMap, WhereClear: testClearMap, AggregatingAttributesEnc: testAggrMap2}, true, groupBy, sum, where))
+	additionProof := storage.InsertDpResponse(libunlynx.DpResponse{GroupByClear: testClearMap, WhereClear: testClearMap, AggregatingAttributesEnc: testAggrMap2}, true, groupBy, sum, where)
+	assert.NotNil(t, additionProof)
+	assert.True(t, libunlynx.SimpleAdditionProofVerification(*additionProof))
+	additionProof = storage.InsertDpResponse(libunlynx.DpResponse{GroupByClear: testClearMap, WhereClear: testClearMap, AggregatingAttributesEnc: testAggrMap2}, true, groupBy, sum, where)
+	assert.NotNil(t, additionProof)
+	assert.True(t, libunlynx.SimpleAdditionProofVerification(*additionProof))
 
 	sum1 := libunlynx.NewCipherVector(len(testAggr2))
 	sum1.Add(testAggr2, testAggr2)
@@ -118,7 +123,11 @@ func TestStoring(t *testing.T) {
 	assert.NoError(t, err)
 	detResponses[2] = libunlynx.FilteredResponseDet{Fr: libunlynx.FilteredResponse{GroupByEnc: testAggr2, AggregatingAttributes: testAggr1}, DetTagGroupBy: dtgb}
 
-	storage.PushDeterministicFilteredResponses(detResponses, "ServerTest", true)
+	aggregationProofs := storage.PushDeterministicFilteredResponses(detResponses, "ServerTest", true)
+	assert.Len(t, aggregationProofs, 2)
+	for _, v := range aggregationProofs {
+		assert.True(t, libunlynxaggr.AggregationListProofVerification(v, 1.0))
+	}
 
 	assert.True(t, len(storage.PullLocallyAggregatedResponses()) == 2)
 	assert.Empty(t, storage.LocAggregatedProcessResponse, 0)
@@ -131,18 +140,37 @@ func TestStoring(t *testing.T) {
 	detResponsesMap[detResponses[2].DetTagGroupBy] = detResponses[2].Fr
 
 	storage.PushCothorityAggregatedFilteredResponses(detResponsesMap)
+	assert.Equal(t, 2*len(testAggr1), storage.NbrAggregatedCells())
 
-	assert.True(t, len(storage.PullCothorityAggregatedFilteredResponses(false, libunlynx.CipherText{})) == 2)
+	aggregated, err := storage.PullCothorityAggregatedFilteredResponses(false, nil)
+	assert.NoError(t, err)
+	assert.True(t, len(aggregated) == 2)
 	assert.Empty(t, storage.GroupedDeterministicFilteredResponses, 0)
 
 	// (5) Test KeySwitching pull and push functions
 	filteredResponses := []libunlynx.FilteredResponse{{GroupByEnc: testAggr2, AggregatingAttributes: testAggr2},
 		{GroupByEnc: testAggr1, AggregatingAttributes: testAggr2}, {GroupByEnc: testAggr2, AggregatingAttributes: testAggr1}}
 	storage.PushQuerierKeyEncryptedResponses(filteredResponses)
-	results := storage.PullDeliverableResults(false, libunlynx.CipherText{})
+	results, err := storage.PullDeliverableResults(false, nil)
+	assert.NoError(t, err)
 
 	assert.True(t, len(results) == 3)
 	assert.Empty(t, len(storage.DeliverableResults), 0)
+
+	// (6) Test the addition of a noise value to each aggregated value
+	storage.PushQuerierKeyEncryptedResponses([]libunlynx.FilteredResponse{{AggregatingAttributes: *libunlynx.EncryptIntVector(pubKey, []int64{1, 2})},
+		{AggregatingAttributes: *libunlynx.EncryptIntVector(pubKey, []int64{3})}})
+	// a noise value cannot be reused for several aggregated values
+	_, err = storage.PullDeliverableResults(true, *libunlynx.EncryptIntVector(pubKey, []int64{10, 20}))
+	assert.Error(t, err)
+	results, err = storage.PullDeliverableResults(true, *libunlynx.EncryptIntVector(pubKey, []int64{10, 20, 30}))
+	assert.NoError(t, err)
+	decrypted, err := libunlynx.DecryptIntVector(secKey, &results[0].AggregatingAttributes)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{11, 22}, decrypted)
+	decrypted, err = libunlynx.DecryptIntVector(secKey, &results[1].AggregatingAttributes)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{33}, decrypted)
 }
 
 func TestConvertDataToMap(t *testing.T) {
@@ -157,3 +185,56 @@ func TestConvertDataToMap(t *testing.T) {
 
 	assert.Equal(t, result, libunlynxtools.ConvertDataToMap(test, "g", 0), "Wrong map conversion")
 }
+
+// TestStoreSnapshot tests the conversion of a store to a snapshot and back.
+func TestStoreSnapshot(t *testing.T) {
+	_, pubKey := libunlynx.GenKey()
+
+	testAggr := *libunlynx.EncryptIntVector(pubKey, []int64{1, 2})
+	testAggrMap := map[string]libunlynx.CipherText{"0": testAggr[0], "1": testAggr[1]}
+	testClearMap := map[string]int64{"0": 0, "1": 1}
+
+	sum := []string{"0", "1"}
+	groupBy := []string{"0", "1"}
+	where := []libunlynx.WhereQueryAttribute{{Name: "0", Value: libunlynx.CipherText{}}}
+
+	storage := NewStore()
+	storage.InsertDpResponse(libunlynx.DpResponse{GroupByClear: testClearMap, WhereClear: testClearMap, AggregatingAttributesEnc: testAggrMap}, false, groupBy, sum, where)
+	storage.InsertDpResponse(libunlynx.DpResponse{GroupByEnc: testAggrMap, AggregatingAttributesEnc: testAggrMap}, false, groupBy, sum, where)
+	storage.PushCothorityAggregatedFilteredResponses(map[libunlynx.GroupingKey]libunlynx.FilteredResponse{"a": {GroupByEnc: testAggr, AggregatingAttributes: testAggr}})
+
+	restored := NewStoreFromSnapshot(storage.Snapshot())
+
+	assert.Equal(t, storage.DpResponses, restored.DpResponses)
+	assert.Equal(t, storage.DpResponsesAggr, restored.DpResponsesAggr)
+	assert.Equal(t, storage.GroupedDeterministicFilteredResponses, restored.GroupedDeterministicFilteredResponses)
+	assert.Empty(t, restored.LocAggregatedProcessResponse)
+}
+
+func TestStorePendingDpResponses(t *testing.T) {
+	_, pubKey := libunlynx.GenKey()
+
+	testAggr := *libunlynx.EncryptIntVector(pubKey, []int64{1, 2})
+	testAggrMap := map[string]libunlynx.CipherText{"0": testAggr[0], "1": testAggr[1]}
+	sum := []string{"0", "1"}
+	groupBy := []string{"0", "1"}
+
+	storage := NewStore()
+	storage.InsertDpResponse(libunlynx.DpResponse{GroupByClear: map[string]int64{"0": 0, "1": 1}, AggregatingAttributesEnc: testAggrMap}, false, groupBy, sum, nil)
+	storage.InsertDpResponse(libunlynx.DpResponse{GroupByClear: map[string]int64{"0": 1, "1": 1}, AggregatingAttributesEnc: testAggrMap}, false, groupBy, sum, nil)
+	storage.InsertDpResponse(libunlynx.DpResponse{GroupByEnc: testAggrMap, AggregatingAttributesEnc: testAggrMap}, false, groupBy, sum, nil)
+
+	pending := storage.PendingDpResponses()
+	assert.Equal(t, 3, len(pending))
+	assert.Equal(t, pending, storage.PendingDpResponses())
+
+	// the responses are replaced in the same order
+	replaced := make([]libunlynx.ProcessResponse, len(pending))
+	for i, v := range pending {
+		replaced[i] = v
+		replaced[i].AggregatingAttributes = *libunlynx.EncryptIntVector(pubKey, []int64{int64(i), 0})
+	}
+	assert.NoError(t, storage.SetPendingDpResponses(replaced))
+	assert.Equal(t, replaced, storage.PendingDpResponses())
+	assert.Error(t, storage.SetPendingDpResponses(replaced[1:]))
+}
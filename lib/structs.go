@@ -2,6 +2,8 @@
 package libunlynx
 
 import (
+	"fmt"
+	"math"
 	"strconv"
 	"strings"
 
@@ -25,6 +27,8 @@ type DpClearResponse struct {
 	GroupByEnc                 map[string]int64
 	AggregatingAttributesClear map[string]int64
 	AggregatingAttributesEnc   map[string]int64
+	// AggregatingAttributesDec are the decimal values of fixed-point aggregating attributes (always encrypted)
+	AggregatingAttributesDec map[string]float64
 }
 
 // DpResponse represents an encrypted DP response (as it is sent to a server)
@@ -45,6 +49,8 @@ type DpResponseToSend struct {
 	GroupByEnc                 map[string][]byte
 	AggregatingAttributesClear map[string]int64
 	AggregatingAttributesEnc   map[string][]byte
+	// RangeProofs are the proofs (see lib/range) that encrypted aggregating attributes are in their declared bound
+	RangeProofs map[string][]byte
 }
 
 // ProcessResponse is a response in the format used for shuffling and det tag
@@ -149,8 +155,11 @@ func (crd *FilteredResponseDet) FormatAggregationProofs(res map[GroupingKey][]Ci
 	}
 }
 
-// EncryptDpClearResponse encrypts a DP response
-func EncryptDpClearResponse(ccr DpClearResponse, encryptionKey kyber.Point, count bool) (DpResponseToSend, error) {
+// EncryptDpClearResponse encrypts a DP response, the aggregating attributes are encoded with their type (the unsigned
+// type if they are not in types) and the derived columns needed by the aggregate operations (squares, count) are added.
+// The prefixes of the where attributes compared with ranges (given with the number of bits of their values) are added
+// to the where attributes.
+func EncryptDpClearResponse(ccr DpClearResponse, encryptionKey kyber.Point, count bool, types map[string]AttributeType, operations []Operation, ranges map[string]int64) (DpResponseToSend, error) {
 	cr := DpResponseToSend{}
 	cr.GroupByClear = ccr.GroupByClear
 	cr.GroupByEnc = make(map[string][]byte, len(ccr.GroupByEnc))
@@ -172,24 +181,106 @@ func EncryptDpClearResponse(ccr DpClearResponse, encryptionKey kyber.Point, coun
 		cr.WhereEnc[i] = data
 	}
 	//cr.WhereEnc = *EncryptIntVector(encryptionKey, ccr.WhereEnc)
-	cr.AggregatingAttributesClear = ccr.AggregatingAttributesClear
-	cr.AggregatingAttributesEnc = make(map[string][]byte, len(ccr.AggregatingAttributesEnc))
-	for i, v := range ccr.AggregatingAttributesEnc {
+	for name, bits := range ranges {
+		if v, ok := ccr.WhereClear[name]; ok {
+			prefixes, err := RangePrefixes(bits, v)
+			if err != nil {
+				return DpResponseToSend{}, fmt.Errorf("attribute %s: %v", name, err)
+			}
+			whereClear := make(map[string]int64, len(cr.WhereClear)+len(prefixes))
+			for k, w := range cr.WhereClear {
+				whereClear[k] = w
+			}
+			for level, prefix := range prefixes {
+				whereClear[RangeColumn(name, int64(level))] = prefix
+			}
+			cr.WhereClear = whereClear
+		}
+		if v, ok := ccr.WhereEnc[name]; ok {
+			prefixes, err := RangePrefixes(bits, v)
+			if err != nil {
+				return DpResponseToSend{}, fmt.Errorf("attribute %s: %v", name, err)
+			}
+			for level, prefix := range prefixes {
+				data, err := (*EncryptInt(encryptionKey, prefix)).ToBytes()
+				if err != nil {
+					return DpResponseToSend{}, err
+				}
+				cr.WhereEnc[RangeColumn(name, int64(level))] = data
+			}
+		}
+	}
+	for _, op := range operations {
+		count = count || op.needsCount()
+	}
+	// the aggregating attributes are encoded with their type, along with their squares when the operations need them
+	var err error
+	cr.AggregatingAttributesClear, err = EncodeAggregatingAttributes(ccr.AggregatingAttributesClear, nil, false, types, operations)
+	if err != nil {
+		return DpResponseToSend{}, err
+	}
+	aggrEnc, err := EncodeAggregatingAttributes(ccr.AggregatingAttributesEnc, ccr.AggregatingAttributesDec, count, types, operations)
+	if err != nil {
+		return DpResponseToSend{}, err
+	}
+
+	cr.AggregatingAttributesEnc = make(map[string][]byte, len(aggrEnc))
+	for i, v := range aggrEnc {
 		data, err := (*EncryptInt(encryptionKey, v)).ToBytes()
 		if err != nil {
 			return DpResponseToSend{}, err
 		}
 		cr.AggregatingAttributesEnc[i] = data
 	}
-	if count {
-		data, err := (*EncryptInt(encryptionKey, int64(1))).ToBytes()
-		if err != nil {
-			return DpResponseToSend{}, err
+
+	return cr, nil
+}
+
+// EncodeAggregatingAttributes encodes the (integer and decimal) values of aggregating attributes with their type, along
+// with their squares when the operations need them and the count column (if count is set). It returns nil if there is
+// no value.
+func EncodeAggregatingAttributes(values map[string]int64, decimals map[string]float64, count bool, types map[string]AttributeType, operations []Operation) (map[string]int64, error) {
+	squares := squaredAttributes(operations)
+	encodeSquare := func(name string, encoded int64, dest map[string]int64) error {
+		if !squares[name] {
+			return nil
 		}
-		cr.AggregatingAttributesEnc["count"] = data
+		if encoded > math.MaxInt32 || encoded < -math.MaxInt32 {
+			return fmt.Errorf("attribute %s: value is too large to be squared", name)
+		}
+		dest[SquareAttribute(name)] = encoded * encoded
+		return nil
 	}
 
-	return cr, nil
+	if values == nil && decimals == nil && !count {
+		return nil, nil
+	}
+
+	encodedValues := make(map[string]int64, len(values)+len(decimals))
+	for i, v := range values {
+		encoded, err := types[i].EncodeInt(v)
+		if err != nil {
+			return nil, fmt.Errorf("attribute %s: %v", i, err)
+		}
+		encodedValues[i] = encoded
+		if err := encodeSquare(i, encoded, encodedValues); err != nil {
+			return nil, err
+		}
+	}
+	for i, v := range decimals {
+		encoded, err := types[i].Encode(v)
+		if err != nil {
+			return nil, fmt.Errorf("attribute %s: %v", i, err)
+		}
+		encodedValues[i] = encoded
+		if err := encodeSquare(i, encoded, encodedValues); err != nil {
+			return nil, err
+		}
+	}
+	if count {
+		encodedValues[CountAttribute] = 1
+	}
+	return encodedValues, nil
 }
 
 // GroupingKey
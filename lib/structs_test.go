@@ -27,8 +27,12 @@ func TestAddClientResponse(t *testing.T) {
 	newCr.AggregatingAttributes = *libunlynx.NewCipherVector(len(cr1.AggregatingAttributes))
 	newCr.Add(cr1, cr2)
 
-	assert.Equal(t, sum, libunlynx.DecryptIntVector(secKey, &newCr.AggregatingAttributes))
-	assert.Equal(t, grouping, libunlynx.DecryptIntVector(secKey, &newCr.GroupByEnc))
+	decrypted, err := libunlynx.DecryptIntVector(secKey, &newCr.AggregatingAttributes)
+	assert.NoError(t, err)
+	assert.Equal(t, sum, decrypted)
+	decrypted, err = libunlynx.DecryptIntVector(secKey, &newCr.GroupByEnc)
+	assert.NoError(t, err)
+	assert.Equal(t, grouping, decrypted)
 }
 
 func TestAddInMap(t *testing.T) {
@@ -61,7 +65,10 @@ func decryptMapBytes(secKey kyber.Scalar, data map[string][]byte) (map[string]in
 		if err != nil {
 			return nil, err
 		}
-		result[k] = libunlynx.DecryptInt(secKey, ct)
+		result[k], err = libunlynx.DecryptInt(secKey, ct)
+		if err != nil {
+			return nil, err
+		}
 	}
 	return result, nil
 }
@@ -86,7 +93,7 @@ func TestEncryptDpClearResponse(t *testing.T) {
 		AggregatingAttributesEnc:   aggrEnc,
 	}
 
-	cr, err := libunlynx.EncryptDpClearResponse(ccr, pubKey, false)
+	cr, err := libunlynx.EncryptDpClearResponse(ccr, pubKey, false, nil, nil, nil)
 	assert.NoError(t, err)
 
 	assert.Equal(t, ccr.GroupByClear, groupingClear)
@@ -103,6 +110,46 @@ func TestEncryptDpClearResponse(t *testing.T) {
 	assert.Equal(t, ccr.AggregatingAttributesEnc, mp)
 }
 
+// TestEncryptDpClearResponseTypes tests the encoding of the aggregating attributes with their type
+func TestEncryptDpClearResponseTypes(t *testing.T) {
+	secKey, pubKey := libunlynx.GenKey()
+
+	types := map[string]libunlynx.AttributeType{"s1": {Kind: libunlynx.TypeSigned}, "s2": {Kind: libunlynx.TypeFixed, Scale: 2}}
+	ccr := libunlynx.DpClearResponse{
+		AggregatingAttributesClear: map[string]int64{"s0": 7},
+		AggregatingAttributesEnc:   map[string]int64{"s1": -3},
+		AggregatingAttributesDec:   map[string]float64{"s2": -1.25},
+	}
+	cr, err := libunlynx.EncryptDpClearResponse(ccr, pubKey, true, types, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{"s0": 7}, cr.AggregatingAttributesClear)
+
+	dpResponse := libunlynx.DpResponse{}
+	assert.NoError(t, dpResponse.FromDpResponseToSend(cr))
+	cv := libunlynx.CipherVector{dpResponse.AggregatingAttributesEnc["s1"], dpResponse.AggregatingAttributesEnc["s2"], dpResponse.AggregatingAttributesEnc["count"]}
+	decrypted, err := libunlynx.DecryptAttributes(secKey, &cv, []libunlynx.AttributeType{types["s1"], types["s2"]})
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{-3, -125, 1}, decrypted)
+	assert.Equal(t, -1.25, types["s2"].Decode(decrypted[1]))
+
+	// the squares and the count needed by the operations are added
+	operations := []libunlynx.Operation{{Op: libunlynx.OpVariance, Attribute: "s2"}}
+	cr, err = libunlynx.EncryptDpClearResponse(ccr, pubKey, false, types, operations, nil)
+	assert.NoError(t, err)
+	dpResponse = libunlynx.DpResponse{}
+	assert.NoError(t, dpResponse.FromDpResponseToSend(cr))
+	cv = libunlynx.CipherVector{dpResponse.AggregatingAttributesEnc["s2^2"], dpResponse.AggregatingAttributesEnc["count"]}
+	decrypted, err = libunlynx.DecryptIntVector(secKey, &cv)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{15625, 1}, decrypted)
+
+	// negative values of unsigned attributes and decimal values of integer attributes are refused
+	_, err = libunlynx.EncryptDpClearResponse(libunlynx.DpClearResponse{AggregatingAttributesEnc: map[string]int64{"s0": -3}}, pubKey, false, types, nil, nil)
+	assert.Error(t, err)
+	_, err = libunlynx.EncryptDpClearResponse(libunlynx.DpClearResponse{AggregatingAttributesDec: map[string]float64{"s1": 0.5}}, pubKey, false, types, nil, nil)
+	assert.Error(t, err)
+}
+
 // TestFilteredResponseConverter tests the FilteredResponse converter (to bytes). In the meantime we also test the Key and UnKey function ... That is the way to go :D
 func TestFilteredResponseConverter(t *testing.T) {
 	grouping := []int64{1}
@@ -118,8 +165,12 @@ func TestFilteredResponseConverter(t *testing.T) {
 	newCr := libunlynx.FilteredResponse{}
 	err = newCr.FromBytes(crb, aabLength, acbLength)
 	assert.NoError(t, err)
-	assert.Equal(t, aggregating, libunlynx.DecryptIntVector(secKey, &newCr.AggregatingAttributes))
-	assert.Equal(t, grouping, libunlynx.DecryptIntVector(secKey, &newCr.GroupByEnc))
+	decrypted, err := libunlynx.DecryptIntVector(secKey, &newCr.AggregatingAttributes)
+	assert.NoError(t, err)
+	assert.Equal(t, aggregating, decrypted)
+	decrypted, err = libunlynx.DecryptIntVector(secKey, &newCr.GroupByEnc)
+	assert.NoError(t, err)
+	assert.Equal(t, grouping, decrypted)
 }
 
 // TestFilteredResponseDetConverter tests the FilteredResponseDet converter (to bytes). In the meantime we also test the Key and UnKey function ... That is the way to go :D
@@ -140,8 +191,12 @@ func TestClientResponseDetConverter(t *testing.T) {
 	gkey, err := libunlynx.UnKey(newCrd.DetTagGroupBy)
 	assert.NoError(t, err)
 	assert.Equal(t, grouping, gkey)
-	assert.Equal(t, aggregating, libunlynx.DecryptIntVector(secKey, &newCrd.Fr.AggregatingAttributes))
-	assert.Equal(t, grouping, libunlynx.DecryptIntVector(secKey, &newCrd.Fr.GroupByEnc))
+	decrypted, err := libunlynx.DecryptIntVector(secKey, &newCrd.Fr.AggregatingAttributes)
+	assert.NoError(t, err)
+	assert.Equal(t, aggregating, decrypted)
+	decrypted, err = libunlynx.DecryptIntVector(secKey, &newCrd.Fr.GroupByEnc)
+	assert.NoError(t, err)
+	assert.Equal(t, grouping, decrypted)
 }
 
 // TestProcessResponseConverter tests the ProcessResponse converter (to bytes).
@@ -163,9 +218,15 @@ func TestProcessResponseConverter(t *testing.T) {
 	newPr := libunlynx.ProcessResponse{}
 	err = newPr.FromBytes(b, gacbLength, aabLength, pgaebLength)
 	assert.NoError(t, err)
-	assert.Equal(t, whereEnc, libunlynx.DecryptIntVector(secKey, &newPr.WhereEnc))
-	assert.Equal(t, grouping, libunlynx.DecryptIntVector(secKey, &newPr.GroupByEnc))
-	assert.Equal(t, aggregating, libunlynx.DecryptIntVector(secKey, &newPr.AggregatingAttributes))
+	decrypted, err := libunlynx.DecryptIntVector(secKey, &newPr.WhereEnc)
+	assert.NoError(t, err)
+	assert.Equal(t, whereEnc, decrypted)
+	decrypted, err = libunlynx.DecryptIntVector(secKey, &newPr.GroupByEnc)
+	assert.NoError(t, err)
+	assert.Equal(t, grouping, decrypted)
+	decrypted, err = libunlynx.DecryptIntVector(secKey, &newPr.AggregatingAttributes)
+	assert.NoError(t, err)
+	assert.Equal(t, aggregating, decrypted)
 }
 
 func TestProcessResponseDetConverter(t *testing.T) {
@@ -242,9 +303,15 @@ func TestDPResponseConverter(t *testing.T) {
 	assert.NoError(t, err)
 
 	for i := 0; i < k; i++ {
-		assert.Equal(t, libunlynx.DecryptInt(secKey, dpResponse.GroupByEnc[strconv.Itoa(i)]), int64(i))
-		assert.Equal(t, libunlynx.DecryptInt(secKey, dpResponse.WhereEnc[strconv.Itoa(i)]), int64(i))
-		assert.Equal(t, libunlynx.DecryptInt(secKey, dpResponse.AggregatingAttributesEnc[strconv.Itoa(i)]), int64(i))
+		decrypted, err := libunlynx.DecryptInt(secKey, dpResponse.GroupByEnc[strconv.Itoa(i)])
+		assert.NoError(t, err)
+		assert.Equal(t, decrypted, int64(i))
+		decrypted, err = libunlynx.DecryptInt(secKey, dpResponse.WhereEnc[strconv.Itoa(i)])
+		assert.NoError(t, err)
+		assert.Equal(t, decrypted, int64(i))
+		decrypted, err = libunlynx.DecryptInt(secKey, dpResponse.AggregatingAttributesEnc[strconv.Itoa(i)])
+		assert.NoError(t, err)
+		assert.Equal(t, decrypted, int64(i))
 		assert.Equal(t, dpResponse.GroupByClear[strconv.Itoa(i)], int64(i))
 		assert.Equal(t, dpResponse.WhereClear[strconv.Itoa(i)], int64(i))
 		assert.Equal(t, dpResponse.AggregatingAttributesClear[strconv.Itoa(i)], int64(i))
@@ -264,6 +331,8 @@ func TestMapBytesToMapCipherText(t *testing.T) {
 	ctMap, err := libunlynx.MapBytesToMapCipherText(bMap)
 	assert.NoError(t, err)
 	for i := 0; i < k; i++ {
-		assert.Equal(t, libunlynx.DecryptInt(secKey, ctMap[strconv.Itoa(i)]), int64(i))
+		decrypted, err := libunlynx.DecryptInt(secKey, ctMap[strconv.Itoa(i)])
+		assert.NoError(t, err)
+		assert.Equal(t, decrypted, int64(i))
 	}
 }
@@ -1,8 +1,90 @@
 package libunlynx
 
 import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+
 	"go.dedis.ch/kyber/v3/suites"
+	"go.dedis.ch/onet/v3/log"
+)
+
+func init() {
+	// e.g. to run the tests with another suite
+	if suite := os.Getenv("UNLYNX_SUITE"); suite != "" {
+		log.ErrFatal(SetSuite(suite), "Couldn't use the suite of UNLYNX_SUITE:")
+	}
+}
+
+// DefaultSuite is the name of the suite used if none is configured
+const DefaultSuite = "Ed25519"
+
+// SupportedSuites are the names of the suites that can be used by the servers and the clients: Ed25519 (the default)
+// and the group G1 of the bn256 pairing (e.g. for BLS signatures)
+var SupportedSuites = []string{DefaultSuite, "bn256.G1"}
+
+// SuiTe is the suite in which all the points and scalars are (the keys, the ciphertexts and the proofs), it is the
+// ed25519 curve unless another one is chosen with SetSuite. It is only written during the initialization of the
+// process, it is read without synchronization afterwards.
+var SuiTe = suites.MustFind(DefaultSuite)
+
+var (
+	// suiteMutex serializes the initialization of the suite
+	suiteMutex sync.Mutex
+	// suiteFrozen is set (to 1) once the suite is chosen or used, it cannot be changed afterwards (see FreezeSuite)
+	suiteFrozen int32
 )
 
-// SuiTe in this case is the ed25519 curve
-var SuiTe = suites.MustFind("Ed25519")
+// FreezeSuite prevents the suite from being changed by SetSuite, it is called as soon as the suite is chosen or used
+// (e.g. by SetSuite, by GenKey, by the decryption or when a server or a client of the services starts).
+func FreezeSuite() {
+	atomic.StoreInt32(&suiteFrozen, 1)
+}
+
+// SetSuite chooses the suite used by the library (case insensitive name, DefaultSuite if empty). It must be called
+// during the initialization of the process (e.g. in main, before a server or a client starts), the suite cannot be
+// changed afterwards: the next calls fail if they choose another suite. The servers and the clients of a roster must
+// use the same suite.
+func SetSuite(name string) error {
+	if name == "" {
+		name = DefaultSuite
+	}
+	supported := false
+	for _, s := range SupportedSuites {
+		if strings.EqualFold(s, name) {
+			supported = true
+		}
+	}
+	if !supported {
+		return fmt.Errorf("unsupported suite %s, the supported suites are %s", name, strings.Join(SupportedSuites, ", "))
+	}
+	suite, err := suites.Find(name)
+	if err != nil {
+		return err
+	}
+
+	suiteMutex.Lock()
+	defer suiteMutex.Unlock()
+	if suite.String() != SuiTe.String() {
+		if atomic.LoadInt32(&suiteFrozen) != 0 {
+			return fmt.Errorf("cannot use the suite %s, the suite %s is already used", suite.String(), SuiTe.String())
+		}
+		SuiTe = suite
+	}
+	FreezeSuite()
+	return nil
+}
+
+// CheckSuite returns an error if name is not the suite used by the library, e.g. to reject the messages built with
+// another suite
+func CheckSuite(name string) error {
+	if name == "" {
+		name = DefaultSuite
+	}
+	if !strings.EqualFold(name, SuiTe.String()) {
+		return fmt.Errorf("wrong suite %s, the suite used is %s", name, SuiTe.String())
+	}
+	return nil
+}
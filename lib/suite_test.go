@@ -0,0 +1,63 @@
+package libunlynx_test
+
+import (
+	"testing"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetSuite(t *testing.T) {
+	suite := libunlynx.SuiTe.String()
+	defer func() {
+		libunlynx.UnfreezeSuite()
+		require.NoError(t, libunlynx.SetSuite(suite))
+	}()
+	libunlynx.UnfreezeSuite()
+
+	assert.Error(t, libunlynx.SetSuite("P256"))
+	assert.Error(t, libunlynx.SetSuite("unknown"))
+	assert.Equal(t, suite, libunlynx.SuiTe.String())
+
+	for _, name := range libunlynx.SupportedSuites {
+		require.NoError(t, libunlynx.SetSuite(name))
+		assert.Equal(t, name, libunlynx.SuiTe.String())
+		assert.NoError(t, libunlynx.CheckSuite(name))
+
+		// the integers are decoded with a table of the suite
+		secKey, pubKey := libunlynx.GenKey()
+		tab := []int64{0, 1, -1, 42, -1000, libunlynx.MaxHomomorphicInt}
+		decrypted, err := libunlynx.DecryptIntVectorWithNeg(secKey, libunlynx.EncryptIntVector(pubKey, tab))
+		require.NoError(t, err)
+		assert.Equal(t, tab, decrypted)
+
+		// serialization
+		ct := libunlynx.EncryptInt(pubKey, 7)
+		b64, err := ct.Serialize()
+		require.NoError(t, err)
+		decoded, err := libunlynx.NewCipherTextFromBase64(b64)
+		require.NoError(t, err)
+		v, err := libunlynx.DecryptInt(secKey, *decoded)
+		require.NoError(t, err)
+		assert.Equal(t, int64(7), v)
+
+		// the suite cannot be changed once keys exist
+		other := libunlynx.SupportedSuites[0]
+		if other == name {
+			other = libunlynx.SupportedSuites[1]
+		}
+		require.NoError(t, libunlynx.SetSuite(name))
+		assert.Error(t, libunlynx.SetSuite(other))
+		assert.Equal(t, name, libunlynx.SuiTe.String())
+		libunlynx.UnfreezeSuite()
+	}
+
+	require.NoError(t, libunlynx.SetSuite(""))
+	assert.Equal(t, libunlynx.DefaultSuite, libunlynx.SuiTe.String())
+	// the suite is chosen once
+	assert.Error(t, libunlynx.SetSuite(libunlynx.SupportedSuites[1]))
+	assert.NoError(t, libunlynx.CheckSuite(""))
+	assert.NoError(t, libunlynx.CheckSuite("ed25519"))
+	assert.Error(t, libunlynx.CheckSuite(libunlynx.SupportedSuites[1]))
+}
@@ -3,6 +3,7 @@ package libunlynxtools
 import (
 	"encoding/binary"
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"os"
 	"strconv"
@@ -26,7 +27,7 @@ func SendISMOthers(s *onet.ServiceProcessor, el *onet.Roster, msg interface{}) e
 	}
 	var err error
 	if len(errStrs) > 0 {
-		err = fmt.Errorf(strings.Join(errStrs, "\n"))
+		err = errors.New(strings.Join(errStrs, "\n"))
 	}
 	return err
 }
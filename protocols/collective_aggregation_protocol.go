@@ -15,6 +15,7 @@ import (
 
 	"github.com/ldsec/unlynx/lib"
 	"github.com/ldsec/unlynx/lib/aggregation"
+	"go.dedis.ch/kyber/v3"
 	"go.dedis.ch/onet/v3"
 	"go.dedis.ch/onet/v3/log"
 	"go.dedis.ch/onet/v3/network"
@@ -104,6 +105,10 @@ type CollectiveAggregationProtocol struct {
 	GroupedData *map[libunlynx.GroupingKey]libunlynx.FilteredResponse
 	SimpleData  *[]libunlynx.CipherText
 
+	// CollectiveKey replaces the aggregate key of the roster if the data is encrypted under another key (e.g. generated
+	// by the DKG protocol)
+	CollectiveKey kyber.Point
+
 	// Proofs
 	Proofs    bool
 	ProofFunc proofCollectiveAggregationFunction // proof function for when we want to do something different with the proofs (e.g. insert in the blockchain)
@@ -201,7 +206,7 @@ func (p *CollectiveAggregationProtocol) aggregationAnnouncementPhase() error {
 			return fmt.Errorf("error sending <DataReferenceMessage>: %v", err)
 		}
 	case <-time.After(libunlynx.TIMEOUT):
-		return fmt.Errorf(p.ServerIdentity().String() + " didn't get the <dataReferenceMessage> on time")
+		return fmt.Errorf("%s didn't get the <dataReferenceMessage> on time", p.ServerIdentity())
 	}
 	return nil
 }
@@ -239,8 +244,12 @@ func (p *CollectiveAggregationProtocol) ascendingAggregationPhase(cvMap map[libu
 				if ok {
 					if len(localAggr.AggregatingAttributes) != len(aggr.Fr.AggregatingAttributes) {
 						encZeros := make(libunlynx.CipherVector, int(math.Abs(float64(len(localAggr.AggregatingAttributes)-len(aggr.Fr.AggregatingAttributes)))))
+						collectiveKey := p.Roster().Aggregate
+						if p.CollectiveKey != nil {
+							collectiveKey = p.CollectiveKey
+						}
 						for e := range encZeros {
-							encZeros[e] = *libunlynx.EncryptInt(p.Roster().Aggregate, 0)
+							encZeros[e] = *libunlynx.EncryptInt(collectiveKey, 0)
 						}
 						if len(localAggr.AggregatingAttributes) > len(aggr.Fr.AggregatingAttributes) {
 							aggr.Fr.AggregatingAttributes = append(aggr.Fr.AggregatingAttributes, encZeros...)
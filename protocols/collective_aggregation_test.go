@@ -63,13 +63,17 @@ func TestCollectiveAggregationGroup(t *testing.T) {
 		log.Lvl1("Received results:")
 		resultData := make(map[libunlynx.GroupingKey][]int64)
 		for k, v := range encryptedResult.GroupedData {
-			resultData[k] = libunlynx.DecryptIntVector(clientPrivate, &v.AggregatingAttributes)
+			var err error
+			resultData[k], err = libunlynx.DecryptIntVector(clientPrivate, &v.AggregatingAttributes)
+			assert.NoError(t, err)
 			log.Lvl1(k, resultData[k])
 		}
 		for k, v1 := range expectedGroups {
 			if v2, ok := encryptedResult.GroupedData[k]; ok {
 				assert.True(t, ok)
-				assert.True(t, reflect.DeepEqual(v1, libunlynx.DecryptIntVector(clientPrivate, &v2.GroupByEnc)))
+				decrypted, err := libunlynx.DecryptIntVector(clientPrivate, &v2.GroupByEnc)
+				assert.NoError(t, err)
+				assert.True(t, reflect.DeepEqual(v1, decrypted))
 				delete(encryptedResult.GroupedData, k)
 			}
 		}
@@ -141,7 +145,8 @@ func TestCollectiveAggregationSimple(t *testing.T) {
 		log.Lvl1("Received results:")
 		resultData := make([]int64, len(encryptedResult.GroupedData[protocolsunlynx.EMPTYKEY].AggregatingAttributes))
 		aggrAttr := encryptedResult.GroupedData[protocolsunlynx.EMPTYKEY].AggregatingAttributes
-		resultData = libunlynx.DecryptIntVector(clientPrivate, &aggrAttr)
+		resultData, err := libunlynx.DecryptIntVector(clientPrivate, &aggrAttr)
+		assert.NoError(t, err)
 		log.Lvl1(resultData)
 		assert.Equal(t, expectedResults, resultData)
 	case <-time.After(timeout):
@@ -223,7 +228,8 @@ func TestCollectiveAggregationDiffSizes(t *testing.T) {
 		for i := 1; i < len(roster.List); i++ {
 			aggrSk.Add(aggrSk, roster.List[i].GetPrivate())
 		}
-		resultData = libunlynx.DecryptIntVector(aggrSk, &aggrAttr)
+		resultData, err := libunlynx.DecryptIntVector(aggrSk, &aggrAttr)
+		assert.NoError(t, err)
 		assert.Equal(t, expectedResults, resultData)
 	case <-time.After(timeout):
 		t.Fatal("Didn't finish in time")
@@ -4,6 +4,8 @@
 // the ciphertexts with an ephemeral secret.
 // This protocol operates in a circuit between the servers: the data is sent sequentially through this circuit and each
 // server applies its transformation.
+// The ciphertexts are streamed in chunks from a server to the next one, each chunk is transformed and forwarded as soon
+// as it arrives.
 package protocolsunlynx
 
 import (
@@ -24,8 +26,6 @@ const DeterministicTaggingProtocolName = "DeterministicTagging"
 
 func init() {
 	network.RegisterMessage(DeterministicTaggingMessage{})
-	network.RegisterMessage(DeterministicTaggingBytesMessage{})
-	network.RegisterMessage(DTBLengthMessage{})
 	network.RegisterMessage(libunlynx.ProcessResponseDet{})
 	_, err := onet.GlobalProtocolRegister(DeterministicTaggingProtocolName, NewDeterministicTaggingProtocol)
 	log.ErrFatal(err, "Failed to register the <DeterministicTagging> protocol:")
@@ -40,35 +40,27 @@ type GroupingAttributes struct {
 }
 
 // DeterministicTaggingMessage represents a deterministic tagging message containing the processed cipher vectors DP
-// responses.
+// responses (a chunk of them once in bytes).
 type DeterministicTaggingMessage struct {
 	Data libunlynx.CipherVector
 }
 
-// DeterministicTaggingBytesMessage represents a deterministic tagging message in bytes
-type DeterministicTaggingBytesMessage struct {
-	Data []byte
-}
-
-// DTBLengthMessage represents a message containing the lengths of a DeterministicTaggingMessageBytes message
-type DTBLengthMessage struct {
-	CVLengths []byte
-}
-
-// Structs
+// Streams
 //______________________________________________________________________________________________________________________
 
-// deterministicTaggingStructBytes is a deterministicTaggingStruct in bytes
-type deterministicTaggingBytesStruct struct {
-	*onet.TreeNode
-	DeterministicTaggingBytesMessage
-}
+// The ciphertexts go twice through the circuit: stream 0 is sent by the root (Start) and then by the other nodes during
+// the first round, stream 1 is sent by the root at the end of the first round and then by the other nodes during the
+// second round.
+const (
+	firstRoundStream  = int64(0)
+	secondRoundStream = int64(1)
+)
 
-// dtmbLengthStruct is a structure containing a message for message length
-type dtmbLengthStruct struct {
-	*onet.TreeNode
-	DTBLengthMessage
-}
+// proofDeterministicTaggingAdditionFunction defines a function that does 'stuff' with the deterministic tagging addition proofs
+type proofDeterministicTaggingAdditionFunction func([]kyber.Point, []kyber.Scalar, []kyber.Point, []kyber.Point) *libunlynxdetertag.PublishedDDTAdditionListProof
+
+// proofDeterministicTaggingCreationFunction defines a function that does 'stuff' with the deterministic tagging creation proofs
+type proofDeterministicTaggingCreationFunction func(libunlynx.CipherVector, libunlynx.CipherVector, kyber.Point, kyber.Scalar, kyber.Scalar) *libunlynxdetertag.PublishedDDTCreationListProof
 
 // Protocol
 //______________________________________________________________________________________________________________________
@@ -80,15 +72,23 @@ type DeterministicTaggingProtocol struct {
 	// Protocol feedback channel
 	FeedbackChannel chan []libunlynx.DeterministCipherText
 
-	// Protocol communication channels
-	PreviousNodeInPathChannel chan deterministicTaggingBytesStruct
-	LengthNodeChannel         chan dtmbLengthStruct
+	// Protocol communication
+	*streamer
 
 	// Protocol state data
-	nextNodeInCircuit *onet.TreeNode
-	TargetOfSwitch    *libunlynx.CipherVector
-	SurveySecretKey   *kyber.Scalar
+	nextNodeInCircuit     *onet.TreeNode
+	previousNodeInCircuit *onet.TreeNode
+	TargetOfSwitch        *libunlynx.CipherVector
+	SurveySecretKey       *kyber.Scalar
+
+	// SecretKey replaces the private key of the server if the data is encrypted under another collective key (e.g. the
+	// share of a key generated by the DKG protocol multiplied by its Lagrange coefficient)
+	SecretKey kyber.Scalar
+
+	// Proofs
 	Proofs            bool
+	AdditionProofFunc proofDeterministicTaggingAdditionFunction // proof functions for when we want to do something different with the proofs (e.g. publish them to the other servers)
+	CreationProofFunc proofDeterministicTaggingCreationFunction
 
 	ExecTime time.Duration
 }
@@ -98,13 +98,28 @@ func NewDeterministicTaggingProtocol(n *onet.TreeNodeInstance) (onet.ProtocolIns
 	dsp := &DeterministicTaggingProtocol{
 		TreeNodeInstance: n,
 		FeedbackChannel:  make(chan []libunlynx.DeterministCipherText),
+		// by default the proofs are only created
+		AdditionProofFunc: func(c1List []kyber.Point, sList []kyber.Scalar, c2List []kyber.Point, rList []kyber.Point) *libunlynxdetertag.PublishedDDTAdditionListProof {
+			proof, err := libunlynxdetertag.DeterministicTagAdditionListProofCreation(c1List, sList, c2List, rList)
+			if err != nil {
+				log.Error(err)
+				return nil
+			}
+			return &proof
+		},
+		CreationProofFunc: func(vBef, vAft libunlynx.CipherVector, K kyber.Point, k, s kyber.Scalar) *libunlynxdetertag.PublishedDDTCreationListProof {
+			proof, err := libunlynxdetertag.DeterministicTagCrListProofCreation(vBef, vAft, K, k, s)
+			if err != nil {
+				log.Error(err)
+				return nil
+			}
+			return &proof
+		},
 	}
 
-	if err := dsp.RegisterChannel(&dsp.PreviousNodeInPathChannel); err != nil {
-		return nil, fmt.Errorf("couldn't register data reference channel: %v", err)
-	}
-	if err := dsp.RegisterChannel(&dsp.LengthNodeChannel); err != nil {
-		return nil, fmt.Errorf("couldn't register data reference channel: %v", err)
+	var err error
+	if dsp.streamer, err = newStreamer(n); err != nil {
+		return nil, err
 	}
 
 	var i int
@@ -113,6 +128,7 @@ func NewDeterministicTaggingProtocol(n *onet.TreeNodeInstance) (onet.ProtocolIns
 	for i, node = range nodeList {
 		if n.TreeNode().Equal(node) {
 			dsp.nextNodeInCircuit = nodeList[(i+1)%len(nodeList)]
+			dsp.previousNodeInCircuit = nodeList[(i+len(nodeList)-1)%len(nodeList)]
 			break
 		}
 	}
@@ -137,180 +153,230 @@ func (p *DeterministicTaggingProtocol) Start() error {
 
 	log.Lvl1("["+p.Name()+"]", " starts a Deterministic Tagging Protocol on ", nbrCipherText, " element(s)")
 
-	// create CipherVector with deterministic tag, at first step the tag creation part is a copy of the proba
-	detTarget := make(libunlynx.CipherVector, nbrCipherText)
-	copy(detTarget, *p.TargetOfSwitch)
+	// at first step the tag creation part is a copy of the proba (the ciphertexts are copied when they are converted
+	// to bytes)
 	libunlynx.EndTimer(roundTotalStart)
 
-	err := sendingDet(*p, DeterministicTaggingMessage{detTarget})
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return p.sendToNext(firstRoundStream, *p.TargetOfSwitch)
 }
 
 // Dispatch is called on each tree node. It waits for incoming messages and handles them.
 func (p *DeterministicTaggingProtocol) Dispatch() error {
 	defer p.Done()
 
-	//************ ----- first round, add value derivated from ephemeral secret to message ---- ********************
-	var deterministicTaggingTargetBytesBef deterministicTaggingBytesStruct
-	select {
-	case deterministicTaggingTargetBytesBef = <-p.PreviousNodeInPathChannel:
-	case <-time.After(libunlynx.TIMEOUT):
-		return fmt.Errorf(p.ServerIdentity().String() + " didn't get the <deterministicTaggingTargetBytesBef> (first round) on time")
+	// the two rounds run at the same time: the first chunks can be in the second round while the next ones are still
+	// in the first round
+	var additionTime, creationTime time.Duration
+	var additionErr, creationErr error
+	var TaggedData []libunlynx.DeterministCipherText
+
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		additionTime, additionErr = p.additionRound()
+	}()
+	go func() {
+		defer wg.Done()
+		TaggedData, creationTime, creationErr = p.creationRound()
+	}()
+	wg.Wait()
+
+	if additionErr != nil {
+		return additionErr
+	}
+	if creationErr != nil {
+		return creationErr
 	}
 
-	deterministicTaggingTargetBef := DeterministicTaggingMessage{Data: make([]libunlynx.CipherText, 0)}
-	err := deterministicTaggingTargetBef.FromBytes(deterministicTaggingTargetBytesBef.Data)
-	if err != nil {
-		return err
+	// If this tree node is the root, then protocol reached the end.
+	if p.IsRoot() {
+		p.ExecTime += additionTime + creationTime
+		p.FeedbackChannel <- TaggedData
 	}
 
-	startT := time.Now()
+	return nil
+}
+
+// additionRound is the first round: it adds a value derivated from the ephemeral secret to each chunk (and returns the
+// computation time)
+func (p *DeterministicTaggingProtocol) additionRound() (time.Duration, error) {
 	toAdd := libunlynx.SuiTe.Point().Mul(*p.SurveySecretKey, libunlynx.SuiTe.Point().Base())
 
-	mutex := sync.Mutex{}
-	wg := sync.WaitGroup{}
-	for i := 0; i < len(deterministicTaggingTargetBef.Data); i += libunlynx.VPARALLELIZE {
-		wg.Add(1)
-		go func(i int) {
-			defer wg.Done()
-			for j := 0; j < libunlynx.VPARALLELIZE && (i+j) < len(deterministicTaggingTargetBef.Data); j++ {
-				r := libunlynx.SuiTe.Point().Add(deterministicTaggingTargetBef.Data[i+j].C, toAdd)
-				if p.Proofs {
-					_, tmpErr := libunlynxdetertag.DeterministicTagAdditionProofCreation(deterministicTaggingTargetBef.Data[i+j].C, *p.SurveySecretKey, toAdd, r)
-					if tmpErr != nil {
-						mutex.Lock()
-						err = tmpErr
-						mutex.Unlock()
-						return
+	// the root starts the second round
+	outStream := firstRoundStream
+	if p.IsRoot() {
+		outStream = secondRoundStream
+	}
+
+	var c1List, rList []kyber.Point
+	var execTime time.Duration
+	err := p.receiveStream(p.previousNodeInCircuit, firstRoundStream, func(chunk StreamChunkMessage) error {
+		deterministicTaggingTargetBef := DeterministicTaggingMessage{Data: make([]libunlynx.CipherText, 0)}
+		if err := deterministicTaggingTargetBef.FromBytes(chunk.Data); err != nil {
+			return err
+		}
+
+		startT := time.Now()
+		nbrAdditions := len(deterministicTaggingTargetBef.Data)
+		offset := len(c1List)
+		if p.Proofs {
+			c1List = append(c1List, make([]kyber.Point, nbrAdditions)...)
+			rList = append(rList, make([]kyber.Point, nbrAdditions)...)
+		}
+
+		wg := sync.WaitGroup{}
+		for i := 0; i < nbrAdditions; i += libunlynx.VPARALLELIZE {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < libunlynx.VPARALLELIZE && (i+j) < nbrAdditions; j++ {
+					r := libunlynx.SuiTe.Point().Add(deterministicTaggingTargetBef.Data[i+j].C, toAdd)
+					if p.Proofs {
+						c1List[offset+i+j] = deterministicTaggingTargetBef.Data[i+j].C
+						rList[offset+i+j] = r
 					}
+					deterministicTaggingTargetBef.Data[i+j].C = r
 				}
-				deterministicTaggingTargetBef.Data[i+j].C = r
-			}
-		}(i)
-	}
-	wg.Wait()
+			}(i)
+		}
+		wg.Wait()
+		execTime += time.Since(startT)
+
+		return p.sendChunkToNext(outStream, chunk, deterministicTaggingTargetBef)
+	})
 	if err != nil {
-		return err
+		return 0, err
+	}
+
+	if p.Proofs {
+		sList := make([]kyber.Scalar, len(c1List))
+		c2List := make([]kyber.Point, len(c1List))
+		for i := range sList {
+			sList[i] = *p.SurveySecretKey
+			c2List[i] = toAdd
+		}
+		p.AdditionProofFunc(c1List, sList, c2List, rList)
 	}
 
 	log.Lvl1(p.ServerIdentity(), " preparation round for deterministic tagging")
+	return execTime, nil
+}
+
+// creationRound is the second round: it creates the deterministic tags chunk by chunk, the root returns them (and the
+// computation time)
+func (p *DeterministicTaggingProtocol) creationRound() ([]libunlynx.DeterministCipherText, time.Duration, error) {
+	roundTotalComputation := libunlynx.StartTimer(p.Name() + "_DetTagging(DISPATCH)")
+
+	secretKey, publicKey := p.Private(), p.Public()
+	if p.SecretKey != nil {
+		secretKey, publicKey = p.SecretKey, libunlynx.SuiTe.Point().Mul(p.SecretKey, nil)
+	}
 
+	var taggingBef, taggingAft libunlynx.CipherVector
+	var TaggedData []libunlynx.DeterministCipherText
 	if p.IsRoot() {
-		p.ExecTime += time.Since(startT)
+		TaggedData = make([]libunlynx.DeterministCipherText, 0)
 	}
-	err = sendingDet(*p, deterministicTaggingTargetBef)
+
+	var execTime time.Duration
+	err := p.receiveStream(p.previousNodeInCircuit, secondRoundStream, func(chunk StreamChunkMessage) error {
+		deterministicTaggingTarget := DeterministicTaggingMessage{Data: make([]libunlynx.CipherText, 0)}
+		if err := deterministicTaggingTarget.FromBytes(chunk.Data); err != nil {
+			return err
+		}
+
+		startT := time.Now()
+		if p.Proofs {
+			taggingBef = append(taggingBef, deterministicTaggingTarget.Data...)
+		}
+
+		if err := taggingDetChunk(deterministicTaggingTarget.Data, secretKey, *p.SurveySecretKey, publicKey); err != nil {
+			return err
+		}
+
+		if p.Proofs {
+			taggingAft = append(taggingAft, deterministicTaggingTarget.Data...)
+		}
+		execTime += time.Since(startT)
+
+		if p.IsRoot() {
+			for _, v := range deterministicTaggingTarget.Data {
+				TaggedData = append(TaggedData, libunlynx.DeterministCipherText{Point: v.C})
+			}
+			return nil
+		}
+		return p.sendChunkToNext(secondRoundStream, chunk, deterministicTaggingTarget)
+	})
 	if err != nil {
-		return err
+		return nil, 0, err
 	}
 
-	//************ ----- second round, deterministic tag creation  ---- ********************
-	var deterministicTaggingTargetBytes deterministicTaggingBytesStruct
-	select {
-	case deterministicTaggingTargetBytes = <-p.PreviousNodeInPathChannel:
-	case <-time.After(libunlynx.TIMEOUT):
-		return fmt.Errorf(p.ServerIdentity().String() + " didn't get the <deterministicTaggingTargetBytes> (second round) on time")
+	if p.Proofs {
+		p.CreationProofFunc(taggingBef, taggingAft, publicKey, secretKey, *p.SurveySecretKey)
 	}
 
-	deterministicTaggingTarget := DeterministicTaggingMessage{Data: make([]libunlynx.CipherText, 0)}
-	err = deterministicTaggingTarget.FromBytes(deterministicTaggingTargetBytes.Data)
-	if err != nil {
-		return err
+	if p.IsRoot() {
+		log.Lvl1(p.ServerIdentity(), " completed deterministic Tagging (", len(TaggedData), "row )")
+	} else {
+		log.Lvl1(p.ServerIdentity(), " carried on deterministic Tagging.")
 	}
 
-	startT = time.Now()
-	roundTotalComputation := libunlynx.StartTimer(p.Name() + "_DetTagging(DISPATCH)")
+	libunlynx.EndTimer(roundTotalComputation)
+	return TaggedData, execTime, nil
+}
 
-	wg = sync.WaitGroup{}
-	for i := 0; i < len(deterministicTaggingTarget.Data); i += libunlynx.VPARALLELIZE {
+// taggingDetChunk creates the deterministic tag contribution of a server on a chunk of ciphertexts (in parallel)
+func taggingDetChunk(data libunlynx.CipherVector, secretKey, surveySecretKey kyber.Scalar, publicKey kyber.Point) error {
+	var err error
+	mutex := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for i := 0; i < len(data); i += libunlynx.VPARALLELIZE {
 		wg.Add(1)
 		go func(i int) {
 			defer wg.Done()
 			j := i + libunlynx.VPARALLELIZE
-			if j > len(deterministicTaggingTarget.Data) {
-				j = len(deterministicTaggingTarget.Data)
+			if j > len(data) {
+				j = len(data)
 			}
-			cv := deterministicTaggingTarget.Data[i:j]
-			tmpErr := TaggingDet(&cv, p.Private(), *p.SurveySecretKey, p.Public(), p.Proofs)
+			cv := data[i:j]
+			tmpErr := TaggingDet(&cv, secretKey, surveySecretKey, publicKey, false)
 			if tmpErr != nil {
 				mutex.Lock()
 				err = tmpErr
 				mutex.Unlock()
 				return
 			}
-			copy(deterministicTaggingTarget.Data[i:j], cv)
+			copy(data[i:j], cv)
 		}(i)
 	}
 	wg.Wait()
-	if err != nil {
-		return err
-	}
-
-	var TaggedData []libunlynx.DeterministCipherText
-
-	if p.IsRoot() {
-		detCreatedData := deterministicTaggingTarget.Data
-		TaggedData = make(libunlynx.DeterministCipherVector, len(*p.TargetOfSwitch))
-
-		for i, v := range detCreatedData {
-			TaggedData[i] = libunlynx.DeterministCipherText{Point: v.C}
-		}
-
-		log.Lvl1(p.ServerIdentity(), " completed deterministic Tagging (", len(detCreatedData), "row )")
-	} else {
-		log.Lvl1(p.ServerIdentity(), " carried on deterministic Tagging.", len(deterministicTaggingTarget.Data))
-	}
-
-	libunlynx.EndTimer(roundTotalComputation)
-
-	if p.IsRoot() {
-		p.ExecTime += time.Since(startT)
-	}
-
-	// If this tree node is the root, then protocol reached the end.
-	if p.IsRoot() {
-		p.FeedbackChannel <- TaggedData
-	} else {
-		err := sendingDet(*p, deterministicTaggingTarget)
-		if err != nil {
-			return err
-		}
-	}
-
-	return nil
+	return err
 }
 
-// sendToNext sends the message msg to the next node in the circuit based on the next TreeNode in Tree.List() If not visited yet.
-// If the message already visited the next node, doesn't send and returns false. Otherwise, return true.
-func (p *DeterministicTaggingProtocol) sendToNext(msg interface{}) error {
-	err := p.SendTo(p.nextNodeInCircuit, msg)
-	if err != nil {
-		return err
-	}
-	return nil
+// sendToNext streams the ciphertexts to the next node in the circuit based on the next TreeNode in Tree.List().
+func (p *DeterministicTaggingProtocol) sendToNext(stream int64, data libunlynx.CipherVector) error {
+	return p.sendStream(p.nextNodeInCircuit, stream, len(data), func(from, to int) ([]byte, []byte, error) {
+		detTarget := DeterministicTaggingMessage{Data: data[from:to]}
+		b, err := detTarget.ToBytes()
+		return b, nil, err
+	})
 }
 
-// sendingDet sends DeterministicTaggingBytes messages
-func sendingDet(p DeterministicTaggingProtocol, detTarget DeterministicTaggingMessage) error {
+// sendChunkToNext forwards a chunk received (once transformed) to the next node in the circuit
+func (p *DeterministicTaggingProtocol) sendChunkToNext(stream int64, received StreamChunkMessage, detTarget DeterministicTaggingMessage) error {
 	data, err := detTarget.ToBytes()
 	if err != nil {
 		return err
 	}
-	err = p.sendToNext(&DeterministicTaggingBytesMessage{Data: data})
-	if err != nil {
-		return err
-	}
-	return nil
+	return p.sendChunk(p.nextNodeInCircuit, &StreamChunkMessage{Stream: stream, Index: received.Index, Last: received.Last, Data: data})
 }
 
 // TaggingDet performs one step in the distributed deterministic tagging process and creates corresponding proof
 func TaggingDet(cv *libunlynx.CipherVector, privKey, secretContrib kyber.Scalar, pubKey kyber.Point, proofs bool) error {
 	switchedVect := libunlynxdetertag.DeterministicTagSequence(*cv, privKey, secretContrib)
 	if proofs {
-		_, err := libunlynxdetertag.DeterministicTagCrListProofCreation(*cv, switchedVect, pubKey, secretContrib, privKey)
+		_, err := libunlynxdetertag.DeterministicTagCrListProofCreation(*cv, switchedVect, pubKey, privKey, secretContrib)
 		if err != nil {
 			return err
 		}
@@ -2,12 +2,15 @@ package protocolsunlynx_test
 
 import (
 	"reflect"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/lib/deterministic_tag"
 	"github.com/ldsec/unlynx/protocols"
 	"github.com/stretchr/testify/assert"
+	"go.dedis.ch/kyber/v3"
 	"go.dedis.ch/kyber/v3/util/random"
 	"go.dedis.ch/onet/v3"
 	"go.dedis.ch/onet/v3/log"
@@ -101,6 +104,7 @@ func TestDeterministicTagging(t *testing.T) {
 		}
 		assert.True(t, threeSame == 6)
 		assert.True(t, threeSame1 == 6)
+		assert.Equal(t, int32(0), atomic.LoadInt32(&detTagWrongProofs))
 		for _, v := range goodFormatResult {
 			log.Lvl1(v)
 		}
@@ -111,11 +115,28 @@ func TestDeterministicTagging(t *testing.T) {
 
 }
 
+// detTagWrongProofs counts the proofs created during the test that cannot be verified
+var detTagWrongProofs int32
+
 // NewDeterministicTaggingTest is a special purpose protocol constructor specific to tests.
 func NewDeterministicTaggingTest(tni *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
 	pi, err := protocolsunlynx.NewDeterministicTaggingProtocol(tni)
 	protocol := pi.(*protocolsunlynx.DeterministicTaggingProtocol)
 	protocol.Proofs = true
+	protocol.AdditionProofFunc = func(c1List []kyber.Point, sList []kyber.Scalar, c2List []kyber.Point, rList []kyber.Point) *libunlynxdetertag.PublishedDDTAdditionListProof {
+		proof, err := libunlynxdetertag.DeterministicTagAdditionListProofCreation(c1List, sList, c2List, rList)
+		if err != nil || !libunlynxdetertag.DeterministicTagAdditionListProofVerification(proof, 1.0) {
+			atomic.AddInt32(&detTagWrongProofs, 1)
+		}
+		return &proof
+	}
+	protocol.CreationProofFunc = func(vBef, vAft libunlynx.CipherVector, K kyber.Point, k, s kyber.Scalar) *libunlynxdetertag.PublishedDDTCreationListProof {
+		proof, err := libunlynxdetertag.DeterministicTagCrListProofCreation(vBef, vAft, K, k, s)
+		if err != nil || !libunlynxdetertag.DeterministicTagCrListProofVerification(proof, 1.0) {
+			atomic.AddInt32(&detTagWrongProofs, 1)
+		}
+		return &proof
+	}
 	clientPrivate := libunlynx.SuiTe.Scalar().Pick(random.New())
 	protocol.SurveySecretKey = &clientPrivate
 
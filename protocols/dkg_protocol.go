@@ -0,0 +1,279 @@
+// Package protocolsunlynx implements the distributed key generation protocol.
+// It permits the servers to generate a collective key whose secret is shared among them (Pedersen DKG with Feldman
+// commitments): each server gets a share of the secret and any t of them can use it (e.g. in the threshold key
+// switching protocol), while less than t servers learn nothing about it.
+// Every server deals shares of a random secret to the others and broadcasts its responses to the deals it receives.
+// Once all the deals are certified, each server computes its share of the collective secret.
+package protocolsunlynx
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ldsec/unlynx/lib"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/share/dkg/pedersen"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+)
+
+// DKGProtocolName is the registered name for the distributed key generation protocol.
+const DKGProtocolName = "DKG"
+
+func init() {
+	network.RegisterMessage(DKGStartMessage{})
+	network.RegisterMessage(DKGDealMessage{})
+	network.RegisterMessage(DKGResponseMessage{})
+	network.RegisterMessage(DKGDoneMessage{})
+	_, err := onet.GlobalProtocolRegister(DKGProtocolName, NewDKGProtocol)
+	log.ErrFatal(err, "Failed to register the <DKG> protocol:")
+}
+
+// Messages
+//______________________________________________________________________________________________________________________
+
+// DKGStartMessage is sent by the root to start the generation of a key shared with threshold Threshold
+type DKGStartMessage struct {
+	Threshold int64
+}
+
+// DKGDealMessage contains the deal of a server for another one
+type DKGDealMessage struct {
+	Deal dkg.Deal
+}
+
+// DKGResponseMessage contains the response of a server to a deal, it is sent to all the servers
+type DKGResponseMessage struct {
+	Response dkg.Response
+}
+
+// DKGDoneMessage is sent to the root by a server once it has its share of the key
+type DKGDoneMessage struct {
+	Public kyber.Point
+}
+
+// Structs
+//______________________________________________________________________________________________________________________
+
+// DKGStartStruct struct used to send DKGStartMessage
+type DKGStartStruct struct {
+	*onet.TreeNode
+	DKGStartMessage
+}
+
+// DKGDealStruct struct used to send DKGDealMessage
+type DKGDealStruct struct {
+	*onet.TreeNode
+	DKGDealMessage
+}
+
+// DKGResponseStruct struct used to send DKGResponseMessage
+type DKGResponseStruct struct {
+	*onet.TreeNode
+	DKGResponseMessage
+}
+
+// DKGDoneStruct struct used to send DKGDoneMessage
+type DKGDoneStruct struct {
+	*onet.TreeNode
+	DKGDoneMessage
+}
+
+// Protocol
+//______________________________________________________________________________________________________________________
+
+// DKGProtocol generates a collective key shared among the servers of the roster (in the order of the roster).
+type DKGProtocol struct {
+	*onet.TreeNodeInstance
+
+	// Protocol feedback channel (root), receives the share of the root once all the servers have theirs
+	FeedbackChannel chan *dkg.DistKeyShare
+
+	// Protocol communication channels
+	StartChannel    chan DKGStartStruct
+	DealChannel     chan DKGDealStruct
+	ResponseChannel chan DKGResponseStruct
+	DoneChannel     chan DKGDoneStruct
+
+	// Threshold is the number of shares needed to use the key (set at the root)
+	Threshold int
+
+	// Share is the share of this server, ShareFunc is called with it once it is generated
+	Share     *dkg.DistKeyShare
+	ShareFunc func(*dkg.DistKeyShare)
+}
+
+// NewDKGProtocol initializes the protocol instance.
+func NewDKGProtocol(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+	p := &DKGProtocol{
+		TreeNodeInstance: n,
+		FeedbackChannel:  make(chan *dkg.DistKeyShare, 1),
+	}
+
+	// every server receives a deal and a response to each deal from each other server
+	size := len(n.Roster().List)
+	if err := p.RegisterChannel(&p.StartChannel); err != nil {
+		return nil, fmt.Errorf("couldn't register start channel: %v", err)
+	}
+	if err := p.RegisterChannelLength(&p.DealChannel, size); err != nil {
+		return nil, fmt.Errorf("couldn't register deal channel: %v", err)
+	}
+	if err := p.RegisterChannelLength(&p.ResponseChannel, size*size); err != nil {
+		return nil, fmt.Errorf("couldn't register response channel: %v", err)
+	}
+	if err := p.RegisterChannelLength(&p.DoneChannel, size); err != nil {
+		return nil, fmt.Errorf("couldn't register done channel: %v", err)
+	}
+	return p, nil
+}
+
+// Start is called at the root to begin the execution of the protocol.
+func (p *DKGProtocol) Start() error {
+	if p.Threshold < 1 || p.Threshold > len(p.Roster().List) {
+		return fmt.Errorf("wrong threshold %d for %d servers", p.Threshold, len(p.Roster().List))
+	}
+	log.Lvl2("[DKG PROTOCOL] <UnLynx> Server", p.ServerIdentity(), " started a distributed key generation")
+
+	for _, tn := range p.List() {
+		if tn.ID.Equal(p.TreeNode().ID) {
+			continue
+		}
+		if err := p.SendTo(tn, &DKGStartMessage{Threshold: int64(p.Threshold)}); err != nil {
+			return fmt.Errorf("Root %s failed to send DKGStartMessage: %v", p.ServerIdentity(), err)
+		}
+	}
+	p.StartChannel <- DKGStartStruct{TreeNode: p.TreeNode(), DKGStartMessage: DKGStartMessage{Threshold: int64(p.Threshold)}}
+	return nil
+}
+
+// Dispatch is called at each node and handle incoming messages.
+func (p *DKGProtocol) Dispatch() error {
+	defer p.Done()
+
+	// the root sends the start message to itself once the protocol is started
+	select {
+	case start := <-p.StartChannel:
+		p.Threshold = int(start.Threshold)
+	case <-time.After(libunlynx.TIMEOUT):
+		return fmt.Errorf("%s didn't get the <DKGStartMessage> on time", p.ServerIdentity())
+	}
+
+	share, err := p.generateShare()
+	if err != nil {
+		return err
+	}
+	p.Share = share
+	if p.ShareFunc != nil {
+		p.ShareFunc(share)
+	}
+
+	if !p.IsRoot() {
+		return p.SendTo(p.Root(), &DKGDoneMessage{Public: share.Public()})
+	}
+
+	for i := 0; i < len(p.List())-1; i++ {
+		select {
+		case done := <-p.DoneChannel:
+			if !done.Public.Equal(share.Public()) {
+				return fmt.Errorf("server %s generated another key", done.ServerIdentity)
+			}
+		case <-time.After(libunlynx.TIMEOUT):
+			return fmt.Errorf("%s didn't get the <DKGDoneMessage> on time", p.ServerIdentity())
+		}
+	}
+	p.FeedbackChannel <- share
+	return nil
+}
+
+// treeNode returns the tree node of the i-th server of the roster
+func (p *DKGProtocol) treeNode(i int) (*onet.TreeNode, error) {
+	for _, tn := range p.List() {
+		if tn.ServerIdentity.Equal(p.Roster().List[i]) {
+			return tn, nil
+		}
+	}
+	return nil, fmt.Errorf("no tree node for server %s", p.Roster().List[i].String())
+}
+
+// broadcast sends a message to all the other servers
+func (p *DKGProtocol) broadcast(msg interface{}) error {
+	for _, tn := range p.List() {
+		if tn.ID.Equal(p.TreeNode().ID) {
+			continue
+		}
+		if err := p.SendTo(tn, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// generateShare deals the shares of this server, processes the deals and the responses of the others and returns the
+// share of the collective key once all the deals are certified
+func (p *DKGProtocol) generateShare() (*dkg.DistKeyShare, error) {
+	gen, err := dkg.NewDistKeyGenerator(libunlynx.SuiTe, p.Private(), p.Roster().Publics(), p.Threshold)
+	if err != nil {
+		return nil, err
+	}
+
+	deals, err := gen.Deals()
+	if err != nil {
+		return nil, err
+	}
+	for i, deal := range deals {
+		tn, err := p.treeNode(i)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.SendTo(tn, &DKGDealMessage{Deal: *deal}); err != nil {
+			return nil, fmt.Errorf("Node %s failed to send DKGDealMessage: %v", p.ServerIdentity(), err)
+		}
+	}
+
+	// the responses are processed once this server has all the deals
+	dealsLeft := len(p.Roster().List) - 1
+	var responses []dkg.Response
+	processResponse := func(resp dkg.Response) error {
+		justification, err := gen.ProcessResponse(&resp)
+		if err != nil {
+			return err
+		}
+		if justification != nil {
+			return fmt.Errorf("a deal of %s was complained about", p.ServerIdentity())
+		}
+		return nil
+	}
+
+	timeout := time.After(libunlynx.TIMEOUT)
+	for dealsLeft > 0 || !gen.Certified() {
+		select {
+		case deal := <-p.DealChannel:
+			resp, err := gen.ProcessDeal(&deal.Deal)
+			if err != nil {
+				return nil, fmt.Errorf("wrong deal from %s: %v", deal.ServerIdentity, err)
+			}
+			if err := p.broadcast(&DKGResponseMessage{Response: *resp}); err != nil {
+				return nil, fmt.Errorf("Node %s failed to broadcast DKGResponseMessage: %v", p.ServerIdentity(), err)
+			}
+			dealsLeft--
+			if dealsLeft == 0 {
+				for _, r := range responses {
+					if err := processResponse(r); err != nil {
+						return nil, err
+					}
+				}
+				responses = nil
+			}
+		case resp := <-p.ResponseChannel:
+			if dealsLeft > 0 {
+				responses = append(responses, resp.Response)
+			} else if err := processResponse(resp.Response); err != nil {
+				return nil, err
+			}
+		case <-timeout:
+			return nil, fmt.Errorf("%s could not certify all the deals on time", p.ServerIdentity())
+		}
+	}
+	return gen.DistKeyShare()
+}
@@ -0,0 +1,76 @@
+package protocolsunlynx_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/protocols"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3/share"
+	"go.dedis.ch/kyber/v3/share/dkg/pedersen"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/network"
+)
+
+var dkgShares = struct {
+	sync.Mutex
+	shares []*dkg.DistKeyShare
+}{}
+
+func TestDKG(t *testing.T) {
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+	_, err := onet.GlobalProtocolRegister("DKGTest", NewDKGTest)
+	assert.NoError(t, err, "Failed to register the DKGTest protocol")
+
+	_, _, tree := local.GenTree(5, true)
+	defer local.CloseAll()
+
+	rootInstance, err := local.CreateProtocol("DKGTest", tree)
+	require.NoError(t, err)
+	protocol := rootInstance.(*protocolsunlynx.DKGProtocol)
+	protocol.Threshold = 3
+
+	go func() {
+		assert.NoError(t, protocol.Start())
+	}()
+
+	timeout := network.WaitRetry * time.Duration(network.MaxRetryConnect*10) * time.Millisecond
+	var rootShare *dkg.DistKeyShare
+	select {
+	case rootShare = <-protocol.FeedbackChannel:
+	case <-time.After(timeout):
+		t.Fatal("Didn't finish in time")
+	}
+
+	dkgShares.Lock()
+	defer dkgShares.Unlock()
+	require.Len(t, dkgShares.shares, 5)
+
+	// any 3 shares recover the secret of the collective key
+	priShares := make([]*share.PriShare, 0)
+	for _, s := range dkgShares.shares {
+		assert.True(t, s.Public().Equal(rootShare.Public()))
+		priShares = append(priShares, s.PriShare())
+	}
+	secret, err := share.RecoverSecret(libunlynx.SuiTe, priShares[2:], 3, 5)
+	require.NoError(t, err)
+	assert.True(t, libunlynx.SuiTe.Point().Mul(secret, nil).Equal(rootShare.Public()))
+}
+
+// NewDKGTest is a special purpose protocol constructor specific to tests.
+func NewDKGTest(tni *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+	pi, err := protocolsunlynx.NewDKGProtocol(tni)
+	if err != nil {
+		return nil, err
+	}
+	protocol := pi.(*protocolsunlynx.DKGProtocol)
+	protocol.ShareFunc = func(s *dkg.DistKeyShare) {
+		dkgShares.Lock()
+		dkgShares.shares = append(dkgShares.shares, s)
+		dkgShares.Unlock()
+	}
+	return protocol, nil
+}
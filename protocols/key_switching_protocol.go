@@ -12,75 +12,29 @@ import (
 
 	"github.com/ldsec/unlynx/lib"
 	"github.com/ldsec/unlynx/lib/key_switch"
-	"github.com/ldsec/unlynx/lib/tools"
 	"go.dedis.ch/kyber/v3"
 	"go.dedis.ch/onet/v3"
 	"go.dedis.ch/onet/v3/log"
-	"go.dedis.ch/onet/v3/network"
 )
 
 // KeySwitchingProtocolName is the registered name for the collective aggregation protocol.
 const KeySwitchingProtocolName = "KeySwitching"
 
 func init() {
-	network.RegisterMessage(DownMessage{})
-	network.RegisterMessage(DownMessageBytes{})
-	network.RegisterMessage(UpMessage{})
-	network.RegisterMessage(UpBytesMessage{})
-	network.RegisterMessage(LengthMessage{})
 	_, err := onet.GlobalProtocolRegister(KeySwitchingProtocolName, NewKeySwitchingProtocol)
 	log.ErrFatal(err, "Failed to register the <KeySwitching> protocol:")
 }
 
-// Messages
+// Streams
 //______________________________________________________________________________________________________________________
 
-// DownMessage message sent down the tree containing all the rB (left part of ciphertexts)
-type DownMessage struct {
-	NewKey kyber.Point
-	Rbs    []kyber.Point
-}
-
-// DownMessageBytes message sent down the tree containing all the rB (left part of ciphertexts) in bytes
-type DownMessageBytes struct {
-	Data []byte
-}
-
-// UpMessage contains the ciphertext used by the servers to create their key switching contribution.
-type UpMessage struct {
-	ChildData []libunlynx.CipherText
-}
-
-// UpBytesMessage is UpMessage in bytes.
-type UpBytesMessage struct {
-	Data []byte
-}
-
-// LengthMessage is a message containing the length of a message in bytes
-type LengthMessage struct {
-	Length []byte
-}
-
-// Structs
-//______________________________________________________________________________________________________________________
-
-// DownBytesStruct struct used to send DownMessage(Bytes)
-type DownBytesStruct struct {
-	*onet.TreeNode
-	DownMessageBytes
-}
-
-// UpBytesStruct struct used to send Up(Bytes)Message
-type UpBytesStruct struct {
-	*onet.TreeNode
-	UpBytesMessage
-}
-
-// LengthStruct struct used to send LengthMessage
-type LengthStruct struct {
-	*onet.TreeNode
-	LengthMessage
-}
+// The ephemeral keys (rB) are streamed down the tree, each chunk starting with the target public key, and the
+// contributions of the nodes are streamed up the tree: chunk i of a node is the sum of its contribution to the
+// ciphertexts of chunk i and of the chunks i of its children.
+const (
+	downStream = int64(0)
+	upStream   = int64(1)
+)
 
 // proofKeySwitchFunction defines a function that does 'stuff' with the key switch proofs
 type proofKeySwitchFunction func(kyber.Point, kyber.Point, kyber.Scalar, []kyber.Point, []kyber.Point, []kyber.Scalar) *libunlynxkeyswitch.PublishedKSListProof
@@ -95,13 +49,12 @@ type KeySwitchingProtocol struct {
 	// Protocol feedback channel
 	FeedbackChannel chan libunlynx.CipherVector
 
-	// Protocol communication channels
-	DownChannel      chan DownBytesStruct
-	LengthChannel    chan []LengthStruct
-	ChildDataChannel chan []UpBytesStruct
+	// Protocol communication
+	*streamer
 
 	// Protocol root data
 	NodeContribution *libunlynx.CipherVector
+	contributions    chan libunlynx.CipherVector // contributions of the root, chunk by chunk
 
 	// Protocol state data
 	TargetOfSwitch  *libunlynx.CipherVector
@@ -121,20 +74,12 @@ func NewKeySwitchingProtocol(n *onet.TreeNodeInstance) (onet.ProtocolInstance, e
 	pap := &KeySwitchingProtocol{
 		TreeNodeInstance: n,
 		FeedbackChannel:  make(chan libunlynx.CipherVector),
+		contributions:    make(chan libunlynx.CipherVector, 1),
 	}
 
-	err := pap.RegisterChannel(&pap.DownChannel)
-	if err != nil {
-		return nil, fmt.Errorf("couldn't register down channel: %v", err)
-	}
-
-	err = pap.RegisterChannel(&pap.ChildDataChannel)
-	if err != nil {
-		return nil, fmt.Errorf("couldn't register child-data channel: %v", err)
-	}
-
-	if err := pap.RegisterChannel(&pap.LengthChannel); err != nil {
-		return nil, fmt.Errorf("couldn't register length channel: %v", err)
+	var err error
+	if pap.streamer, err = newStreamer(n); err != nil {
+		return nil, err
 	}
 
 	return pap, nil
@@ -155,31 +100,41 @@ func (p *KeySwitchingProtocol) Start() error {
 
 	log.Lvl2("[KEY SWITCHING PROTOCOL] <Drynx> Server", p.ServerIdentity(), " started a Key Switching Protocol")
 
-	// Initializes the target ciphertext and extract the original ephemeral keys.
+	// Extracts the original ephemeral keys, they are sent chunk by chunk (with the target public key in first position)
 	dataLength := len(*p.TargetOfSwitch)
-	initialTab := make([]kyber.Point, dataLength+1)
+	var ks2s, rBNegs []kyber.Point
+	var vis []kyber.Scalar
+
+	for i := 0; i < streamChunks(dataLength); i++ {
+		from, to := chunkBounds(i, dataLength)
+		chunkTab := make([]kyber.Point, to-from+1)
+		chunkTab[0] = *p.TargetPublicKey
+		for j, v := range (*p.TargetOfSwitch)[from:to] {
+			chunkTab[j+1] = v.K
+		}
 
-	// put the target public key in first position
-	initialTab[0] = *p.TargetPublicKey
-	for i, v := range *p.TargetOfSwitch {
-		initialTab[i+1] = v.K
+		data, err := libunlynx.AbstractPointsToBytes(chunkTab)
+		if err != nil {
+			return err
+		}
+		chunk := StreamChunkMessage{Stream: downStream, Index: int64(i), Last: i == streamChunks(dataLength)-1, Data: data}
+		for _, child := range p.Children() {
+			if err := p.sendChunk(child, &chunk); err != nil {
+				return err
+			}
+		}
+
+		// root does its key switching
+		switchedCiphers, chunkKs2s, chunkRBNegs, chunkVis := libunlynxkeyswitch.KeySwitchSequence(*p.TargetPublicKey, chunkTab[1:], p.Private())
+		if p.Proofs {
+			ks2s, rBNegs, vis = append(ks2s, chunkKs2s...), append(rBNegs, chunkRBNegs...), append(vis, chunkVis...)
+		}
+		p.contributions <- switchedCiphers
 	}
 
-	// root does its key switching
-	switchedCiphers, ks2s, rBNegs, vis := libunlynxkeyswitch.KeySwitchSequence(*p.TargetPublicKey, initialTab[1:], p.Private())
 	if p.Proofs {
 		p.ProofFunc(p.Public(), *p.TargetPublicKey, p.Private(), ks2s, rBNegs, vis)
 	}
-	p.NodeContribution = &switchedCiphers
-
-	data, err := libunlynx.AbstractPointsToBytes(initialTab)
-	if err != nil {
-		return err
-	}
-
-	if err := p.SendToChildren(&DownMessageBytes{Data: data}); err != nil {
-		return fmt.Errorf("Root "+p.ServerIdentity().String()+" failed to broadcast DownMessageBytes: %v", err)
-	}
 
 	libunlynx.EndTimer(keySwitchingStart)
 
@@ -190,28 +145,35 @@ func (p *KeySwitchingProtocol) Start() error {
 func (p *KeySwitchingProtocol) Dispatch() error {
 	defer p.Done()
 
-	// 1. Key switching announcement phase
-	if !p.IsRoot() {
-		targetPublicKey, rbs, err := p.announcementKSPhase()
-		if err != nil {
-			return err
-		}
+	keySwitchingAscendingAggregation := libunlynx.StartTimer(p.Name() + "_KeySwitching(ascendingAggregation)")
 
-		switchedCiphers, ks2s, rBNegs, vis := libunlynxkeyswitch.KeySwitchSequence(targetPublicKey, rbs, p.Private())
-		if p.Proofs {
-			p.ProofFunc(p.Public(), targetPublicKey, p.Private(), ks2s, rBNegs, vis)
-		}
-		p.NodeContribution = &switchedCiphers
-	}
+	// 1. Key switching announcement phase (at the root, the contributions are computed by Start)
+	if p.IsRoot() {
+		contribution := make(libunlynx.CipherVector, 0)
+		for i := 0; ; i++ {
+			var chunkContribution libunlynx.CipherVector
+			select {
+			case chunkContribution = <-p.contributions:
+			case <-time.After(libunlynx.TIMEOUT):
+				return fmt.Errorf("%s didn't compute its contribution on time", p.ServerIdentity())
+			}
 
-	// 2. Ascending key switching phase
-	_, err := p.ascendingKSPhase()
-	if err != nil {
-		return err
-	}
+			// 2. Ascending key switching phase
+			sum, err := p.ascendingKSPhase(chunkContribution)
+			if err != nil {
+				return err
+			}
+			contribution = append(contribution, sum...)
 
-	// 3. Response reporting
-	if p.IsRoot() {
+			// the target is set once the root has started
+			if i == streamChunks(len(*p.TargetOfSwitch))-1 {
+				break
+			}
+		}
+		p.NodeContribution = &contribution
+		libunlynx.EndTimer(keySwitchingAscendingAggregation)
+
+		// 3. Response reporting
 		ksCiphers := *libunlynx.NewCipherVector(len(*p.TargetOfSwitch))
 
 		wg := libunlynx.StartParallelize(len(*p.TargetOfSwitch))
@@ -224,23 +186,55 @@ func (p *KeySwitchingProtocol) Dispatch() error {
 		}
 		libunlynx.EndParallelize(wg)
 		p.FeedbackChannel <- ksCiphers
+		return nil
 	}
-	return nil
-}
 
-// Announce forwarding down the tree.
-func (p *KeySwitchingProtocol) announcementKSPhase() (kyber.Point, []kyber.Point, error) {
-	var dataReferenceMessage DownBytesStruct
-	select {
-	case dataReferenceMessage = <-p.DownChannel:
-	case <-time.After(libunlynx.TIMEOUT):
-		return nil, nil, fmt.Errorf(p.ServerIdentity().String() + " didn't get the <dataReferenceMessage> on time")
+	var targetPublicKey kyber.Point
+	var ks2s, rBNegs []kyber.Point
+	var vis []kyber.Scalar
+	err := p.receiveStream(p.Parent(), downStream, func(chunk StreamChunkMessage) error {
+		key, rbs, err := p.announcementKSPhase(chunk)
+		if err != nil {
+			return err
+		}
+		targetPublicKey = key
+
+		switchedCiphers, chunkKs2s, chunkRBNegs, chunkVis := libunlynxkeyswitch.KeySwitchSequence(targetPublicKey, rbs, p.Private())
+		if p.Proofs {
+			ks2s, rBNegs, vis = append(ks2s, chunkKs2s...), append(rBNegs, chunkRBNegs...), append(vis, chunkVis...)
+		}
+
+		// 2. Ascending key switching phase
+		sum, err := p.ascendingKSPhase(switchedCiphers)
+		if err != nil {
+			return err
+		}
+		data, _, err := sum.ToBytes()
+		if err != nil {
+			return err
+		}
+		return p.sendChunk(p.Parent(), &StreamChunkMessage{Stream: upStream, Index: chunk.Index, Last: chunk.Last, Data: data})
+	})
+	if err != nil {
+		return err
+	}
+	libunlynx.EndTimer(keySwitchingAscendingAggregation)
+
+	if p.Proofs {
+		p.ProofFunc(p.Public(), targetPublicKey, p.Private(), ks2s, rBNegs, vis)
 	}
+	return nil
+}
 
-	if err := p.SendToChildren(&dataReferenceMessage.DownMessageBytes); err != nil {
-		return nil, nil, fmt.Errorf("Node "+p.ServerIdentity().String()+" failed to broadcast DownMessageBytes: %v", err)
+// Announce forwarding down the tree (a chunk of the ephemeral keys).
+func (p *KeySwitchingProtocol) announcementKSPhase(chunk StreamChunkMessage) (kyber.Point, []kyber.Point, error) {
+	for _, child := range p.Children() {
+		down := chunk
+		if err := p.sendChunk(child, &down); err != nil {
+			return nil, nil, err
+		}
 	}
-	message, err := libunlynx.FromBytesToAbstractPoints(dataReferenceMessage.Data)
+	message, err := libunlynx.FromBytesToAbstractPoints(chunk.Data)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -248,49 +242,22 @@ func (p *KeySwitchingProtocol) announcementKSPhase() (kyber.Point, []kyber.Point
 	return message[0], message[1:], nil
 }
 
-// Results pushing up the tree containing key switching results.
-func (p *KeySwitchingProtocol) ascendingKSPhase() (*libunlynx.CipherVector, error) {
-
-	keySwitchingAscendingAggregation := libunlynx.StartTimer(p.Name() + "_KeySwitching(ascendingAggregation)")
-
-	if !p.IsLeaf() {
-		length := make([]LengthStruct, 0)
-		for _, v := range <-p.LengthChannel {
-			length = append(length, v)
-		}
-
-		datas := make([]UpBytesStruct, 0)
-		for _, v := range <-p.ChildDataChannel {
-			datas = append(datas, v)
-		}
-		for i := range length { // len of length is number of children
-			cv := libunlynx.CipherVector{}
-			err := cv.FromBytes(datas[i].Data, libunlynxtools.UnsafeCastBytesToInts(length[i].Length)[0])
-			if err != nil {
-				return nil, err
-			}
-
-			sumCv := libunlynx.NewCipherVector(len(cv))
-			sumCv.Add(*p.NodeContribution, cv)
-			p.NodeContribution = sumCv
-
-		}
-	}
-	libunlynx.EndTimer(keySwitchingAscendingAggregation)
-
-	if !p.IsRoot() {
-		if err := p.SendToParent(&LengthMessage{Length: libunlynxtools.UnsafeCastIntsToBytes([]int{len(*p.NodeContribution)})}); err != nil {
-			return nil, fmt.Errorf("Node "+p.ServerIdentity().String()+" failed to broadcast LengthMessage: %v", err)
-		}
-		message, _, err := (*p.NodeContribution).ToBytes()
+// Results pushing up the tree containing key switching results: the contribution of a node to a chunk is summed with
+// the chunks of its children.
+func (p *KeySwitchingProtocol) ascendingKSPhase(contribution libunlynx.CipherVector) (libunlynx.CipherVector, error) {
+	for _, child := range p.Children() {
+		chunk, err := p.receiveChunk(child, upStream)
 		if err != nil {
 			return nil, err
 		}
-
-		if err := p.SendToParent(&UpBytesMessage{Data: message}); err != nil {
-			return nil, fmt.Errorf("Node "+p.ServerIdentity().String()+" failed to broadcast UpBytesMessage: %v", err)
+		cv := libunlynx.CipherVector{}
+		if err := cv.FromBytes(chunk.Data, len(contribution)); err != nil {
+			return nil, err
 		}
-	}
 
-	return p.NodeContribution, nil
+		sumCv := libunlynx.NewCipherVector(len(cv))
+		sumCv.Add(contribution, cv)
+		contribution = *sumCv
+	}
+	return contribution, nil
 }
@@ -71,7 +71,8 @@ func TestCTKS(t *testing.T) {
 	select {
 	case encryptedResult := <-feedback:
 		cv1 := encryptedResult
-		res := libunlynx.DecryptIntVector(clientPrivate, &cv1)
+		res, err := libunlynx.DecryptIntVector(clientPrivate, &cv1)
+		assert.NoError(t, err)
 		log.Lvl2("Received results (attributes) ", res)
 
 		if !reflect.DeepEqual(res, append(data1, data2...)) {
@@ -157,14 +157,14 @@ func (p *ShufflingPlusDDTProtocol) Dispatch() error {
 	select {
 	case shufflingPlusDDTBytesMessageLength = <-p.LengthNodeChannel:
 	case <-time.After(libunlynx.TIMEOUT):
-		return fmt.Errorf(p.ServerIdentity().String() + " didn't get the <shufflingPlusDDTBytesMessageLength> on time")
+		return fmt.Errorf("%s didn't get the <shufflingPlusDDTBytesMessageLength> on time", p.ServerIdentity())
 	}
 
 	var spDDTbs shufflingPlusDDTBytesStruct
 	select {
 	case spDDTbs = <-p.PreviousNodeInPathChannel:
 	case <-time.After(libunlynx.TIMEOUT):
-		return fmt.Errorf(p.ServerIdentity().String() + " didn't get the <spDDTbs> on time")
+		return fmt.Errorf("%s didn't get the <spDDTbs> on time", p.ServerIdentity())
 	}
 
 	readData := libunlynx.StartTimer(p.Name() + "_ShufflingPlusDDT(ReadData)")
@@ -1,6 +1,8 @@
 // Package protocolsunlynx implement the shuffling protocol. It rerandomizes and shuffles a list of ciphertexts.
 // This operates in a circuit between the servers: the data is sent sequentially through this circuit and each
 // server applies its transformation.
+// The rows are streamed in chunks from a server to the next one, they are decoded as soon as they arrive but a server
+// needs all of them to shuffle.
 package protocolsunlynx
 
 import (
@@ -20,8 +22,6 @@ const ShufflingProtocolName = "Shuffling"
 
 func init() {
 	network.RegisterMessage(ShufflingMessage{})
-	network.RegisterMessage(ShufflingBytesMessage{})
-	network.RegisterMessage(ShufflingBytesMessageLength{})
 	if _, err := onet.GlobalProtocolRegister(ShufflingProtocolName, NewShufflingProtocol); err != nil {
 		log.Fatal("Failed to register the <Shuffling> protocol: ", err)
 	}
@@ -30,36 +30,11 @@ func init() {
 // Messages
 //______________________________________________________________________________________________________________________
 
-// ShufflingMessage represents a message containing data to shuffle
+// ShufflingMessage represents a message containing data to shuffle (a chunk of the rows once in bytes)
 type ShufflingMessage struct {
 	Data []libunlynx.CipherVector
 }
 
-// ShufflingBytesMessage represents a shuffling message in bytes
-type ShufflingBytesMessage struct {
-	Data []byte
-}
-
-// ShufflingBytesMessageLength is a message containing the lengths to read a shuffling message in bytes
-type ShufflingBytesMessageLength struct {
-	CVLengths []byte
-}
-
-// Structs
-//______________________________________________________________________________________________________________________
-
-// shufflingBytesStruct contains a shuffling message in bytes
-type shufflingBytesStruct struct {
-	*onet.TreeNode
-	ShufflingBytesMessage
-}
-
-// shufflingBytesLengthStruct contains a length message
-type shufflingBytesLengthStruct struct {
-	*onet.TreeNode
-	ShufflingBytesMessageLength
-}
-
 // proofShuffleFunction defines a function that does 'stuff' with the shuffle proofs
 type proofShuffleFunction func([]libunlynx.CipherVector, []libunlynx.CipherVector, kyber.Point, [][]kyber.Scalar, []int) *libunlynxshuffle.PublishedShufflingProof
 
@@ -73,22 +48,29 @@ type ShufflingProtocol struct {
 	// Protocol feedback channel
 	FeedbackChannel chan []libunlynx.CipherVector
 
-	// Protocol communication channels
-	LengthNodeChannel         chan shufflingBytesLengthStruct
-	PreviousNodeInPathChannel chan shufflingBytesStruct
+	// Protocol communication
+	*streamer
 
 	// Protocol state data
-	ShuffleTarget     *[]libunlynx.CipherVector
-	Precomputed       []libunlynxshuffle.CipherVectorScalar
-	nextNodeInCircuit *onet.TreeNode
+	ShuffleTarget         *[]libunlynx.CipherVector
+	Precomputed           []libunlynxshuffle.CipherVectorScalar
+	nextNodeInCircuit     *onet.TreeNode
+	previousNodeInCircuit *onet.TreeNode
+
+	// PrecomputedFunc, if it is set, gives the precomputed values used to shuffle a number of rows (one line per row)
+	// instead of Precomputed (e.g. to take them from a pool)
+	PrecomputedFunc func(rows int) []libunlynxshuffle.CipherVectorScalar
 
 	// Proofs
 	Proofs    bool
 	ProofFunc proofShuffleFunction             // proof function for when we want to do something different with the proofs (e.g. insert in the blockchain)
 	MapPIs    map[string]onet.ProtocolInstance // protocol instances to be able to call protocols inside protocols (e.g. proof_collection_protocol)
 
-	// Test (only use in order to test the protocol)
+	// CollectiveKey replaces the aggregate key of the roster if the data is encrypted under another key (e.g. generated
+	// by the DKG protocol or to test the protocol)
 	CollectiveKey kyber.Point
+
+	// Test (only use in order to test the protocol)
 	ExecTimeStart time.Duration
 	ExecTime      time.Duration
 }
@@ -100,19 +82,17 @@ func NewShufflingProtocol(n *onet.TreeNodeInstance) (onet.ProtocolInstance, erro
 		FeedbackChannel:  make(chan []libunlynx.CipherVector),
 	}
 
-	if err := dsp.RegisterChannel(&dsp.PreviousNodeInPathChannel); err != nil {
-		return nil, fmt.Errorf("couldn't register data reference channel: %v", err)
-	}
-
-	if err := dsp.RegisterChannel(&dsp.LengthNodeChannel); err != nil {
-		return nil, fmt.Errorf("couldn't register data reference channel: %v", err)
+	var err error
+	if dsp.streamer, err = newStreamer(n); err != nil {
+		return nil, err
 	}
 
-	// choose next node in circuit
+	// choose next and previous nodes in circuit
 	nodeList := n.Tree().List()
 	for i, node := range nodeList {
 		if n.TreeNode().Equal(node) {
 			dsp.nextNodeInCircuit = nodeList[(i+1)%len(nodeList)]
+			dsp.previousNodeInCircuit = nodeList[(i+len(nodeList)-1)%len(nodeList)]
 			break
 		}
 	}
@@ -139,18 +119,14 @@ func (p *ShufflingProtocol) Start() error {
 	shuffleTarget := *p.ShuffleTarget
 
 	collectiveKey := p.Roster().Aggregate
-	// when testing protocol
 	if p.CollectiveKey != nil {
 		collectiveKey = p.CollectiveKey
 	}
 
 	shufflingStartNoProof := libunlynx.StartTimer(p.Name() + "_Shuffling(START-noProof)")
 
-	if p.Precomputed != nil {
-		log.Lvl1(p.Name(), " uses pre-computation in shuffling")
-	}
-
-	shuffledData, pi, beta := libunlynxshuffle.ShuffleSequence(shuffleTarget, libunlynx.SuiTe.Point().Base(), collectiveKey, p.Precomputed)
+	precomputed := p.precomputed(len(shuffleTarget))
+	shuffledData, pi, beta := libunlynxshuffle.ShuffleSequence(shuffleTarget, libunlynx.SuiTe.Point().Base(), collectiveKey, precomputed)
 
 	libunlynx.EndTimer(shufflingStartNoProof)
 
@@ -165,61 +141,34 @@ func (p *ShufflingProtocol) Start() error {
 
 	p.ExecTimeStart += time.Since(timer)
 
-	message := ShufflingBytesMessage{}
-	var cvLengthsByte []byte
-	var err error
-
-	message.Data, cvLengthsByte, err = (&ShufflingMessage{shuffledData}).ToBytes()
-	if err != nil {
-		return err
-	}
-
-	if err := p.sendToNext(&ShufflingBytesMessageLength{CVLengths: cvLengthsByte}); err != nil {
-		return err
-	}
-	if err := p.sendToNext(&message); err != nil {
-		return err
-	}
-	return nil
+	return p.sendToNext(shuffledData)
 }
 
 // Dispatch is called on each tree node. It waits for incoming messages and handles them.
 func (p *ShufflingProtocol) Dispatch() error {
 	defer p.Done()
 
-	var shufflingBytesMessageLength shufflingBytesLengthStruct
-	select {
-	case shufflingBytesMessageLength = <-p.LengthNodeChannel:
-	case <-time.After(libunlynx.TIMEOUT):
-		return fmt.Errorf(p.ServerIdentity().String() + " didn't get the <shufflingBytesMessageLength> on time")
-	}
-
-	var sbs shufflingBytesStruct
-	select {
-	case sbs = <-p.PreviousNodeInPathChannel:
-	case <-time.After(libunlynx.TIMEOUT):
-		return fmt.Errorf(p.ServerIdentity().String() + " didn't get the <sbs> on time")
-	}
-
-	sm := ShufflingMessage{}
-	if err := sm.FromBytes(sbs.Data, shufflingBytesMessageLength.CVLengths); err != nil {
+	shuffleTarget := make([]libunlynx.CipherVector, 0)
+	err := p.receiveStream(p.previousNodeInCircuit, 0, func(chunk StreamChunkMessage) error {
+		sm := ShufflingMessage{}
+		if err := sm.FromBytes(chunk.Data, chunk.Lengths); err != nil {
+			return err
+		}
+		shuffleTarget = append(shuffleTarget, sm.Data...)
+		return nil
+	})
+	if err != nil {
 		return err
 	}
-	shuffleTarget := sm.Data
 
 	timer := time.Now()
 	shufflingDispatch := libunlynx.StartTimer(p.Name() + "_Shuffling(DISPATCH)")
 
 	collectiveKey := p.Roster().Aggregate
-	// when testing protocol
 	if p.CollectiveKey != nil {
 		collectiveKey = p.CollectiveKey
 	}
 
-	if p.Precomputed != nil {
-		log.Lvl1(p.Name(), " uses pre-computation in shuffling")
-	}
-
 	shuffledData := shuffleTarget
 	var pi []int
 	var beta [][]kyber.Scalar
@@ -227,7 +176,8 @@ func (p *ShufflingProtocol) Dispatch() error {
 	if !p.IsRoot() {
 		shufflingDispatchNoProof := libunlynx.StartTimer(p.Name() + "_Shuffling(DISPATCH-noProof)")
 
-		shuffledData, pi, beta = libunlynxshuffle.ShuffleSequence(shuffleTarget, libunlynx.SuiTe.Point().Base(), collectiveKey, p.Precomputed)
+		precomputed := p.precomputed(len(shuffleTarget))
+		shuffledData, pi, beta = libunlynxshuffle.ShuffleSequence(shuffleTarget, libunlynx.SuiTe.Point().Base(), collectiveKey, precomputed)
 
 		libunlynx.EndTimer(shufflingDispatchNoProof)
 
@@ -257,18 +207,7 @@ func (p *ShufflingProtocol) Dispatch() error {
 		p.FeedbackChannel <- shuffleTarget
 	} else {
 		// Forward switched message.
-		message := ShufflingBytesMessage{}
-		var cvBytesLengths []byte
-		var err error
-		message.Data, cvBytesLengths, err = (&ShufflingMessage{shuffledData}).ToBytes()
-		if err != nil {
-			return err
-		}
-
-		if err := p.sendToNext(&ShufflingBytesMessageLength{cvBytesLengths}); err != nil {
-			return err
-		}
-		if err := p.sendToNext(&message); err != nil {
+		if err := p.sendToNext(shuffledData); err != nil {
 			return err
 		}
 	}
@@ -276,13 +215,23 @@ func (p *ShufflingProtocol) Dispatch() error {
 	return nil
 }
 
-// Sends the message msg to the next node in the circuit based on the next TreeNode in Tree.List().
-func (p *ShufflingProtocol) sendToNext(msg interface{}) error {
-	err := p.SendTo(p.nextNodeInCircuit, msg)
-	if err != nil {
-		return err
+// precomputed returns the precomputed values used to shuffle a number of rows
+func (p *ShufflingProtocol) precomputed(rows int) []libunlynxshuffle.CipherVectorScalar {
+	precomputed := p.Precomputed
+	if p.PrecomputedFunc != nil {
+		precomputed = p.PrecomputedFunc(rows)
 	}
-	return nil
+	if precomputed != nil {
+		log.Lvl1(p.Name(), " uses pre-computation in shuffling")
+	}
+	return precomputed
+}
+
+// Streams the rows to the next node in the circuit based on the next TreeNode in Tree.List().
+func (p *ShufflingProtocol) sendToNext(rows []libunlynx.CipherVector) error {
+	return p.sendStream(p.nextNodeInCircuit, 0, len(rows), func(from, to int) ([]byte, []byte, error) {
+		return (&ShufflingMessage{rows[from:to]}).ToBytes()
+	})
 }
 
 // Marshal
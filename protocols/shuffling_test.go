@@ -106,12 +106,16 @@ func TestShuffling(t *testing.T) {
 		formatedResult := protocolsunlynx.MatrixCipherTextToProcessResponse(encryptedResult, lengths)
 
 		for _, v := range formatedResult {
-			decryptedVAggr := libunlynx.DecryptIntVector(groupSec, &v.AggregatingAttributes)
-			decryptedVGrp := libunlynx.DecryptIntVector(groupSec, &v.GroupByEnc)
+			decryptedVAggr, err := libunlynx.DecryptIntVector(groupSec, &v.AggregatingAttributes)
+			assert.NoError(t, err)
+			decryptedVGrp, err := libunlynx.DecryptIntVector(groupSec, &v.GroupByEnc)
+			assert.NoError(t, err)
 			present := false
 			for _, w := range mapi {
-				decryptedWAggr := libunlynx.DecryptIntVector(groupSec, &w.AggregatingAttributes)
-				decryptedWGrp := libunlynx.DecryptIntVector(groupSec, &w.GroupByEnc)
+				decryptedWAggr, err := libunlynx.DecryptIntVector(groupSec, &w.AggregatingAttributes)
+				assert.NoError(t, err)
+				decryptedWGrp, err := libunlynx.DecryptIntVector(groupSec, &w.GroupByEnc)
+				assert.NoError(t, err)
 				if reflect.DeepEqual(decryptedWAggr, decryptedVAggr) && reflect.DeepEqual(decryptedWGrp, decryptedVGrp) {
 					present = true
 				}
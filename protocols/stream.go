@@ -0,0 +1,242 @@
+package protocolsunlynx
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ldsec/unlynx/lib"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/network"
+)
+
+// StreamChunkSize is the maximum number of elements (rows, ciphertexts or points) sent in a chunk by the protocols
+// that stream their data (shuffling, deterministic tagging and key switching)
+var StreamChunkSize = 1024
+
+// StreamWindow is the maximum number of chunks of a stream sent and not yet processed by the receiving node: a node
+// never buffers more than StreamWindow chunks per stream, whatever the size of the survey
+var StreamWindow = 4
+
+func init() {
+	network.RegisterMessage(StreamChunkMessage{})
+	network.RegisterMessage(StreamAckMessage{})
+}
+
+// Messages
+//______________________________________________________________________________________________________________________
+
+// StreamChunkMessage is a chunk of the data streamed from a node to another: the chunks of a stream are numbered from
+// 0 and the last one is flagged. Lengths are the lengths needed to read Data (if any, e.g. the lengths of the rows).
+type StreamChunkMessage struct {
+	Stream  int64
+	Index   int64
+	Last    bool
+	Data    []byte
+	Lengths []byte
+}
+
+// StreamAckMessage acknowledges that a chunk was taken by the receiving node, so that the next ones can be sent
+type StreamAckMessage struct {
+	Stream int64
+	Index  int64
+}
+
+// Structs
+//______________________________________________________________________________________________________________________
+
+// streamChunkStruct contains a chunk
+type streamChunkStruct struct {
+	*onet.TreeNode
+	StreamChunkMessage
+}
+
+// streamAckStruct contains an acknowledgement
+type streamAckStruct struct {
+	*onet.TreeNode
+	StreamAckMessage
+}
+
+// streamID identifies a stream by the other node (the sender or the receiver) and its number
+type streamID struct {
+	node   onet.TreeNodeID
+	stream int64
+}
+
+// chunkID identifies a chunk of a stream
+type chunkID struct {
+	streamID
+	index int64
+}
+
+// Streamer
+//______________________________________________________________________________________________________________________
+
+// streamer sends and receives the streams of a protocol instance. The chunks and the acknowledgements are handled as
+// soon as they arrive (they are not dispatched to channels that could be full), the chunks received are kept until
+// they are taken in order by receiveChunk.
+type streamer struct {
+	*onet.TreeNodeInstance
+
+	mutex    sync.Mutex
+	chunks   map[chunkID]StreamChunkMessage
+	next     map[streamID]int64 // index of the next chunk to take, by sender and stream
+	acked    map[streamID]int64 // number of chunks acknowledged, by receiver and stream
+	received chan struct{}      // closed (and replaced) when a chunk or an acknowledgement is received
+}
+
+// newStreamer creates the streamer of a protocol instance and registers its handlers
+func newStreamer(n *onet.TreeNodeInstance) (*streamer, error) {
+	s := &streamer{
+		TreeNodeInstance: n,
+		chunks:           make(map[chunkID]StreamChunkMessage),
+		next:             make(map[streamID]int64),
+		acked:            make(map[streamID]int64),
+		received:         make(chan struct{}),
+	}
+	if err := n.RegisterHandler(s.handleChunk); err != nil {
+		return nil, fmt.Errorf("couldn't register chunk handler: %v", err)
+	}
+	if err := n.RegisterHandler(s.handleAck); err != nil {
+		return nil, fmt.Errorf("couldn't register acknowledgement handler: %v", err)
+	}
+	return s, nil
+}
+
+// handleChunk keeps a chunk until it is taken
+func (s *streamer) handleChunk(msg streamChunkStruct) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.chunks[chunkID{streamID{msg.TreeNode.ID, msg.Stream}, msg.Index}] = msg.StreamChunkMessage
+	s.notify()
+	return nil
+}
+
+// handleAck counts the chunks acknowledged by a node
+func (s *streamer) handleAck(msg streamAckStruct) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	id := streamID{msg.TreeNode.ID, msg.Stream}
+	if msg.Index+1 > s.acked[id] {
+		s.acked[id] = msg.Index + 1
+	}
+	s.notify()
+	return nil
+}
+
+// notify wakes up the goroutines waiting for a chunk or an acknowledgement (the caller holds the mutex)
+func (s *streamer) notify() {
+	close(s.received)
+	s.received = make(chan struct{})
+}
+
+// wait waits (at most libunlynx.TIMEOUT) until ready returns true (ready is called with the mutex held)
+func (s *streamer) wait(ready func() bool) bool {
+	timeout := time.After(libunlynx.TIMEOUT)
+	for {
+		s.mutex.Lock()
+		ok := ready()
+		received := s.received
+		s.mutex.Unlock()
+		if ok {
+			return true
+		}
+
+		select {
+		case <-received:
+		case <-timeout:
+			return false
+		}
+	}
+}
+
+// sendChunk sends a chunk of a stream to a node, once the node acknowledged all the chunks but the last
+// StreamWindow - 1 ones
+func (s *streamer) sendChunk(to *onet.TreeNode, chunk *StreamChunkMessage) error {
+	id := streamID{to.ID, chunk.Stream}
+	if !s.wait(func() bool { return chunk.Index-s.acked[id] < int64(StreamWindow) }) {
+		return fmt.Errorf("%s didn't get the acknowledgement of chunk %d (stream %d) on time", s.ServerIdentity(), chunk.Index-int64(StreamWindow), chunk.Stream)
+	}
+	if err := s.SendTo(to, chunk); err != nil {
+		return fmt.Errorf("Node %s failed to send a StreamChunkMessage: %v", s.ServerIdentity(), err)
+	}
+	return nil
+}
+
+// sendStream sends a number of elements to a node, in chunks of (at most) StreamChunkSize elements: encode converts
+// the elements [from, to) of a chunk to bytes (and their lengths) only when the chunk can be sent
+func (s *streamer) sendStream(to *onet.TreeNode, stream int64, elements int, encode func(from, to int) ([]byte, []byte, error)) error {
+	chunks := streamChunks(elements)
+	for i := 0; i < chunks; i++ {
+		from, end := chunkBounds(i, elements)
+		data, lengths, err := encode(from, end)
+		if err != nil {
+			return err
+		}
+		chunk := StreamChunkMessage{Stream: stream, Index: int64(i), Last: i == chunks-1, Data: data, Lengths: lengths}
+		if err := s.sendChunk(to, &chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// receiveChunk takes the next chunk of a stream sent by a node and acknowledges it
+func (s *streamer) receiveChunk(from *onet.TreeNode, stream int64) (StreamChunkMessage, error) {
+	sid := streamID{from.ID, stream}
+	var chunk StreamChunkMessage
+	var index int64
+	ok := s.wait(func() bool {
+		index = s.next[sid]
+		id := chunkID{sid, index}
+		c, ok := s.chunks[id]
+		if ok {
+			delete(s.chunks, id)
+			s.next[sid]++
+			chunk = c
+		}
+		return ok
+	})
+	if !ok {
+		return StreamChunkMessage{}, fmt.Errorf("%s didn't get the chunk %d (stream %d) on time", s.ServerIdentity(), index, stream)
+	}
+
+	if err := s.SendTo(from, &StreamAckMessage{Stream: stream, Index: chunk.Index}); err != nil {
+		return StreamChunkMessage{}, fmt.Errorf("Node %s failed to send a StreamAckMessage: %v", s.ServerIdentity(), err)
+	}
+	return chunk, nil
+}
+
+// receiveStream calls process on each chunk of a stream sent by a node, in order, until the last one
+func (s *streamer) receiveStream(from *onet.TreeNode, stream int64, process func(StreamChunkMessage) error) error {
+	for {
+		chunk, err := s.receiveChunk(from, stream)
+		if err != nil {
+			return err
+		}
+		if err := process(chunk); err != nil {
+			return err
+		}
+		if chunk.Last {
+			return nil
+		}
+	}
+}
+
+// streamChunks returns the number of chunks needed to stream a number of elements (an empty stream is one empty chunk)
+func streamChunks(elements int) int {
+	if elements == 0 {
+		return 1
+	}
+	return (elements + StreamChunkSize - 1) / StreamChunkSize
+}
+
+// chunkBounds returns the first element and the end (excluded) of a chunk of a stream
+func chunkBounds(chunk, elements int) (int, int) {
+	from := chunk * StreamChunkSize
+	end := from + StreamChunkSize
+	if end > elements {
+		end = elements
+	}
+	return from, end
+}
@@ -0,0 +1,116 @@
+package protocolsunlynx_test
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/protocols"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+)
+
+// TestStreaming runs the protocols that stream their data with more chunks than the nodes can buffer
+func TestStreaming(t *testing.T) {
+	defer log.AfterTest(t)
+
+	chunkSize, window := protocolsunlynx.StreamChunkSize, protocolsunlynx.StreamWindow
+	protocolsunlynx.StreamChunkSize, protocolsunlynx.StreamWindow = 2, 1
+	defer func() {
+		protocolsunlynx.StreamChunkSize, protocolsunlynx.StreamWindow = chunkSize, window
+	}()
+
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+	_, err := onet.GlobalProtocolRegister("DeterministicTaggingStreamTest", NewDeterministicTaggingTest)
+	require.NoError(t, err)
+
+	servers, roster, tree := local.GenTree(5, true)
+	defer local.CloseAll()
+
+	groupSec := libunlynx.SuiTe.Scalar().Zero()
+	for _, server := range servers {
+		groupSec.Add(groupSec, local.GetPrivate(server))
+	}
+
+	nbrRows := 21
+	values := make([]int64, nbrRows)
+	for i := range values {
+		values[i] = int64(i % 3)
+	}
+	target := *libunlynx.EncryptIntVector(roster.Aggregate, values)
+	timeout := network.WaitRetry * time.Duration(network.MaxRetryConnect*10) * time.Millisecond
+
+	// shuffling (the rows are [value, index])
+	pi, err := local.CreateProtocol(protocolsunlynx.ShufflingProtocolName, tree)
+	require.NoError(t, err)
+	shuffling := pi.(*protocolsunlynx.ShufflingProtocol)
+	rows := make([]libunlynx.CipherVector, nbrRows)
+	for i := range rows {
+		rows[i] = *libunlynx.EncryptIntVector(roster.Aggregate, []int64{values[i], int64(i)})
+	}
+	shuffling.ShuffleTarget = &rows
+	go func() {
+		assert.NoError(t, shuffling.Start())
+	}()
+
+	select {
+	case shuffled := <-shuffling.FeedbackChannel:
+		require.Equal(t, nbrRows, len(shuffled))
+		seen := make(map[int64]bool)
+		for _, row := range shuffled {
+			decrypted, err := libunlynx.DecryptIntVector(groupSec, &row)
+			require.NoError(t, err)
+			assert.Equal(t, values[decrypted[1]], decrypted[0])
+			seen[decrypted[1]] = true
+		}
+		assert.Equal(t, nbrRows, len(seen))
+	case <-time.After(timeout):
+		t.Fatal("Didn't finish the shuffling in time")
+	}
+
+	// deterministic tagging
+	pi, err = local.CreateProtocol("DeterministicTaggingStreamTest", tree)
+	require.NoError(t, err)
+	tagging := pi.(*protocolsunlynx.DeterministicTaggingProtocol)
+	tagging.TargetOfSwitch = &target
+	go func() {
+		assert.NoError(t, tagging.Start())
+	}()
+
+	select {
+	case tags := <-tagging.FeedbackChannel:
+		require.Equal(t, nbrRows, len(tags))
+		for i := range tags {
+			for j := range tags {
+				assert.Equal(t, values[i] == values[j], tags[i].Point.Equal(tags[j].Point))
+			}
+		}
+		assert.Equal(t, int32(0), atomic.LoadInt32(&detTagWrongProofs))
+	case <-time.After(timeout):
+		t.Fatal("Didn't finish the deterministic tagging in time")
+	}
+
+	// key switching
+	pi, err = local.CreateProtocol(protocolsunlynx.KeySwitchingProtocolName, tree)
+	require.NoError(t, err)
+	keySwitching := pi.(*protocolsunlynx.KeySwitchingProtocol)
+	clientSecret, clientPublic := libunlynx.GenKey()
+	keySwitching.TargetOfSwitch = &target
+	keySwitching.TargetPublicKey = &clientPublic
+	go func() {
+		assert.NoError(t, keySwitching.Start())
+	}()
+
+	select {
+	case switched := <-keySwitching.FeedbackChannel:
+		decrypted, err := libunlynx.DecryptIntVector(clientSecret, &switched)
+		require.NoError(t, err)
+		assert.Equal(t, values, decrypted)
+	case <-time.After(timeout):
+		t.Fatal("Didn't finish the key switching in time")
+	}
+}
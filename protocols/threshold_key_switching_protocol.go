@@ -0,0 +1,300 @@
+// Package protocolsunlynx implements the threshold key switching protocol.
+// It permits to switch a ciphertext encrypted under a collective key whose secret is shared among the servers (see the
+// DKG protocol) to another ciphertext encrypted under another key.
+// The root sends the ciphertexts to all the servers, each one computes a key switching contribution with its share of
+// the secret (like in the key switching protocol) and sends it back to the root. The root combines the contributions of
+// the first servers to answer, once it has as many as the threshold of the collective key: the protocol completes
+// even if some servers are unavailable.
+// Each contribution comes with a key switching proof, which the root verifies against the public share of the sender
+// (the index of the share is the one of the sender among the participants of the sharing) before combining it.
+package protocolsunlynx
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/lib/key_switch"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/share"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+)
+
+// ThresholdKeySwitchingProtocolName is the registered name for the threshold key switching protocol.
+const ThresholdKeySwitchingProtocolName = "ThresholdKeySwitching"
+
+func init() {
+	network.RegisterMessage(ThresholdKSRequestMessage{})
+	network.RegisterMessage(ThresholdKSContributionMessage{})
+	_, err := onet.GlobalProtocolRegister(ThresholdKeySwitchingProtocolName, NewThresholdKeySwitchingProtocol)
+	log.ErrFatal(err, "Failed to register the <ThresholdKeySwitching> protocol:")
+}
+
+// Messages
+//______________________________________________________________________________________________________________________
+
+// ThresholdKSRequestMessage contains the target public key followed by the rB (left part of the ciphertexts)
+type ThresholdKSRequestMessage struct {
+	Data []byte
+}
+
+// ThresholdKSContributionMessage contains the key switching contribution of a server computed with the share of
+// index Index, and the proof that it was computed with this share
+type ThresholdKSContributionMessage struct {
+	Index  int64
+	Length int64
+	Data   []byte
+	Proof  libunlynxkeyswitch.PublishedKSListProofBytes
+}
+
+// Structs
+//______________________________________________________________________________________________________________________
+
+// ThresholdKSRequestStruct struct used to send ThresholdKSRequestMessage
+type ThresholdKSRequestStruct struct {
+	*onet.TreeNode
+	ThresholdKSRequestMessage
+}
+
+// ThresholdKSContributionStruct struct used to send ThresholdKSContributionMessage
+type ThresholdKSContributionStruct struct {
+	*onet.TreeNode
+	ThresholdKSContributionMessage
+}
+
+// Protocol
+//______________________________________________________________________________________________________________________
+
+// ThresholdKeySwitchingProtocol switches ciphertexts encrypted under a collective key shared among the servers.
+type ThresholdKeySwitchingProtocol struct {
+	*onet.TreeNodeInstance
+
+	// Protocol feedback channel
+	FeedbackChannel chan libunlynx.CipherVector
+
+	// Protocol communication channels
+	RequestChannel      chan ThresholdKSRequestStruct
+	ContributionChannel chan ThresholdKSContributionStruct
+
+	// Protocol state data
+	TargetOfSwitch  *libunlynx.CipherVector
+	TargetPublicKey *kyber.Point
+
+	// Share is the share of the secret of the collective key held by this server and Threshold the number of shares
+	// needed to switch the ciphertexts (at the root)
+	Share     *share.PriShare
+	Threshold int
+
+	// Participants are the public keys of the servers that took part in the sharing, in the order of their share
+	// indices, and PubPoly its public polynomial: the root uses them to verify the contributions
+	Participants []kyber.Point
+	PubPoly      *share.PubPoly
+
+	// Contributors are the servers whose contributions were combined (at the root, once the protocol completed)
+	Contributors []*network.ServerIdentity
+
+	// Proofs (the public key of a proof is the public share of the server), ProofFunc is called with the proof of the
+	// contribution of this server
+	Proofs    bool
+	ProofFunc func(libunlynxkeyswitch.PublishedKSListProof)
+
+	rBs []kyber.Point
+}
+
+// NewThresholdKeySwitchingProtocol initializes the protocol instance.
+func NewThresholdKeySwitchingProtocol(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+	p := &ThresholdKeySwitchingProtocol{
+		TreeNodeInstance: n,
+		FeedbackChannel:  make(chan libunlynx.CipherVector, 1),
+	}
+
+	if err := p.RegisterChannel(&p.RequestChannel); err != nil {
+		return nil, fmt.Errorf("couldn't register request channel: %v", err)
+	}
+	if err := p.RegisterChannelLength(&p.ContributionChannel, len(n.Roster().List)); err != nil {
+		return nil, fmt.Errorf("couldn't register contribution channel: %v", err)
+	}
+	return p, nil
+}
+
+// Start is called at the root to begin the execution of the protocol.
+func (p *ThresholdKeySwitchingProtocol) Start() error {
+	if p.TargetOfSwitch == nil {
+		return fmt.Errorf("no ciphertext given as key switching target")
+	}
+	if p.TargetPublicKey == nil {
+		return fmt.Errorf("no new public key to be switched on provided")
+	}
+	if p.Share == nil || p.Threshold < 1 {
+		return fmt.Errorf("no share of the collective key")
+	}
+	if p.PubPoly == nil || len(p.Participants) == 0 {
+		return fmt.Errorf("no public polynomial to verify the contributions")
+	}
+
+	log.Lvl2("[THRESHOLD KEY SWITCHING PROTOCOL] <UnLynx> Server", p.ServerIdentity(), " started a Threshold Key Switching Protocol")
+
+	initialTab := make([]kyber.Point, len(*p.TargetOfSwitch)+1)
+	initialTab[0] = *p.TargetPublicKey
+	for i, v := range *p.TargetOfSwitch {
+		initialTab[i+1] = v.K
+	}
+	data, err := libunlynx.AbstractPointsToBytes(initialTab)
+	if err != nil {
+		return err
+	}
+	p.rBs = initialTab[1:]
+
+	// the contribution of the root is handled like the ones of the other servers
+	contribution, err := p.contribution(*p.TargetPublicKey, initialTab[1:])
+	if err != nil {
+		return err
+	}
+	p.ContributionChannel <- ThresholdKSContributionStruct{TreeNode: p.TreeNode(), ThresholdKSContributionMessage: *contribution}
+
+	// the unavailable servers are ignored
+	for _, tn := range p.List() {
+		if tn.ID.Equal(p.TreeNode().ID) {
+			continue
+		}
+		if err := p.SendTo(tn, &ThresholdKSRequestMessage{Data: data}); err != nil {
+			log.Warn("Root "+p.ServerIdentity().String()+" failed to send ThresholdKSRequestMessage to ", tn.ServerIdentity, ": ", err)
+		}
+	}
+	return nil
+}
+
+// Dispatch is called at each node and handle incoming messages.
+func (p *ThresholdKeySwitchingProtocol) Dispatch() error {
+	defer p.Done()
+
+	if !p.IsRoot() {
+		return p.contribute()
+	}
+
+	// the first contribution (the one of the root) is received once the protocol is started
+	contributions := make(map[int]libunlynx.CipherVector)
+	contributors := make([]*network.ServerIdentity, 0)
+	timeout := time.After(libunlynx.TIMEOUT)
+	for len(contributions) == 0 || len(contributions) < p.Threshold {
+		select {
+		case msg := <-p.ContributionChannel:
+			index, cv, err := p.verifyContribution(msg)
+			if err != nil {
+				log.Error("wrong contribution from ", msg.ServerIdentity, ": ", err)
+				continue
+			}
+			if _, ok := contributions[index]; ok {
+				continue
+			}
+			contributions[index] = cv
+			contributors = append(contributors, msg.ServerIdentity)
+		case <-timeout:
+			return fmt.Errorf("%s got %d key switching contributions out of %d", p.ServerIdentity(), len(contributions), p.Threshold)
+		}
+	}
+
+	ksCiphers, err := libunlynxkeyswitch.ThresholdKeySwitchCombination(*p.TargetOfSwitch, contributions)
+	if err != nil {
+		return err
+	}
+	p.Contributors = contributors
+	p.FeedbackChannel <- ksCiphers
+	return nil
+}
+
+// verifyContribution returns the share index of the sender of a contribution and its ciphertexts, after checking that
+// the sender is the participant of this index and that the contribution is proven with its public share
+func (p *ThresholdKeySwitchingProtocol) verifyContribution(msg ThresholdKSContributionStruct) (int, libunlynx.CipherVector, error) {
+	index := -1
+	for i, public := range p.Participants {
+		if public.Equal(msg.ServerIdentity.Public) {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return 0, nil, fmt.Errorf("the sender did not take part in the sharing of the collective key")
+	}
+	if msg.Index != int64(index) {
+		return 0, nil, fmt.Errorf("the sender claims the share of index %d instead of %d", msg.Index, index)
+	}
+
+	cv := libunlynx.CipherVector{}
+	if err := cv.FromBytes(msg.Data, int(msg.Length)); err != nil {
+		return 0, nil, err
+	}
+	// the root trusts its own contribution
+	if msg.TreeNode.ID.Equal(p.TreeNode().ID) {
+		return index, cv, nil
+	}
+
+	proof := libunlynxkeyswitch.PublishedKSListProof{}
+	if err := proof.FromBytes(msg.Proof); err != nil {
+		return 0, nil, err
+	}
+	if len(cv) != len(p.rBs) || len(proof.List) != len(cv) {
+		return 0, nil, fmt.Errorf("wrong number of ciphertexts or proofs")
+	}
+	pubShare := p.PubPoly.Eval(index).V
+	for k, pr := range proof.List {
+		rBNeg := libunlynx.SuiTe.Point().Neg(p.rBs[k])
+		if !pr.K.Equal(pubShare) || !pr.Q.Equal(*p.TargetPublicKey) || !pr.RbNeg.Equal(rBNeg) ||
+			!pr.ViB.Equal(cv[k].K) || !pr.Ks2.Equal(cv[k].C) {
+			return 0, nil, fmt.Errorf("the proof does not match the contribution")
+		}
+	}
+	if !libunlynxkeyswitch.KeySwitchListProofVerification(proof, 1.0) {
+		return 0, nil, fmt.Errorf("wrong key switching proof")
+	}
+	return index, cv, nil
+}
+
+// contribution computes the key switching contribution of this server with its share and proves it
+func (p *ThresholdKeySwitchingProtocol) contribution(targetPublicKey kyber.Point, rBs []kyber.Point) (*ThresholdKSContributionMessage, error) {
+	switchedCiphers, ks2s, rBNegs, vis := libunlynxkeyswitch.KeySwitchSequence(targetPublicKey, rBs, p.Share.V)
+	proof, err := libunlynxkeyswitch.KeySwitchListProofCreation(libunlynx.SuiTe.Point().Mul(p.Share.V, nil), targetPublicKey, p.Share.V, ks2s, rBNegs, vis)
+	if err != nil {
+		return nil, err
+	}
+	if p.Proofs {
+		p.ProofFunc(proof)
+	}
+	proofBytes, err := proof.ToBytes()
+	if err != nil {
+		return nil, err
+	}
+	data, length, err := switchedCiphers.ToBytes()
+	if err != nil {
+		return nil, err
+	}
+	return &ThresholdKSContributionMessage{Index: int64(p.Share.I), Length: int64(length), Data: data, Proof: proofBytes}, nil
+}
+
+// contribute waits for the request of the root and sends it the contribution of this server
+func (p *ThresholdKeySwitchingProtocol) contribute() error {
+	var request ThresholdKSRequestStruct
+	select {
+	case request = <-p.RequestChannel:
+	case <-time.After(libunlynx.TIMEOUT):
+		return fmt.Errorf("%s didn't get the <ThresholdKSRequestMessage> on time", p.ServerIdentity())
+	}
+	if p.Share == nil {
+		return fmt.Errorf("%s has no share of the collective key", p.ServerIdentity())
+	}
+
+	message, err := libunlynx.FromBytesToAbstractPoints(request.Data)
+	if err != nil {
+		return err
+	}
+	contribution, err := p.contribution(message[0], message[1:])
+	if err != nil {
+		return err
+	}
+	if err := p.SendTo(p.Root(), contribution); err != nil {
+		return fmt.Errorf("Node %s failed to send ThresholdKSContributionMessage: %v", p.ServerIdentity(), err)
+	}
+	return nil
+}
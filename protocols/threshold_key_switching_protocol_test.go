@@ -0,0 +1,86 @@
+package protocolsunlynx_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/protocols"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3/share"
+	"go.dedis.ch/kyber/v3/util/key"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/network"
+)
+
+// thresholdShares are the shares of the servers (by public key) in the threshold key switching test
+var thresholdShares = make(map[string]*share.PriShare)
+
+func TestThresholdKeySwitching(t *testing.T) {
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+	_, err := onet.GlobalProtocolRegister("ThresholdKSTest", NewThresholdKSTest)
+	assert.NoError(t, err, "Failed to register the ThresholdKSTest protocol")
+
+	_, entityList, tree := local.GenTree(5, true)
+	defer local.CloseAll()
+
+	// the collective key is shared among the 5 servers with threshold 3, one of them lost its share and another one
+	// uses a wrong share (its contribution is rejected)
+	secret := libunlynx.SuiTe.Scalar().Pick(libunlynx.SuiTe.RandomStream())
+	poly := share.NewPriPoly(libunlynx.SuiTe, 3, secret, libunlynx.SuiTe.RandomStream())
+	shares := poly.Shares(5)
+	for i, si := range entityList.List {
+		if i != 3 {
+			thresholdShares[si.Public.String()] = shares[i]
+		}
+	}
+	thresholdShares[entityList.List[1].Public.String()] = &share.PriShare{I: 1, V: libunlynx.SuiTe.Scalar().Pick(libunlynx.SuiTe.RandomStream())}
+	collectiveKey := libunlynx.SuiTe.Point().Mul(secret, nil)
+
+	rootInstance, err := local.CreateProtocol("ThresholdKSTest", tree)
+	require.NoError(t, err)
+	protocol := rootInstance.(*protocolsunlynx.ThresholdKeySwitchingProtocol)
+
+	data := []int64{1, 2, 3, 6, 7, 8, 9, 7}
+	cv := *libunlynx.EncryptIntVector(collectiveKey, data)
+	client := key.NewKeyPair(libunlynx.SuiTe)
+
+	protocol.TargetOfSwitch = &cv
+	protocol.TargetPublicKey = &client.Public
+	protocol.Threshold = 3
+	protocol.Participants = entityList.Publics()
+	protocol.PubPoly = poly.Commit(nil)
+
+	go func() {
+		assert.NoError(t, protocol.Start())
+	}()
+
+	timeout := network.WaitRetry * time.Duration(network.MaxRetryConnect*10) * time.Millisecond
+	select {
+	case encryptedResult := <-protocol.FeedbackChannel:
+		res, err := libunlynx.DecryptIntVector(client.Private, &encryptedResult)
+		assert.NoError(t, err)
+		if !reflect.DeepEqual(res, data) {
+			t.Fatal("Wrong results, expected", data, "but got", res)
+		}
+		assert.Equal(t, 3, len(protocol.Contributors))
+		for _, si := range protocol.Contributors {
+			assert.False(t, si.Equal(entityList.List[1]))
+		}
+	case <-time.After(timeout):
+		t.Fatal("Didn't finish in time")
+	}
+}
+
+// NewThresholdKSTest is a special purpose protocol constructor specific to tests.
+func NewThresholdKSTest(tni *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+	pi, err := protocolsunlynx.NewThresholdKeySwitchingProtocol(tni)
+	if err != nil {
+		return nil, err
+	}
+	protocol := pi.(*protocolsunlynx.ThresholdKeySwitchingProtocol)
+	protocol.Share = thresholdShares[tni.Public().String()]
+	return protocol, nil
+}
@@ -26,7 +26,9 @@ func TestRetrieveSimpleDataFromMap(t *testing.T) {
 	result, err := protocolsunlynx.RetrieveSimpleDataFromMap(mapToTest)
 	assert.Nil(t, err)
 	for i, v := range result {
-		assert.Equal(t, int64(i), libunlynx.DecryptInt(secKey, v))
+		decrypted, err := libunlynx.DecryptInt(secKey, v)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(i), decrypted)
 	}
 }
 
@@ -39,6 +39,12 @@ type AddRmServerProtocol struct {
 	KeyToRm                kyber.Scalar
 	Proofs                 bool
 	Add                    bool
+
+	// ProofFunc is called with the proofs of the transformation when Proofs is set (e.g. to send them to the servers
+	// holding the ciphertexts)
+	ProofFunc func(proofs libunlynxaddrm.PublishedAddRmListProof)
+
+	finalResult chan []libunlynx.CipherText
 }
 
 // NewAddRmProtocol is constructor of add/rm protocol instances.
@@ -46,13 +52,12 @@ func NewAddRmProtocol(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
 	pvp := &AddRmServerProtocol{
 		TreeNodeInstance: n,
 		FeedbackChannel:  make(chan []libunlynx.CipherText),
+		finalResult:      make(chan []libunlynx.CipherText, 1),
 	}
 
 	return pvp, nil
 }
 
-var finalResultAddrm = make(chan []libunlynx.CipherText)
-
 // Start is called at the root to start the execution of the Add/Rm protocol.
 func (p *AddRmServerProtocol) Start() error {
 
@@ -85,7 +90,11 @@ func (p *AddRmServerProtocol) Start() error {
 
 	libunlynx.EndTimer(roundProof)
 
-	finalResultAddrm <- result
+	if p.Proofs && p.ProofFunc != nil {
+		p.ProofFunc(proofs)
+	}
+
+	p.finalResult <- result
 	return nil
 }
 
@@ -95,9 +104,9 @@ func (p *AddRmServerProtocol) Dispatch() error {
 
 	var finalResultMessage []libunlynx.CipherText
 	select {
-	case finalResultMessage = <-finalResultAddrm:
+	case finalResultMessage = <-p.finalResult:
 	case <-time.After(libunlynx.TIMEOUT):
-		return fmt.Errorf(p.ServerIdentity().String() + " didn't get the <finalResultMessage> on time")
+		return fmt.Errorf("%s didn't get the <finalResultMessage> on time", p.ServerIdentity())
 	}
 
 	p.FeedbackChannel <- finalResultMessage
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/lib/add_rm"
 	"github.com/stretchr/testify/assert"
 	"go.dedis.ch/kyber/v3/util/random"
 	"go.dedis.ch/onet/v3"
@@ -48,6 +49,10 @@ func TestAddRmServer(t *testing.T) {
 	feedback := protocol.FeedbackChannel
 	protocol.Add = false
 	protocol.KeyToRm = secKeyAddRm
+	var proofs libunlynxaddrm.PublishedAddRmListProof
+	protocol.ProofFunc = func(p libunlynxaddrm.PublishedAddRmListProof) {
+		proofs = p
+	}
 
 	go func() {
 		err := protocol.Start()
@@ -62,9 +67,13 @@ func TestAddRmServer(t *testing.T) {
 		log.Lvl1(results)
 		decryptedResult := make([]int64, 2)
 		for i, v := range results {
-			decryptedResult[i] = libunlynx.DecryptInt(secKeyAfter, v)
+			var err error
+			decryptedResult[i], err = libunlynx.DecryptInt(secKeyAfter, v)
+			assert.NoError(t, err)
 		}
 		assert.Equal(t, decryptedResult, expectedResults)
+		assert.Equal(t, len(tab), len(proofs.List))
+		assert.True(t, libunlynxaddrm.AddRmListProofVerification(proofs, 1.0))
 	case <-time.After(timeout):
 		t.Fatal("Didn't finish in time")
 
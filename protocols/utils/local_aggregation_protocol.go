@@ -88,7 +88,7 @@ func (p *LocalAggregationProtocol) Dispatch() error {
 	select {
 	case finalResultMessage = <-finalResultAggr:
 	case <-time.After(libunlynx.TIMEOUT):
-		return fmt.Errorf(p.ServerIdentity().String() + " didn't get the <finalResultMessage> on time")
+		return fmt.Errorf("%s didn't get the <finalResultMessage> on time", p.ServerIdentity())
 	}
 
 	p.FeedbackChannel <- finalResultMessage
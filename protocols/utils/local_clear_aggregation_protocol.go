@@ -62,7 +62,7 @@ func (p *LocalClearAggregationProtocol) Dispatch() error {
 	select {
 	case finalResultMessage = <-finalResultClearAggr:
 	case <-time.After(libunlynx.TIMEOUT):
-		return fmt.Errorf(p.ServerIdentity().String() + " didn't get the <finalResultMessage> on time")
+		return fmt.Errorf("%s didn't get the <finalResultMessage> on time", p.ServerIdentity())
 	}
 
 	p.FeedbackChannel <- finalResultMessage
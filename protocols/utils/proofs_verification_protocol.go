@@ -11,6 +11,7 @@ import (
 	"github.com/ldsec/unlynx/lib/deterministic_tag"
 	"github.com/ldsec/unlynx/lib/key_switch"
 	"github.com/ldsec/unlynx/lib/shuffle"
+	"go.dedis.ch/kyber/v3"
 	"go.dedis.ch/onet/v3"
 	"go.dedis.ch/onet/v3/log"
 	"time"
@@ -38,6 +39,10 @@ type ProofsToVerify struct {
 	CollectiveAggregationProofs libunlynxaggr.PublishedAggregationListProof
 }
 
+// ProofsKinds are the names of the proofs checked by VerifyProofs, in the order of its results.
+var ProofsKinds = []string{"key switching", "deterministic tagging (creation)", "deterministic tagging (addition)",
+	"local aggregation", "shuffling", "collective aggregation"}
+
 // ProofsVerificationProtocol is a struct holding the state of a protocol instance.
 type ProofsVerificationProtocol struct {
 	*onet.TreeNodeInstance
@@ -63,46 +68,51 @@ var finalResult = make(chan []bool)
 
 // Start is called at the root to start the execution of the key switching.
 func (p *ProofsVerificationProtocol) Start() error {
+	finalResult <- VerifyProofs(p.Name(), p.TargetOfVerification, p.Roster().Aggregate)
+	return nil
+}
 
+// VerifyProofs checks all the proofs in ptv (the timers are prefixed by name) and returns one result per kind of proof
+// (see ProofsKinds).
+func VerifyProofs(name string, ptv ProofsToVerify, collectiveKey kyber.Point) []bool {
 	// we have 6 different types of proofs (check ProofsToVerify struct)
 	result := make([]bool, 6)
 
 	// key switching ***************************************************************************************************
-	keySwitchTime := libunlynx.StartTimer(p.Name() + "_KeySwitchingVerif")
-	result[0] = libunlynxkeyswitch.KeySwitchListProofVerification(p.TargetOfVerification.KeySwitchingProofs, 1.0)
+	keySwitchTime := libunlynx.StartTimer(name + "_KeySwitchingVerif")
+	result[0] = libunlynxkeyswitch.KeySwitchListProofVerification(ptv.KeySwitchingProofs, 1.0)
 	libunlynx.EndTimer(keySwitchTime)
 
 	// deterministic tagging (creation) ********************************************************************************
-	detTagTime := libunlynx.StartTimer(p.Name() + "_DetTagVerif")
-	result[1] = libunlynxdetertag.DeterministicTagCrListProofVerification(p.TargetOfVerification.DetTagCreationProofs, 1.0)
+	detTagTime := libunlynx.StartTimer(name + "_DetTagVerif")
+	result[1] = libunlynxdetertag.DeterministicTagCrListProofVerification(ptv.DetTagCreationProofs, 1.0)
 	libunlynx.EndTimer(detTagTime)
 
 	// deterministic tagging (addition) ********************************************************************************
 
-	detTagAddTime := libunlynx.StartTimer(p.Name() + "_DetTagAddVerif")
-	result[2] = libunlynxdetertag.DeterministicTagAdditionListProofVerification(p.TargetOfVerification.DetTagAdditionProofs, 1.0)
+	detTagAddTime := libunlynx.StartTimer(name + "_DetTagAddVerif")
+	result[2] = libunlynxdetertag.DeterministicTagAdditionListProofVerification(ptv.DetTagAdditionProofs, 1.0)
 	libunlynx.EndTimer(detTagAddTime)
 
 	// local aggregation ***********************************************************************************************
 
-	localAggrTime := libunlynx.StartTimer(p.Name() + "_LocalAggrVerif")
-	result[3] = libunlynxaggr.AggregationListProofVerification(p.TargetOfVerification.AggregationProofs, 1.0)
+	localAggrTime := libunlynx.StartTimer(name + "_LocalAggrVerif")
+	result[3] = libunlynxaggr.AggregationListProofVerification(ptv.AggregationProofs, 1.0)
 	libunlynx.EndTimer(localAggrTime)
 
 	// shuffling *******************************************************************************************************
 
-	shufflingTime := libunlynx.StartTimer(p.Name() + "_ShufflingVerif")
-	result[4] = libunlynxshuffle.ShuffleListProofVerification(p.TargetOfVerification.ShufflingProofs, p.Roster().Aggregate, 1.0)
+	shufflingTime := libunlynx.StartTimer(name + "_ShufflingVerif")
+	result[4] = libunlynxshuffle.ShuffleListProofVerification(ptv.ShufflingProofs, collectiveKey, 1.0)
 	libunlynx.EndTimer(shufflingTime)
 
 	// collective aggregation ******************************************************************************************
 
-	collectiveAggrTime := libunlynx.StartTimer(p.Name() + "_CollectiveAggrVerif")
-	result[5] = libunlynxaggr.AggregationListProofVerification(p.TargetOfVerification.CollectiveAggregationProofs, 1.0)
+	collectiveAggrTime := libunlynx.StartTimer(name + "_CollectiveAggrVerif")
+	result[5] = libunlynxaggr.AggregationListProofVerification(ptv.CollectiveAggregationProofs, 1.0)
 	libunlynx.EndTimer(collectiveAggrTime)
 
-	finalResult <- result
-	return nil
+	return result
 }
 
 // Dispatch is called on each node. It waits for incoming messages and handle them.
@@ -113,7 +123,7 @@ func (p *ProofsVerificationProtocol) Dispatch() error {
 	select {
 	case finalResultMessage = <-finalResult:
 	case <-time.After(libunlynx.TIMEOUT):
-		return fmt.Errorf(p.ServerIdentity().String() + " didn't get the <finalResultMessage> on time")
+		return fmt.Errorf("%s didn't get the <finalResultMessage> on time", p.ServerIdentity())
 	}
 
 	p.FeedbackChannel <- finalResultMessage
@@ -1,15 +1,40 @@
 package servicesunlynx
 
 import (
+	"fmt"
+	"github.com/ldsec/unlynx/data"
 	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/lib/differential_privacy"
+	"github.com/ldsec/unlynx/lib/range"
 	"go.dedis.ch/kyber/v3"
 	"go.dedis.ch/kyber/v3/util/key"
 	"go.dedis.ch/onet/v3"
 	"go.dedis.ch/onet/v3/log"
 	"go.dedis.ch/onet/v3/network"
+	"io/ioutil"
 	"sync"
+	"time"
 )
 
+// SurveyResults are the decrypted results of a survey: for each group the values of its group by attributes, the
+// aggregates (decoded with the types of the aggregating attributes) and the results of the aggregate operations.
+type SurveyResults struct {
+	GroupBy    [][]int64
+	Aggregates [][]float64
+	Types      []libunlynx.AttributeType
+
+	// Columns are the names of the aggregating attributes and Statistics the results of the Operations
+	Columns    []string
+	Operations []libunlynx.Operation
+	Statistics [][]float64
+
+	// Participants is the number of data providers whose data is in the results
+	Participants int64
+}
+
+// ResultsPollingInterval is the time between two fetches of the results of a survey while they are computed
+var ResultsPollingInterval = 200 * time.Millisecond
+
 // API represents a client with the server to which he is connected and its public/private key pair.
 type API struct {
 	*onet.Client
@@ -21,7 +46,13 @@ type API struct {
 
 // NewUnLynxClient constructor of a client.
 func NewUnLynxClient(entryPoint *network.ServerIdentity, clientID string) *API {
-	keys := key.NewKeyPair(libunlynx.SuiTe)
+	return NewUnLynxClientWithKeys(entryPoint, clientID, key.NewKeyPair(libunlynx.SuiTe))
+}
+
+// NewUnLynxClientWithKeys constructor of a client with a given key pair (a querier keeps the same key pair to be
+// identified by the servers, e.g. for its privacy budget).
+func NewUnLynxClientWithKeys(entryPoint *network.ServerIdentity, clientID string, keys *key.Pair) *API {
+	libunlynx.FreezeSuite()
 	newClient := &API{
 
 		Client:     onet.NewClient(libunlynx.SuiTe, ServiceName),
@@ -36,12 +67,68 @@ func NewUnLynxClient(entryPoint *network.ServerIdentity, clientID string) *API {
 // Send Query
 //______________________________________________________________________________________________________________________
 
-// SendSurveyCreationQuery creates a survey based on a set of entities (servers) and a survey description.
-func (c *API) SendSurveyCreationQuery(entities *onet.Roster, surveyID SurveyID, clientPubKey kyber.Point, nbrDPs map[string]int64, proofs, appFlag bool, sum []string, count bool, where []libunlynx.WhereQueryAttribute, predicate string, groupBy []string) (*SurveyID, error) {
+// SurveyOptions are the optional parameters of a survey, the zero value creates a survey without any of them.
+type SurveyOptions struct {
+	// Dataset is the name of the queried dataset (see SchemaRegistration)
+	Dataset string
+	// WhereRange are the range conditions on the where attributes and Operations the aggregate operations on the
+	// aggregating attributes (see OperationColumns)
+	WhereRange []libunlynx.WhereQueryRange
+	Operations []libunlynx.Operation
+	Types      map[string]libunlynx.AttributeType
+	// Bounds are the intervals of the aggregating attributes that the data providers must prove (see EffectiveBounds)
+	Bounds []libunlynxrange.Bound
+	// if Deadline is set, the servers stop collecting data after this time and compute the results if at least Quorum
+	// data providers (all the servers together) have sent their data
+	Deadline time.Duration
+	Quorum   int64
+	// ExpectedRows is the number of response rows the data providers are expected to send (see
+	// SurveyCreationQuery.ExpectedRows)
+	ExpectedRows int64
+	// CollectiveKey is the key under which the data is encrypted (see SendDKGQuery), the aggregate key of the roster
+	// if it is nil
+	CollectiveKey kyber.Point
+	DiffPri       libunlynxdiffprivacy.Params
+}
+
+// SendSurveyCreationQuery creates a survey based on a set of entities (servers), a survey description and its options.
+func (c *API) SendSurveyCreationQuery(entities *onet.Roster, surveyID SurveyID, clientPubKey kyber.Point, nbrDPs map[string]int64, proofs, appFlag bool, sum []string, count bool, where []libunlynx.WhereQueryAttribute, predicate string, groupBy []string, options SurveyOptions) (*SurveyID, error) {
 	log.Lvl1(c, "is creating a survey with id: ", surveyID)
 
 	var newSurveyID SurveyID
 
+	// the columns needed by the aggregate operations are aggregated too
+	for _, op := range options.Operations {
+		if err := op.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	sum, count = libunlynx.OperationColumns(sum, count, options.Operations)
+
+	// the types are sent in the order of the aggregating attributes
+	var sumTypes []libunlynx.AttributeType
+	if len(options.Types) > 0 {
+		sumTypes = make([]libunlynx.AttributeType, len(sum))
+		for i, name := range sum {
+			if attribute, ok := libunlynx.SquareOf(name); ok {
+				sumTypes[i] = libunlynx.SquareType(options.Types[attribute])
+			} else {
+				sumTypes[i] = options.Types[name]
+			}
+		}
+	}
+	for name := range options.Types {
+		found := false
+		for _, v := range sum {
+			if v == name {
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("attribute %s has a type but is not aggregated", name)
+		}
+	}
+
 	scq := SurveyCreationQuery{
 		SurveyID:     surveyID,
 		Roster:       *entities,
@@ -49,13 +136,32 @@ func (c *API) SendSurveyCreationQuery(entities *onet.Roster, surveyID SurveyID,
 		MapDPs:       nbrDPs,
 		Proofs:       proofs,
 		AppFlag:      appFlag,
+		Quorum:       options.Quorum,
+		ExpectedRows: options.ExpectedRows,
+		Suite:        libunlynx.SuiTe.String(),
+
+		CollectiveKey: options.CollectiveKey,
 
 		// query statement
-		Sum:       sum,
-		Count:     count,
-		Where:     where,
-		Predicate: predicate,
-		GroupBy:   groupBy,
+		Dataset:    options.Dataset,
+		Sum:        sum,
+		Count:      count,
+		Where:      where,
+		WhereRange: options.WhereRange,
+		Predicate:  predicate,
+		GroupBy:    groupBy,
+
+		Types:      sumTypes,
+		Operations: options.Operations,
+		Bounds:     options.Bounds,
+
+		DiffPri: options.DiffPri,
+	}
+	if options.Deadline > 0 {
+		scq.Deadline = time.Now().Add(options.Deadline).UnixNano()
+	}
+	if err := scq.Sign(c.private); err != nil {
+		return nil, err
 	}
 	resp := ServiceState{}
 	err := c.SendProtobuf(c.entryPoint, &scq, &resp)
@@ -68,27 +174,160 @@ func (c *API) SendSurveyCreationQuery(entities *onet.Roster, surveyID SurveyID,
 	return &newSurveyID, nil
 }
 
-// SendSurveyResponseQuery handles the encryption and sending of DP responses
-func (c *API) SendSurveyResponseQuery(surveyID SurveyID, clearClientResponses []libunlynx.DpClearResponse, groupKey kyber.Point, dataRepetitions int, count bool) error {
+// SendSurveySQLQuery creates a survey from an SQL-like query (see ParseQuery), the ranges compare values of rangeBits
+// bits. The dataset, the range conditions and the aggregate operations of the options are the ones of the query.
+func (c *API) SendSurveySQLQuery(entities *onet.Roster, surveyID SurveyID, clientPubKey kyber.Point, nbrDPs map[string]int64, proofs, appFlag bool, query string, rangeBits int64, options SurveyOptions) (*SurveyID, error) {
+	key := entities.Aggregate
+	if options.CollectiveKey != nil {
+		key = options.CollectiveKey
+	}
+	scq, err := ParseQueryWithKey(entities, key, query, rangeBits)
+	if err != nil {
+		return nil, err
+	}
+	options.Dataset, options.WhereRange, options.Operations = scq.Dataset, scq.WhereRange, scq.Operations
+	return c.SendSurveyCreationQuery(entities, surveyID, clientPubKey, nbrDPs, proofs, appFlag, scq.Sum, scq.Count, scq.Where, scq.Predicate, scq.GroupBy, options)
+}
+
+// SendDKGQuery asks the servers of a roster to generate a collective key whose secret is shared among them, any
+// threshold of them being enough to switch the results of a survey encrypted under this key.
+func (c *API) SendDKGQuery(entities *onet.Roster, threshold int64) (kyber.Point, error) {
+	resp := DKGResponse{}
+	if err := c.SendProtobuf(c.entryPoint, &DKGQuery{Roster: *entities, Threshold: threshold}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.CollectiveKey, nil
+}
+
+// SendRosterChangeQuery adds the entry point of the client to (add) or removes it from the roster of the surveys that
+// are collecting data, the query is signed with the private key of this server and with the key pair of the client,
+// which must be the one of an administrator of the servers. It returns the new roster of the surveys, its aggregate key
+// is their new collective key.
+func (c *API) SendRosterChangeQuery(entities *onet.Roster, private kyber.Scalar, add bool) (*onet.Roster, error) {
+	query := RosterChangeQuery{Roster: *entities, Server: c.entryPoint, Add: add}
+	if err := query.Sign(private); err != nil {
+		return nil, err
+	}
+	if err := query.SignAdmin(c.private); err != nil {
+		return nil, err
+	}
+	resp := RosterChangeResponse{}
+	if err := c.SendProtobuf(c.entryPoint, &query, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Roster, nil
+}
+
+// SendSurveyResponseQuery handles the encryption and sending of DP responses, the aggregating attributes are encoded with
+// the types of the survey and completed with the columns needed by its aggregate operations and range conditions (ranges
+// are the number of bits of the where attributes compared with ranges). The encrypted aggregating attributes with a bound
+// are sent with a range proof.
+func (c *API) SendSurveyResponseQuery(surveyID SurveyID, clearClientResponses []libunlynx.DpClearResponse, groupKey kyber.Point, dataRepetitions int, count bool, types map[string]libunlynx.AttributeType, operations []libunlynx.Operation, ranges map[string]int64, bounds []libunlynxrange.Bound) error {
 	log.Lvl1(c, " sends a result for survey ", surveyID)
 	var err error
 
-	s, err := EncryptDataToSurvey(c.String(), surveyID, clearClientResponses, groupKey, dataRepetitions, count)
+	s, err := EncryptDataToSurvey(c.String(), surveyID, clearClientResponses, groupKey, dataRepetitions, count, types, operations, ranges, bounds)
 	if err != nil {
 		return err
 	}
+	return c.SendEncryptedSurveyResponseQuery(s)
+}
 
+// SendEncryptedSurveyResponseQuery signs with the key pair of the client (the long-term key of the data provider) and
+// sends DP responses already encrypted (e.g. by EncryptDataToSurvey).
+func (c *API) SendEncryptedSurveyResponseQuery(s *SurveyResponseQuery) error {
+	if err := s.Sign(c.private, c.entryPoint.Public); err != nil {
+		return err
+	}
 	resp := ServiceState{}
 	return c.SendProtobuf(c.entryPoint, s, &resp)
 }
 
-// SendSurveyResultsQuery to get the result from associated server and decrypt the response using its private key.
+// SendSurveyResultsQuery to get the result from associated server and decrypt the response using its private key. The
+// aggregates are the encoded values of their attribute (e.g. fixed-point values are scaled), see
+// SendSurveyTypedResultsQuery for the decoded values.
 func (c *API) SendSurveyResultsQuery(surveyID SurveyID) (*[][]int64, *[][]int64, error) {
+	grp, aggr, _, err := c.getSurveyResults(surveyID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &grp, &aggr, nil
+}
+
+// SendSurveyTypedResultsQuery gets and decrypts the results of a survey like SendSurveyResultsQuery, the aggregates
+// being decoded with the type of their attribute. The aggregate operations of the survey are computed from them.
+func (c *API) SendSurveyTypedResultsQuery(surveyID SurveyID) (*SurveyResults, error) {
+	grp, aggr, resp, err := c.getSurveyResults(surveyID)
+	if err != nil {
+		return nil, err
+	}
+
+	results := SurveyResults{GroupBy: grp, Aggregates: make([][]float64, len(aggr)), Types: resp.Types,
+		Columns: resp.Columns, Operations: resp.Operations, Statistics: make([][]float64, len(aggr)), Participants: resp.Participants}
+	for i, values := range aggr {
+		results.Aggregates[i] = make([]float64, len(values))
+		columns := make(map[string]float64, len(values))
+		for j, v := range values {
+			if j < len(resp.Types) {
+				results.Aggregates[i][j] = resp.Types[j].Decode(v)
+			} else {
+				results.Aggregates[i][j] = float64(v)
+			}
+			if j < len(resp.Columns) {
+				columns[resp.Columns[j]] = results.Aggregates[i][j]
+			}
+		}
+
+		results.Statistics[i] = make([]float64, len(resp.Operations))
+		for k, op := range resp.Operations {
+			results.Statistics[i][k], err = op.Evaluate(columns)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &results, nil
+}
+
+// StartSurveyResultsQuery asks the entry point to compute the results of a survey (switched to the key of the client),
+// it returns once the computation is started. The results are then fetched with SendSurveyResultFetch.
+func (c *API) StartSurveyResultsQuery(surveyID SurveyID) error {
 	log.Lvl1(c, " asks for the results of the survey ", surveyID)
+	resq := SurveyResultsQuery{SurveyID: surveyID, ClientPublic: c.public}
+	if err := resq.Sign(c.private); err != nil {
+		return err
+	}
+	return c.SendProtobuf(c.entryPoint, &resq, &ServiceState{})
+}
+
+// SendSurveyResultFetch fetches the (encrypted) results of a survey from the entry point. If they are not computed yet,
+// the result is Pending and its Phase is the phase of the survey. Once fetched, the results are released by the server.
+func (c *API) SendSurveyResultFetch(surveyID SurveyID) (*ServiceResult, error) {
+	recq := SurveyResultFetch{SurveyID: surveyID}
+	if err := recq.Sign(c.private); err != nil {
+		return nil, err
+	}
 	resp := ServiceResult{}
-	err := c.SendProtobuf(c.entryPoint, &SurveyResultsQuery{false, surveyID, c.public}, &resp)
+	if err := c.SendProtobuf(c.entryPoint, &recq, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// getSurveyResults gets the results of a survey (it waits for them to be computed) and decrypts them, the aggregates
+// can be negative if their type is signed
+func (c *API) getSurveyResults(surveyID SurveyID) ([][]int64, [][]int64, *ServiceResult, error) {
+	if err := c.StartSurveyResultsQuery(surveyID); err != nil {
+		return nil, nil, nil, err
+	}
+	resp, err := c.SendSurveyResultFetch(surveyID)
+	for err == nil && resp.Pending {
+		log.Lvl2(c, " waits for the results of the survey ", surveyID, " (", resp.Phase, " phase)")
+		time.Sleep(ResultsPollingInterval)
+		resp, err = c.SendSurveyResultFetch(surveyID)
+	}
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
 	log.Lvl1(c, " got the survey result from ", c.entryPoint)
@@ -96,17 +335,102 @@ func (c *API) SendSurveyResultsQuery(surveyID SurveyID) (*[][]int64, *[][]int64,
 	grp := make([][]int64, len(resp.Results))
 	aggr := make([][]int64, len(resp.Results))
 	for i, res := range resp.Results {
-		grp[i] = libunlynx.DecryptIntVector(c.private, &res.GroupByEnc)
-		aggr[i] = libunlynx.DecryptIntVector(c.private, &res.AggregatingAttributes)
+		grp[i], err = libunlynx.DecryptIntVector(c.private, &res.GroupByEnc)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		aggr[i], err = libunlynx.DecryptAttributes(c.private, &res.AggregatingAttributes, resp.Types)
+		if err != nil {
+			return nil, nil, nil, err
+		}
 	}
-	return &grp, &aggr, nil
+	return grp, aggr, resp, nil
+}
+
+// SendSurveyListQuery lists the surveys of the client (as querier) known by the entry point.
+func (c *API) SendSurveyListQuery() ([]SurveyStatus, error) {
+	auth, err := newQuerierSignature(c.private, "survey listing", "")
+	if err != nil {
+		return nil, err
+	}
+	resp := SurveyList{}
+	err = c.SendProtobuf(c.entryPoint, &SurveyListQuery{Auth: auth}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Surveys, nil
+}
+
+// SendSurveyStatusQuery asks the entry point for the status of a survey of the client (as querier).
+func (c *API) SendSurveyStatusQuery(surveyID SurveyID) (*SurveyStatus, error) {
+	auth, err := newQuerierSignature(c.private, "status query", surveyID)
+	if err != nil {
+		return nil, err
+	}
+	return c.sendSurveyStatusQuery(&SurveyStatusQuery{SurveyID: surveyID, Auth: auth})
+}
+
+// SendSurveyDpStatusQuery asks the entry point for what a data provider needs to send its data to a survey (the status
+// of the survey without its progress).
+func (c *API) SendSurveyDpStatusQuery(surveyID SurveyID) (*SurveyStatus, error) {
+	return c.sendSurveyStatusQuery(&SurveyStatusQuery{SurveyID: surveyID})
+}
+
+func (c *API) sendSurveyStatusQuery(recq *SurveyStatusQuery) (*SurveyStatus, error) {
+	resp := SurveyStatus{}
+	err := c.SendProtobuf(c.entryPoint, recq, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// SendSurveyCancelQuery cancels a survey of the client (as querier) and deletes it from all the servers (it can also
+// be used to delete a survey once its results were retrieved).
+func (c *API) SendSurveyCancelQuery(surveyID SurveyID) error {
+	log.Lvl1(c, " cancels the survey ", surveyID)
+	auth, err := newQuerierSignature(c.private, "cancellation", surveyID)
+	if err != nil {
+		return err
+	}
+	resp := ServiceState{}
+	return c.SendProtobuf(c.entryPoint, &SurveyCancelQuery{SurveyID: surveyID, Auth: auth}, &resp)
+}
+
+// SendSchemaRegistration registers (or replaces) the schema of a dataset on every server of a roster, the key pair of
+// the client must be the one of an administrator of the servers.
+func (c *API) SendSchemaRegistration(entities *onet.Roster, schema dataunlynx.Schema) error {
+	log.Lvl1(c, " registers the schema of dataset ", schema.Dataset)
+	if err := schema.Validate(); err != nil {
+		return err
+	}
+	recq := SchemaRegistration{Schema: schema}
+	if err := recq.Sign(c.private); err != nil {
+		return err
+	}
+	for _, server := range entities.List {
+		resp := ServiceState{}
+		if err := c.SendProtobuf(server, &recq, &resp); err != nil {
+			return fmt.Errorf("could not register the schema on %s: %v", server, err)
+		}
+	}
+	return nil
+}
+
+// SendSchemaQuery gets the schema of a dataset from the entry point.
+func (c *API) SendSchemaQuery(dataset string) (*dataunlynx.Schema, error) {
+	resp := SchemaResponse{}
+	if err := c.SendProtobuf(c.entryPoint, &SchemaQuery{Dataset: dataset}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Schema, nil
 }
 
 // Helper Functions
 //______________________________________________________________________________________________________________________
 
 // EncryptDataToSurvey is used to encrypt client responses with the collective key
-func EncryptDataToSurvey(name string, surveyID SurveyID, dpClearResponses []libunlynx.DpClearResponse, groupKey kyber.Point, dataRepetitions int, count bool) (*SurveyResponseQuery, error) {
+func EncryptDataToSurvey(name string, surveyID SurveyID, dpClearResponses []libunlynx.DpClearResponse, groupKey kyber.Point, dataRepetitions int, count bool, types map[string]libunlynx.AttributeType, operations []libunlynx.Operation, ranges map[string]int64, bounds []libunlynxrange.Bound) (*SurveyResponseQuery, error) {
 	nbrResponses := len(dpClearResponses)
 
 	log.Lvl1(name, " responds with ", nbrResponses, " response(s)")
@@ -128,7 +452,10 @@ func EncryptDataToSurvey(name string, surveyID SurveyID, dpClearResponses []libu
 			i = i * dataRepetitions
 			if i < len(dpResponses) {
 				var tmpErr error
-				dpResponses[i], tmpErr = libunlynx.EncryptDpClearResponse(v, groupKey, count)
+				dpResponses[i], tmpErr = libunlynx.EncryptDpClearResponse(v, groupKey, count, types, operations, ranges)
+				if tmpErr == nil {
+					tmpErr = attachRangeProofs(&dpResponses[i], v, groupKey, count, types, operations, bounds)
+				}
 				if tmpErr != nil {
 					mutex.Lock()
 					err = tmpErr
@@ -143,6 +470,7 @@ func EncryptDataToSurvey(name string, surveyID SurveyID, dpClearResponses []libu
 					dpResponses[i+j].WhereEnc = dpResponses[i].WhereEnc
 					dpResponses[i+j].AggregatingAttributesClear = dpResponses[i].AggregatingAttributesClear
 					dpResponses[i+j].AggregatingAttributesEnc = dpResponses[i].AggregatingAttributesEnc
+					dpResponses[i+j].RangeProofs = dpResponses[i].RangeProofs
 				}
 			}
 		}(i, v)
@@ -154,7 +482,33 @@ func EncryptDataToSurvey(name string, surveyID SurveyID, dpClearResponses []libu
 		return nil, err
 	}
 
-	return &SurveyResponseQuery{SurveyID: surveyID, Responses: dpResponses}, nil
+	return &SurveyResponseQuery{SurveyID: surveyID, Responses: dpResponses, Suite: libunlynx.SuiTe.String()}, nil
+}
+
+// SaveSurveyResponseQuery writes encrypted DP responses to a file, to send them later (see LoadSurveyResponseQuery).
+func SaveSurveyResponseQuery(filename string, s *SurveyResponseQuery) error {
+	data, err := network.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, data, 0600)
+}
+
+// LoadSurveyResponseQuery reads encrypted DP responses written by SaveSurveyResponseQuery.
+func LoadSurveyResponseQuery(filename string) (*SurveyResponseQuery, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	_, msg, err := network.Unmarshal(data, libunlynx.SuiTe)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := msg.(*SurveyResponseQuery)
+	if !ok {
+		return nil, fmt.Errorf("%s does not contain encrypted DP responses", filename)
+	}
+	return s, nil
 }
 
 // String permits to have the string representation of a client.
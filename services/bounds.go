@@ -0,0 +1,166 @@
+package servicesunlynx
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/lib/range"
+	"go.dedis.ch/kyber/v3"
+)
+
+// Bounds of the aggregating attributes
+//______________________________________________________________________________________________________________________
+
+// EffectiveBounds returns the bounds that the encrypted aggregating attributes (sum) of the responses must be proven
+// to respect: the declared bounds, the bounds of the squares of the bounded attributes and the count column (always 1).
+// The count column is bounded even if no bound is declared, so that a data provider cannot count a response several
+// times.
+func EffectiveBounds(bounds []libunlynxrange.Bound, sum []string, count bool) []libunlynxrange.Bound {
+	if len(bounds) == 0 && !count {
+		return nil
+	}
+	effective := append([]libunlynxrange.Bound{}, bounds...)
+	for _, column := range sum {
+		attribute, ok := libunlynx.SquareOf(column)
+		if !ok {
+			continue
+		}
+		for _, b := range bounds {
+			if b.Attribute == attribute {
+				// the squared values are limited to MaxInt32 (see libunlynx.EncodeAggregatingAttributes)
+				max := math.Max(math.Abs(float64(b.Min)), math.Abs(float64(b.Max)))
+				max = math.Min(max, math.MaxInt32)
+				min := 0.0
+				if b.Min > 0 || b.Max < 0 {
+					min = math.Min(math.Abs(float64(b.Min)), math.Abs(float64(b.Max)))
+					min = math.Min(min, math.MaxInt32)
+				}
+				effective = append(effective, libunlynxrange.Bound{Attribute: column, Min: int64(min * min), Max: int64(max * max)})
+			}
+		}
+	}
+	if count {
+		effective = append(effective, libunlynxrange.Bound{Attribute: libunlynx.CountAttribute, Min: 1, Max: 1})
+	}
+	return effective
+}
+
+// rangeBounds returns the bounds that the responses to a query must be proven to respect (see EffectiveBounds)
+func (query *SurveyCreationQuery) rangeBounds() []libunlynxrange.Bound {
+	sum, count := libunlynx.OperationColumns(query.Sum, query.Count, query.Operations)
+	return EffectiveBounds(query.Bounds, sum, count)
+}
+
+// validateBounds checks that the bounds of a query are intervals on distinct aggregating attributes and that the
+// squared attributes have a bound small enough for their squares to be decrypted
+func (query *SurveyCreationQuery) validateBounds() error {
+	seen := make(map[string]bool, len(query.Bounds))
+	for _, b := range query.Bounds {
+		if err := b.Validate(); err != nil {
+			return err
+		}
+		found := false
+		for _, column := range query.Sum {
+			found = found || column == b.Attribute
+		}
+		if !found || b.Attribute == libunlynx.CountAttribute {
+			return fmt.Errorf("attribute %s has a bound but is not aggregated", b.Attribute)
+		}
+		if seen[b.Attribute] {
+			return fmt.Errorf("attribute %s has several bounds", b.Attribute)
+		}
+		seen[b.Attribute] = true
+	}
+
+	// the sums of squares must be decryptable, so the squared attributes must be bounded
+	for _, b := range query.rangeBounds() {
+		if attribute, ok := libunlynx.SquareOf(b.Attribute); ok && b.Max > libunlynx.DecryptionBound() {
+			return fmt.Errorf("the squares of attribute %s can be larger than the decryption bound %d", attribute, libunlynx.DecryptionBound())
+		}
+	}
+	for _, column := range query.Sum {
+		if attribute, ok := libunlynx.SquareOf(column); ok && !seen[attribute] {
+			return fmt.Errorf("attribute %s is squared but has no bound", attribute)
+		}
+	}
+	return nil
+}
+
+// attachRangeProofs encrypts again the bounded aggregating attributes of an encrypted response with the proofs that
+// they are in their bound (the clear attributes are sent as they are). The count column is always proven, even if it
+// is not in the bounds (see EffectiveBounds).
+func attachRangeProofs(dr *libunlynx.DpResponseToSend, ccr libunlynx.DpClearResponse, groupKey kyber.Point, count bool, types map[string]libunlynx.AttributeType, operations []libunlynx.Operation, bounds []libunlynxrange.Bound) error {
+	_, count = libunlynx.OperationColumns(nil, count, operations)
+	if count {
+		bounded := false
+		for _, b := range bounds {
+			bounded = bounded || b.Attribute == libunlynx.CountAttribute
+		}
+		if !bounded {
+			bounds = append(append([]libunlynxrange.Bound{}, bounds...), libunlynxrange.Bound{Attribute: libunlynx.CountAttribute, Min: 1, Max: 1})
+		}
+	}
+	if len(bounds) == 0 {
+		return nil
+	}
+	values, err := libunlynx.EncodeAggregatingAttributes(ccr.AggregatingAttributesEnc, ccr.AggregatingAttributesDec, count, types, operations)
+	if err != nil {
+		return err
+	}
+
+	dr.RangeProofs = make(map[string][]byte)
+	for _, b := range bounds {
+		v, ok := values[b.Attribute]
+		if !ok {
+			continue
+		}
+		ct, prp, err := libunlynxrange.EncryptIntWithRangeProof(groupKey, v, b.Min, b.Max)
+		if err != nil {
+			return fmt.Errorf("attribute %s: %v", b.Attribute, err)
+		}
+		if dr.AggregatingAttributesEnc[b.Attribute], err = ct.ToBytes(); err != nil {
+			return err
+		}
+		if dr.RangeProofs[b.Attribute], err = prp.ToBytes(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkRangeProofs checks that the bounded aggregating attributes of a response are in their bound: the clear values
+// directly and the encrypted ones with their range proof (a missing attribute is rejected)
+func checkRangeProofs(dr libunlynx.DpResponseToSend, groupKey kyber.Point, bounds []libunlynxrange.Bound) error {
+	for _, b := range bounds {
+		if v, ok := dr.AggregatingAttributesClear[b.Attribute]; ok {
+			if !b.Contains(v) {
+				return fmt.Errorf("value %d of attribute %s is out of its bound", v, b.Attribute)
+			}
+			continue
+		}
+		data, ok := dr.AggregatingAttributesEnc[b.Attribute]
+		if !ok {
+			return fmt.Errorf("no value for the bounded attribute %s", b.Attribute)
+		}
+		proofData, ok := dr.RangeProofs[b.Attribute]
+		if !ok {
+			return fmt.Errorf("no range proof for attribute %s", b.Attribute)
+		}
+		prp := libunlynxrange.PublishedRangeProof{}
+		if err := prp.FromBytes(proofData); err != nil {
+			return fmt.Errorf("wrong range proof for attribute %s: %v", b.Attribute, err)
+		}
+		ct := libunlynx.CipherText{}
+		if len(data) != 2*libunlynx.SuiTe.PointLen() {
+			return fmt.Errorf("wrong ciphertext for attribute %s", b.Attribute)
+		}
+		if err := ct.FromBytes(data); err != nil {
+			return err
+		}
+		if prp.Min != b.Min || prp.Max != b.Max || !libunlynxrange.RangeProofVerification(groupKey, ct, prp) {
+			return fmt.Errorf("wrong range proof for attribute %s", b.Attribute)
+		}
+	}
+	return nil
+}
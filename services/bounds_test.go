@@ -0,0 +1,97 @@
+package servicesunlynx_test
+
+import (
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/lib/range"
+	"github.com/ldsec/unlynx/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+)
+
+func TestEffectiveBounds(t *testing.T) {
+	assert.Nil(t, servicesunlynx.EffectiveBounds(nil, []string{"s1"}, false))
+	assert.Equal(t, []libunlynxrange.Bound{{Attribute: libunlynx.CountAttribute, Min: 1, Max: 1}},
+		servicesunlynx.EffectiveBounds(nil, []string{"s1", "count"}, true))
+
+	bounds := []libunlynxrange.Bound{{Attribute: "s1", Min: -3, Max: 2}, {Attribute: "s2", Min: 2, Max: 5}}
+	assert.Equal(t, []libunlynxrange.Bound{
+		{Attribute: "s1", Min: -3, Max: 2},
+		{Attribute: "s2", Min: 2, Max: 5},
+		{Attribute: libunlynx.SquareAttribute("s1"), Min: 0, Max: 9},
+		{Attribute: libunlynx.SquareAttribute("s2"), Min: 4, Max: 25},
+		{Attribute: libunlynx.CountAttribute, Min: 1, Max: 1},
+	}, servicesunlynx.EffectiveBounds(bounds, []string{"s1", "s2", libunlynx.SquareAttribute("s1"), libunlynx.SquareAttribute("s2"), "count"}, true))
+}
+
+func TestServiceRangeProofs(t *testing.T) {
+	log.Lvl1("***************************************************************************************************")
+	os.Remove("pre_compute_multiplications.gob")
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+	_, el, _ := local.GenTree(3, true)
+	defer local.CloseAll()
+
+	client := servicesunlynx.NewUnLynxClient(el.List[0], strconv.Itoa(0))
+	nbrDPs := make(map[string]int64)
+	for _, server := range el.List {
+		nbrDPs[server.String()] = 1
+	}
+
+	// the bounds must be on aggregated attributes
+	bounds := []libunlynxrange.Bound{{Attribute: "s2", Min: 0, Max: 100}}
+	_, err := client.SendSurveySQLQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, "SELECT SUM(s1), COUNT(*)", 8, servicesunlynx.SurveyOptions{Bounds: bounds})
+	assert.Error(t, err)
+
+	bounds = []libunlynxrange.Bound{{Attribute: "s1", Min: 0, Max: 100}}
+	surveyID, err := client.SendSurveySQLQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, "SELECT SUM(s1), COUNT(*)", 8, servicesunlynx.SurveyOptions{Bounds: bounds})
+	require.NoError(t, err)
+	status, err := client.SendSurveyStatusQuery(*surveyID)
+	require.NoError(t, err)
+	require.Len(t, status.Bounds, 2)
+
+	// a value out of its bound cannot be proven
+	outOfBound := []libunlynx.DpClearResponse{{AggregatingAttributesEnc: map[string]int64{"s1": 101}}}
+	_, err = servicesunlynx.EncryptDataToSurvey("dp", *surveyID, outOfBound, el.Aggregate, 1, status.Count, nil, nil, nil, status.Bounds)
+	assert.Error(t, err)
+
+	for i, server := range el.List {
+		dp := servicesunlynx.NewUnLynxClient(server, strconv.Itoa(i+1))
+		responses := []libunlynx.DpClearResponse{{AggregatingAttributesEnc: map[string]int64{"s1": int64(10 * (i + 1))}}}
+
+		// no range proofs
+		s, err := servicesunlynx.EncryptDataToSurvey(dp.String(), *surveyID, responses, el.Aggregate, 1, status.Count, nil, nil, nil, nil)
+		require.NoError(t, err)
+		assert.Error(t, dp.SendEncryptedSurveyResponseQuery(s))
+
+		// a ciphertext replaced by the encryption of a value out of its bound, with the proof of the original one
+		s, err = servicesunlynx.EncryptDataToSurvey(dp.String(), *surveyID, responses, el.Aggregate, 1, status.Count, nil, nil, nil, status.Bounds)
+		require.NoError(t, err)
+		for _, attribute := range []string{"s1", libunlynx.CountAttribute} {
+			forged := *s
+			forged.Responses = []libunlynx.DpResponseToSend{{AggregatingAttributesEnc: make(map[string][]byte), RangeProofs: s.Responses[0].RangeProofs}}
+			for k, v := range s.Responses[0].AggregatingAttributesEnc {
+				forged.Responses[0].AggregatingAttributesEnc[k] = v
+			}
+			forged.Responses[0].AggregatingAttributesEnc[attribute], err = libunlynx.EncryptInt(el.Aggregate, 1000).ToBytes()
+			require.NoError(t, err)
+			assert.Error(t, dp.SendEncryptedSurveyResponseQuery(&forged))
+		}
+
+		// a bounded column left out of the response
+		missing := *s
+		missing.Responses = []libunlynx.DpResponseToSend{{AggregatingAttributesEnc: map[string][]byte{"s1": s.Responses[0].AggregatingAttributesEnc["s1"]}, RangeProofs: s.Responses[0].RangeProofs}}
+		assert.Error(t, dp.SendEncryptedSurveyResponseQuery(&missing))
+
+		require.NoError(t, dp.SendEncryptedSurveyResponseQuery(s))
+	}
+
+	results, err := client.SendSurveyTypedResultsQuery(*surveyID)
+	require.NoError(t, err)
+	require.Len(t, results.Aggregates, 1)
+	assert.Equal(t, []float64{60, 3}, results.Aggregates[0])
+}
@@ -0,0 +1,217 @@
+package servicesunlynx
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.dedis.ch/kyber/v3"
+	"go.etcd.io/bbolt"
+)
+
+// PrivacyBudgets is the differential privacy budget (total epsilon) of each querier on each dataset, the "" entry is
+// the budget on the datasets that are not listed. The queries are not limited if it is empty. It is set by the
+// PrivacyBudget of the configuration of the server (see ServerConfig). Each server enforces the budgets with its own
+// ledger (see BudgetLedger), they only hold if the access policy lists the queriers (see Policy).
+var PrivacyBudgets = make(map[string]float64)
+
+// budgetBucket is the name of the bucket, in the conode database, where the privacy budget ledger is persisted
+var budgetBucket = []byte("budget")
+
+// ParsePrivacyBudgets parses a list of privacy budgets ("10" or "dataset1=10,dataset2=2.5", an entry without dataset
+// name being the budget on the other datasets).
+func ParsePrivacyBudgets(str string) (map[string]float64, error) {
+	budgets := make(map[string]float64)
+	for _, entry := range strings.Split(str, ",") {
+		dataset := ""
+		value := strings.TrimSpace(entry)
+		if i := strings.Index(value, "="); i >= 0 {
+			dataset = strings.TrimSpace(value[:i])
+			value = strings.TrimSpace(value[i+1:])
+		}
+		budget, err := strconv.ParseFloat(value, 64)
+		if err != nil || budget < 0 {
+			return nil, fmt.Errorf("wrong privacy budget: %s", entry)
+		}
+		budgets[dataset] = budget
+	}
+	return budgets, nil
+}
+
+// BudgetLedger keeps track of the privacy budget spent by each querier on each dataset. Every server of a roster
+// charges (and enforces the budget of) the differentially private surveys it takes part in, so that the budget does
+// not depend on the server receiving the queries. Each server keeps its own ledger: a survey is charged when the
+// server accepts its results query and refunded if the survey is cancelled before its results are computed (e.g.
+// because another server refused the query, see cancelSurvey), so that the ledgers of the servers of a roster agree.
+//
+// The queriers are identified by their public key: the budget only holds if the surveys are restricted to known
+// queriers (see the access policy), a querier could otherwise get a fresh budget with a new key.
+type BudgetLedger struct {
+	mutex  sync.Mutex
+	db     *bbolt.DB
+	bucket []byte
+
+	spent   map[string]float64 // by querier and dataset (see ledgerKey)
+	charged map[SurveyID]charge
+}
+
+// charge is the epsilon charged for a survey to a querier on a dataset (identified by its ledgerKey), the key is
+// empty if the charge cannot be refunded
+type charge struct {
+	key     string
+	epsilon float64
+}
+
+// encodeCharge encodes a charge as it is persisted in the ledger bucket
+func encodeCharge(c charge) []byte {
+	buf := make([]byte, 8, 8+len(c.key))
+	binary.BigEndian.PutUint64(buf, math.Float64bits(c.epsilon))
+	return append(buf, c.key...)
+}
+
+// decodeCharge decodes a persisted charge, the charges persisted without their epsilon and key cannot be refunded
+func decodeCharge(v []byte) charge {
+	if len(v) < 8 {
+		return charge{}
+	}
+	return charge{key: string(v[8:]), epsilon: math.Float64frombits(binary.BigEndian.Uint64(v[:8]))}
+}
+
+// NewBudgetLedger constructor of a BudgetLedger, it is persisted in a BoltDB bucket (created if it does not exist) or
+// only kept in memory if db is nil.
+func NewBudgetLedger(db *bbolt.DB, bucket []byte) (*BudgetLedger, error) {
+	bl := &BudgetLedger{db: db, bucket: bucket, spent: make(map[string]float64), charged: make(map[SurveyID]charge)}
+	if db == nil {
+		return bl, nil
+	}
+
+	err := db.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(bucket)
+		if err != nil {
+			return err
+		}
+		return b.ForEach(func(k, v []byte) error {
+			key := string(k)
+			if strings.HasPrefix(key, "survey/") {
+				bl.charged[SurveyID(strings.TrimPrefix(key, "survey/"))] = decodeCharge(v)
+			} else if len(v) == 8 {
+				bl.spent[key] = math.Float64frombits(binary.BigEndian.Uint64(v))
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not load the privacy budget ledger: %v", err)
+	}
+	return bl, nil
+}
+
+// ledgerKey is the key of the budget spent by a querier on a dataset
+func ledgerKey(querier kyber.Point, dataset string) string {
+	return "spent/" + querier.String() + "/" + dataset
+}
+
+// Spent returns the privacy budget already spent by a querier on a dataset
+func (bl *BudgetLedger) Spent(querier kyber.Point, dataset string) float64 {
+	bl.mutex.Lock()
+	defer bl.mutex.Unlock()
+	return bl.spent[ledgerKey(querier, dataset)]
+}
+
+// Spend charges the epsilon of a survey to its querier, the survey is refused if it exceeds the budget of the querier
+// on the dataset (see PrivacyBudgets). A survey is only charged once.
+func (bl *BudgetLedger) Spend(sid SurveyID, querier kyber.Point, dataset string, epsilon float64) error {
+	if querier == nil {
+		return fmt.Errorf("the querier of a differentially private survey must be identified")
+	}
+
+	bl.mutex.Lock()
+	defer bl.mutex.Unlock()
+
+	if _, ok := bl.charged[sid]; ok {
+		return nil
+	}
+
+	key := ledgerKey(querier, dataset)
+	spent := bl.spent[key] + epsilon
+	budget, ok := PrivacyBudgets[dataset]
+	if !ok {
+		budget, ok = PrivacyBudgets[""]
+	}
+	if ok && spent > budget {
+		return fmt.Errorf("survey %s would exceed the privacy budget of the querier on dataset '%s' (spent %s out of %s)", sid, dataset, strconv.FormatFloat(bl.spent[key], 'f', -1, 64), strconv.FormatFloat(budget, 'f', -1, 64))
+	}
+
+	c := charge{key: key, epsilon: epsilon}
+	if err := bl.persist(sid, key, spent, &c); err != nil {
+		return err
+	}
+	bl.spent[key] = spent
+	bl.charged[sid] = c
+	return nil
+}
+
+// Refund cancels the charge of a survey (if it was charged), it is called when the results of the survey will not be
+// computed.
+func (bl *BudgetLedger) Refund(sid SurveyID) error {
+	bl.mutex.Lock()
+	defer bl.mutex.Unlock()
+
+	c, ok := bl.charged[sid]
+	if !ok || c.key == "" {
+		return nil
+	}
+
+	spent := math.Max(bl.spent[c.key]-c.epsilon, 0)
+	if err := bl.persist(sid, c.key, spent, nil); err != nil {
+		return err
+	}
+	bl.spent[c.key] = spent
+	delete(bl.charged, sid)
+	return nil
+}
+
+// persist persists the budget spent on a ledger key and the charge of a survey (deleted if it is nil), the caller
+// holds the lock of the ledger
+func (bl *BudgetLedger) persist(sid SurveyID, key string, spent float64, c *charge) error {
+	if bl.db == nil {
+		return nil
+	}
+	err := bl.db.Update(func(tx *bbolt.Tx) error {
+		buf := make([]byte, 8)
+		binary.BigEndian.PutUint64(buf, math.Float64bits(spent))
+		if err := tx.Bucket(bl.bucket).Put([]byte(key), buf); err != nil {
+			return err
+		}
+		if c == nil {
+			return tx.Bucket(bl.bucket).Delete([]byte("survey/" + string(sid)))
+		}
+		return tx.Bucket(bl.bucket).Put([]byte("survey/"+string(sid)), encodeCharge(*c))
+	})
+	if err != nil {
+		return fmt.Errorf("could not update the privacy budget ledger: %v", err)
+	}
+	return nil
+}
+
+// checkPrivacyBudget checks that the privacy budget of a differentially private survey can be charged: its querier must
+// be identified by its signature and, if budgets are set, the survey must be on a registered dataset (the budgets
+// could otherwise be bypassed with new keys or dataset names)
+func (s *Service) checkPrivacyBudget(query *SurveyCreationQuery) error {
+	if !query.DiffPri.Enabled() {
+		return nil
+	}
+	// the signature of the querier is verified by authorize
+	if query.Querier == nil {
+		return fmt.Errorf("a differentially private survey must be signed by its querier")
+	}
+	if len(PrivacyBudgets) > 0 {
+		if _, ok := s.Schemas.Get(query.Dataset); !ok {
+			return fmt.Errorf("a differentially private survey must be on a registered dataset, '%s' is not", query.Dataset)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package servicesunlynx_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ldsec/unlynx/data"
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/lib/differential_privacy"
+	"github.com/ldsec/unlynx/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3/util/key"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	"go.etcd.io/bbolt"
+)
+
+func TestParsePrivacyBudgets(t *testing.T) {
+	budgets, err := servicesunlynx.ParsePrivacyBudgets("10")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"": 10}, budgets)
+
+	budgets, err = servicesunlynx.ParsePrivacyBudgets("dataset1=10, dataset2 = 2.5,1")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"dataset1": 10, "dataset2": 2.5, "": 1}, budgets)
+
+	_, err = servicesunlynx.ParsePrivacyBudgets("dataset1=ten")
+	assert.Error(t, err)
+	_, err = servicesunlynx.ParsePrivacyBudgets("-1")
+	assert.Error(t, err)
+}
+
+func TestBudgetLedger(t *testing.T) {
+	budgets := servicesunlynx.PrivacyBudgets
+	servicesunlynx.PrivacyBudgets = map[string]float64{"dataset1": 2, "": 1}
+	defer func() { servicesunlynx.PrivacyBudgets = budgets }()
+
+	dir, err := ioutil.TempDir("", "unlynx")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	db, err := bbolt.Open(filepath.Join(dir, "budget.db"), 0600, nil)
+	require.NoError(t, err)
+	defer db.Close()
+
+	ledger, err := servicesunlynx.NewBudgetLedger(db, []byte("budget"))
+	require.NoError(t, err)
+
+	_, querier := libunlynx.GenKey()
+	_, other := libunlynx.GenKey()
+
+	require.NoError(t, ledger.Spend("s1", querier, "dataset1", 1.5))
+	// a survey is only charged once
+	require.NoError(t, ledger.Spend("s1", querier, "dataset1", 1.5))
+	assert.Equal(t, 1.5, ledger.Spent(querier, "dataset1"))
+
+	assert.Error(t, ledger.Spend("s2", querier, "dataset1", 1))
+	assert.Error(t, ledger.Spend("s2", querier, "dataset2", 1.5))
+	require.NoError(t, ledger.Spend("s2", other, "dataset1", 1))
+	assert.Error(t, ledger.Spend("s3", nil, "dataset1", 1))
+
+	require.NoError(t, ledger.Spend("s4", querier, "dataset1", 0.5))
+	assert.Equal(t, 2.0, ledger.Spent(querier, "dataset1"))
+
+	// the ledger survives a restart
+	restored, err := servicesunlynx.NewBudgetLedger(db, []byte("budget"))
+	require.NoError(t, err)
+	assert.Equal(t, 2.0, restored.Spent(querier, "dataset1"))
+	assert.Equal(t, 1.0, restored.Spent(other, "dataset1"))
+	require.NoError(t, restored.Spend("s4", querier, "dataset1", 0.5))
+	assert.Equal(t, 2.0, restored.Spent(querier, "dataset1"))
+	assert.Error(t, restored.Spend("s5", querier, "dataset1", 0.5))
+
+	// a refunded survey can be charged again, the refunds are persisted too
+	require.NoError(t, restored.Refund("s4"))
+	require.NoError(t, restored.Refund("s4"))
+	require.NoError(t, restored.Refund("unknown"))
+	assert.Equal(t, 1.5, restored.Spent(querier, "dataset1"))
+	restored, err = servicesunlynx.NewBudgetLedger(db, []byte("budget"))
+	require.NoError(t, err)
+	assert.Equal(t, 1.5, restored.Spent(querier, "dataset1"))
+	require.NoError(t, restored.Spend("s5", querier, "dataset1", 0.5))
+	assert.Equal(t, 2.0, restored.Spent(querier, "dataset1"))
+}
+
+//______________________________________________________________________________________________________________________
+// Test that the privacy budget of a querier is enforced whatever the server receiving the query
+func TestServicePrivacyBudget(t *testing.T) {
+	log.Lvl1("***************************************************************************************************")
+	budgets := servicesunlynx.PrivacyBudgets
+	servicesunlynx.PrivacyBudgets = map[string]float64{"dataset": 1.5}
+	defer func() { servicesunlynx.PrivacyBudgets = budgets }()
+
+	os.Remove("pre_compute_multiplications.gob")
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+	servers, el, _ := local.GenTree(3, true)
+	defer local.CloseAll()
+
+	// the budgets are on registered datasets
+	schema := dataunlynx.Schema{Dataset: "dataset", Attributes: []dataunlynx.SchemaAttribute{
+		{Name: "g1", Role: dataunlynx.RoleGroupBy},
+		{Name: "s1", Role: dataunlynx.RoleAggregate, Encrypted: true},
+	}}
+	services := local.GetServices(servers, onet.ServiceFactory.ServiceID(servicesunlynx.ServiceName))
+	for _, service := range services {
+		require.NoError(t, service.(*servicesunlynx.Service).Schemas.Register(schema))
+	}
+
+	nbrDPs := make(map[string]int64)
+	for _, server := range el.List {
+		nbrDPs[server.String()] = 1
+	}
+	diffPri := libunlynxdiffprivacy.Params{Epsilon: 1, Sensitivity: 1, NoiseListSize: 10, Quanta: 0.1, Scale: 1}
+
+	// the querier sends its queries to the first server and then to the second one
+	keys := key.NewKeyPair(libunlynx.SuiTe)
+	for i, entryPoint := range el.List[:2] {
+		querier := servicesunlynx.NewUnLynxClientWithKeys(entryPoint, strconv.Itoa(0), keys)
+
+		surveyID, err := querier.SendSurveyCreationQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, false, false, []string{"s1"}, false, nil, "", []string{"g1"}, servicesunlynx.SurveyOptions{Dataset: "dataset", DiffPri: diffPri})
+		require.NoError(t, err)
+
+		for j, server := range el.List {
+			dp := servicesunlynx.NewUnLynxClient(server, strconv.Itoa(j+1))
+			responses := []libunlynx.DpClearResponse{{GroupByClear: map[string]int64{"g1": 0}, AggregatingAttributesEnc: map[string]int64{"s1": 1}}}
+			require.NoError(t, dp.SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, false, nil, nil, nil, nil))
+		}
+
+		_, _, err = querier.SendSurveyResultsQuery(*surveyID)
+		if i == 0 {
+			require.NoError(t, err)
+		} else {
+			assert.Error(t, err)
+		}
+	}
+
+	// the surveys on other datasets are refused
+	other := key.NewKeyPair(libunlynx.SuiTe)
+	querier := servicesunlynx.NewUnLynxClientWithKeys(el.List[0], strconv.Itoa(0), other)
+	_, err := querier.SendSurveyCreationQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, false, false, []string{"s1"}, false, nil, "", []string{"g1"}, servicesunlynx.SurveyOptions{Dataset: "other", DiffPri: diffPri})
+	assert.Error(t, err)
+
+	// the budget is enforced by every server, not only the one receiving the query
+	require.NoError(t, services[2].(*servicesunlynx.Service).Budget.Spend("elsewhere", other.Public, "dataset", 1))
+	surveyID, err := querier.SendSurveyCreationQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, false, false, []string{"s1"}, false, nil, "", []string{"g1"}, servicesunlynx.SurveyOptions{Dataset: "dataset", DiffPri: diffPri})
+	require.NoError(t, err)
+	for j, server := range el.List {
+		dp := servicesunlynx.NewUnLynxClient(server, strconv.Itoa(j+1))
+		responses := []libunlynx.DpClearResponse{{GroupByClear: map[string]int64{"g1": 0}, AggregatingAttributesEnc: map[string]int64{"s1": 1}}}
+		require.NoError(t, dp.SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, false, nil, nil, nil, nil))
+	}
+	_, _, err = querier.SendSurveyResultsQuery(*surveyID)
+	assert.Error(t, err)
+
+	// the servers that accepted the refused query are refunded
+	require.Eventually(t, func() bool {
+		return services[0].(*servicesunlynx.Service).Budget.Spent(other.Public, "dataset") == 0 &&
+			services[1].(*servicesunlynx.Service).Budget.Spent(other.Public, "dataset") == 0
+	}, 10*time.Second, 100*time.Millisecond)
+	assert.Equal(t, 1.0, services[2].(*servicesunlynx.Service).Budget.Spent(other.Public, "dataset"))
+}
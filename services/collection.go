@@ -0,0 +1,154 @@
+package servicesunlynx
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/lib/tools"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+)
+
+// CollectionFinished is sent by a server to the others when it stops collecting data for a survey, with the number of
+// data providers that sent it their data and the number of rows it will shuffle
+type CollectionFinished struct {
+	SurveyID   SurveyID
+	Server     string
+	DpReceived int64
+	Rows       int64
+}
+
+// Collection of the data
+//______________________________________________________________________________________________________________________
+
+// validateCollection checks the deadline, the quorum and the expected rows of a query: the quorum cannot be reached
+// without a deadline and it cannot be more than the number of data providers
+func (query *SurveyCreationQuery) validateCollection() error {
+	if query.Deadline < 0 || query.Quorum < 0 {
+		return fmt.Errorf("wrong deadline or quorum")
+	}
+	if query.Quorum > 0 && query.Deadline == 0 {
+		return fmt.Errorf("a quorum needs a deadline")
+	}
+	if query.Quorum > CountDPs(query.MapDPs) {
+		return fmt.Errorf("quorum of %d data providers for only %d expected", query.Quorum, CountDPs(query.MapDPs))
+	}
+	if query.ExpectedRows < 0 || query.ExpectedRows > MaxExpectedRows {
+		return fmt.Errorf("wrong number of expected rows %d (at most %d)", query.ExpectedRows, MaxExpectedRows)
+	}
+	return nil
+}
+
+// deadlinePassed returns true if the survey has a deadline and it has passed (on the clock of this server)
+func (query *SurveyCreationQuery) deadlinePassed() bool {
+	return query.Deadline > 0 && time.Now().UnixNano() >= query.Deadline
+}
+
+// minParticipants returns the minimum number of data providers needed to compute the results of the survey: its
+// quorum or, if it has a deadline and no quorum, one data provider (0 if the survey waits for all of them)
+func (query *SurveyCreationQuery) minParticipants() int64 {
+	if query.Quorum == 0 && query.Deadline > 0 {
+		return 1
+	}
+	return query.Quorum
+}
+
+// waitDataProviders waits until all the data providers of this server have sent their data or the deadline of the
+// survey passes, then it stops the collection of data (the survey moves to the shuffling phase)
+func (s *Service) waitDataProviders(targetSurvey SurveyID) error {
+	survey, err := s.getSurvey(targetSurvey)
+	if err != nil {
+		return err
+	}
+
+	var deadline <-chan time.Time
+	if survey.Query.Deadline > 0 {
+		timer := time.NewTimer(time.Until(time.Unix(0, survey.Query.Deadline)))
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	counter := survey.Query.MapDPs[s.ServerIdentity().String()]
+	for counter > int64(0) {
+		log.Lvl1(s.ServerIdentity(), " is waiting for ", counter, " data providers to send their data")
+		select {
+		case nbr := <-survey.DpChannel:
+			counter = counter - int64(nbr)
+		case <-deadline:
+			log.Lvl1(s.ServerIdentity(), " reached the deadline of survey ", targetSurvey, " (", counter, " data providers missing)")
+			counter = 0
+		case <-survey.CancelChannel:
+			return errSurveyCancelled(targetSurvey)
+		}
+	}
+
+	// the data received until now (PushData is locked) are the ones of the survey, unless its roster is being changed
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.checkTransition(&survey.Query.Roster); err != nil {
+		return err
+	}
+	return s.setPhase(targetSurvey, PhaseShuffling)
+}
+
+// agreeOnParticipants sends the number of data providers that sent their data to this server to the others and waits
+// for theirs. Every server then knows the number of participants of the survey and checks that it reaches the quorum,
+// and the number of rows to shuffle.
+func (s *Service) agreeOnParticipants(targetSurvey SurveyID) (int64, error) {
+	survey, err := s.getSurvey(targetSurvey)
+	if err != nil {
+		return 0, err
+	}
+
+	aux := survey.Query.Roster
+	rows := int64(survey.NbrPendingDpResponses())
+	err = libunlynxtools.SendISMOthers(s.ServiceProcessor, &aux, &CollectionFinished{SurveyID: targetSurvey,
+		Server: s.ServerIdentity().String(), DpReceived: survey.DpReceived, Rows: rows})
+	if err != nil {
+		return 0, err
+	}
+
+	participants := survey.DpReceived
+	received := make(map[string]bool)
+	for len(received) < len(survey.Query.Roster.List)-1 {
+		select {
+		case cf := <-survey.CollectionChannel:
+			if !received[cf.Server] {
+				received[cf.Server] = true
+				participants += cf.DpReceived
+				rows += cf.Rows
+			}
+		case <-survey.CancelChannel:
+			return 0, errSurveyCancelled(targetSurvey)
+		case <-time.After(libunlynx.TIMEOUT):
+			return 0, fmt.Errorf("the other servers did not finish the collection of survey %s", targetSurvey)
+		}
+	}
+
+	if participants < survey.Query.minParticipants() {
+		return 0, fmt.Errorf("quorum not reached for survey %s: %d data providers out of %d", targetSurvey, participants, survey.Query.minParticipants())
+	}
+	log.Lvl1(s.ServerIdentity(), " computes survey ", targetSurvey, " with ", participants, " data providers")
+	// this server shuffles the rows of all the servers
+	s.topUpPrecomputations(targetSurvey, &survey.Query, rows)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	survey, err = s.getSurvey(targetSurvey)
+	if err != nil {
+		return 0, err
+	}
+	survey.Participants = participants
+	return participants, s.putSurvey(targetSurvey, survey)
+}
+
+// HandleCollectionFinished handles the message CollectionFinished: one of the servers stopped collecting data
+func (s *Service) HandleCollectionFinished(recq *CollectionFinished) (network.Message, error) {
+	survey, err := s.getSurvey(recq.SurveyID)
+	if err != nil {
+		return nil, err
+	}
+	survey.CollectionChannel <- *recq
+	return nil, nil
+}
@@ -0,0 +1,70 @@
+package servicesunlynx_test
+
+import (
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+)
+
+func TestServiceDeadlineQuorum(t *testing.T) {
+	log.Lvl1("***************************************************************************************************")
+	os.Remove("pre_compute_multiplications.gob")
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+	_, el, _ := local.GenTree(3, true)
+	defer local.CloseAll()
+
+	client := servicesunlynx.NewUnLynxClient(el.List[0], strconv.Itoa(0))
+	nbrDPs := make(map[string]int64)
+	for _, server := range el.List {
+		nbrDPs[server.String()] = 1
+	}
+	query := "SELECT SUM(s1), COUNT(*)"
+
+	// a quorum needs a deadline and cannot be more than the number of data providers
+	_, err := client.SendSurveySQLQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, query, 8, servicesunlynx.SurveyOptions{Quorum: 2})
+	assert.Error(t, err)
+	_, err = client.SendSurveySQLQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, query, 8, servicesunlynx.SurveyOptions{Deadline: time.Minute, Quorum: 4})
+	assert.Error(t, err)
+	// too many rows to precompute
+	_, err = client.SendSurveySQLQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, query, 8, servicesunlynx.SurveyOptions{ExpectedRows: servicesunlynx.MaxExpectedRows + 1})
+	assert.Error(t, err)
+
+	// the data provider of the last server does not send its data
+	surveyID, err := client.SendSurveySQLQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, query, 8, servicesunlynx.SurveyOptions{Deadline: 2 * time.Second, Quorum: 2, ExpectedRows: 4})
+	require.NoError(t, err)
+	status, err := client.SendSurveyStatusQuery(*surveyID)
+	require.NoError(t, err)
+	assert.NotZero(t, status.Deadline)
+
+	for i, server := range el.List[:2] {
+		dp := servicesunlynx.NewUnLynxClient(server, strconv.Itoa(i+1))
+		responses := []libunlynx.DpClearResponse{{AggregatingAttributesEnc: map[string]int64{"s1": int64(i + 1)}}}
+		require.NoError(t, dp.SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, status.Count, nil, nil, nil, nil))
+	}
+
+	results, err := client.SendSurveyTypedResultsQuery(*surveyID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), results.Participants)
+	require.Len(t, results.Aggregates, 1)
+	assert.Equal(t, []float64{3, 2}, results.Aggregates[0])
+
+	// the data is not accepted after the deadline
+	dp := servicesunlynx.NewUnLynxClient(el.List[2], "3")
+	responses := []libunlynx.DpClearResponse{{AggregatingAttributesEnc: map[string]int64{"s1": 3}}}
+	assert.Error(t, dp.SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, status.Count, nil, nil, nil, nil))
+
+	// the quorum is not reached
+	surveyID, err = client.SendSurveySQLQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, query, 8, servicesunlynx.SurveyOptions{Deadline: time.Second, Quorum: 2})
+	require.NoError(t, err)
+	require.NoError(t, dp.SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, status.Count, nil, nil, nil, nil))
+	_, err = client.SendSurveyTypedResultsQuery(*surveyID)
+	assert.Error(t, err)
+}
@@ -0,0 +1,107 @@
+package servicesunlynx
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/ldsec/unlynx/lib"
+	"go.dedis.ch/onet/v3/log"
+)
+
+// ServerConfig is the configuration of the unlynx service of a server. It is the [UnLynx] table of the configuration
+// file of the server (private.toml), e.g.:
+//
+//	[UnLynx]
+//	SurveyTTL = "48h"
+//	PrivacyBudget = "dataset1=10,dataset2=2.5"
+//	QuerierPolicy = "/etc/unlynx/policy.toml"
+//
+// The settings that are not set keep their default value.
+type ServerConfig struct {
+	// SurveyTTL and ResultTTL are durations (e.g. "24h"), see SurveyTTL and ResultTTL
+	SurveyTTL string
+	ResultTTL string
+	// PrivacyBudget are the privacy budgets of the queriers (see ParsePrivacyBudgets)
+	PrivacyBudget string
+	// QuerierPolicy is the file of the access policy (see LoadAccessPolicy) and DPAllowlist the file of the data
+	// providers allowed to send data (see LoadAuthorizedDPs)
+	QuerierPolicy string
+	DPAllowlist   string
+	// ProofsArchive is the directory where the proofs are archived and PrecomputeDir the one where the precomputed
+	// values for shuffling are saved
+	ProofsArchive string
+	PrecomputeDir string
+	// DiscreteLogBound and DiscreteLogTable are the bound and the file of the table used to decrypt the integers (see
+	// libunlynx.DiscreteLogBound)
+	DiscreteLogBound int64
+	DiscreteLogTable string
+}
+
+// LoadServerConfig reads the configuration of the unlynx service from the configuration file of a server (it is empty
+// if the file has no [UnLynx] table).
+func LoadServerConfig(filename string) (*ServerConfig, error) {
+	file := struct{ UnLynx ServerConfig }{}
+	if _, err := toml.DecodeFile(filename, &file); err != nil {
+		return nil, fmt.Errorf("could not read the configuration of %s: %v", filename, err)
+	}
+	return &file.UnLynx, nil
+}
+
+// Apply configures the unlynx service, before the server starts. Nothing is changed if a setting is wrong.
+func (conf *ServerConfig) Apply() error {
+	surveyTTL, resultTTL := SurveyTTL, ResultTTL
+	var err error
+	if conf.SurveyTTL != "" {
+		if surveyTTL, err = time.ParseDuration(conf.SurveyTTL); err != nil {
+			return fmt.Errorf("wrong SurveyTTL: %v", err)
+		}
+	}
+	if conf.ResultTTL != "" {
+		if resultTTL, err = time.ParseDuration(conf.ResultTTL); err != nil {
+			return fmt.Errorf("wrong ResultTTL: %v", err)
+		}
+	}
+
+	budgets := PrivacyBudgets
+	if conf.PrivacyBudget != "" {
+		if budgets, err = ParsePrivacyBudgets(conf.PrivacyBudget); err != nil {
+			return fmt.Errorf("wrong PrivacyBudget: %v", err)
+		}
+	}
+	policy := Policy
+	if conf.QuerierPolicy != "" {
+		if policy, err = LoadAccessPolicy(conf.QuerierPolicy); err != nil {
+			return fmt.Errorf("could not load the QuerierPolicy: %v", err)
+		}
+	}
+	dps := AuthorizedDPs
+	if conf.DPAllowlist != "" {
+		if dps, err = LoadAuthorizedDPs(conf.DPAllowlist); err != nil {
+			return fmt.Errorf("could not load the DPAllowlist: %v", err)
+		}
+	}
+	if conf.DiscreteLogBound < 0 {
+		return fmt.Errorf("wrong DiscreteLogBound %d", conf.DiscreteLogBound)
+	}
+
+	if len(budgets) > 0 && len(policy.Queriers) == 0 {
+		log.Warn("the privacy budgets are set without querier in the access policy: a querier can bypass them with a new key")
+	}
+
+	SurveyTTL, ResultTTL = surveyTTL, resultTTL
+	PrivacyBudgets, Policy, AuthorizedDPs = budgets, policy, dps
+	if conf.ProofsArchive != "" {
+		ProofsArchiveDir = conf.ProofsArchive
+	}
+	if conf.PrecomputeDir != "" {
+		PrecomputationDir = conf.PrecomputeDir
+	}
+	if conf.DiscreteLogBound > 0 {
+		libunlynx.DiscreteLogBound = conf.DiscreteLogBound
+	}
+	if conf.DiscreteLogTable != "" {
+		libunlynx.DiscreteLogTableFile = conf.DiscreteLogTable
+	}
+	return nil
+}
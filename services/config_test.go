@@ -0,0 +1,59 @@
+package servicesunlynx_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unlynx")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	surveyTTL, resultTTL, budgets, archive := servicesunlynx.SurveyTTL, servicesunlynx.ResultTTL, servicesunlynx.PrivacyBudgets, servicesunlynx.ProofsArchiveDir
+	bound, table := libunlynx.DiscreteLogBound, libunlynx.DiscreteLogTableFile
+	defer func() {
+		servicesunlynx.SurveyTTL, servicesunlynx.ResultTTL, servicesunlynx.PrivacyBudgets, servicesunlynx.ProofsArchiveDir = surveyTTL, resultTTL, budgets, archive
+		libunlynx.DiscreteLogBound, libunlynx.DiscreteLogTableFile = bound, table
+	}()
+
+	// the settings of the service are next to the ones of the conode
+	filename := filepath.Join(dir, "private.toml")
+	require.NoError(t, ioutil.WriteFile(filename, []byte(`Address = "tls://127.0.0.1:2000"
+Suite = "Ed25519"
+
+[UnLynx]
+SurveyTTL = "48h"
+PrivacyBudget = "dataset1=10,2"
+ProofsArchive = "/tmp/proofs"
+DiscreteLogBound = 1000000
+`), 0600))
+	conf, err := servicesunlynx.LoadServerConfig(filename)
+	require.NoError(t, err)
+	require.NoError(t, conf.Apply())
+	assert.Equal(t, 48*time.Hour, servicesunlynx.SurveyTTL)
+	assert.Equal(t, resultTTL, servicesunlynx.ResultTTL)
+	assert.Equal(t, map[string]float64{"dataset1": 10, "": 2}, servicesunlynx.PrivacyBudgets)
+	assert.Equal(t, "/tmp/proofs", servicesunlynx.ProofsArchiveDir)
+	assert.Equal(t, int64(1000000), libunlynx.DiscreteLogBound)
+
+	// nothing is changed by a wrong configuration
+	conf = &servicesunlynx.ServerConfig{ResultTTL: "1m", QuerierPolicy: filepath.Join(dir, "missing.toml")}
+	assert.Error(t, conf.Apply())
+	assert.Equal(t, resultTTL, servicesunlynx.ResultTTL)
+	assert.Error(t, (&servicesunlynx.ServerConfig{SurveyTTL: "a day"}).Apply())
+
+	// a file without unlynx settings gives an empty configuration
+	require.NoError(t, ioutil.WriteFile(filename, []byte(`Suite = "Ed25519"`), 0600))
+	conf, err = servicesunlynx.LoadServerConfig(filename)
+	require.NoError(t, err)
+	assert.Equal(t, servicesunlynx.ServerConfig{}, *conf)
+}
@@ -0,0 +1,259 @@
+package servicesunlynx
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/lib/key_switch"
+	"github.com/ldsec/unlynx/protocols"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/share"
+	"go.dedis.ch/kyber/v3/share/dkg/pedersen"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+	"go.etcd.io/bbolt"
+	"golang.org/x/xerrors"
+)
+
+// keyBucket is the name of the bucket, in the conode database, where the shares of the collective keys are persisted
+var keyBucket = []byte("keys")
+
+// DKGQuery is used to ask the servers of a roster to generate a collective key whose secret is shared among them: the
+// results of the surveys encrypted under this key can be switched by any Threshold of them.
+type DKGQuery struct {
+	Roster    onet.Roster
+	Threshold int64
+}
+
+// DKGResponse contains the collective key generated for a DKGQuery.
+type DKGResponse struct {
+	CollectiveKey kyber.Point
+}
+
+func init() {
+	network.RegisterMessage(&DKGQuery{})
+	network.RegisterMessage(&DKGResponse{})
+	network.RegisterMessage(&KeyShare{})
+}
+
+// KeyShare is the share of a collective key held by a server.
+type KeyShare struct {
+	CollectiveKey kyber.Point
+	// Roster is the ID of the roster that generated the key, Servers its number of servers and Threshold the number of
+	// shares needed to use the key
+	Roster    string
+	Servers   int64
+	Threshold int64
+
+	Index  int64
+	Secret kyber.Scalar
+
+	// Participants are the public keys of the servers in the order of their share indices and Commits the public
+	// commitments of the sharing, they are used to verify the contributions of the servers
+	Participants []kyber.Point
+	Commits      []kyber.Point
+}
+
+// priShare returns the share as a polynomial share (evaluated at Index + 1)
+func (ks *KeyShare) priShare() *share.PriShare {
+	return &share.PriShare{I: int(ks.Index), V: ks.Secret}
+}
+
+// pubPoly returns the public polynomial of the sharing, whose evaluation at the index of a server is its public share
+func (ks *KeyShare) pubPoly() *share.PubPoly {
+	return share.NewPubPoly(libunlynx.SuiTe, nil, ks.Commits)
+}
+
+// lagrangeSecret returns the share multiplied by its Lagrange coefficient for all the servers of the roster: the sum
+// of these values is the secret of the collective key, the servers use them as their private keys in the protocols in
+// which they all take part (e.g. the deterministic tagging)
+func (ks *KeyShare) lagrangeSecret() kyber.Scalar {
+	return libunlynx.SuiTe.Scalar().Mul(ks.lagrangeCoefficient(int(ks.Index)), ks.Secret)
+}
+
+// lagrangeCoefficient returns the Lagrange coefficient of a share index for all the servers of the roster
+func (ks *KeyShare) lagrangeCoefficient(index int) kyber.Scalar {
+	indices := make([]int, ks.Servers)
+	for i := range indices {
+		indices[i] = i
+	}
+	return libunlynxkeyswitch.LagrangeCoefficient(index, indices)
+}
+
+// participantIndex returns the share index of the server with a public key, -1 if it did not take part in the sharing
+func (ks *KeyShare) participantIndex(public kyber.Point) int {
+	for i, p := range ks.Participants {
+		if p.Equal(public) {
+			return i
+		}
+	}
+	return -1
+}
+
+// KeyRegistry keeps the shares of the collective keys generated by the rosters in which a server takes part.
+type KeyRegistry struct {
+	mutex  sync.Mutex
+	db     *bbolt.DB
+	bucket []byte
+
+	shares map[string]KeyShare // by collective key
+}
+
+// NewKeyRegistry constructor of a KeyRegistry, it is persisted in a BoltDB bucket (created if it does not exist) or
+// only kept in memory if db is nil.
+func NewKeyRegistry(db *bbolt.DB, bucket []byte) (*KeyRegistry, error) {
+	kr := &KeyRegistry{db: db, bucket: bucket, shares: make(map[string]KeyShare)}
+	if db == nil {
+		return kr, nil
+	}
+
+	err := db.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(bucket)
+		if err != nil {
+			return err
+		}
+		return b.ForEach(func(k, v []byte) error {
+			_, msg, err := network.Unmarshal(v, libunlynx.SuiTe)
+			if err != nil {
+				return fmt.Errorf("could not unmarshal the share of key %s: %v", k, err)
+			}
+			ks, ok := msg.(*KeyShare)
+			if !ok {
+				return fmt.Errorf("wrong type stored for key %s", k)
+			}
+			kr.shares[string(k)] = *ks
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not load the key shares: %v", err)
+	}
+	return kr, nil
+}
+
+// Put adds (and persists) the share of a collective key
+func (kr *KeyRegistry) Put(ks KeyShare) error {
+	kr.mutex.Lock()
+	defer kr.mutex.Unlock()
+
+	if kr.db != nil {
+		buf, err := network.Marshal(&ks)
+		if err != nil {
+			return err
+		}
+		err = kr.db.Update(func(tx *bbolt.Tx) error {
+			return tx.Bucket(kr.bucket).Put([]byte(ks.CollectiveKey.String()), buf)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	kr.shares[ks.CollectiveKey.String()] = ks
+	return nil
+}
+
+// Get returns the share of a collective key
+func (kr *KeyRegistry) Get(collectiveKey kyber.Point) (KeyShare, bool) {
+	kr.mutex.Lock()
+	defer kr.mutex.Unlock()
+	ks, ok := kr.shares[collectiveKey.String()]
+	return ks, ok
+}
+
+// collectiveKey returns the key under which the data of a survey is encrypted: the key generated by a DKG if the query
+// has one, the aggregate key of the roster otherwise
+func (query *SurveyCreationQuery) collectiveKey() kyber.Point {
+	if query.CollectiveKey != nil {
+		return query.CollectiveKey
+	}
+	return query.Roster.Aggregate
+}
+
+// checkCollectiveKey checks that the server has a share of the collective key of a query, generated by its roster
+func (s *Service) checkCollectiveKey(query *SurveyCreationQuery) error {
+	if query.CollectiveKey == nil {
+		return nil
+	}
+	ks, ok := s.Keys.Get(query.CollectiveKey)
+	if !ok {
+		return fmt.Errorf("no share of the collective key %s", query.CollectiveKey.String())
+	}
+	if ks.Roster != query.Roster.ID.String() {
+		return fmt.Errorf("the collective key %s was not generated by the roster of the survey", query.CollectiveKey.String())
+	}
+	return nil
+}
+
+// newDKGProtocol instantiates the DKG protocol, the share of the server is stored once it is generated
+func (s *Service) newDKGProtocol(tn *onet.TreeNodeInstance, rosterID string) (onet.ProtocolInstance, error) {
+	pi, err := protocolsunlynx.NewDKGProtocol(tn)
+	if err != nil {
+		return nil, err
+	}
+	dkgProtocol := pi.(*protocolsunlynx.DKGProtocol)
+	dkgProtocol.ShareFunc = func(dks *dkg.DistKeyShare) {
+		ks := KeyShare{
+			CollectiveKey: dks.Public(),
+			Roster:        rosterID,
+			Servers:       int64(len(tn.Roster().List)),
+			Threshold:     int64(dkgProtocol.Threshold),
+			Index:         int64(dks.Share.I),
+			Secret:        dks.Share.V,
+			Participants:  tn.Roster().Publics(),
+			Commits:       dks.Commits,
+		}
+		if err := s.Keys.Put(ks); err != nil {
+			log.Error(err)
+		}
+	}
+	return pi, nil
+}
+
+// HandleDKGQuery handles the generation of a collective key by the servers of a roster.
+func (s *Service) HandleDKGQuery(query *DKGQuery) (network.Message, error) {
+	log.Lvl1(s.ServerIdentity(), " received a DKG query")
+
+	if query.Threshold < 1 || query.Threshold > int64(len(query.Roster.List)) {
+		return nil, fmt.Errorf("wrong threshold %d for %d servers", query.Threshold, len(query.Roster.List))
+	}
+	if i, _ := query.Roster.Search(s.ServerIdentity().ID); i < 0 {
+		return nil, fmt.Errorf("%s is not in the roster of the query", s.ServerIdentity())
+	}
+
+	tree := query.Roster.GenerateNaryTreeWithRoot(2, s.ServerIdentity())
+	tn := s.NewTreeNodeInstance(tree, tree.Root, protocolsunlynx.DKGProtocolName)
+	conf := onet.GenericConfig{Data: []byte(query.Roster.ID.String())}
+	if err := tn.SetConfig(&conf); err != nil {
+		return nil, xerrors.Errorf("couldn't set config: %+v", err)
+	}
+	pi, err := s.newDKGProtocol(tn, query.Roster.ID.String())
+	if err != nil {
+		return nil, err
+	}
+	if err := s.RegisterProtocolInstance(pi); err != nil {
+		return nil, err
+	}
+	dkgProtocol := pi.(*protocolsunlynx.DKGProtocol)
+	dkgProtocol.Threshold = int(query.Threshold)
+
+	go func() {
+		if err := pi.Dispatch(); err != nil {
+			log.Error("Error running Dispatch ->" + protocolsunlynx.DKGProtocolName + " :" + err.Error())
+		}
+	}()
+	go func() {
+		if err := pi.Start(); err != nil {
+			log.Error("Error running Start ->" + protocolsunlynx.DKGProtocolName + " :" + err.Error())
+		}
+	}()
+
+	select {
+	case dks := <-dkgProtocol.FeedbackChannel:
+		return &DKGResponse{CollectiveKey: dks.Public()}, nil
+	case <-time.After(libunlynx.TIMEOUT):
+		return nil, fmt.Errorf("%s didn't get the collective key on time", s.ServerIdentity())
+	}
+}
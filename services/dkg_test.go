@@ -0,0 +1,67 @@
+package servicesunlynx_test
+
+import (
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3/util/key"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+)
+
+func TestServiceDKG(t *testing.T) {
+	log.Lvl1("***************************************************************************************************")
+	os.Remove("pre_compute_multiplications.gob")
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+	_, el, _ := local.GenTree(4, true)
+	defer local.CloseAll()
+
+	client := servicesunlynx.NewUnLynxClient(el.List[0], strconv.Itoa(0))
+	_, err := client.SendDKGQuery(el, 5)
+	assert.Error(t, err, "the threshold is more than the number of servers")
+
+	collectiveKey, err := client.SendDKGQuery(el, 3)
+	require.NoError(t, err)
+	assert.False(t, collectiveKey.Equal(el.Aggregate))
+
+	nbrDPs := make(map[string]int64)
+	for _, server := range el.List {
+		nbrDPs[server.String()] = 1
+	}
+	query := "SELECT SUM(s1), COUNT(*) WHERE w1 = 1 GROUP BY g1"
+
+	// the servers only accept the keys they generated
+	_, err = client.SendSurveySQLQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, query, 8, servicesunlynx.SurveyOptions{CollectiveKey: key.NewKeyPair(libunlynx.SuiTe).Public})
+	assert.Error(t, err)
+
+	surveyID, err := client.SendSurveySQLQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, query, 8, servicesunlynx.SurveyOptions{CollectiveKey: collectiveKey})
+	require.NoError(t, err)
+
+	for i, server := range el.List {
+		dp := servicesunlynx.NewUnLynxClient(server, strconv.Itoa(i+1))
+		status, err := dp.SendSurveyDpStatusQuery(*surveyID)
+		require.NoError(t, err)
+		assert.True(t, status.CollectiveKey.Equal(collectiveKey))
+
+		responses := []libunlynx.DpClearResponse{{
+			WhereEnc:                 map[string]int64{"w1": int64(i % 2)},
+			GroupByEnc:               map[string]int64{"g1": int64(i % 3)},
+			AggregatingAttributesEnc: map[string]int64{"s1": int64(i + 1)},
+		}}
+		require.NoError(t, dp.SendSurveyResponseQuery(*surveyID, responses, status.CollectiveKey, 1, status.Count, nil, nil, nil, nil))
+	}
+
+	// the data providers 1 and 3 (groups 1 and 0) match the where condition
+	grp, aggr, err := client.SendSurveyResultsQuery(*surveyID)
+	require.NoError(t, err)
+	results := make(map[int64][]int64)
+	for i := range *grp {
+		results[(*grp)[i][0]] = (*aggr)[i]
+	}
+	assert.Equal(t, map[int64][]int64{0: {4, 1}, 1: {2, 1}}, results)
+}
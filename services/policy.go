@@ -0,0 +1,474 @@
+package servicesunlynx
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/ldsec/unlynx/lib"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/sign/schnorr"
+	"go.dedis.ch/kyber/v3/util/encoding"
+)
+
+// Policy is the access policy of the servers: the queriers allowed to create surveys and the attributes they can use.
+// The queriers are not authenticated if it has no querier. It is loaded from the QuerierPolicy file of the
+// configuration of the server (see ServerConfig).
+var Policy = &AccessPolicy{}
+
+// QuerierRights are the rights of a querier, identified by its long-term public key (hex). The lists of attributes
+// can contain "*" to allow all the attributes.
+type QuerierRights struct {
+	Name      string
+	Public    string
+	Aggregate []string // attributes that can be aggregated (the count is always allowed)
+	GroupBy   []string // attributes that can be used to group the results
+	Where     []string // attributes that can be used in the where conditions (compared with values or ranges)
+	Proofs    bool     // the surveys of the querier must be run with proofs
+	DiffPri   bool     // the surveys of the querier must be differentially private
+}
+
+// AdminKey is the long-term public key (hex) of an administrator of the servers, who registers the schemas of the
+// datasets and authorizes the changes of roster.
+type AdminKey struct {
+	Name   string
+	Public string
+}
+
+// AccessPolicy lists the rights of the queriers and the administrators of the servers, it is written in TOML:
+//
+//	[[querier]]
+//	name = "alice"
+//	public = "5f8a..."
+//	aggregate = ["s1", "s2"]
+//	groupBy = ["*"]
+//	where = ["w1"]
+//	diffPri = true
+//
+//	[[admin]]
+//	name = "bob"
+//	public = "3c1e..."
+type AccessPolicy struct {
+	Queriers []QuerierRights `toml:"querier"`
+	Admins   []AdminKey      `toml:"admin"`
+
+	rights map[string]QuerierRights // by public key
+	admins map[string]AdminKey      // by public key
+}
+
+// LoadAccessPolicy reads an access policy from a TOML file
+func LoadAccessPolicy(filename string) (*AccessPolicy, error) {
+	policy := AccessPolicy{}
+	if _, err := toml.DecodeFile(filename, &policy); err != nil {
+		return nil, err
+	}
+	return NewAccessPolicyWithAdmins(policy.Queriers, policy.Admins)
+}
+
+// NewAccessPolicy constructor of an AccessPolicy without administrator, the rights of the queriers are indexed by
+// public key
+func NewAccessPolicy(queriers []QuerierRights) (*AccessPolicy, error) {
+	return NewAccessPolicyWithAdmins(queriers, nil)
+}
+
+// NewAccessPolicyWithAdmins constructor of an AccessPolicy, the rights of the queriers and the administrators are
+// indexed by public key
+func NewAccessPolicyWithAdmins(queriers []QuerierRights, admins []AdminKey) (*AccessPolicy, error) {
+	p := &AccessPolicy{Queriers: queriers, Admins: admins, rights: make(map[string]QuerierRights, len(queriers)),
+		admins: make(map[string]AdminKey, len(admins))}
+	for _, qr := range queriers {
+		public, err := encoding.StringHexToPoint(libunlynx.SuiTe, qr.Public)
+		if err != nil {
+			return nil, fmt.Errorf("wrong public key for querier %s: %v", qr.Name, err)
+		}
+		p.rights[public.String()] = qr
+	}
+	for _, admin := range admins {
+		public, err := encoding.StringHexToPoint(libunlynx.SuiTe, admin.Public)
+		if err != nil {
+			return nil, fmt.Errorf("wrong public key for administrator %s: %v", admin.Name, err)
+		}
+		p.admins[public.String()] = admin
+	}
+	return p, nil
+}
+
+// admin returns the administrator with a public key, if there is one
+func (p *AccessPolicy) admin(public kyber.Point) (AdminKey, bool) {
+	admin, ok := p.admins[public.String()]
+	return admin, ok
+}
+
+// Enforced returns true if the queriers are authenticated and their queries checked
+func (p *AccessPolicy) Enforced() bool {
+	return len(p.Queriers) > 0
+}
+
+// allowed checks if an attribute is in a list of allowed attributes
+func allowed(list []string, attribute string) bool {
+	for _, v := range list {
+		if v == "*" || v == attribute {
+			return true
+		}
+	}
+	return false
+}
+
+// Check checks that the querier of a survey is allowed to run it
+func (p *AccessPolicy) Check(query *SurveyCreationQuery) error {
+	if query.Querier == nil {
+		return fmt.Errorf("the querier is not identified")
+	}
+	qr, ok := p.rights[query.Querier.String()]
+	if !ok {
+		return fmt.Errorf("querier %s is not authorized", query.Querier.String())
+	}
+
+	for _, column := range query.Sum {
+		if column == libunlynx.CountAttribute && query.Count {
+			continue
+		}
+		attribute := column
+		if squared, ok := libunlynx.SquareOf(column); ok {
+			attribute = squared
+		}
+		if !allowed(qr.Aggregate, attribute) {
+			return fmt.Errorf("querier %s cannot aggregate attribute %s", qr.Name, attribute)
+		}
+	}
+	for _, attribute := range query.GroupBy {
+		if !allowed(qr.GroupBy, attribute) {
+			return fmt.Errorf("querier %s cannot group by attribute %s", qr.Name, attribute)
+		}
+	}
+	// the predicate can only use the where attributes of the query
+	for _, w := range query.Where {
+		if !allowed(qr.Where, w.Name) {
+			return fmt.Errorf("querier %s cannot filter on attribute %s", qr.Name, w.Name)
+		}
+	}
+	for _, wr := range query.WhereRange {
+		if !allowed(qr.Where, wr.Name) {
+			return fmt.Errorf("querier %s cannot filter on attribute %s", qr.Name, wr.Name)
+		}
+	}
+	if _, err := query.compilePredicate(); err != nil {
+		return fmt.Errorf("invalid predicate: %v", err)
+	}
+	if qr.Proofs && !query.Proofs {
+		return fmt.Errorf("the surveys of querier %s must be run with proofs", qr.Name)
+	}
+	if qr.DiffPri && !query.DiffPri.Enabled() {
+		return fmt.Errorf("the surveys of querier %s must be differentially private", qr.Name)
+	}
+	return nil
+}
+
+// Signed queries
+//______________________________________________________________________________________________________________________
+
+// SignatureValidity is the time during which the signed requests that are not bound to a survey state (e.g. a schema
+// registration) are accepted after they are signed, they cannot be replayed once it is over
+var SignatureValidity = time.Minute
+
+// checkTimestamp checks that a signed request was signed less than SignatureValidity ago
+func checkTimestamp(timestamp int64) error {
+	age := time.Since(time.Unix(0, timestamp))
+	if age > SignatureValidity || age < -SignatureValidity {
+		return fmt.Errorf("the request was not signed in the last %s", SignatureValidity.String())
+	}
+	return nil
+}
+
+// signedMessageHash hashes the fields of a signed message in a canonical binary encoding: every value is written with
+// a fixed size or after its length, so that the message does not depend on the formatting of the values
+type signedMessageHash struct {
+	hash.Hash
+	err error
+}
+
+// newSignedMessageHash starts the hash of a signed message, the domain separates the kinds of signed messages
+func newSignedMessageHash(domain string) *signedMessageHash {
+	h := &signedMessageHash{Hash: sha256.New()}
+	h.writeString(domain)
+	return h
+}
+
+func (h *signedMessageHash) writeUint(v uint64) {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	h.Write(b)
+}
+
+func (h *signedMessageHash) writeInt(v int64) {
+	h.writeUint(uint64(v))
+}
+
+func (h *signedMessageHash) writeFloat(v float64) {
+	h.writeUint(math.Float64bits(v))
+}
+
+func (h *signedMessageHash) writeBool(v bool) {
+	if v {
+		h.writeUint(1)
+	} else {
+		h.writeUint(0)
+	}
+}
+
+func (h *signedMessageHash) writeBytes(b []byte) {
+	h.writeUint(uint64(len(b)))
+	h.Write(b)
+}
+
+func (h *signedMessageHash) writeString(s string) {
+	h.writeBytes([]byte(s))
+}
+
+func (h *signedMessageHash) writeStrings(list []string) {
+	h.writeUint(uint64(len(list)))
+	for _, s := range list {
+		h.writeString(s)
+	}
+}
+
+// writePoint writes a point (a nil point is written as an empty value)
+func (h *signedMessageHash) writePoint(p kyber.Point) {
+	if p == nil {
+		h.writeBytes(nil)
+		return
+	}
+	b, err := p.MarshalBinary()
+	if err != nil && h.err == nil {
+		h.err = err
+	}
+	h.writeBytes(b)
+}
+
+func (h *signedMessageHash) writeCipherText(ct libunlynx.CipherText) {
+	h.writePoint(ct.K)
+	h.writePoint(ct.C)
+}
+
+// sum returns the hash of the message, or the error of the first value that could not be written
+func (h *signedMessageHash) sum() ([]byte, error) {
+	if h.err != nil {
+		return nil, h.err
+	}
+	return h.Sum(nil), nil
+}
+
+// signedMessage returns the message signed by the querier: the statement of the query and its parameters (the fields
+// set by the servers when the query is broadcast are not signed)
+func (query *SurveyCreationQuery) signedMessage() ([]byte, error) {
+	h := newSignedMessageHash("survey creation")
+	h.writeString(query.Suite)
+	h.writeBytes(query.Roster.ID[:])
+	h.writePoint(query.Roster.Aggregate)
+	h.writePoint(query.CollectiveKey)
+	h.writePoint(query.ClientPubKey)
+
+	servers := make([]string, 0, len(query.MapDPs))
+	for server := range query.MapDPs {
+		servers = append(servers, server)
+	}
+	sort.Strings(servers)
+	h.writeUint(uint64(len(servers)))
+	for _, server := range servers {
+		h.writeString(server)
+		h.writeInt(query.MapDPs[server])
+	}
+
+	h.writeBool(query.Proofs)
+	h.writeBool(query.AppFlag)
+	h.writeInt(query.Deadline)
+	h.writeInt(query.Quorum)
+	h.writeInt(query.ExpectedRows)
+	h.writeString(query.Dataset)
+	h.writeStrings(query.Sum)
+	h.writeBool(query.Count)
+	h.writeUint(uint64(len(query.Where)))
+	for _, w := range query.Where {
+		h.writeString(w.Name)
+		h.writeCipherText(w.Value)
+	}
+	h.writeString(query.Predicate)
+	h.writeStrings(query.GroupBy)
+	h.writeUint(uint64(len(query.WhereRange)))
+	for _, wr := range query.WhereRange {
+		h.writeString(wr.Name)
+		h.writeInt(wr.Bits)
+		h.writeUint(uint64(len(wr.Cover)))
+		for _, ct := range wr.Cover {
+			h.writeCipherText(ct)
+		}
+	}
+	h.writeUint(uint64(len(query.Types)))
+	for _, at := range query.Types {
+		h.writeString(at.Kind)
+		h.writeInt(at.Scale)
+	}
+	h.writeUint(uint64(len(query.Operations)))
+	for _, op := range query.Operations {
+		h.writeString(op.Op)
+		h.writeString(op.Attribute)
+	}
+	h.writeUint(uint64(len(query.Bounds)))
+	for _, b := range query.Bounds {
+		h.writeString(b.Attribute)
+		h.writeInt(b.Min)
+		h.writeInt(b.Max)
+	}
+	h.writeFloat(query.DiffPri.Epsilon)
+	h.writeFloat(query.DiffPri.Sensitivity)
+	h.writeInt(query.DiffPri.NoiseListSize)
+	h.writeFloat(query.DiffPri.Quanta)
+	h.writeFloat(query.DiffPri.Scale)
+	h.writeFloat(query.DiffPri.Limit)
+	return h.sum()
+}
+
+// Sign signs the query with the long-term private key of the querier
+func (query *SurveyCreationQuery) Sign(private kyber.Scalar) error {
+	query.Querier = libunlynx.SuiTe.Point().Mul(private, nil)
+	msg, err := query.signedMessage()
+	if err != nil {
+		return err
+	}
+	signature, err := schnorr.Sign(libunlynx.SuiTe, private, msg)
+	if err != nil {
+		return err
+	}
+	query.Signature = signature
+	return nil
+}
+
+// Verify checks the signature of the query
+func (query *SurveyCreationQuery) Verify() error {
+	if query.Querier == nil || len(query.Signature) == 0 {
+		return fmt.Errorf("the query is not signed")
+	}
+	msg, err := query.signedMessage()
+	if err != nil {
+		return err
+	}
+	if err := schnorr.Verify(libunlynx.SuiTe, query.Querier, msg, query.Signature); err != nil {
+		return fmt.Errorf("wrong signature of the query: %v", err)
+	}
+	return nil
+}
+
+// authorize checks the signature of a query and that its querier is allowed to run it by the policy. The unsigned
+// queries are only accepted if the policy is not enforced.
+func (query *SurveyCreationQuery) authorize(policy *AccessPolicy) error {
+	if query.Querier == nil && len(query.Signature) == 0 && !policy.Enforced() {
+		return nil
+	}
+	if err := query.Verify(); err != nil {
+		return err
+	}
+	if policy.Enforced() {
+		return policy.Check(query)
+	}
+	return nil
+}
+
+// QuerierSignature is the signature of a request about the surveys of a querier (listing, status or cancellation):
+// Querier is the long-term public key of the querier and Signature its signature of the request and of the Timestamp
+// (unix nanoseconds) at which it is signed.
+type QuerierSignature struct {
+	Querier   kyber.Point
+	Timestamp int64
+	Signature []byte
+}
+
+// signedMessage returns the message signed by the querier: the kind of request, the survey (if any) and the timestamp
+func (qs *QuerierSignature) signedMessage(request string, sid SurveyID) ([]byte, error) {
+	h := newSignedMessageHash(request)
+	h.writeString(string(sid))
+	h.writePoint(qs.Querier)
+	h.writeInt(qs.Timestamp)
+	return h.sum()
+}
+
+// newQuerierSignature signs a request with the long-term private key of the querier
+func newQuerierSignature(private kyber.Scalar, request string, sid SurveyID) (QuerierSignature, error) {
+	qs := QuerierSignature{Querier: libunlynx.SuiTe.Point().Mul(private, nil), Timestamp: time.Now().UnixNano()}
+	msg, err := qs.signedMessage(request, sid)
+	if err != nil {
+		return QuerierSignature{}, err
+	}
+	qs.Signature, err = schnorr.Sign(libunlynx.SuiTe, private, msg)
+	return qs, err
+}
+
+// verify checks that a request was recently signed by its querier
+func (qs *QuerierSignature) verify(request string, sid SurveyID) error {
+	if qs.Querier == nil || len(qs.Signature) == 0 {
+		return fmt.Errorf("the %s is not signed", request)
+	}
+	if err := checkTimestamp(qs.Timestamp); err != nil {
+		return err
+	}
+	msg, err := qs.signedMessage(request, sid)
+	if err != nil {
+		return err
+	}
+	if err := schnorr.Verify(libunlynx.SuiTe, qs.Querier, msg, qs.Signature); err != nil {
+		return fmt.Errorf("wrong signature of the %s: %v", request, err)
+	}
+	return nil
+}
+
+// verifyFor checks that a request about a survey was recently signed by the querier of the survey
+func (qs *QuerierSignature) verifyFor(request string, query *SurveyCreationQuery) error {
+	if query.Querier == nil {
+		return fmt.Errorf("survey %s has no identified querier", query.SurveyID)
+	}
+	if qs.Querier == nil || !qs.Querier.Equal(query.Querier) {
+		return fmt.Errorf("the %s of survey %s can only be made by its querier", request, query.SurveyID)
+	}
+	return qs.verify(request, query.SurveyID)
+}
+
+// signedMessage returns the message signed by the querier: the survey and the key to which the results are switched
+func (resq *SurveyResultsQuery) signedMessage() ([]byte, error) {
+	h := newSignedMessageHash("survey results")
+	h.writeString(string(resq.SurveyID))
+	h.writePoint(resq.ClientPublic)
+	return h.sum()
+}
+
+// Sign signs the query with the long-term private key of the querier
+func (resq *SurveyResultsQuery) Sign(private kyber.Scalar) error {
+	msg, err := resq.signedMessage()
+	if err != nil {
+		return err
+	}
+	resq.Signature, err = schnorr.Sign(libunlynx.SuiTe, private, msg)
+	return err
+}
+
+// authorize checks that the results of a survey created by an identified querier are requested by this querier (the
+// query is signed with its key) and switched to its key
+func (resq *SurveyResultsQuery) authorize(query *SurveyCreationQuery) error {
+	if query.Querier == nil {
+		return nil
+	}
+	if resq.ClientPublic == nil || !resq.ClientPublic.Equal(query.Querier) {
+		return fmt.Errorf("the results of survey %s can only be switched to the key of its querier", resq.SurveyID)
+	}
+	msg, err := resq.signedMessage()
+	if err != nil {
+		return err
+	}
+	if err := schnorr.Verify(libunlynx.SuiTe, query.Querier, msg, resq.Signature); err != nil {
+		return fmt.Errorf("wrong signature of the results query: %v", err)
+	}
+	return nil
+}
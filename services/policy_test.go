@@ -0,0 +1,131 @@
+package servicesunlynx_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/lib/differential_privacy"
+	"github.com/ldsec/unlynx/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3/util/encoding"
+	"go.dedis.ch/kyber/v3/util/key"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+)
+
+func TestAccessPolicy(t *testing.T) {
+	keys := key.NewKeyPair(libunlynx.SuiTe)
+	public, err := encoding.PointToStringHex(libunlynx.SuiTe, keys.Public)
+	require.NoError(t, err)
+
+	dir, err := ioutil.TempDir("", "unlynx")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "policy.toml")
+	policyToml := "[[querier]]\nname = \"alice\"\npublic = \"" + public + "\"\naggregate = [\"s1\"]\ngroupBy = [\"*\"]\nwhere = [\"w1\"]\ndiffPri = true\n"
+	require.NoError(t, ioutil.WriteFile(filename, []byte(policyToml), 0600))
+
+	policy, err := servicesunlynx.LoadAccessPolicy(filename)
+	require.NoError(t, err)
+	assert.True(t, policy.Enforced())
+
+	dp := libunlynxdiffprivacy.Params{Epsilon: 1, Sensitivity: 1, NoiseListSize: 10, Quanta: 0.1, Scale: 1}
+	query := servicesunlynx.SurveyCreationQuery{Sum: []string{"s1", "s1^2", "count"}, Count: true, GroupBy: []string{"g1"}, DiffPri: dp}
+	assert.Error(t, policy.Check(&query))
+	require.NoError(t, query.Sign(keys.Private))
+	require.NoError(t, query.Verify())
+	require.NoError(t, policy.Check(&query))
+
+	// the statement of the query is signed
+	tampered := query
+	tampered.Sum = []string{"s2"}
+	assert.Error(t, tampered.Verify())
+
+	// where attributes
+	filtered := query
+	filtered.Where = []libunlynx.WhereQueryAttribute{{Name: "w1", Value: *libunlynx.EncryptInt(keys.Public, 1)}}
+	filtered.WhereRange = []libunlynx.WhereQueryRange{{Name: "w1", Bits: 1}}
+	filtered.Predicate = "w1 = :w1 && range(w1)"
+	require.NoError(t, filtered.Sign(keys.Private))
+	require.NoError(t, policy.Check(&filtered))
+
+	for _, q := range []servicesunlynx.SurveyCreationQuery{
+		{Sum: []string{"s2"}, DiffPri: dp},
+		{Sum: []string{"s1"}},
+		{Sum: []string{"s1"}, DiffPri: dp, Where: []libunlynx.WhereQueryAttribute{{Name: "w2", Value: *libunlynx.EncryptInt(keys.Public, 1)}}, Predicate: "w2 = :w2"},
+		{Sum: []string{"s1"}, DiffPri: dp, WhereRange: []libunlynx.WhereQueryRange{{Name: "w2", Bits: 1}}, Predicate: "range(w2)"},
+		{Sum: []string{"s1"}, DiffPri: dp, Where: []libunlynx.WhereQueryAttribute{{Name: "w1", Value: *libunlynx.EncryptInt(keys.Public, 1)}}, Predicate: "w1 = :w3"},
+	} {
+		require.NoError(t, q.Sign(keys.Private))
+		assert.Error(t, policy.Check(&q))
+	}
+	other := query
+	require.NoError(t, other.Sign(key.NewKeyPair(libunlynx.SuiTe).Private))
+	assert.Error(t, policy.Check(&other))
+
+	_, err = servicesunlynx.NewAccessPolicy([]servicesunlynx.QuerierRights{{Name: "bob", Public: "bob"}})
+	assert.Error(t, err)
+}
+
+func TestServiceAccessPolicy(t *testing.T) {
+	log.Lvl1("***************************************************************************************************")
+	os.Remove("pre_compute_multiplications.gob")
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+	servers, el, _ := local.GenTree(3, true)
+	defer local.CloseAll()
+
+	alice := key.NewKeyPair(libunlynx.SuiTe)
+	public, err := encoding.PointToStringHex(libunlynx.SuiTe, alice.Public)
+	require.NoError(t, err)
+	policy, err := servicesunlynx.NewAccessPolicy([]servicesunlynx.QuerierRights{{Name: "alice", Public: public, Aggregate: []string{"s1", "s2"}, GroupBy: []string{"g1"}}})
+	require.NoError(t, err)
+	// the last server does not let alice aggregate s2
+	restricted, err := servicesunlynx.NewAccessPolicy([]servicesunlynx.QuerierRights{{Name: "alice", Public: public, Aggregate: []string{"s1"}, GroupBy: []string{"g1"}}})
+	require.NoError(t, err)
+	for i, service := range local.GetServices(servers, onet.ServiceFactory.ServiceID(servicesunlynx.ServiceName)) {
+		service.(*servicesunlynx.Service).Policy = policy
+		if i == len(servers)-1 {
+			service.(*servicesunlynx.Service).Policy = restricted
+		}
+	}
+
+	nbrDPs := make(map[string]int64)
+	for _, server := range el.List {
+		nbrDPs[server.String()] = 1
+	}
+
+	client := servicesunlynx.NewUnLynxClientWithKeys(el.List[0], strconv.Itoa(0), alice)
+	stranger := servicesunlynx.NewUnLynxClient(el.List[0], "stranger")
+
+	_, err = stranger.SendSurveySQLQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, "SELECT SUM(s1)", 0, servicesunlynx.SurveyOptions{})
+	assert.Error(t, err)
+	_, err = client.SendSurveySQLQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, "SELECT SUM(s1) GROUP BY g2", 0, servicesunlynx.SurveyOptions{})
+	assert.Error(t, err)
+	// refused by the last server only
+	_, err = client.SendSurveySQLQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, "SELECT SUM(s2)", 0, servicesunlynx.SurveyOptions{})
+	assert.Error(t, err)
+	list, err := client.SendSurveyListQuery()
+	require.NoError(t, err)
+	assert.Empty(t, list)
+
+	surveyID, err := client.SendSurveySQLQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, "SELECT SUM(s1) GROUP BY g1", 0, servicesunlynx.SurveyOptions{})
+	require.NoError(t, err)
+	for i, server := range el.List {
+		dp := servicesunlynx.NewUnLynxClient(server, strconv.Itoa(i+1))
+		responses := []libunlynx.DpClearResponse{{GroupByClear: map[string]int64{"g1": 1}, AggregatingAttributesEnc: map[string]int64{"s1": 2}}}
+		require.NoError(t, dp.SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, false, nil, nil, nil, nil))
+	}
+
+	// only alice gets the results
+	_, _, err = stranger.SendSurveyResultsQuery(*surveyID)
+	assert.Error(t, err)
+	grp, aggr, err := client.SendSurveyResultsQuery(*surveyID)
+	require.NoError(t, err)
+	assert.Equal(t, [][]int64{{1}}, *grp)
+	assert.Equal(t, [][]int64{{6}}, *aggr)
+}
@@ -0,0 +1,71 @@
+package servicesunlynx
+
+import (
+	"path/filepath"
+
+	"github.com/ldsec/unlynx/lib/shuffle"
+	"go.dedis.ch/onet/v3/log"
+)
+
+// PrecomputationDir is the directory where the servers save their pool of precomputed values for shuffling (one
+// sub-directory per server), the pools are only kept in memory if it is empty.
+var PrecomputationDir string
+
+// newPrecomputationPool creates the pool of precomputed values of a server
+func newPrecomputationPool(server string) (*libunlynxshuffle.PrecomputationPool, error) {
+	dir := ""
+	if PrecomputationDir != "" {
+		dir = filepath.Join(PrecomputationDir, server)
+	}
+	return libunlynxshuffle.NewPrecomputationPool(dir)
+}
+
+// shuffleLineSize returns the size of the precomputed lines used to shuffle the responses of a survey (twice the
+// number of their attributes)
+func (query *SurveyCreationQuery) shuffleLineSize() int {
+	lineSize := len(query.Sum) + len(query.whereColumns()) + len(query.GroupBy) + 1 // + 1 is for the possible count attribute
+	return lineSize * 2
+}
+
+// MaxExpectedRows is the largest number of rows that a survey can expect (see SurveyCreationQuery.ExpectedRows), the
+// servers would spend too much time and space precomputing the values to shuffle more
+var MaxExpectedRows int64 = 1000000
+
+// expectedRows returns the number of rows a survey is expected to shuffle: its expected rows, and at least one
+// response per data provider
+func (query *SurveyCreationQuery) expectedRows() int {
+	rows := query.ExpectedRows
+	if dps := CountDPs(query.MapDPs); dps > rows {
+		rows = dps
+	}
+	if rows < 1 {
+		rows = 1
+	}
+	return int(rows)
+}
+
+// reservePrecomputations reserves the precomputed values needed to shuffle the responses of a survey, they are
+// computed in the background while the data is collected
+func (s *Service) reservePrecomputations(sid SurveyID, query *SurveyCreationQuery) {
+	s.Precomputations.Reserve(string(sid), query.collectiveKey(), query.shuffleLineSize(), query.expectedRows())
+}
+
+// topUpPrecomputations reserves the precomputed values needed to shuffle the rows actually sent to a survey, once its
+// collection ends, if there are more than expected
+func (s *Service) topUpPrecomputations(sid SurveyID, query *SurveyCreationQuery, rows int64) {
+	if rows > int64(query.expectedRows()) {
+		log.Lvl2(s.ServerIdentity(), " precomputes the values to shuffle ", rows, " rows for survey ", sid, " (", query.expectedRows(), " expected)")
+		s.Precomputations.Reserve(string(sid), query.collectiveKey(), query.shuffleLineSize(), int(rows))
+	}
+}
+
+// takePrecomputations returns the precomputed values used to shuffle the rows of a survey, they are removed from the
+// pool (on-line randomization is used if they cannot be taken)
+func (s *Service) takePrecomputations(sid SurveyID, query *SurveyCreationQuery, rows int) []libunlynxshuffle.CipherVectorScalar {
+	precomputed, err := s.Precomputations.Take(string(sid), query.collectiveKey(), query.shuffleLineSize(), rows)
+	if err != nil {
+		log.Error(s.ServerIdentity(), " could not take the precomputations of survey ", sid, ": ", err)
+		return nil
+	}
+	return precomputed
+}
@@ -0,0 +1,379 @@
+package servicesunlynx
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/ldsec/unlynx/lib"
+)
+
+// Predicates
+//______________________________________________________________________________________________________________________
+
+// Predicate is a compiled predicate on the where attributes of the responses to a query. It is evaluated on the tags
+// of the values of the query, the tags of the where attributes of a response and the results of the range conditions.
+type Predicate struct {
+	source string
+	root   predicateNode
+}
+
+type predicateNode interface {
+	evaluate(queryValues, responseValues []libunlynx.GroupingKey, inRanges []bool) (bool, error)
+}
+
+// predicateOperand is a tag of a value of the query (parameter) or of a where attribute of a response, given by its
+// index in the where attributes of the query
+type predicateOperand struct {
+	parameter bool
+	index     int
+}
+
+func (o predicateOperand) value(queryValues, responseValues []libunlynx.GroupingKey) (libunlynx.GroupingKey, error) {
+	values := responseValues
+	if o.parameter {
+		values = queryValues
+	}
+	if o.index >= len(values) {
+		return "", fmt.Errorf("missing where attribute %d to evaluate the predicate", o.index)
+	}
+	return values[o.index], nil
+}
+
+type andNode struct{ left, right predicateNode }
+
+func (n andNode) evaluate(queryValues, responseValues []libunlynx.GroupingKey, inRanges []bool) (bool, error) {
+	left, err := n.left.evaluate(queryValues, responseValues, inRanges)
+	if err != nil || !left {
+		return false, err
+	}
+	return n.right.evaluate(queryValues, responseValues, inRanges)
+}
+
+type orNode struct{ left, right predicateNode }
+
+func (n orNode) evaluate(queryValues, responseValues []libunlynx.GroupingKey, inRanges []bool) (bool, error) {
+	left, err := n.left.evaluate(queryValues, responseValues, inRanges)
+	if err != nil || left {
+		return left, err
+	}
+	return n.right.evaluate(queryValues, responseValues, inRanges)
+}
+
+type notNode struct{ operand predicateNode }
+
+func (n notNode) evaluate(queryValues, responseValues []libunlynx.GroupingKey, inRanges []bool) (bool, error) {
+	result, err := n.operand.evaluate(queryValues, responseValues, inRanges)
+	return !result, err
+}
+
+type constantNode bool
+
+func (n constantNode) evaluate(queryValues, responseValues []libunlynx.GroupingKey, inRanges []bool) (bool, error) {
+	return bool(n), nil
+}
+
+// inNode is true if the left operand is equal to one of the operands of the list (an equality is a list of one operand)
+type inNode struct {
+	left predicateOperand
+	list []predicateOperand
+}
+
+func (n inNode) evaluate(queryValues, responseValues []libunlynx.GroupingKey, inRanges []bool) (bool, error) {
+	left, err := n.left.value(queryValues, responseValues)
+	if err != nil {
+		return false, err
+	}
+	for _, o := range n.list {
+		right, err := o.value(queryValues, responseValues)
+		if err != nil {
+			return false, err
+		}
+		if left == right {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type rangeNode int
+
+func (n rangeNode) evaluate(queryValues, responseValues []libunlynx.GroupingKey, inRanges []bool) (bool, error) {
+	if int(n) >= len(inRanges) {
+		return false, fmt.Errorf("missing range condition %d to evaluate the predicate", int(n))
+	}
+	return inRanges[n], nil
+}
+
+// String returns the source of the predicate
+func (p *Predicate) String() string {
+	return p.source
+}
+
+// Evaluate evaluates the predicate: queryValues are the tags of the where attributes of the query, responseValues the
+// tags of the where attributes of a response (in the same order) and inRanges tells if the response satisfies each range
+// condition of the query.
+func (p *Predicate) Evaluate(queryValues, responseValues []libunlynx.GroupingKey, inRanges []bool) (bool, error) {
+	return p.root.evaluate(queryValues, responseValues, inRanges)
+}
+
+// Compiler
+//______________________________________________________________________________________________________________________
+
+var (
+	positionalValueRegex = regexp.MustCompile(`^v([0-9]+)$`)
+	positionalRangeRegex = regexp.MustCompile(`^r([0-9]+)$`)
+)
+
+// predicateParser compiles a predicate:
+//
+//	condition: condition || condition, condition && condition, !condition, (condition), true, false,
+//	           operand == operand, operand != operand, operand IN (operand, ...), operand NOT IN (operand, ...),
+//	           range(attribute)
+//	operand:   attribute (its value in the response) or :attribute (its value in the query)
+//
+// "and", "or" and "not" can be used instead of &&, || and !. When a query has several values (or range conditions) for
+// an attribute, the i-th one (from 0) is :attribute[i] (range(attribute[i])). The positional predicates are also
+// supported: v(2k) is the k-th value of the query, v(2k+1) the k-th where attribute of a response and rk the k-th range
+// condition.
+type predicateParser struct {
+	tokenStream
+	where  []string
+	ranges []string
+}
+
+func isPredicateKeyword(t token) bool {
+	for _, keyword := range []string{"and", "or", "not", "in", "true", "false", "range"} {
+		if isKeyword(t, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *predicateParser) acceptOperator(symbol, keyword string) bool {
+	if t := p.peek(); (t.kind == tokenSymbol && t.text == symbol) || isKeyword(t, keyword) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *predicateParser) parseOr() (predicateNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptOperator("||", "or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *predicateParser) parseAnd() (predicateNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptOperator("&&", "and") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *predicateParser) parseNot() (predicateNode, error) {
+	if p.acceptOperator("!", "not") {
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{operand: operand}, nil
+	}
+	if p.acceptSymbol("(") {
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		return inner, nil
+	}
+
+	t := p.peek()
+	switch {
+	case isKeyword(t, "true") || isKeyword(t, "false"):
+		p.next()
+		return constantNode(isKeyword(t, "true")), nil
+	case isKeyword(t, "range"):
+		p.next()
+		return p.parseRange()
+	case t.kind == tokenIdent && positionalRangeRegex.MatchString(t.text) && p.indexOf(p.where, t.text, 0) < 0:
+		p.next()
+		k, _ := strconv.Atoi(t.text[1:])
+		if k >= len(p.ranges) {
+			return nil, p.errorf(t, "the query has no range condition "+t.text)
+		}
+		return rangeNode(k), nil
+	}
+	return p.parseComparison()
+}
+
+func (p *predicateParser) parseComparison() (predicateNode, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	t := p.next()
+	switch {
+	case t.kind == tokenSymbol && (t.text == "==" || t.text == "=" || t.text == "!=" || t.text == "<>"):
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		var node predicateNode = inNode{left: left, list: []predicateOperand{right}}
+		if t.text == "!=" || t.text == "<>" {
+			node = notNode{operand: node}
+		}
+		return node, nil
+	case isKeyword(t, "in") || isKeyword(t, "not"):
+		negate := isKeyword(t, "not")
+		if negate {
+			if in := p.next(); !isKeyword(in, "in") {
+				return nil, p.errorf(in, "expected IN but found "+in.describe())
+			}
+		}
+		if err := p.expectSymbol("("); err != nil {
+			return nil, err
+		}
+		var list []predicateOperand
+		for {
+			o, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, o)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		var node predicateNode = inNode{left: left, list: list}
+		if negate {
+			node = notNode{operand: node}
+		}
+		return node, nil
+	default:
+		return nil, p.errorf(t, "expected ==, !=, IN or NOT IN but found "+t.describe())
+	}
+}
+
+// parseOperand parses a where attribute of the responses or a parameter of the query and resolves its index
+func (p *predicateParser) parseOperand() (predicateOperand, error) {
+	parameter := p.acceptSymbol(":")
+	t := p.next()
+	if t.kind != tokenIdent || isPredicateKeyword(t) {
+		return predicateOperand{}, p.errorf(t, "expected a where attribute but found "+t.describe())
+	}
+
+	if !parameter && positionalValueRegex.MatchString(t.text) && p.indexOf(p.where, t.text, 0) < 0 {
+		n, _ := strconv.Atoi(t.text[1:])
+		if n/2 >= len(p.where) {
+			return predicateOperand{}, p.errorf(t, "the query has no where attribute "+t.text)
+		}
+		return predicateOperand{parameter: n%2 == 0, index: n / 2}, nil
+	}
+
+	i := 0
+	if parameter {
+		var err error
+		if i, err = p.parseIndex(); err != nil {
+			return predicateOperand{}, err
+		}
+	}
+	index := p.indexOf(p.where, t.text, i)
+	if index < 0 {
+		return predicateOperand{}, p.errorf(t, "the query has no where attribute "+t.text+indexSuffix(i))
+	}
+	return predicateOperand{parameter: parameter, index: index}, nil
+}
+
+// parseRange parses the arguments of a range condition and resolves its index
+func (p *predicateParser) parseRange() (predicateNode, error) {
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	t := p.next()
+	if t.kind != tokenIdent || isPredicateKeyword(t) {
+		return nil, p.errorf(t, "expected a where attribute but found "+t.describe())
+	}
+	i, err := p.parseIndex()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectSymbol(")"); err != nil {
+		return nil, err
+	}
+	index := p.indexOf(p.ranges, t.text, i)
+	if index < 0 {
+		return nil, p.errorf(t, "the query has no range condition on "+t.text+indexSuffix(i))
+	}
+	return rangeNode(index), nil
+}
+
+// parseIndex parses the optional index ([i]) of a value of an attribute
+func (p *predicateParser) parseIndex() (int, error) {
+	if !p.acceptSymbol("[") {
+		return 0, nil
+	}
+	t := p.next()
+	i, err := strconv.Atoi(t.text)
+	if t.kind != tokenNumber || err != nil || i < 0 {
+		return 0, p.errorf(t, "expected an index but found "+t.describe())
+	}
+	return i, p.expectSymbol("]")
+}
+
+// indexOf returns the position of the i-th occurrence of a name, -1 if there is none
+func (p *predicateParser) indexOf(names []string, name string, i int) int {
+	for j, v := range names {
+		if v == name {
+			if i == 0 {
+				return j
+			}
+			i--
+		}
+	}
+	return -1
+}
+
+// CompilePredicate compiles a predicate on the where attributes of a query, given the names of its where attributes and
+// of the attributes of its range conditions, e.g. "w1 == :w1 && (w2 != :w2 || w3 IN (:w3, :w3[1])) && range(w4)". The
+// syntax errors and the unknown attributes are *QueryError.
+func CompilePredicate(pred string, where, ranges []string) (*Predicate, error) {
+	tokens, err := tokenize(pred)
+	if err != nil {
+		return nil, err
+	}
+
+	p := predicateParser{tokenStream: tokenStream{tokens: tokens}, where: where, ranges: ranges}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectEOF(); err != nil {
+		return nil, err
+	}
+	return &Predicate{source: pred, root: root}, nil
+}
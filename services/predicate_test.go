@@ -0,0 +1,82 @@
+package servicesunlynx_test
+
+import (
+	"testing"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPredicateEvaluate tests the evaluation of compiled predicates.
+func TestPredicateEvaluate(t *testing.T) {
+	where := []string{"w1", "w2", "w2"}
+	ranges := []string{"w3"}
+	query := []libunlynx.GroupingKey{"1", "2", "3"}
+
+	for pred, expected := range map[string][]bool{
+		"w1 == :w1":                            {true, false, true, false},
+		"w1 = :w1 and w2 <> :w2":               {false, false, true, false},
+		"w2 IN (:w2, :w2[1])":                  {true, true, false, false},
+		"w2 NOT IN (:w2, :w2[1]) || range(w3)": {false, false, true, true},
+		"!(w1 == :w1 && range(w3)) && true":    {true, true, true, true},
+		"(v0 == v1 || v2 != v3) && !r0":        {true, true, true, false},
+		"false || range(w3[0]) || :w1 == w1":   {true, false, true, true},
+		"not not (w2 == :w2 or w2 == :w2[1])":  {true, true, false, false},
+	} {
+		p, err := servicesunlynx.CompilePredicate(pred, where, ranges)
+		require.NoError(t, err, pred)
+		assert.Equal(t, pred, p.String())
+
+		for i, response := range []struct {
+			values  []libunlynx.GroupingKey
+			inRange bool
+		}{
+			{[]libunlynx.GroupingKey{"1", "2", "2"}, false},
+			{[]libunlynx.GroupingKey{"0", "3", "3"}, false},
+			{[]libunlynx.GroupingKey{"1", "4", "4"}, false},
+			{[]libunlynx.GroupingKey{"0", "4", "4"}, true},
+		} {
+			keep, err := p.Evaluate(query, response.values, []bool{response.inRange})
+			require.NoError(t, err)
+			assert.Equal(t, expected[i], keep, pred+" on response "+string(rune('0'+i)))
+		}
+	}
+
+	// a response without all the where attributes
+	p, err := servicesunlynx.CompilePredicate("w2 == :w2", where, ranges)
+	require.NoError(t, err)
+	_, err = p.Evaluate(query, []libunlynx.GroupingKey{"1"}, []bool{false})
+	assert.Error(t, err)
+}
+
+// TestCompilePredicateErrors tests the positions of the errors of the predicates.
+func TestCompilePredicateErrors(t *testing.T) {
+	where := []string{"w1", "w2"}
+	ranges := []string{"w3"}
+
+	for pred, position := range map[string]int{
+		"":                           1,
+		"w1":                         3,
+		"w1 == :w4":                  8,
+		"w1 == :w1[1]":               8,
+		"w1 == :w1 &&":               13,
+		"(w1 == :w1":                 11,
+		"w1 IN :w1":                  7,
+		"w1 NOT w2":                  8,
+		"range(w1)":                  7,
+		"range(w3) || r1":            14,
+		"v0 == v4":                   7,
+		"w1 == :w1 w2":               11,
+		"w1 == :w1 # w2 == :w2":      11,
+		"w1 + 1":                     4,
+		"w1 == :w1 && range(w3[-1])": 23,
+	} {
+		_, err := servicesunlynx.CompilePredicate(pred, where, ranges)
+		require.Error(t, err, pred)
+		queryErr, ok := err.(*servicesunlynx.QueryError)
+		require.True(t, ok, pred)
+		assert.Equal(t, position, queryErr.Position, pred+": "+err.Error())
+	}
+}
@@ -0,0 +1,855 @@
+package servicesunlynx
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/lib/aggregation"
+	"github.com/ldsec/unlynx/lib/deterministic_tag"
+	"github.com/ldsec/unlynx/lib/key_switch"
+	"github.com/ldsec/unlynx/lib/shuffle"
+	"github.com/ldsec/unlynx/protocols/utils"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+)
+
+// ProofsArchiveDir is the directory where a server archives the proofs it creates (one sub-directory per survey), the
+// proofs are not archived if it is empty.
+var ProofsArchiveDir string
+
+func init() {
+	network.RegisterMessage(&ArchivedProofs{})
+}
+
+// ProofsPublication is sent by a server with the proofs it created for a survey to the root of the survey (the server
+// that received the query from the querier), which verifies them before releasing the results. Server is set by the
+// root to the server that sent the publication.
+type ProofsPublication struct {
+	SurveyID SurveyID
+	Server   string
+	Phase    SurveyPhase
+
+	ShufflingProofs      []libunlynxshuffle.PublishedShufflingProofBytes
+	DetTagAdditionProofs []libunlynxdetertag.PublishedDDTAdditionListProof
+	DetTagCreationProofs []libunlynxdetertag.PublishedDDTCreationListProof
+	AggregationProofs    []libunlynxaggr.PublishedAggregationListProof
+	KeySwitchingProofs   []libunlynxkeyswitch.PublishedKSListProof
+	SimpleAdditionProofs []libunlynx.PublishedSimpleAdditionProof
+
+	// Last is set in the last publication of a server for the survey (key switching), Count is then the total number
+	// of publications sent by this server
+	Last  bool
+	Count int64
+}
+
+// ProofsRecord keeps track of the proofs published for a survey and of their verification.
+type ProofsRecord struct {
+	mutex sync.Mutex
+
+	published int64            // number of publications sent by this server
+	received  map[string]int64 // number of verified publications per server
+	expected  map[string]int64 // total number of publications announced by each server
+	required  []string         // servers whose proofs are required (all the servers of the roster if nil)
+	additions []libunlynx.PublishedSimpleAdditionProof
+	failure   error
+
+	// links are the inputs and outputs of the proofs of the protocols in which the servers transform the data one
+	// after the other, per phase and kind of proof (see VerifyProofsChains)
+	links map[string][]proofsLink
+
+	// keySwitching are the key switching proofs of each server, they must match the ciphertexts switched by the root
+	// (see checkKeySwitching)
+	keySwitching map[string][]libunlynxkeyswitch.PublishedKSProof
+	switched     *switchedCiphers
+
+	updated chan int
+}
+
+// switchedCiphers are the ciphertexts switched to the key of the querier by the root and the results of the switch,
+// shares are the share indices of the servers whose contributions were combined (nil if all the servers switched the
+// ciphertexts with their private keys)
+type switchedCiphers struct {
+	target libunlynx.CipherVector
+	result libunlynx.CipherVector
+	shares map[string]int
+}
+
+// NewProofsRecord constructor of a ProofsRecord.
+func NewProofsRecord() *ProofsRecord {
+	return &ProofsRecord{
+		received:     make(map[string]int64),
+		expected:     make(map[string]int64),
+		links:        make(map[string][]proofsLink),
+		keySwitching: make(map[string][]libunlynxkeyswitch.PublishedKSProof),
+		updated:      make(chan int, 1),
+	}
+}
+
+// add records a publication (and the result of its verification) received from a server
+func (pr *ProofsRecord) add(pub *ProofsPublication, err error) {
+	pr.mutex.Lock()
+	pr.received[pub.Server]++
+	if pub.Last {
+		pr.expected[pub.Server] = pub.Count
+	}
+	addLinks(pr.links, pub)
+	for _, v := range pub.KeySwitchingProofs {
+		pr.keySwitching[pub.Server] = append(pr.keySwitching[pub.Server], v.List...)
+	}
+	if err != nil && pr.failure == nil {
+		pr.failure = err
+	}
+	pr.mutex.Unlock()
+
+	select {
+	case pr.updated <- 1:
+	default:
+	}
+}
+
+// Failure returns the error of the first proof that could not be verified, if any
+func (pr *ProofsRecord) Failure() error {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+	return pr.failure
+}
+
+// requireOnly restricts the servers whose proofs are required to the ones given, e.g. the servers whose key switching
+// contributions were combined (the others may be unavailable)
+func (pr *ProofsRecord) requireOnly(servers []*network.ServerIdentity) {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+	pr.required = make([]string, len(servers))
+	for i, si := range servers {
+		pr.required[i] = si.String()
+	}
+}
+
+// complete checks if all the required servers of the roster have published (and we have verified) all their proofs
+func (pr *ProofsRecord) complete(roster *onet.Roster) bool {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+	required := pr.required
+	if required == nil {
+		for _, si := range roster.List {
+			required = append(required, si.String())
+		}
+	}
+	for _, server := range required {
+		expected, ok := pr.expected[server]
+		if !ok || pr.received[server] < expected {
+			return false
+		}
+	}
+	// all the servers take part in the protocols whose proofs are chained
+	for _, links := range pr.links {
+		servers := make(map[string]bool)
+		for _, link := range links {
+			servers[link.server] = true
+		}
+		if len(servers) < len(roster.List) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkChains checks the chains of the proofs received from the servers of a roster (see VerifyProofsChains)
+func (pr *ProofsRecord) checkChains(roster *onet.Roster) error {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+	return checkChains(pr.links, len(roster.List))
+}
+
+// keySwitched records the ciphertexts switched by the root and the results of the switch (see switchedCiphers)
+func (pr *ProofsRecord) keySwitched(target, result libunlynx.CipherVector, shares map[string]int) {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+	pr.switched = &switchedCiphers{target: target, result: result, shares: shares}
+}
+
+// checkKeySwitching checks that the key switching proofs of the servers of a roster are on the ciphertexts switched by
+// the root and that their contributions add up to the results of the switch
+func (pr *ProofsRecord) checkKeySwitching(roster *onet.Roster) error {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+	sc := pr.switched
+	if sc == nil {
+		return nil
+	}
+
+	servers := make([]string, 0)
+	if sc.shares != nil {
+		for server := range sc.shares {
+			servers = append(servers, server)
+		}
+	} else {
+		for _, si := range roster.List {
+			servers = append(servers, si.String())
+		}
+	}
+
+	contributions := make(map[int]libunlynx.CipherVector)
+	for i, server := range servers {
+		proofs := pr.keySwitching[server]
+		if len(proofs) != len(sc.target) {
+			return fmt.Errorf("server %s published %d key switching proofs for %d ciphertexts", server, len(proofs), len(sc.target))
+		}
+		cv := make(libunlynx.CipherVector, len(proofs))
+		for k, p := range proofs {
+			if p.RbNeg == nil || p.ViB == nil || p.Ks2 == nil || !p.RbNeg.Equal(libunlynx.SuiTe.Point().Neg(sc.target[k].K)) {
+				return fmt.Errorf("the key switching proofs of server %s are not on the switched ciphertexts", server)
+			}
+			cv[k] = libunlynx.CipherText{K: p.ViB, C: p.Ks2}
+		}
+		if sc.shares != nil {
+			i = sc.shares[server]
+		}
+		contributions[i] = cv
+	}
+
+	var expected libunlynx.CipherVector
+	if sc.shares != nil {
+		var err error
+		if expected, err = libunlynxkeyswitch.ThresholdKeySwitchCombination(sc.target, contributions); err != nil {
+			return err
+		}
+	} else {
+		expected = *libunlynx.NewCipherVector(len(sc.target))
+		for k := range expected {
+			expected[k].K = libunlynx.SuiTe.Point().Null()
+			expected[k].C = libunlynx.SuiTe.Point().Set(sc.target[k].C)
+			for _, cv := range contributions {
+				expected[k].K.Add(expected[k].K, cv[k].K)
+				expected[k].C.Add(expected[k].C, cv[k].C)
+			}
+		}
+	}
+	if len(expected) != len(sc.result) {
+		return fmt.Errorf("the key switching proofs do not match the switched results")
+	}
+	for k := range expected {
+		if !expected[k].K.Equal(sc.result[k].K) || !expected[k].C.Equal(sc.result[k].C) {
+			return fmt.Errorf("the key switching proofs do not match the switched results")
+		}
+	}
+	return nil
+}
+
+// addAddition keeps a proof of an addition done while collecting the data, it is published with the first proofs of the
+// survey (all the servers have the survey by then)
+func (pr *ProofsRecord) addAddition(proof libunlynx.PublishedSimpleAdditionProof) {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+	pr.additions = append(pr.additions, proof)
+}
+
+// takeAdditions returns and forgets the proofs of additions that were not published yet
+func (pr *ProofsRecord) takeAdditions() []libunlynx.PublishedSimpleAdditionProof {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+	additions := pr.additions
+	pr.additions = nil
+	return additions
+}
+
+// proofsLink is the input and the output of the proofs of a server in a protocol in which the servers transform the
+// data one after the other (hashes, empty if there is no data)
+type proofsLink struct {
+	server string
+	input  string
+	output string
+}
+
+// links returns the input and the output of the proofs of a publication that are chained, by kind of proof: shuffling
+// and deterministic tagging (addition and creation)
+func (pub *ProofsPublication) links() map[string]proofsLink {
+	links := make(map[string]proofsLink)
+	hash := func(write func(add func([]byte))) string {
+		h := sha256.New()
+		empty := true
+		write(func(b []byte) {
+			empty = false
+			binary.Write(h, binary.BigEndian, int64(len(b)))
+			h.Write(b)
+		})
+		if empty {
+			return ""
+		}
+		return hex.EncodeToString(h.Sum(nil))
+	}
+	bytesOf := func(b *[]byte) []byte {
+		if b == nil {
+			return nil
+		}
+		return *b
+	}
+	point := func(p kyber.Point) []byte {
+		if p == nil {
+			return nil
+		}
+		b, err := p.MarshalBinary()
+		if err != nil {
+			return nil
+		}
+		return b
+	}
+
+	if len(pub.ShufflingProofs) > 0 {
+		links["shuffling"] = proofsLink{
+			server: pub.Server,
+			input: hash(func(add func([]byte)) {
+				for _, v := range pub.ShufflingProofs {
+					add(bytesOf(v.OriginalList))
+					add(bytesOf(v.OriginalListLength))
+				}
+			}),
+			output: hash(func(add func([]byte)) {
+				for _, v := range pub.ShufflingProofs {
+					add(bytesOf(v.ShuffledList))
+					add(bytesOf(v.ShuffledListLength))
+				}
+			}),
+		}
+	}
+	if len(pub.DetTagAdditionProofs) > 0 {
+		links["deterministic tagging (addition)"] = proofsLink{
+			server: pub.Server,
+			input: hash(func(add func([]byte)) {
+				for _, v := range pub.DetTagAdditionProofs {
+					for _, p := range v.List {
+						add(point(p.C1))
+					}
+				}
+			}),
+			output: hash(func(add func([]byte)) {
+				for _, v := range pub.DetTagAdditionProofs {
+					for _, p := range v.List {
+						add(point(p.R))
+					}
+				}
+			}),
+		}
+	}
+	if len(pub.DetTagCreationProofs) > 0 {
+		links["deterministic tagging (creation)"] = proofsLink{
+			server: pub.Server,
+			input: hash(func(add func([]byte)) {
+				for _, v := range pub.DetTagCreationProofs {
+					for _, p := range v.List {
+						add(point(p.CTbef.K))
+						add(point(p.CTbef.C))
+					}
+				}
+			}),
+			output: hash(func(add func([]byte)) {
+				for _, v := range pub.DetTagCreationProofs {
+					for _, p := range v.List {
+						add(point(p.CTaft.K))
+						add(point(p.CTaft.C))
+					}
+				}
+			}),
+		}
+	}
+	return links
+}
+
+// addLinks adds the links of a publication to the links of a survey, per phase and kind of proof
+func addLinks(links map[string][]proofsLink, pub *ProofsPublication) {
+	for kind, link := range pub.links() {
+		if link.input == "" && link.output == "" {
+			// no data was transformed
+			continue
+		}
+		key := pub.Phase.String() + " " + kind
+		links[key] = append(links[key], link)
+	}
+}
+
+// checkChains checks that the links of each phase and kind of proof form chains of the given number of servers (see
+// VerifyProofsChains)
+func checkChains(links map[string][]proofsLink, servers int) error {
+	for key, list := range links {
+		next := make(map[string]int)
+		for i, link := range list {
+			if j, ok := next[link.input]; ok {
+				return fmt.Errorf("servers %s and %s published %s proofs with the same input", list[j].server, link.server, key)
+			}
+			next[link.input] = i
+		}
+		outputs := make(map[string]bool)
+		for _, link := range list {
+			outputs[link.output] = true
+		}
+
+		visited := make([]bool, len(list))
+		starts := make(map[string]bool)
+		for i, link := range list {
+			if outputs[link.input] {
+				continue
+			}
+			if starts[link.server] {
+				return fmt.Errorf("server %s published %s proofs whose input is not the output of another server", link.server, key)
+			}
+			starts[link.server] = true
+
+			// the chain goes through every server once
+			inChain := make(map[string]bool)
+			for j, ok := i, true; ok; j, ok = next[list[j].output] {
+				if inChain[list[j].server] || visited[j] {
+					return fmt.Errorf("server %s appears twice in a chain of %s proofs", list[j].server, key)
+				}
+				inChain[list[j].server] = true
+				visited[j] = true
+			}
+			if len(inChain) != servers {
+				return fmt.Errorf("a chain of %s proofs started by server %s goes through %d servers instead of %d", key, link.server, len(inChain), servers)
+			}
+		}
+		for i, ok := range visited {
+			if !ok {
+				return fmt.Errorf("the input of the %s proofs of server %s is not the output of another server", key, list[i].server)
+			}
+		}
+	}
+	return nil
+}
+
+// Publication
+//______________________________________________________________________________________________________________________
+
+// publishProofs sends proofs created by this server to the root of the survey
+func (s *Service) publishProofs(sid SurveyID, pub *ProofsPublication) error {
+	survey, err := s.getSurvey(sid)
+	if err != nil {
+		return err
+	}
+
+	pub.SurveyID = sid
+	pub.Server = s.ServerIdentity().String()
+
+	survey.ProofsRecord.mutex.Lock()
+	survey.ProofsRecord.published++
+	pub.Count = survey.ProofsRecord.published
+	survey.ProofsRecord.mutex.Unlock()
+
+	if ProofsArchiveDir != "" {
+		if err := ArchiveProofs(ProofsArchiveDir, survey.Query.collectiveKey(), pub); err != nil {
+			log.Error(s.ServerIdentity(), " could not archive its proofs for survey ", sid, ": ", err)
+		}
+	}
+
+	// the root verifies its own proofs as well
+	if survey.Query.Source == nil {
+		return s.recordProofs(&survey, pub, s.ServerIdentity())
+	}
+	return s.SendRaw(survey.Query.Source, pub)
+}
+
+// shufflingProofsPublication creates the publication of a shuffling proof (which is sent in bytes)
+func shufflingProofsPublication(phase SurveyPhase, proof libunlynxshuffle.PublishedShufflingProof) (*ProofsPublication, error) {
+	proofBytes, err := proof.ToBytes()
+	if err != nil {
+		return nil, err
+	}
+	return &ProofsPublication{Phase: phase, ShufflingProofs: []libunlynxshuffle.PublishedShufflingProofBytes{proofBytes}}, nil
+}
+
+// publishProofsOrLog is used by the protocols' proof functions, which cannot return an error
+func (s *Service) publishProofsOrLog(sid SurveyID, pub *ProofsPublication) {
+	if err := s.publishProofs(sid, pub); err != nil {
+		log.Error(s.ServerIdentity(), " could not publish its proofs for survey ", sid, ": ", err)
+	}
+}
+
+// HandleProofsPublication handles the proofs published by a server of the roster (the sender of the publication): they
+// are verified and the survey is aborted if one of them is wrong.
+func (s *Service) HandleProofsPublication(pub *ProofsPublication, sender *network.ServerIdentity) (network.Message, error) {
+	survey, err := s.getSurvey(pub.SurveyID)
+	if err != nil {
+		return nil, err
+	}
+	if !rosterMember(&survey.Query.Roster, sender) {
+		return nil, fmt.Errorf("%s is not a server of survey %s, its proofs are ignored", sender, pub.SurveyID)
+	}
+	// the publication is attributed to its sender, whatever server it names
+	pub.Server = sender.String()
+	return nil, s.recordProofs(&survey, pub, sender)
+}
+
+// recordProofs verifies the proofs published by a server of a survey (with its keys, see proofsKeys) and records them,
+// the survey is aborted if one of them is wrong
+func (s *Service) recordProofs(survey *Survey, pub *ProofsPublication, server *network.ServerIdentity) error {
+	keys, err := s.proofsKeys(&survey.Query, server)
+	if err == nil {
+		verifTime := libunlynx.StartTimer(s.ServerIdentity().String() + "_ProofsVerification")
+		err = VerifyProofsPublication(pub, survey.Query.collectiveKey(), keys)
+		libunlynx.EndTimer(verifTime)
+	}
+
+	survey.ProofsRecord.add(pub, err)
+	if err != nil {
+		log.Error(s.ServerIdentity(), " aborts survey ", pub.SurveyID, ": ", err)
+		if tmpErr := s.setPhase(pub.SurveyID, PhaseAborted); tmpErr != nil {
+			log.Error(tmpErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// proofsKeys returns the keys that the proofs of a server of a survey must be created with (see ProofsKeys)
+func (s *Service) proofsKeys(query *SurveyCreationQuery, server *network.ServerIdentity) (ProofsKeys, error) {
+	keys := ProofsKeys{KeySwitching: server.Public, Tagging: server.Public, Querier: query.ClientPubKey}
+	if query.CollectiveKey == nil {
+		return keys, nil
+	}
+
+	ks, ok := s.Keys.Get(query.CollectiveKey)
+	if !ok {
+		return keys, fmt.Errorf("no share of the collective key of survey %s", query.SurveyID)
+	}
+	index := ks.participantIndex(server.Public)
+	if index < 0 || len(ks.Commits) == 0 {
+		return keys, fmt.Errorf("the public share of server %s for the collective key of survey %s is unknown", server, query.SurveyID)
+	}
+	keys.KeySwitching = ks.pubPoly().Eval(index).V
+	keys.Tagging = libunlynx.SuiTe.Point().Mul(ks.lagrangeCoefficient(index), keys.KeySwitching)
+	return keys, nil
+}
+
+// waitProofsVerification waits until the proofs of all the required servers are verified
+func (s *Service) waitProofsVerification(sid SurveyID) error {
+	survey, err := s.getSurvey(sid)
+	if err != nil {
+		return err
+	}
+
+	for {
+		if err := survey.ProofsRecord.Failure(); err != nil {
+			return err
+		}
+		if survey.ProofsRecord.complete(&survey.Query.Roster) {
+			if err := survey.ProofsRecord.checkChains(&survey.Query.Roster); err != nil {
+				return err
+			}
+			if err := survey.ProofsRecord.checkKeySwitching(&survey.Query.Roster); err != nil {
+				return err
+			}
+			log.Lvl1(s.ServerIdentity(), " verified all the proofs of survey ", sid)
+			return nil
+		}
+
+		select {
+		case <-survey.ProofsRecord.updated:
+		case <-time.After(libunlynx.TIMEOUT):
+			return fmt.Errorf("%s didn't get all the proofs of survey %s on time", s.ServerIdentity(), sid)
+		case <-survey.CancelChannel:
+			return errSurveyCancelled(sid)
+		}
+	}
+}
+
+// Archive
+//______________________________________________________________________________________________________________________
+
+// ArchivedProofs is an entry of the proofs archive of a survey.
+type ArchivedProofs struct {
+	CollectiveKey kyber.Point
+	Publication   ProofsPublication
+}
+
+// archiveMutex serializes the writes in the proofs archive
+var archiveMutex sync.Mutex
+
+// archiveFileName converts the name of a server to the name of its file in the archive of a survey
+func archiveFileName(server string) string {
+	return regexp.MustCompile("[^a-zA-Z0-9.-]").ReplaceAllString(server, "_") + ".proofs"
+}
+
+// archiveSurveyDir returns the directory where the proofs of a survey are archived
+func archiveSurveyDir(dir string, sid SurveyID) (string, error) {
+	if sid == "" || filepath.Base(string(sid)) != string(sid) {
+		return "", fmt.Errorf("invalid surveyID %s for the proofs archive", sid)
+	}
+	return filepath.Join(dir, string(sid)), nil
+}
+
+// ArchiveProofs appends a publication of proofs to the archive of its survey in dir. Every server has its own file in
+// the archive in which each entry is written after its length (4 bytes, big endian).
+func ArchiveProofs(dir string, collectiveKey kyber.Point, pub *ProofsPublication) error {
+	surveyDir, err := archiveSurveyDir(dir, pub.SurveyID)
+	if err != nil {
+		return err
+	}
+	data, err := network.Marshal(&ArchivedProofs{CollectiveKey: collectiveKey, Publication: *pub})
+	if err != nil {
+		return err
+	}
+	entry := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(entry, uint32(len(data)))
+	copy(entry[4:], data)
+
+	archiveMutex.Lock()
+	defer archiveMutex.Unlock()
+
+	if err := os.MkdirAll(surveyDir, 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(surveyDir, archiveFileName(pub.Server)), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(entry); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadProofsArchive returns all the entries of the archive of a survey in dir (the files of all the servers of the
+// survey have to be gathered in its sub-directory).
+func ReadProofsArchive(dir string, sid SurveyID) ([]ArchivedProofs, error) {
+	surveyDir, err := archiveSurveyDir(dir, sid)
+	if err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(surveyDir, "*.proofs"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no proofs archived for survey %s in %s", sid, dir)
+	}
+
+	entries := make([]ArchivedProofs, 0)
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		for len(data) > 0 {
+			if len(data) < 4 || uint32(len(data)-4) < binary.BigEndian.Uint32(data) {
+				return nil, fmt.Errorf("truncated entry in %s", file)
+			}
+			size := binary.BigEndian.Uint32(data)
+			_, msg, err := network.Unmarshal(data[4:4+size], libunlynx.SuiTe)
+			if err != nil {
+				return nil, fmt.Errorf("could not read an entry of %s: %v", file, err)
+			}
+			entry, ok := msg.(*ArchivedProofs)
+			if !ok {
+				return nil, fmt.Errorf("unexpected entry in %s", file)
+			}
+			entries = append(entries, *entry)
+			data = data[4+size:]
+		}
+	}
+	return entries, nil
+}
+
+// AuditVerdict is the result of the audit of the proofs published by a server in a phase of a survey.
+type AuditVerdict struct {
+	Phase        SurveyPhase
+	Server       string
+	Publications int
+	// Failed lists the kinds of proofs that could not be verified
+	Failed []string
+}
+
+// AuditProofsArchive verifies offline all the proofs archived for a survey in dir against the collective key of the
+// survey (the aggregate key of its roster or the key generated by its DKG, never the key written in the archive) and
+// returns a verdict per phase and per server, sorted by phase.
+func AuditProofsArchive(dir string, sid SurveyID, collectiveKey kyber.Point) ([]AuditVerdict, error) {
+	entries, err := ReadProofsArchive(dir, sid)
+	if err != nil {
+		return nil, err
+	}
+
+	verdicts := make(map[SurveyPhase]map[string]*AuditVerdict)
+	for _, entry := range entries {
+		pub := entry.Publication
+		if _, ok := verdicts[pub.Phase]; !ok {
+			verdicts[pub.Phase] = make(map[string]*AuditVerdict)
+		}
+		verdict, ok := verdicts[pub.Phase][pub.Server]
+		if !ok {
+			verdict = &AuditVerdict{Phase: pub.Phase, Server: pub.Server}
+			verdicts[pub.Phase][pub.Server] = verdict
+		}
+		verdict.Publications++
+
+		failed := func(kind string) {
+			for _, v := range verdict.Failed {
+				if v == kind {
+					return
+				}
+			}
+			verdict.Failed = append(verdict.Failed, kind)
+		}
+
+		if entry.CollectiveKey == nil || !entry.CollectiveKey.Equal(collectiveKey) {
+			failed("collective key")
+		}
+		toVerify, err := proofsToVerify(pub)
+		if err != nil {
+			failed("shuffling")
+		}
+		for _, ptv := range toVerify {
+			for i, ok := range protocolsunlynxutils.VerifyProofs(pub.Server, ptv, collectiveKey) {
+				if !ok {
+					failed(protocolsunlynxutils.ProofsKinds[i])
+				}
+			}
+		}
+		for _, v := range pub.SimpleAdditionProofs {
+			if !libunlynx.SimpleAdditionProofVerification(v) {
+				failed("addition")
+			}
+		}
+	}
+
+	result := make([]AuditVerdict, 0)
+	for _, byServer := range verdicts {
+		for _, verdict := range byServer {
+			result = append(result, *verdict)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Phase != result[j].Phase {
+			return result[i].Phase < result[j].Phase
+		}
+		return result[i].Server < result[j].Server
+	})
+	return result, nil
+}
+
+// proofsToVerify splits a publication in the ProofsToVerify of the verification protocol (each of them can only hold one
+// list proof of each kind)
+func proofsToVerify(pub ProofsPublication) ([]protocolsunlynxutils.ProofsToVerify, error) {
+	size := 1
+	for _, l := range []int{len(pub.DetTagAdditionProofs), len(pub.DetTagCreationProofs), len(pub.AggregationProofs), len(pub.KeySwitchingProofs)} {
+		if l > size {
+			size = l
+		}
+	}
+
+	toVerify := make([]protocolsunlynxutils.ProofsToVerify, size)
+	for i, v := range pub.DetTagAdditionProofs {
+		toVerify[i].DetTagAdditionProofs = v
+	}
+	for i, v := range pub.DetTagCreationProofs {
+		toVerify[i].DetTagCreationProofs = v
+	}
+	for i, v := range pub.AggregationProofs {
+		// the aggregation proofs of the aggregation phase are created by the collective aggregation
+		if pub.Phase == PhaseAggregation {
+			toVerify[i].CollectiveAggregationProofs = v
+		} else {
+			toVerify[i].AggregationProofs = v
+		}
+	}
+	for i, v := range pub.KeySwitchingProofs {
+		toVerify[i].KeySwitchingProofs = v
+	}
+
+	toVerify[0].ShufflingProofs.List = make([]libunlynxshuffle.PublishedShufflingProof, len(pub.ShufflingProofs))
+	for i, v := range pub.ShufflingProofs {
+		if err := toVerify[0].ShufflingProofs.List[i].FromBytes(v); err != nil {
+			return nil, err
+		}
+	}
+	return toVerify, nil
+}
+
+// Verification
+//______________________________________________________________________________________________________________________
+
+// VerifyProofsChains checks that the proofs published for a survey by the servers of a roster (their number is given) in
+// the protocols in which they transform the data one after the other (shuffling and deterministic tagging) form
+// chains: the input of the proofs of a server is the output of the proofs of the previous one, except for the server
+// that starts the protocol, and each chain goes once through every server. Every server may start its own chain (e.g.
+// to shuffle its own data) but an output is never the input of several servers.
+func VerifyProofsChains(pubs []ProofsPublication, servers int) error {
+	links := make(map[string][]proofsLink)
+	for i := range pubs {
+		addLinks(links, &pubs[i])
+	}
+	return checkChains(links, servers)
+}
+
+// ProofsKeys are the keys that the proofs of a server must be created with: the key with which it switches the results
+// (its public key, or its public share of the collective key if it was generated with a DKG), the key with which it
+// tags the data (its public key, or its public share multiplied by its Lagrange coefficient) and the key of the querier
+// to which the results are switched. The keys that are nil are not checked.
+type ProofsKeys struct {
+	KeySwitching kyber.Point
+	Tagging      kyber.Point
+	Querier      kyber.Point
+}
+
+// VerifyProofsPublication verifies all the proofs of a publication and that they were created with the keys of its
+// server, it returns an error naming the server if one of them is wrong.
+func VerifyProofsPublication(pub *ProofsPublication, collectiveKey kyber.Point, keys ProofsKeys) error {
+	wrongProof := func(name string) error {
+		return fmt.Errorf("server %s published a wrong %s proof for survey %s (%s phase)", pub.Server, name, pub.SurveyID, pub.Phase.String())
+	}
+
+	shufflingProofs := libunlynxshuffle.PublishedShufflingListProof{List: make([]libunlynxshuffle.PublishedShufflingProof, len(pub.ShufflingProofs))}
+	for i, v := range pub.ShufflingProofs {
+		if err := shufflingProofs.List[i].FromBytes(v); err != nil {
+			return wrongProof("shuffling")
+		}
+	}
+	if !libunlynxshuffle.ShuffleListProofVerification(shufflingProofs, collectiveKey, 1.0) {
+		return wrongProof("shuffling")
+	}
+	for _, v := range pub.DetTagAdditionProofs {
+		if !libunlynxdetertag.DeterministicTagAdditionListProofVerification(v, 1.0) {
+			return wrongProof("deterministic tagging (addition)")
+		}
+	}
+	for _, v := range pub.DetTagCreationProofs {
+		if keys.Tagging != nil && (v.K == nil || !v.K.Equal(keys.Tagging)) {
+			return wrongProof("deterministic tagging (creation)")
+		}
+		if !libunlynxdetertag.DeterministicTagCrListProofVerification(v, 1.0) {
+			return wrongProof("deterministic tagging (creation)")
+		}
+	}
+	for _, v := range pub.AggregationProofs {
+		if !libunlynxaggr.AggregationListProofVerification(v, 1.0) {
+			return wrongProof("aggregation")
+		}
+	}
+	for _, v := range pub.KeySwitchingProofs {
+		for _, p := range v.List {
+			if (keys.KeySwitching != nil && (p.K == nil || !p.K.Equal(keys.KeySwitching))) ||
+				(keys.Querier != nil && (p.Q == nil || !p.Q.Equal(keys.Querier))) {
+				return wrongProof("key switching")
+			}
+		}
+		if !libunlynxkeyswitch.KeySwitchListProofVerification(v, 1.0) {
+			return wrongProof("key switching")
+		}
+	}
+	for _, v := range pub.SimpleAdditionProofs {
+		if !libunlynx.SimpleAdditionProofVerification(v) {
+			return wrongProof("addition")
+		}
+	}
+	return nil
+}
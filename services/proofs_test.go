@@ -0,0 +1,154 @@
+package servicesunlynx_test
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/lib/key_switch"
+	"github.com/ldsec/unlynx/lib/shuffle"
+	"github.com/ldsec/unlynx/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/util/key"
+)
+
+// TestVerifyProofsPublication checks that a wrong proof is detected and that the error names the server that published it
+func TestVerifyProofsPublication(t *testing.T) {
+	keysTarget := key.NewKeyPair(libunlynx.SuiTe)
+	keys := key.NewKeyPair(libunlynx.SuiTe)
+
+	ct1 := libunlynx.EncryptInt(keys.Public, int64(1))
+	ct2 := libunlynx.EncryptInt(keys.Public, int64(2))
+	rBs := []kyber.Point{ct1.K, ct2.K}
+
+	_, ks2s, rBNegs, vis := libunlynxkeyswitch.KeySwitchSequence(keysTarget.Public, rBs, keys.Private)
+	pkslp, err := libunlynxkeyswitch.KeySwitchListProofCreation(keys.Public, keysTarget.Public, keys.Private, ks2s, rBNegs, vis)
+	require.NoError(t, err)
+
+	aggr := *libunlynx.EncryptIntVector(keys.Public, []int64{1, 2})
+	toAdd := *libunlynx.EncryptIntVector(keys.Public, []int64{3, 4})
+	result := libunlynx.NewCipherVector(len(aggr))
+	result.Add(aggr, toAdd)
+
+	pub := &servicesunlynx.ProofsPublication{
+		SurveyID:             "survey",
+		Server:               "server1",
+		Phase:                servicesunlynx.PhaseKeySwitching,
+		KeySwitchingProofs:   []libunlynxkeyswitch.PublishedKSListProof{pkslp},
+		SimpleAdditionProofs: []libunlynx.PublishedSimpleAdditionProof{{C1: aggr, C2: toAdd, C1PlusC2: *result}},
+	}
+	serverKeys := servicesunlynx.ProofsKeys{KeySwitching: keys.Public, Tagging: keys.Public, Querier: keysTarget.Public}
+	assert.NoError(t, servicesunlynx.VerifyProofsPublication(pub, keys.Public, serverKeys))
+
+	// a correct proof created with the key of another server or for another querier
+	assert.Error(t, servicesunlynx.VerifyProofsPublication(pub, keys.Public, servicesunlynx.ProofsKeys{KeySwitching: keysTarget.Public}))
+	assert.Error(t, servicesunlynx.VerifyProofsPublication(pub, keys.Public, servicesunlynx.ProofsKeys{Querier: keys.Public}))
+
+	// wrong key switching proof
+	pkslp.List[0].K = keysTarget.Public
+	err = servicesunlynx.VerifyProofsPublication(pub, keys.Public, servicesunlynx.ProofsKeys{})
+	require.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "server1"))
+	assert.True(t, strings.Contains(err.Error(), "key switching"))
+
+	// wrong addition proof
+	pub.KeySwitchingProofs = nil
+	pub.SimpleAdditionProofs[0].C1PlusC2 = aggr
+	err = servicesunlynx.VerifyProofsPublication(pub, keys.Public, serverKeys)
+	require.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "addition"))
+}
+
+// TestVerifyProofsChains checks that the shuffling proofs of the servers must be chained
+func TestVerifyProofsChains(t *testing.T) {
+	keys := key.NewKeyPair(libunlynx.SuiTe)
+	shuffle := func(server string, rows []libunlynx.CipherVector) ([]libunlynx.CipherVector, servicesunlynx.ProofsPublication) {
+		shuffled, pi, beta := libunlynxshuffle.ShuffleSequence(rows, libunlynx.SuiTe.Point().Base(), keys.Public, nil)
+		proof, err := libunlynxshuffle.ShuffleProofCreation(rows, shuffled, libunlynx.SuiTe.Point().Base(), keys.Public, beta, pi)
+		require.NoError(t, err)
+		proofBytes, err := proof.ToBytes()
+		require.NoError(t, err)
+		return shuffled, servicesunlynx.ProofsPublication{SurveyID: "survey", Server: server, Phase: servicesunlynx.PhaseShuffling,
+			ShufflingProofs: []libunlynxshuffle.PublishedShufflingProofBytes{proofBytes}}
+	}
+	rows := []libunlynx.CipherVector{*libunlynx.EncryptIntVector(keys.Public, []int64{1, 2}), *libunlynx.EncryptIntVector(keys.Public, []int64{3, 4})}
+
+	rows1, pub1 := shuffle("server1", rows)
+	rows2, pub2 := shuffle("server2", rows1)
+	_, pub3 := shuffle("server3", rows2)
+	assert.NoError(t, servicesunlynx.VerifyProofsChains([]servicesunlynx.ProofsPublication{pub3, pub1, pub2}, 3))
+
+	// every server can start a chain to shuffle its own data
+	rows = []libunlynx.CipherVector{*libunlynx.EncryptIntVector(keys.Public, []int64{5, 6}), *libunlynx.EncryptIntVector(keys.Public, []int64{7, 8})}
+	other1, otherPub2 := shuffle("server2", rows)
+	other2, otherPub3 := shuffle("server3", other1)
+	_, otherPub1 := shuffle("server1", other2)
+	assert.NoError(t, servicesunlynx.VerifyProofsChains([]servicesunlynx.ProofsPublication{pub1, otherPub3, pub2, otherPub1, pub3, otherPub2}, 3))
+
+	// a server cannot shuffle other data than the output of the previous server
+	_, wrong := shuffle("server3", rows1)
+	assert.Error(t, servicesunlynx.VerifyProofsChains([]servicesunlynx.ProofsPublication{pub1, pub2, wrong}, 3))
+	_, wrong = shuffle("server3", other1)
+	assert.Error(t, servicesunlynx.VerifyProofsChains([]servicesunlynx.ProofsPublication{pub1, pub2, wrong}, 3))
+	// nor skip a server
+	assert.Error(t, servicesunlynx.VerifyProofsChains([]servicesunlynx.ProofsPublication{pub1, pub2}, 3))
+	assert.Error(t, servicesunlynx.VerifyProofsChains([]servicesunlynx.ProofsPublication{pub1, pub3}, 3))
+}
+
+// TestProofsArchive checks that the archived proofs are audited per phase and per server
+func TestProofsArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "proofs")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	keysTarget := key.NewKeyPair(libunlynx.SuiTe)
+	keys := key.NewKeyPair(libunlynx.SuiTe)
+
+	ct1 := libunlynx.EncryptInt(keys.Public, int64(1))
+	ct2 := libunlynx.EncryptInt(keys.Public, int64(2))
+	rBs := []kyber.Point{ct1.K, ct2.K}
+
+	_, ks2s, rBNegs, vis := libunlynxkeyswitch.KeySwitchSequence(keysTarget.Public, rBs, keys.Private)
+	pkslp, err := libunlynxkeyswitch.KeySwitchListProofCreation(keys.Public, keysTarget.Public, keys.Private, ks2s, rBNegs, vis)
+	require.NoError(t, err)
+	wrongPkslp, err := libunlynxkeyswitch.KeySwitchListProofCreation(keys.Public, keysTarget.Public, keys.Private, ks2s, rBNegs, vis)
+	require.NoError(t, err)
+	wrongPkslp.List[1].K = keysTarget.Public
+
+	for i, server := range []string{"tls://127.0.0.1:2000", "tls://127.0.0.1:2002"} {
+		pub := &servicesunlynx.ProofsPublication{SurveyID: "survey", Server: server, Phase: servicesunlynx.PhaseKeySwitching,
+			KeySwitchingProofs: []libunlynxkeyswitch.PublishedKSListProof{pkslp}}
+		if i == 1 {
+			pub.KeySwitchingProofs = append(pub.KeySwitchingProofs, wrongPkslp)
+		}
+		require.NoError(t, servicesunlynx.ArchiveProofs(dir, keys.Public, pub))
+	}
+	require.NoError(t, servicesunlynx.ArchiveProofs(dir, keys.Public, &servicesunlynx.ProofsPublication{SurveyID: "survey",
+		Server: "tls://127.0.0.1:2002", Phase: servicesunlynx.PhaseTagging}))
+
+	verdicts, err := servicesunlynx.AuditProofsArchive(dir, "survey", keys.Public)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(verdicts))
+
+	assert.Equal(t, servicesunlynx.AuditVerdict{Phase: servicesunlynx.PhaseTagging, Server: "tls://127.0.0.1:2002", Publications: 1}, verdicts[0])
+	assert.Equal(t, servicesunlynx.AuditVerdict{Phase: servicesunlynx.PhaseKeySwitching, Server: "tls://127.0.0.1:2000", Publications: 1}, verdicts[1])
+	assert.Equal(t, servicesunlynx.AuditVerdict{Phase: servicesunlynx.PhaseKeySwitching, Server: "tls://127.0.0.1:2002", Publications: 1,
+		Failed: []string{"key switching"}}, verdicts[2])
+
+	// the proofs are verified against the key given, not the one written in the archive
+	verdicts, err = servicesunlynx.AuditProofsArchive(dir, "survey", keysTarget.Public)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(verdicts))
+	for _, v := range verdicts {
+		assert.Contains(t, v.Failed, "collective key")
+	}
+
+	_, err = servicesunlynx.AuditProofsArchive(dir, "unknown", keys.Public)
+	assert.Error(t, err)
+	_, err = servicesunlynx.AuditProofsArchive(dir, "../survey", keys.Public)
+	assert.Error(t, err)
+}
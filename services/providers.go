@@ -0,0 +1,207 @@
+package servicesunlynx
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ldsec/unlynx/lib"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/sign/schnorr"
+	"go.dedis.ch/kyber/v3/util/encoding"
+	"go.dedis.ch/onet/v3/network"
+)
+
+// AuthorizedDPs are the long-term public keys (hex) of the data providers allowed to send data to this server. The
+// submissions must be signed by one of these keys, the data providers are not authenticated if it is empty. It is loaded
+// from the DPAllowlist file of the configuration of the server (see ServerConfig).
+var AuthorizedDPs = make(map[string]bool)
+
+// nonceSize is the size of the random nonce of a signed submission
+const nonceSize = 32
+
+// LoadAuthorizedDPs reads an allowlist of data providers: one public key (hex) per line, optionally followed by a
+// description. The empty lines and the lines starting with # are ignored.
+func LoadAuthorizedDPs(filename string) (map[string]bool, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	dps := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		public, err := encoding.StringHexToPoint(libunlynx.SuiTe, fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("wrong public key %s: %v", fields[0], err)
+		}
+		dps[public.String()] = true
+	}
+	return dps, scanner.Err()
+}
+
+// Signed submissions
+//______________________________________________________________________________________________________________________
+
+// responsesHash hashes the responses of a submission, the attributes (and range proofs) of each response are hashed in
+// a fixed order
+func responsesHash(responses []libunlynx.DpResponseToSend) []byte {
+	h := sha256.New()
+	writeUint := func(v uint64) {
+		b := make([]byte, 8)
+		binary.BigEndian.PutUint64(b, v)
+		h.Write(b)
+	}
+	writeBytes := func(b []byte) {
+		writeUint(uint64(len(b)))
+		h.Write(b)
+	}
+	writeClear := func(m map[string]int64) {
+		names := make([]string, 0, len(m))
+		for name := range m {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		writeUint(uint64(len(names)))
+		for _, name := range names {
+			writeBytes([]byte(name))
+			writeUint(uint64(m[name]))
+		}
+	}
+	writeEnc := func(m map[string][]byte) {
+		names := make([]string, 0, len(m))
+		for name := range m {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		writeUint(uint64(len(names)))
+		for _, name := range names {
+			writeBytes([]byte(name))
+			writeBytes(m[name])
+		}
+	}
+
+	writeUint(uint64(len(responses)))
+	for _, r := range responses {
+		writeClear(r.WhereClear)
+		writeEnc(r.WhereEnc)
+		writeClear(r.GroupByClear)
+		writeEnc(r.GroupByEnc)
+		writeClear(r.AggregatingAttributesClear)
+		writeEnc(r.AggregatingAttributesEnc)
+		writeEnc(r.RangeProofs)
+	}
+	return h.Sum(nil)
+}
+
+// signedMessage returns the message signed by the data provider: the survey ID, the suite, the hash of the responses,
+// the destination server and the nonce
+func (resp *SurveyResponseQuery) signedMessage() ([]byte, error) {
+	h := newSignedMessageHash("survey response")
+	h.writeString(string(resp.SurveyID))
+	h.writeString(resp.Suite)
+	h.writeBytes(responsesHash(resp.Responses))
+	h.writePoint(resp.Server)
+	h.writeBytes(resp.Nonce)
+	return h.sum()
+}
+
+// Sign signs the submission to the server of public key server with the long-term private key of the data provider
+// and a fresh nonce
+func (resp *SurveyResponseQuery) Sign(private kyber.Scalar, server kyber.Point) error {
+	if server == nil {
+		return fmt.Errorf("no destination server for the submission")
+	}
+	resp.DpPublic = libunlynx.SuiTe.Point().Mul(private, nil)
+	resp.Server = server
+	resp.Nonce = make([]byte, nonceSize)
+	libunlynx.SuiTe.RandomStream().XORKeyStream(resp.Nonce, resp.Nonce)
+
+	msg, err := resp.signedMessage()
+	if err != nil {
+		return err
+	}
+	signature, err := schnorr.Sign(libunlynx.SuiTe, private, msg)
+	if err != nil {
+		return err
+	}
+	resp.Signature = signature
+	return nil
+}
+
+// Verify checks the signature of the submission
+func (resp *SurveyResponseQuery) Verify() error {
+	if resp.DpPublic == nil || len(resp.Signature) == 0 {
+		return fmt.Errorf("the submission is not signed")
+	}
+	if len(resp.Nonce) != nonceSize {
+		return fmt.Errorf("the submission has a wrong nonce")
+	}
+	msg, err := resp.signedMessage()
+	if err != nil {
+		return err
+	}
+	if err := schnorr.Verify(libunlynx.SuiTe, resp.DpPublic, msg, resp.Signature); err != nil {
+		return fmt.Errorf("wrong signature of the submission: %v", err)
+	}
+	return nil
+}
+
+// authenticateDp checks that a submission is signed by an authorized data provider for the server si (the signed
+// submissions cannot be replayed to the other servers of the roster). The unsigned submissions are only accepted if the
+// data providers are not authenticated (AuthorizedDPs is empty).
+func authenticateDp(resp *SurveyResponseQuery, si *network.ServerIdentity) error {
+	if resp.DpPublic == nil && len(resp.Signature) == 0 && len(AuthorizedDPs) == 0 {
+		return nil
+	}
+	if err := resp.Verify(); err != nil {
+		return err
+	}
+	if resp.Server == nil || !resp.Server.Equal(si.Public) {
+		return fmt.Errorf("the submission was signed for another server")
+	}
+	if len(AuthorizedDPs) > 0 && !AuthorizedDPs[resp.DpPublic.String()] {
+		return fmt.Errorf("data provider %s is not authorized", resp.DpPublic.String())
+	}
+	return nil
+}
+
+// checkDp rejects the replayed submissions to a survey and the data providers that already sent their data (each one
+// is counted once against MapDPs)
+func (surv *Survey) checkDp(resp *SurveyResponseQuery) error {
+	if resp.DpPublic == nil {
+		return nil
+	}
+	nonce := hex.EncodeToString(resp.Nonce)
+	for _, n := range surv.DpNonces {
+		if n == nonce {
+			return fmt.Errorf("replayed submission to survey %s", resp.SurveyID)
+		}
+	}
+	dp := resp.DpPublic.String()
+	for _, p := range surv.DpKeys {
+		if p == dp {
+			return fmt.Errorf("data provider %s already sent its data to survey %s", dp, resp.SurveyID)
+		}
+	}
+	return nil
+}
+
+// recordDp records the data provider and the nonce of a signed submission to a survey (checked by checkDp)
+func (surv *Survey) recordDp(resp *SurveyResponseQuery) {
+	if resp.DpPublic == nil {
+		return
+	}
+	surv.DpNonces = append(surv.DpNonces, hex.EncodeToString(resp.Nonce))
+	surv.DpKeys = append(surv.DpKeys, resp.DpPublic.String())
+}
@@ -0,0 +1,121 @@
+package servicesunlynx_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3/util/encoding"
+	"go.dedis.ch/kyber/v3/util/key"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+)
+
+func TestSignedSubmission(t *testing.T) {
+	keys := key.NewKeyPair(libunlynx.SuiTe)
+	s := servicesunlynx.SurveyResponseQuery{SurveyID: "s1", Responses: []libunlynx.DpResponseToSend{
+		{WhereClear: map[string]int64{"w1": 1, "w2": 2}, AggregatingAttributesClear: map[string]int64{"s1": 3}},
+	}}
+	assert.Error(t, s.Verify())
+
+	assert.Error(t, s.Sign(keys.Private, nil))
+	server := key.NewKeyPair(libunlynx.SuiTe).Public
+	require.NoError(t, s.Sign(keys.Private, server))
+	assert.True(t, keys.Public.Equal(s.DpPublic))
+	require.NoError(t, s.Verify())
+
+	// the survey, the responses, the destination server and the nonce are signed
+	tampered := s
+	tampered.SurveyID = "s2"
+	assert.Error(t, tampered.Verify())
+	tampered = s
+	tampered.Responses = []libunlynx.DpResponseToSend{{WhereClear: map[string]int64{"w1": 1, "w2": 2}, AggregatingAttributesClear: map[string]int64{"s1": 4}}}
+	assert.Error(t, tampered.Verify())
+	tampered = s
+	tampered.Server = key.NewKeyPair(libunlynx.SuiTe).Public
+	assert.Error(t, tampered.Verify())
+	tampered = s
+	tampered.Nonce = make([]byte, len(s.Nonce))
+	assert.Error(t, tampered.Verify())
+}
+
+func TestLoadAuthorizedDPs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unlynx")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	_, public := libunlynx.GenKey()
+	hex, err := encoding.PointToStringHex(libunlynx.SuiTe, public)
+	require.NoError(t, err)
+
+	filename := filepath.Join(dir, "allowlist")
+	require.NoError(t, ioutil.WriteFile(filename, []byte("# data providers\n\n"+hex+" hospital A\n"), 0600))
+	dps, err := servicesunlynx.LoadAuthorizedDPs(filename)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{public.String(): true}, dps)
+
+	require.NoError(t, ioutil.WriteFile(filename, []byte("hospital A\n"), 0600))
+	_, err = servicesunlynx.LoadAuthorizedDPs(filename)
+	assert.Error(t, err)
+}
+
+func TestServiceAuthenticatedDPs(t *testing.T) {
+	log.Lvl1("***************************************************************************************************")
+	os.Remove("pre_compute_multiplications.gob")
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+	_, el, _ := local.GenTree(3, true)
+	defer local.CloseAll()
+
+	dpKeys := make([]*key.Pair, len(el.List))
+	authorized := make(map[string]bool)
+	for i := range el.List {
+		dpKeys[i] = key.NewKeyPair(libunlynx.SuiTe)
+		authorized[dpKeys[i].Public.String()] = true
+	}
+	dps := servicesunlynx.AuthorizedDPs
+	servicesunlynx.AuthorizedDPs = authorized
+	defer func() { servicesunlynx.AuthorizedDPs = dps }()
+
+	querier := key.NewKeyPair(libunlynx.SuiTe)
+	client := servicesunlynx.NewUnLynxClientWithKeys(el.List[0], strconv.Itoa(0), querier)
+	nbrDPs := make(map[string]int64)
+	for _, server := range el.List {
+		nbrDPs[server.String()] = 1
+	}
+	surveyID, err := client.SendSurveySQLQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, "SELECT SUM(s1), COUNT(*)", 8, servicesunlynx.SurveyOptions{})
+	require.NoError(t, err)
+
+	responses := []libunlynx.DpClearResponse{{AggregatingAttributesEnc: map[string]int64{"s1": 5}}}
+	for i, server := range el.List {
+		s, err := servicesunlynx.EncryptDataToSurvey(strconv.Itoa(i+1), *surveyID, responses, el.Aggregate, 1, true, nil, nil, nil, nil)
+		require.NoError(t, err)
+
+		// unsigned and unauthorized submissions
+		resp := servicesunlynx.ServiceState{}
+		assert.Error(t, client.SendProtobuf(server, s, &resp))
+		assert.Error(t, servicesunlynx.NewUnLynxClient(server, "stranger").SendEncryptedSurveyResponseQuery(s))
+
+		dp := servicesunlynx.NewUnLynxClientWithKeys(server, strconv.Itoa(i+1), dpKeys[i])
+		require.NoError(t, dp.SendEncryptedSurveyResponseQuery(s))
+
+		// replayed submission (to this server or to another one) and second submission of the same data provider
+		assert.Error(t, dp.SendProtobuf(server, s, &resp))
+		assert.Error(t, dp.SendProtobuf(el.List[(i+1)%len(el.List)], s, &resp))
+		assert.Error(t, dp.SendEncryptedSurveyResponseQuery(s))
+
+		status, err := servicesunlynx.NewUnLynxClientWithKeys(server, strconv.Itoa(0), querier).SendSurveyStatusQuery(*surveyID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), status.DpReceived)
+	}
+
+	results, err := client.SendSurveyTypedResultsQuery(*surveyID)
+	require.NoError(t, err)
+	require.Len(t, results.Aggregates, 1)
+	assert.Equal(t, []float64{15, 3}, results.Aggregates[0])
+}
@@ -0,0 +1,477 @@
+package servicesunlynx
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/ldsec/unlynx/lib"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/onet/v3"
+)
+
+// DefaultRangeBits is the number of bits of the values of the where attributes compared with ranges (<, <=, >, >=,
+// BETWEEN) when ParseQuery is not given one
+const DefaultRangeBits = 32
+
+// QueryError is a syntax error in a query, Position is the (1-based) position of the character where it occurs
+type QueryError struct {
+	Position int
+	Message  string
+}
+
+func (e *QueryError) Error() string {
+	return "syntax error at position " + strconv.Itoa(e.Position) + ": " + e.Message
+}
+
+// Lexer
+//______________________________________________________________________________________________________________________
+
+const (
+	tokenEOF = iota
+	tokenIdent
+	tokenNumber
+	tokenSymbol
+)
+
+type token struct {
+	kind int
+	text string
+	pos  int
+}
+
+// describe returns the representation of a token used in the error messages
+func (t token) describe() string {
+	if t.kind == tokenEOF {
+		return "end of query"
+	}
+	return "'" + t.text + "'"
+}
+
+// symbols are the operators and punctuation of the queries and of the predicates, the two-character ones first
+var symbols = []string{"<=", ">=", "!=", "<>", "==", "&&", "||", "=", "<", ">", "!", "(", ")", "[", "]", ":", ",", "*", ";"}
+
+func tokenize(query string) ([]token, error) {
+	var tokens []token
+	runes := []rune(query)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: string(runes[start:i]), pos: start + 1})
+		case unicode.IsDigit(r) || (r == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			start := i
+			i++
+			for i < len(runes) && unicode.IsDigit(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: string(runes[start:i]), pos: start + 1})
+		default:
+			found := false
+			for _, s := range symbols {
+				if strings.HasPrefix(string(runes[i:]), s) {
+					tokens = append(tokens, token{kind: tokenSymbol, text: s, pos: i + 1})
+					i += len(s)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, &QueryError{Position: i + 1, Message: "unexpected character '" + string(r) + "'"}
+			}
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(runes) + 1}), nil
+}
+
+// tokenStream is the sequence of tokens read by a parser
+type tokenStream struct {
+	tokens  []token
+	current int
+}
+
+func (ts *tokenStream) peek() token {
+	return ts.tokens[ts.current]
+}
+
+func (ts *tokenStream) next() token {
+	t := ts.tokens[ts.current]
+	if t.kind != tokenEOF {
+		ts.current++
+	}
+	return t
+}
+
+func (ts *tokenStream) errorf(t token, message string) error {
+	return &QueryError{Position: t.pos, Message: message}
+}
+
+func (ts *tokenStream) expectSymbol(symbol string) error {
+	if t := ts.next(); t.kind != tokenSymbol || t.text != symbol {
+		return ts.errorf(t, "expected '"+symbol+"' but found "+t.describe())
+	}
+	return nil
+}
+
+func (ts *tokenStream) acceptSymbol(symbol string) bool {
+	if t := ts.peek(); t.kind == tokenSymbol && t.text == symbol {
+		ts.next()
+		return true
+	}
+	return false
+}
+
+func (ts *tokenStream) expectEOF() error {
+	if t := ts.next(); t.kind != tokenEOF {
+		return ts.errorf(t, "unexpected "+t.describe())
+	}
+	return nil
+}
+
+// isKeyword checks (case-insensitively) if a token is a given keyword
+func isKeyword(t token, keyword string) bool {
+	return t.kind == tokenIdent && strings.EqualFold(t.text, keyword)
+}
+
+// Parser
+//______________________________________________________________________________________________________________________
+
+// queryParser builds a SurveyCreationQuery from the tokens of a query:
+//
+//	SELECT item [, item]* [FROM dataset] [WHERE condition] [GROUP BY attribute [, attribute]*] [;]
+//
+// an item is SUM(s), COUNT(*) or an aggregate operation (AVG(s), VARIANCE(s)...), a condition combines with AND, OR,
+// NOT and parentheses the comparisons w = c, w != c, w < c, w <= c, w > c, w >= c and w BETWEEN c1 AND c2.
+type queryParser struct {
+	tokenStream
+	key       kyber.Point
+	rangeBits int64
+	query     SurveyCreationQuery
+}
+
+// isReserved checks if an identifier is a keyword of the query language
+func isReserved(t token) bool {
+	for _, keyword := range []string{"SELECT", "FROM", "WHERE", "GROUP", "BY", "AND", "OR", "NOT", "BETWEEN"} {
+		if isKeyword(t, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *queryParser) expectKeyword(keyword string) error {
+	if t := p.next(); !isKeyword(t, keyword) {
+		return p.errorf(t, "expected "+keyword+" but found "+t.describe())
+	}
+	return nil
+}
+
+func (p *queryParser) identifier(what string) (string, error) {
+	t := p.next()
+	if t.kind != tokenIdent || isReserved(t) {
+		return "", p.errorf(t, "expected "+what+" but found "+t.describe())
+	}
+	return t.text, nil
+}
+
+func (p *queryParser) number() (int64, token, error) {
+	t := p.next()
+	if t.kind != tokenNumber {
+		return 0, t, p.errorf(t, "expected an integer but found "+t.describe())
+	}
+	value, err := strconv.ParseInt(t.text, 10, 64)
+	if err != nil {
+		return 0, t, p.errorf(t, "integer "+t.text+" is out of range")
+	}
+	return value, t, nil
+}
+
+func (p *queryParser) parse() error {
+	if err := p.expectKeyword("SELECT"); err != nil {
+		return err
+	}
+	if err := p.parseSelect(); err != nil {
+		return err
+	}
+
+	if isKeyword(p.peek(), "FROM") {
+		p.next()
+		dataset, err := p.identifier("a dataset")
+		if err != nil {
+			return err
+		}
+		p.query.Dataset = dataset
+	}
+
+	if isKeyword(p.peek(), "WHERE") {
+		p.next()
+		predicate, err := p.parseOr()
+		if err != nil {
+			return err
+		}
+		p.query.Predicate = predicate
+	}
+
+	if isKeyword(p.peek(), "GROUP") {
+		p.next()
+		if err := p.expectKeyword("BY"); err != nil {
+			return err
+		}
+		for {
+			attribute, err := p.identifier("a group by attribute")
+			if err != nil {
+				return err
+			}
+			p.query.GroupBy = append(p.query.GroupBy, attribute)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+
+	p.acceptSymbol(";")
+	return p.expectEOF()
+}
+
+// parseSelect parses the aggregates: the sums and the count fill Sum and Count, the other operations are only computed
+// if one of them is not a sum or a count (Operations then follow the order of the items)
+func (p *queryParser) parseSelect() error {
+	var operations []libunlynx.Operation
+	onlySums := true
+	for {
+		t := p.next()
+		if t.kind != tokenIdent || isReserved(t) {
+			return p.errorf(t, "expected an aggregate (e.g. SUM(s1)) but found "+t.describe())
+		}
+		if err := p.expectSymbol("("); err != nil {
+			return err
+		}
+
+		var op libunlynx.Operation
+		if strings.EqualFold(t.text, libunlynx.OpCount) {
+			if err := p.expectSymbol("*"); err != nil {
+				return err
+			}
+			op = libunlynx.Operation{Op: libunlynx.OpCount}
+			p.query.Count = true
+		} else {
+			attribute, err := p.identifier("an aggregating attribute")
+			if err != nil {
+				return err
+			}
+			if op, err = libunlynx.ParseOperation(t.text + "(" + attribute + ")"); err != nil {
+				return p.errorf(t, err.Error())
+			}
+			if op.Op == libunlynx.OpSum {
+				p.query.Sum = append(p.query.Sum, attribute)
+			} else {
+				onlySums = false
+			}
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return err
+		}
+		operations = append(operations, op)
+
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+
+	if !onlySums {
+		p.query.Sum = nil
+		p.query.Operations = operations
+	}
+	return nil
+}
+
+// parseOr parses a disjunction and returns it as a predicate
+func (p *queryParser) parseOr() (string, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return "", err
+	}
+	for isKeyword(p.peek(), "OR") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return "", err
+		}
+		left = left + " || " + right
+	}
+	return left, nil
+}
+
+// parseAnd parses a conjunction and returns it as a predicate
+func (p *queryParser) parseAnd() (string, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return "", err
+	}
+	for isKeyword(p.peek(), "AND") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return "", err
+		}
+		left = left + " && " + right
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseNot() (string, error) {
+	if isKeyword(p.peek(), "NOT") {
+		p.next()
+		operand, err := p.parseNot()
+		if err != nil {
+			return "", err
+		}
+		return "!(" + operand + ")", nil
+	}
+	if p.acceptSymbol("(") {
+		inner, err := p.parseOr()
+		if err != nil {
+			return "", err
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return "", err
+		}
+		return "(" + inner + ")", nil
+	}
+	return p.parseComparison()
+}
+
+// parseComparison parses a comparison: the equalities add a where attribute (w == :w in the predicate, see
+// CompilePredicate) and the inequalities a range condition (range(w))
+func (p *queryParser) parseComparison() (string, error) {
+	attribute, err := p.identifier("a where attribute")
+	if err != nil {
+		return "", err
+	}
+
+	if isKeyword(p.peek(), "BETWEEN") {
+		p.next()
+		lower, _, err := p.number()
+		if err != nil {
+			return "", err
+		}
+		if err := p.expectKeyword("AND"); err != nil {
+			return "", err
+		}
+		upper, _, err := p.number()
+		if err != nil {
+			return "", err
+		}
+		return p.addRange(attribute, lower, upper)
+	}
+
+	t := p.next()
+	if t.kind != tokenSymbol {
+		return "", p.errorf(t, "expected a comparison operator but found "+t.describe())
+	}
+	value, valueToken, err := p.number()
+	if err != nil {
+		return "", err
+	}
+
+	switch t.text {
+	case "=", "==", "!=", "<>":
+		parameter := ":" + attribute + indexSuffix(p.countWhere(attribute))
+		p.query.Where = append(p.query.Where, libunlynx.WhereQueryAttribute{Name: attribute, Value: *libunlynx.EncryptInt(p.key, value)})
+		operator := "=="
+		if t.text == "!=" || t.text == "<>" {
+			operator = "!="
+		}
+		return attribute + " " + operator + " " + parameter, nil
+	case "<":
+		if value == math.MinInt64 {
+			return "", p.errorf(valueToken, "integer "+valueToken.text+" is out of range")
+		}
+		return p.addRange(attribute, 0, value-1)
+	case "<=":
+		return p.addRange(attribute, 0, value)
+	case ">":
+		if value == math.MaxInt64 {
+			return "", p.errorf(valueToken, "integer "+valueToken.text+" is out of range")
+		}
+		return p.addRange(attribute, value+1, math.MaxInt64)
+	case ">=":
+		return p.addRange(attribute, value, math.MaxInt64)
+	default:
+		return "", p.errorf(t, "expected a comparison operator but found "+t.describe())
+	}
+}
+
+func (p *queryParser) addRange(attribute string, lower, upper int64) (string, error) {
+	condition := "range(" + attribute + indexSuffix(p.countRanges(attribute)) + ")"
+	wr, err := libunlynx.NewWhereQueryRange(attribute, p.rangeBits, lower, upper, p.key)
+	if err != nil {
+		return "", err
+	}
+	p.query.WhereRange = append(p.query.WhereRange, wr)
+	return condition, nil
+}
+
+// countWhere returns the number of values of an attribute already in the where attributes of the query
+func (p *queryParser) countWhere(attribute string) int {
+	count := 0
+	for _, w := range p.query.Where {
+		if w.Name == attribute {
+			count++
+		}
+	}
+	return count
+}
+
+// countRanges returns the number of range conditions already on an attribute
+func (p *queryParser) countRanges(attribute string) int {
+	count := 0
+	for _, wr := range p.query.WhereRange {
+		if wr.Name == attribute {
+			count++
+		}
+	}
+	return count
+}
+
+// indexSuffix returns the index of the i-th value of an attribute in a predicate ("" for the first one)
+func indexSuffix(i int) string {
+	if i == 0 {
+		return ""
+	}
+	return "[" + strconv.Itoa(i) + "]"
+}
+
+// ParseQuery parses an SQL-like query (e.g. SELECT SUM(s1), COUNT(*) FROM dataset WHERE w1 = 1 AND (w2 = 27 OR
+// w3 >= 4) GROUP BY g1, g2) and returns the query statement of a survey: the constants of the where attributes are
+// encrypted with the collective key of the roster and the ranges compare values of rangeBits bits (DefaultRangeBits if
+// it is 0). The syntax errors are *QueryError.
+func ParseQuery(roster *onet.Roster, query string, rangeBits int64) (*SurveyCreationQuery, error) {
+	return ParseQueryWithKey(roster, roster.Aggregate, query, rangeBits)
+}
+
+// ParseQueryWithKey parses a query like ParseQuery, the constants being encrypted with another collective key (e.g.
+// generated by the servers with a DKG, see SendDKGQuery).
+func ParseQueryWithKey(roster *onet.Roster, collectiveKey kyber.Point, query string, rangeBits int64) (*SurveyCreationQuery, error) {
+	if rangeBits == 0 {
+		rangeBits = DefaultRangeBits
+	}
+	tokens, err := tokenize(query)
+	if err != nil {
+		return nil, err
+	}
+
+	p := queryParser{tokenStream: tokenStream{tokens: tokens}, key: collectiveKey, rangeBits: rangeBits}
+	p.query.Roster = *roster
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+	return &p.query, nil
+}
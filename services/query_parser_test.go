@@ -0,0 +1,81 @@
+package servicesunlynx_test
+
+import (
+	"testing"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3/util/key"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/network"
+)
+
+// TestParseQuery tests the translation of a query in the query statement of a survey.
+func TestParseQuery(t *testing.T) {
+	keys := key.NewKeyPair(libunlynx.SuiTe)
+	roster := onet.NewRoster([]*network.ServerIdentity{network.NewServerIdentity(keys.Public, network.NewLocalAddress("127.0.0.1:2000"))})
+
+	scq, err := servicesunlynx.ParseQuery(roster, "SELECT SUM(s1), count(*) FROM patients WHERE w1 = 1 AND (w2 = 27 OR w3 <> 4) group by g1, g2;", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "patients", scq.Dataset)
+	assert.Equal(t, []string{"s1"}, scq.Sum)
+	assert.True(t, scq.Count)
+	assert.Equal(t, "w1 == :w1 && (w2 == :w2 || w3 != :w3)", scq.Predicate)
+	assert.Equal(t, []string{"g1", "g2"}, scq.GroupBy)
+	assert.Empty(t, scq.Operations)
+	require.Len(t, scq.Where, 3)
+	for i, expected := range []int64{1, 27, 4} {
+		value, err := libunlynx.DecryptInt(keys.Private, scq.Where[i].Value)
+		require.NoError(t, err)
+		assert.Equal(t, expected, value)
+	}
+
+	// ranges and aggregate operations
+	scq, err = servicesunlynx.ParseQuery(roster, "SELECT AVG(s1), SUM(s2) WHERE w1 >= 40 AND NOT w2 BETWEEN 5 AND 9 OR w3 < 3", 8)
+	require.NoError(t, err)
+	assert.Empty(t, scq.Dataset)
+	assert.Empty(t, scq.Sum)
+	assert.Equal(t, []libunlynx.Operation{{Op: libunlynx.OpMean, Attribute: "s1"}, {Op: libunlynx.OpSum, Attribute: "s2"}}, scq.Operations)
+	assert.Equal(t, "range(w1) && !(range(w2)) || range(w3)", scq.Predicate)
+	require.Len(t, scq.WhereRange, 3)
+	for i, expected := range [][2]int64{{40, 255}, {5, 9}, {0, 2}} {
+		cover, err := libunlynx.RangeCover(8, expected[0], expected[1])
+		require.NoError(t, err)
+		values, err := libunlynx.DecryptIntVector(keys.Private, &scq.WhereRange[i].Cover)
+		require.NoError(t, err)
+		assert.Equal(t, cover, values)
+	}
+
+	// several values of an attribute
+	scq, err = servicesunlynx.ParseQuery(roster, "SELECT SUM(s1) WHERE (w1 = 1 OR w1 = 2) AND w2 > 3 AND w2 < 9", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "(w1 == :w1 || w1 == :w1[1]) && range(w2) && range(w2[1])", scq.Predicate)
+	_, err = servicesunlynx.CompilePredicate(scq.Predicate, []string{"w1", "w1"}, []string{"w2", "w2"})
+	assert.NoError(t, err)
+}
+
+// TestParseQueryErrors tests the positions of the syntax errors.
+func TestParseQueryErrors(t *testing.T) {
+	keys := key.NewKeyPair(libunlynx.SuiTe)
+	roster := onet.NewRoster([]*network.ServerIdentity{network.NewServerIdentity(keys.Public, network.NewLocalAddress("127.0.0.1:2000"))})
+
+	for query, position := range map[string]int{
+		"SUM(s1)":                               1,
+		"SELECT SUM(s1) WHERE w1 = 1 AND":       32,
+		"SELECT SUM(s1) WHERE w1 = x":           27,
+		"SELECT SUM(s1) WHERE (w1 = 1":          29,
+		"SELECT SUM(s1), MEDIAN(s2)":            17,
+		"SELECT COUNT(s1)":                      14,
+		"SELECT SUM(s1) GROUP g1":               22,
+		"SELECT SUM(s1) WHERE w1 # 2":           25,
+		"SELECT SUM(s1) FROM d WHERE w1 = 1 g1": 36,
+	} {
+		_, err := servicesunlynx.ParseQuery(roster, query, 0)
+		require.Error(t, err, query)
+		queryErr, ok := err.(*servicesunlynx.QueryError)
+		require.True(t, ok, query)
+		assert.Equal(t, position, queryErr.Position, query+": "+err.Error())
+	}
+}
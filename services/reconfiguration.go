@@ -0,0 +1,1289 @@
+package servicesunlynx
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/lib/add_rm"
+	"github.com/ldsec/unlynx/lib/store"
+	"github.com/ldsec/unlynx/lib/tools"
+	"github.com/ldsec/unlynx/protocols/utils"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/sign/schnorr"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+	"go.etcd.io/bbolt"
+)
+
+// RosterChangeQuery is used by the administrator of a server to add it to (Add) or remove it from the roster of the
+// surveys that are collecting data. It is sent to this server, which coordinates the change, and signed with its
+// private key (see Sign). It must also be signed by an administrator of every server of the roster (see SignAdmin):
+// Admin is its public key and AdminSignature its signature of the change and of the Timestamp (unix nanoseconds) at
+// which it is signed. The ciphertexts kept by the servers for these surveys are re-encrypted under the new collective
+// key (the aggregate key of the new roster) with the AddRmServer protocol, and the data of a server removed is taken
+// over by the first server of the new roster.
+type RosterChangeQuery struct {
+	Roster    onet.Roster
+	Server    *network.ServerIdentity
+	Add       bool
+	Signature []byte
+
+	Admin          kyber.Point
+	Timestamp      int64
+	AdminSignature []byte
+}
+
+// RosterChangeResponse contains the new roster of the surveys, its aggregate key is their new collective key.
+type RosterChangeResponse struct {
+	Roster onet.Roster
+}
+
+// RosterChangePrepare is sent by the server coordinating a roster change to the other servers: they stop accepting
+// queries for the surveys of the roster and send back their ciphertexts.
+type RosterChangePrepare struct {
+	Query  RosterChangeQuery
+	Source *network.ServerIdentity
+}
+
+// RosterChangePrepared contains the ciphertexts of the collecting surveys of the roster kept by a server, or the reason
+// why it refuses the change.
+type RosterChangePrepared struct {
+	RosterID string
+	Server   string
+	Surveys  []SurveyCiphertexts
+	Refusal  string
+}
+
+// SurveyCiphertexts are the ciphertexts of a survey kept by a server that are encrypted under its collective key: the
+// ones of the query and the ones of the DP responses not processed yet (with the data providers that sent them).
+type SurveyCiphertexts struct {
+	Query      SurveyCreationQuery
+	Responses  []libunlynx.ProcessResponse
+	DpReceived int64
+	DpKeys     []string
+	DpNonces   []string
+}
+
+// RosterChangeCommit is sent by the server coordinating a roster change to each server with the proofs of the
+// transformation of its ciphertexts (the proofs contain the new ciphertexts).
+type RosterChangeCommit struct {
+	RosterID string
+	Surveys  []SurveyTransformation
+}
+
+// SurveyTransformation contains the proofs of the transformation of the ciphertexts of a survey kept by a server.
+type SurveyTransformation struct {
+	// Query is the query of the survey before the change (only used by a server added, the others have it)
+	Query           SurveyCreationQuery
+	QueryProofs     libunlynxaddrm.PublishedAddRmListProof
+	ResponsesProofs libunlynxaddrm.PublishedAddRmListProof
+
+	// Handover are the (transformed) ciphertexts of the server removed, taken over by this server
+	Handover       *SurveyCiphertexts
+	HandoverProofs libunlynxaddrm.PublishedAddRmListProof
+}
+
+// RosterChangeDecision is sent by the server coordinating a roster change once all the servers verified their new
+// ciphertexts (Apply), or to abort the change.
+type RosterChangeDecision struct {
+	RosterID string
+	Apply    bool
+}
+
+// RosterChangeAck is sent back by a server to the server coordinating a roster change once it verified its new
+// ciphertexts or applied the change, with the error it got if it failed.
+type RosterChangeAck struct {
+	RosterID string
+	Server   string
+	Error    string
+}
+
+// RosterChangeStatusQuery is sent by a server that staged a roster change which was not decided on time (see
+// RosterChangeTimeout) to the other servers taking part in it, to learn the decision.
+type RosterChangeStatusQuery struct {
+	RosterID string
+}
+
+// RosterChangeStatusReply contains the status of a roster change on a server. A server that did not stage the change
+// aborts it before replying, so that the change cannot be applied anymore.
+type RosterChangeStatusReply struct {
+	RosterID string
+	Server   string
+	Status   RosterChangeStatus
+}
+
+// RosterChangeStatus is the status of a roster change on a server.
+type RosterChangeStatus int
+
+const (
+	// RosterChangeUnknown means that the server did not stage the change
+	RosterChangeUnknown RosterChangeStatus = iota
+	// RosterChangeStaged means that the server verified and persisted its new ciphertexts, it waits for the decision
+	RosterChangeStaged
+	// RosterChangeApplied means that the change was decided, the server applies it (again after a restart if needed)
+	RosterChangeApplied
+	// RosterChangeAborted means that the change was aborted
+	RosterChangeAborted
+)
+
+// RosterChangeRecord is the state of a roster change persisted by a server once its new ciphertexts are verified.
+type RosterChangeRecord struct {
+	Query     RosterChangeQuery
+	NewRoster onet.Roster
+	Surveys   []StagedSurvey
+	Status    RosterChangeStatus
+}
+
+// StagedSurvey is a survey as it will be once a roster change is applied: its query, its DP responses not processed
+// yet and the data taken over from the server removed.
+type StagedSurvey struct {
+	Query     SurveyCreationQuery
+	Responses []libunlynx.ProcessResponse
+	Handover  *SurveyCiphertexts
+}
+
+// RosterChangeTimeout is the time after which a server taking part in a roster change ends it if it was not decided
+// (e.g. the coordinator is unavailable): the change is aborted if the server did not stage it yet, the server asks the
+// other servers for the decision otherwise.
+var RosterChangeTimeout = 4 * libunlynx.TIMEOUT
+
+// rosterChangeBucket is the name of the bucket, in the conode database, where the roster changes are persisted
+var rosterChangeBucket = []byte("rosterchanges")
+
+func init() {
+	network.RegisterMessage(&RosterChangeQuery{})
+	network.RegisterMessage(&RosterChangeResponse{})
+	network.RegisterMessage(&RosterChangeRecord{})
+}
+
+// rosterTransition is the state of a roster change on a server, from its preparation to its application: the surveys
+// of the roster do not accept queries meanwhile.
+type rosterTransition struct {
+	query     RosterChangeQuery
+	newRoster *onet.Roster
+	surveys   map[SurveyID]bool // collecting surveys of the roster on this server
+
+	// staged are the surveys, with their new ciphertexts, once they are verified
+	staged map[SurveyID]StagedSurvey
+
+	// deadline ends the change if it is not decided on time (see RosterChangeTimeout)
+	deadline *time.Timer
+
+	// channels of the server coordinating the change, and of a server asking for the decision
+	prepared chan RosterChangePrepared
+	acks     chan RosterChangeAck
+	statuses chan RosterChangeStatusReply
+}
+
+// newRosterTransition constructor of a rosterTransition
+func newRosterTransition(query RosterChangeQuery, newRoster *onet.Roster) *rosterTransition {
+	size := len(query.participants().List)
+	return &rosterTransition{
+		query:     query,
+		newRoster: newRoster,
+		surveys:   make(map[SurveyID]bool),
+		prepared:  make(chan RosterChangePrepared, size),
+		acks:      make(chan RosterChangeAck, size),
+		statuses:  make(chan RosterChangeStatusReply, size),
+	}
+}
+
+// record returns the record of a staged change with the given status, the surveys are sorted by ID
+func (t *rosterTransition) record(status RosterChangeStatus) RosterChangeRecord {
+	record := RosterChangeRecord{Query: t.query, NewRoster: *t.newRoster, Status: status, Surveys: make([]StagedSurvey, 0, len(t.staged))}
+	for _, st := range t.staged {
+		record.Surveys = append(record.Surveys, st)
+	}
+	sort.Slice(record.Surveys, func(i, j int) bool { return record.Surveys[i].Query.SurveyID < record.Surveys[j].Query.SurveyID })
+	return record
+}
+
+// RosterChangeLog keeps the roster changes staged by a server and their decisions.
+type RosterChangeLog struct {
+	mutex  sync.Mutex
+	db     *bbolt.DB
+	bucket []byte
+
+	records map[string]RosterChangeRecord // by ID of the roster changed
+}
+
+// NewRosterChangeLog constructor of a RosterChangeLog, it is persisted in a BoltDB bucket (created if it does not
+// exist) or only kept in memory if db is nil.
+func NewRosterChangeLog(db *bbolt.DB, bucket []byte) (*RosterChangeLog, error) {
+	rl := &RosterChangeLog{db: db, bucket: bucket, records: make(map[string]RosterChangeRecord)}
+	if db == nil {
+		return rl, nil
+	}
+
+	err := db.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(bucket)
+		if err != nil {
+			return err
+		}
+		return b.ForEach(func(k, v []byte) error {
+			_, msg, err := network.Unmarshal(v, libunlynx.SuiTe)
+			if err != nil {
+				return fmt.Errorf("could not unmarshal the change of roster %s: %v", k, err)
+			}
+			record, ok := msg.(*RosterChangeRecord)
+			if !ok {
+				return fmt.Errorf("wrong type stored for the change of roster %s", k)
+			}
+			rl.records[string(k)] = *record
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not load the roster changes: %v", err)
+	}
+	return rl, nil
+}
+
+// Put adds (and persists) or replaces the record of a roster change
+func (rl *RosterChangeLog) Put(record RosterChangeRecord) error {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	rosterID := record.Query.Roster.ID.String()
+	if rl.db != nil {
+		buf, err := network.Marshal(&record)
+		if err != nil {
+			return err
+		}
+		err = rl.db.Update(func(tx *bbolt.Tx) error {
+			return tx.Bucket(rl.bucket).Put([]byte(rosterID), buf)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	rl.records[rosterID] = record
+	return nil
+}
+
+// Get returns the record of the change of a roster
+func (rl *RosterChangeLog) Get(rosterID string) (RosterChangeRecord, bool) {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+	record, ok := rl.records[rosterID]
+	return record, ok
+}
+
+// List returns the records of all the roster changes
+func (rl *RosterChangeLog) List() []RosterChangeRecord {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+	records := make([]RosterChangeRecord, 0, len(rl.records))
+	for _, record := range rl.records {
+		records = append(records, record)
+	}
+	return records
+}
+
+// Roster change queries
+//______________________________________________________________________________________________________________________
+
+// signedMessage returns the message signed by the server added or removed: the roster and the change
+func (query *RosterChangeQuery) signedMessage() ([]byte, error) {
+	h := newSignedMessageHash("roster change")
+	h.writeBytes(query.Roster.ID[:])
+	h.writePoint(query.Server.Public)
+	h.writeBool(query.Add)
+	return h.sum()
+}
+
+// Sign signs the query with the private key of the server added or removed
+func (query *RosterChangeQuery) Sign(private kyber.Scalar) error {
+	if query.Server == nil {
+		return fmt.Errorf("no server to add or remove")
+	}
+	msg, err := query.signedMessage()
+	if err != nil {
+		return err
+	}
+	signature, err := schnorr.Sign(libunlynx.SuiTe, private, msg)
+	if err != nil {
+		return err
+	}
+	query.Signature = signature
+	return nil
+}
+
+// Verify checks the signature of the query
+func (query *RosterChangeQuery) Verify() error {
+	if query.Server == nil {
+		return fmt.Errorf("no server to add or remove")
+	}
+	msg, err := query.signedMessage()
+	if err != nil {
+		return err
+	}
+	if err := schnorr.Verify(libunlynx.SuiTe, query.Server.Public, msg, query.Signature); err != nil {
+		return fmt.Errorf("wrong signature of the roster change: %v", err)
+	}
+	return nil
+}
+
+// adminSignedMessage returns the message signed by the administrator: the roster, the change and the timestamp
+func (query *RosterChangeQuery) adminSignedMessage() ([]byte, error) {
+	h := newSignedMessageHash("roster change administration")
+	h.writeBytes(query.Roster.ID[:])
+	h.writePoint(query.Server.Public)
+	h.writeBool(query.Add)
+	h.writeInt(query.Timestamp)
+	return h.sum()
+}
+
+// SignAdmin signs the query with the long-term private key of an administrator of the servers
+func (query *RosterChangeQuery) SignAdmin(private kyber.Scalar) error {
+	if query.Server == nil {
+		return fmt.Errorf("no server to add or remove")
+	}
+	query.Admin = libunlynx.SuiTe.Point().Mul(private, nil)
+	query.Timestamp = time.Now().UnixNano()
+	msg, err := query.adminSignedMessage()
+	if err != nil {
+		return err
+	}
+	query.AdminSignature, err = schnorr.Sign(libunlynx.SuiTe, private, msg)
+	return err
+}
+
+// authorize checks that the query was recently signed by an administrator of the policy
+func (query *RosterChangeQuery) authorize(policy *AccessPolicy) error {
+	if query.Server == nil {
+		return fmt.Errorf("no server to add or remove")
+	}
+	if query.Admin == nil || len(query.AdminSignature) == 0 {
+		return fmt.Errorf("the roster change is not signed by an administrator")
+	}
+	if _, ok := policy.admin(query.Admin); !ok {
+		return fmt.Errorf("%s is not an administrator of the server", query.Admin.String())
+	}
+	if err := checkTimestamp(query.Timestamp); err != nil {
+		return err
+	}
+	msg, err := query.adminSignedMessage()
+	if err != nil {
+		return err
+	}
+	if err := schnorr.Verify(libunlynx.SuiTe, query.Admin, msg, query.AdminSignature); err != nil {
+		return fmt.Errorf("wrong administrator signature of the roster change: %v", err)
+	}
+	return nil
+}
+
+// newRoster returns the roster of the surveys after the change
+func (query *RosterChangeQuery) newRoster() (*onet.Roster, error) {
+	i, _ := query.Roster.Search(query.Server.ID)
+	list := make([]*network.ServerIdentity, 0, len(query.Roster.List)+1)
+	if query.Add {
+		if i >= 0 {
+			return nil, fmt.Errorf("%s is already in the roster", query.Server)
+		}
+		list = append(append(list, query.Roster.List...), query.Server)
+	} else {
+		if i < 0 {
+			return nil, fmt.Errorf("%s is not in the roster", query.Server)
+		}
+		if len(query.Roster.List) == 1 {
+			return nil, fmt.Errorf("the last server of the roster cannot be removed")
+		}
+		list = append(append(list, query.Roster.List[:i]...), query.Roster.List[i+1:]...)
+	}
+	return onet.NewRoster(list), nil
+}
+
+// participants returns the servers taking part in the change: the servers of the roster and the server added
+func (query *RosterChangeQuery) participants() *onet.Roster {
+	if !query.Add {
+		return &query.Roster
+	}
+	return onet.NewRoster(append(append([]*network.ServerIdentity{}, query.Roster.List...), query.Server))
+}
+
+// ciphertexts returns the ciphertexts of a query: the values of its where attributes followed by the covers of its
+// range conditions
+func (query *SurveyCreationQuery) ciphertexts() libunlynx.CipherVector {
+	cv := make(libunlynx.CipherVector, 0)
+	for _, w := range query.Where {
+		cv = append(cv, w.Value)
+	}
+	for _, wr := range query.WhereRange {
+		cv = append(cv, wr.Cover...)
+	}
+	return cv
+}
+
+// setCiphertexts replaces the ciphertexts of a query, in the order of ciphertexts
+func (query *SurveyCreationQuery) setCiphertexts(cv libunlynx.CipherVector) error {
+	if len(cv) != len(query.ciphertexts()) {
+		return fmt.Errorf("wrong number of ciphertexts for the query of survey %s", query.SurveyID)
+	}
+	where := make([]libunlynx.WhereQueryAttribute, len(query.Where))
+	for i, w := range query.Where {
+		where[i] = libunlynx.WhereQueryAttribute{Name: w.Name, Value: cv[i]}
+	}
+	cv = cv[len(where):]
+	whereRange := make([]libunlynx.WhereQueryRange, len(query.WhereRange))
+	for i, wr := range query.WhereRange {
+		whereRange[i] = libunlynx.WhereQueryRange{Name: wr.Name, Bits: wr.Bits, Cover: append(libunlynx.CipherVector{}, cv[:len(wr.Cover)]...)}
+		cv = cv[len(wr.Cover):]
+	}
+	query.Where = where
+	query.WhereRange = whereRange
+	return nil
+}
+
+// responsesCiphertexts returns the ciphertexts of DP responses
+func responsesCiphertexts(responses []libunlynx.ProcessResponse) libunlynx.CipherVector {
+	cv := make(libunlynx.CipherVector, 0)
+	for _, r := range responses {
+		cv = append(cv, r.WhereEnc...)
+		cv = append(cv, r.GroupByEnc...)
+		cv = append(cv, r.AggregatingAttributes...)
+	}
+	return cv
+}
+
+// replaceResponsesCiphertexts returns DP responses whose ciphertexts are replaced by the ones of cv, in the order of
+// responsesCiphertexts
+func replaceResponsesCiphertexts(responses []libunlynx.ProcessResponse, cv libunlynx.CipherVector) ([]libunlynx.ProcessResponse, error) {
+	if len(cv) != len(responsesCiphertexts(responses)) {
+		return nil, fmt.Errorf("wrong number of ciphertexts for %d responses", len(responses))
+	}
+	result := make([]libunlynx.ProcessResponse, len(responses))
+	for i, r := range responses {
+		result[i].WhereEnc = append(libunlynx.CipherVector{}, cv[:len(r.WhereEnc)]...)
+		cv = cv[len(r.WhereEnc):]
+		result[i].GroupByEnc = append(libunlynx.CipherVector{}, cv[:len(r.GroupByEnc)]...)
+		cv = cv[len(r.GroupByEnc):]
+		result[i].AggregatingAttributes = append(libunlynx.CipherVector{}, cv[:len(r.AggregatingAttributes)]...)
+		cv = cv[len(r.AggregatingAttributes):]
+	}
+	return result, nil
+}
+
+// verifyAddRmProofs checks the proofs of the transformation of ciphertexts by the server added or removed (with its
+// key) and returns the new ciphertexts. The ciphertexts before the transformation are the ones of the proofs if before
+// is nil.
+func verifyAddRmProofs(proofs libunlynxaddrm.PublishedAddRmListProof, before libunlynx.CipherVector, query *RosterChangeQuery) (libunlynx.CipherVector, error) {
+	if before != nil && len(proofs.List) != len(before) {
+		return nil, fmt.Errorf("wrong number of add/rm proofs")
+	}
+	after := make(libunlynx.CipherVector, len(proofs.List))
+	if len(proofs.List) == 0 {
+		return after, nil
+	}
+	if proofs.Krm == nil || !proofs.Krm.Equal(query.Server.Public) || proofs.ToAdd != query.Add {
+		return nil, fmt.Errorf("the ciphertexts were not transformed with the key of %s", query.Server)
+	}
+	for i, p := range proofs.List {
+		if before != nil && !p.CtBef.Equal(&before[i]) {
+			return nil, fmt.Errorf("the add/rm proofs are not the ones of the ciphertexts of this server")
+		}
+		if !p.CtAft.K.Equal(p.CtBef.K) {
+			return nil, fmt.Errorf("the add/rm proofs do not keep the random part of the ciphertexts")
+		}
+		after[i] = p.CtAft
+	}
+	if !libunlynxaddrm.AddRmListProofVerification(proofs, 1.0) {
+		return nil, fmt.Errorf("wrong add/rm proofs")
+	}
+	return after, nil
+}
+
+// Roster transitions
+//______________________________________________________________________________________________________________________
+
+// checkTransition returns an error if the roster is being changed (the caller holds the lock of the service)
+func (s *Service) checkTransition(roster *onet.Roster) error {
+	if _, ok := s.transitions[roster.ID.String()]; ok {
+		return fmt.Errorf("the roster %s is being changed, try again later", roster.ID.String())
+	}
+	return nil
+}
+
+// getTransition returns the change of a roster in progress on this server
+func (s *Service) getTransition(rosterID string) (*rosterTransition, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	t, ok := s.transitions[rosterID]
+	if !ok {
+		return nil, fmt.Errorf("no change of roster %s in progress", rosterID)
+	}
+	return t, nil
+}
+
+// endTransition ends the change of a roster on this server, its surveys accept queries again
+func (s *Service) endTransition(t *rosterTransition) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.endTransitionLocked(t)
+}
+
+// endTransitionLocked ends the change of a roster on this server (the caller holds the lock of the service)
+func (s *Service) endTransitionLocked(t *rosterTransition) {
+	if t.deadline != nil {
+		t.deadline.Stop()
+	}
+	if s.transitions[t.query.Roster.ID.String()] == t {
+		delete(s.transitions, t.query.Roster.ID.String())
+	}
+}
+
+// scheduleExpiration (re)starts the deadline of the change of a roster on this server
+func (s *Service) scheduleExpiration(t *rosterTransition) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if t.deadline != nil {
+		t.deadline.Stop()
+	}
+	t.deadline = time.AfterFunc(RosterChangeTimeout, func() { s.expireTransition(t) })
+}
+
+// expireTransition ends the change of a roster that was not decided on time: it is aborted if this server did not
+// stage it, otherwise this server applies or aborts it if it learns the decision (the deadline is restarted if not)
+func (s *Service) expireTransition(t *rosterTransition) {
+	rosterID := t.query.Roster.ID.String()
+	s.mutex.Lock()
+	current := s.transitions[rosterID] == t
+	staged := t.staged != nil
+	if current && !staged {
+		s.endTransitionLocked(t)
+	}
+	s.mutex.Unlock()
+	if !current {
+		return
+	}
+	if !staged {
+		log.Warn(s.ServerIdentity(), " aborts the change of roster ", rosterID, ": it was not decided on time")
+		return
+	}
+
+	status := RosterChangeStaged
+	if record, ok := s.RosterChanges.Get(rosterID); ok {
+		status = record.Status
+	}
+	if status == RosterChangeStaged {
+		status = s.askRosterChangeDecision(t)
+	}
+	switch status {
+	case RosterChangeApplied, RosterChangeAborted:
+		if err := s.decideRosterChange(t, status == RosterChangeApplied); err != nil {
+			log.Error(s.ServerIdentity(), " could not apply the change of roster ", rosterID, ": ", err)
+		}
+	default:
+		log.Warn(s.ServerIdentity(), " does not know the decision of the change of roster ", rosterID, " yet")
+		s.scheduleExpiration(t)
+	}
+}
+
+// askRosterChangeDecision asks the other servers taking part in the change of a roster for its decision: it is applied
+// if one of them applied it, it is aborted if one of them aborted it or did not stage it (it cannot be applied then)
+func (s *Service) askRosterChangeDecision(t *rosterTransition) RosterChangeStatus {
+	rosterID := t.query.Roster.ID.String()
+	asked := 0
+	for _, si := range t.query.participants().List {
+		if si.Equal(s.ServerIdentity()) {
+			continue
+		}
+		if err := s.SendRaw(si, &RosterChangeStatusQuery{RosterID: rosterID}); err != nil {
+			log.Warn(s.ServerIdentity(), " could not ask ", si, " for the decision of the change of roster ", rosterID, ": ", err)
+			continue
+		}
+		asked++
+	}
+
+	timeout := time.After(libunlynx.TIMEOUT)
+	for ; asked > 0; asked-- {
+		select {
+		case reply := <-t.statuses:
+			switch reply.Status {
+			case RosterChangeApplied:
+				return RosterChangeApplied
+			case RosterChangeAborted, RosterChangeUnknown:
+				return RosterChangeAborted
+			}
+		case <-timeout:
+			return RosterChangeStaged
+		}
+	}
+	return RosterChangeStaged
+}
+
+// decideRosterChange applies (or aborts) the change of a roster staged on this server. The decision is persisted
+// before the change is applied: if the application fails, it is retried at the deadline of the change or when the
+// server restarts.
+func (s *Service) decideRosterChange(t *rosterTransition, apply bool) error {
+	s.mutex.Lock()
+	staged := t.staged != nil
+	s.mutex.Unlock()
+
+	// the decided changes are kept without their surveys, to answer the other servers
+	if !apply {
+		if staged {
+			aborted := RosterChangeRecord{Query: t.query, NewRoster: *t.newRoster, Status: RosterChangeAborted}
+			if err := s.RosterChanges.Put(aborted); err != nil {
+				log.Error(err)
+			}
+		}
+		s.endTransition(t)
+		return nil
+	}
+
+	if err := s.applyDecidedRosterChange(t); err != nil {
+		return err
+	}
+	s.endTransition(t)
+	return nil
+}
+
+// applyDecidedRosterChange persists the decision to apply the change of a roster staged on this server and applies it,
+// the application is retried at the deadline of the change if it fails
+func (s *Service) applyDecidedRosterChange(t *rosterTransition) error {
+	s.mutex.Lock()
+	staged := t.staged != nil
+	s.mutex.Unlock()
+	if !staged {
+		return fmt.Errorf("the new ciphertexts of %s were not verified", s.ServerIdentity())
+	}
+
+	if err := s.RosterChanges.Put(t.record(RosterChangeApplied)); err != nil {
+		return err
+	}
+	if err := s.applyRosterChange(t); err != nil {
+		s.scheduleExpiration(t)
+		return err
+	}
+	decided := RosterChangeRecord{Query: t.query, NewRoster: *t.newRoster, Status: RosterChangeApplied}
+	if err := s.RosterChanges.Put(decided); err != nil {
+		log.Error(err)
+	}
+	return nil
+}
+
+// restoreRosterChanges resumes the roster changes staged by this server before it restarted: the ones that were
+// decided are applied again, the surveys of the others do not accept queries until they are decided
+func (s *Service) restoreRosterChanges() error {
+	for _, record := range s.RosterChanges.List() {
+		if record.Status != RosterChangeStaged && (record.Status != RosterChangeApplied || len(record.Surveys) == 0) {
+			continue
+		}
+		newRoster := record.NewRoster
+		t := newRosterTransition(record.Query, &newRoster)
+		t.staged = make(map[SurveyID]StagedSurvey, len(record.Surveys))
+		for _, st := range record.Surveys {
+			t.staged[st.Query.SurveyID] = st
+		}
+
+		s.mutex.Lock()
+		s.transitions[record.Query.Roster.ID.String()] = t
+		s.mutex.Unlock()
+
+		if record.Status == RosterChangeApplied {
+			if err := s.decideRosterChange(t, true); err != nil {
+				return err
+			}
+		} else {
+			s.scheduleExpiration(t)
+		}
+	}
+	return nil
+}
+
+// prepareRosterChange stops the surveys of the roster from accepting queries and returns their ciphertexts. The change
+// is refused if it is not signed by an administrator of this server, or if a survey of the roster is in the middle of
+// the protocols or uses a collective key generated by a DKG.
+func (s *Service) prepareRosterChange(query *RosterChangeQuery) (*rosterTransition, []SurveyCiphertexts, error) {
+	if err := query.Verify(); err != nil {
+		return nil, nil, err
+	}
+	if err := query.authorize(s.Policy); err != nil {
+		return nil, nil, err
+	}
+	newRoster, err := query.newRoster()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.checkTransition(&query.Roster); err != nil {
+		return nil, nil, err
+	}
+
+	surveys := make([]SurveyCiphertexts, 0)
+	for _, entry := range s.Survey.ToSlice() {
+		survey := entry.Value().(Survey)
+		if !survey.Query.Roster.ID.Equal(query.Roster.ID) || survey.Phase == PhaseFinished || survey.Phase == PhaseAborted {
+			continue
+		}
+		if survey.Phase != PhaseCollecting {
+			return nil, nil, fmt.Errorf("survey %s is in the %s phase", survey.Query.SurveyID, survey.Phase.String())
+		}
+		if survey.Query.CollectiveKey != nil {
+			return nil, nil, fmt.Errorf("survey %s uses a collective key generated by a DKG", survey.Query.SurveyID)
+		}
+		surveys = append(surveys, SurveyCiphertexts{Query: survey.Query, Responses: survey.PendingDpResponses(),
+			DpReceived: survey.DpReceived, DpKeys: survey.DpKeys, DpNonces: survey.DpNonces})
+	}
+	sort.Slice(surveys, func(i, j int) bool { return surveys[i].Query.SurveyID < surveys[j].Query.SurveyID })
+
+	t := newRosterTransition(*query, newRoster)
+	for _, sc := range surveys {
+		t.surveys[sc.Query.SurveyID] = true
+	}
+	t.deadline = time.AfterFunc(RosterChangeTimeout, func() { s.expireTransition(t) })
+	s.transitions[query.Roster.ID.String()] = t
+	return t, surveys, nil
+}
+
+// newQuery returns the query of a survey after the change on server si: its roster, its ciphertexts, its root and, if a
+// server is removed, the number of data providers of the server that takes over its data
+func (t *rosterTransition) newQuery(query SurveyCreationQuery, ciphertexts libunlynx.CipherVector, si *network.ServerIdentity) (SurveyCreationQuery, error) {
+	if err := query.setCiphertexts(ciphertexts); err != nil {
+		return SurveyCreationQuery{}, err
+	}
+	query.Roster = *t.newRoster
+
+	// the successor of the server removed becomes the root of its surveys
+	if !t.query.Add && query.Source != nil && query.Source.Equal(t.query.Server) {
+		query.Source = t.successor()
+	}
+	if query.Source != nil && query.Source.Equal(si) {
+		query.Source = nil
+	}
+
+	mapDPs := make(map[string]int64, len(query.MapDPs))
+	for k, v := range query.MapDPs {
+		mapDPs[k] = v
+	}
+	if !t.query.Add {
+		mapDPs[t.successor().String()] += mapDPs[t.query.Server.String()]
+		delete(mapDPs, t.query.Server.String())
+	}
+	query.MapDPs = mapDPs
+	return query, nil
+}
+
+// successor returns the server that takes over the data of the server removed
+func (t *rosterTransition) successor() *network.ServerIdentity {
+	return t.newRoster.List[0]
+}
+
+// commitRosterChange verifies the proofs of the new ciphertexts of the surveys kept by this server and stages them
+// (they are persisted, so that the change can be applied even if the server restarts)
+func (s *Service) commitRosterChange(t *rosterTransition, msg *RosterChangeCommit) error {
+	added := t.query.Add && t.query.Server.Equal(s.ServerIdentity())
+	if !added && len(msg.Surveys) != len(t.surveys) {
+		return fmt.Errorf("the roster change does not cover all the surveys of %s", s.ServerIdentity())
+	}
+
+	staged := make(map[SurveyID]StagedSurvey, len(msg.Surveys))
+	for _, st := range msg.Surveys {
+		sid := st.Query.SurveyID
+		query := st.Query
+		var responses []libunlynx.ProcessResponse
+		if !added {
+			if !t.surveys[sid] {
+				return fmt.Errorf("survey %s is not changed on %s", sid, s.ServerIdentity())
+			}
+			survey, err := s.getSurvey(sid)
+			if err != nil {
+				return err
+			}
+			query = survey.Query
+			responses = survey.PendingDpResponses()
+		}
+
+		queryCiphertexts, err := verifyAddRmProofs(st.QueryProofs, query.ciphertexts(), &t.query)
+		if err != nil {
+			return fmt.Errorf("survey %s: %v", sid, err)
+		}
+		newQuery, err := t.newQuery(query, queryCiphertexts, s.ServerIdentity())
+		if err != nil {
+			return err
+		}
+		newCiphertexts, err := verifyAddRmProofs(st.ResponsesProofs, responsesCiphertexts(responses), &t.query)
+		if err != nil {
+			return fmt.Errorf("survey %s: %v", sid, err)
+		}
+		newResponses, err := replaceResponsesCiphertexts(responses, newCiphertexts)
+		if err != nil {
+			return err
+		}
+
+		// the data of the server removed is only taken over by its successor
+		if st.Handover != nil {
+			if t.query.Add || !t.successor().Equal(s.ServerIdentity()) {
+				return fmt.Errorf("%s cannot take over the data of %s", s.ServerIdentity(), t.query.Server.String())
+			}
+			handoverCiphertexts, err := verifyAddRmProofs(st.HandoverProofs, nil, &t.query)
+			if err != nil {
+				return fmt.Errorf("survey %s: %v", sid, err)
+			}
+			cv := responsesCiphertexts(st.Handover.Responses)
+			if !cv.Equal(&handoverCiphertexts) {
+				return fmt.Errorf("the data taken over for survey %s is not the one of the add/rm proofs", sid)
+			}
+		}
+		staged[sid] = StagedSurvey{Query: newQuery, Responses: newResponses, Handover: st.Handover}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.transitions[t.query.Roster.ID.String()] != t {
+		return fmt.Errorf("the change of roster %s already ended on %s", t.query.Roster.ID, s.ServerIdentity())
+	}
+	t.staged = staged
+	if err := s.RosterChanges.Put(t.record(RosterChangeStaged)); err != nil {
+		t.staged = nil
+		return err
+	}
+	return nil
+}
+
+// applyRosterChange replaces the roster and the ciphertexts of the surveys by the staged ones: the server removed
+// deletes the surveys and the server added creates them. It can be applied again: the surveys that already have the
+// new roster are left as they are.
+func (s *Service) applyRosterChange(t *rosterTransition) error {
+	// the data providers taken over are counted once the lock is released
+	handovers := make(map[SurveyID]int)
+	defer func() {
+		for sid, dps := range handovers {
+			if survey, err := s.getSurvey(sid); err == nil {
+				survey.DpChannel <- dps
+			}
+		}
+	}()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if t.staged == nil {
+		return fmt.Errorf("the new ciphertexts of %s were not verified", s.ServerIdentity())
+	}
+	removed := !t.query.Add && t.query.Server.Equal(s.ServerIdentity())
+	added := t.query.Add && t.query.Server.Equal(s.ServerIdentity())
+	for sid, st := range t.staged {
+		survey, err := s.getSurvey(sid)
+		if removed {
+			if err == nil {
+				if err := s.deleteSurvey(sid); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if err != nil {
+			// the survey expired or was cancelled meanwhile
+			if !added {
+				continue
+			}
+			surveySecret, err := s.surveySecret(sid)
+			if err != nil {
+				return err
+			}
+			survey = newSurvey(st.Query, surveySecret, libunlynxstore.NewStore())
+			s.scheduleRemoval(sid, survey.CreationTime)
+		} else if survey.Query.Roster.ID.Equal(t.newRoster.ID) {
+			// already applied
+			continue
+		} else if err := survey.SetPendingDpResponses(st.Responses); err != nil {
+			return err
+		}
+		survey.Query = st.Query
+
+		if st.Handover != nil {
+			survey.DpResponses = append(survey.DpResponses, st.Handover.Responses...)
+			survey.DpReceived += st.Handover.DpReceived
+			survey.DpKeys = append(survey.DpKeys, st.Handover.DpKeys...)
+			survey.DpNonces = append(survey.DpNonces, st.Handover.DpNonces...)
+			if st.Handover.DpReceived > 0 {
+				handovers[sid] = int(st.Handover.DpReceived)
+			}
+		}
+
+		// the values precomputed for the previous collective key cannot be used
+		s.reservePrecomputations(sid, &survey.Query)
+		if err := s.putSurvey(sid, survey); err != nil {
+			delete(handovers, sid)
+			return err
+		}
+	}
+	log.Lvl1(s.ServerIdentity(), " changed the roster of ", len(t.staged), " surveys, their collective key is ", t.newRoster.Aggregate)
+	return nil
+}
+
+// transformCiphertexts adds (or removes) the key of this server to (from) ciphertexts with the AddRmServer protocol, it
+// returns the proofs of the transformation (they contain the new ciphertexts)
+func (s *Service) transformCiphertexts(target libunlynx.CipherVector, add bool) (libunlynxaddrm.PublishedAddRmListProof, error) {
+	proofs := libunlynxaddrm.PublishedAddRmListProof{}
+	if len(target) == 0 {
+		return proofs, nil
+	}
+
+	roster := onet.NewRoster([]*network.ServerIdentity{s.ServerIdentity()})
+	tree := roster.GenerateNaryTreeWithRoot(1, s.ServerIdentity())
+	tn := s.NewTreeNodeInstance(tree, tree.Root, protocolsunlynxutils.AddRmServerProtocolName)
+	pi, err := protocolsunlynxutils.NewAddRmProtocol(tn)
+	if err != nil {
+		return proofs, err
+	}
+	if err := s.RegisterProtocolInstance(pi); err != nil {
+		return proofs, err
+	}
+
+	addRmProtocol := pi.(*protocolsunlynxutils.AddRmServerProtocol)
+	addRmProtocol.TargetOfTransformation = target
+	addRmProtocol.KeyToRm = tn.Private()
+	addRmProtocol.Proofs = true
+	addRmProtocol.Add = add
+	addRmProtocol.ProofFunc = func(p libunlynxaddrm.PublishedAddRmListProof) {
+		proofs = p
+	}
+
+	go func() {
+		if err := pi.Dispatch(); err != nil {
+			log.Error("Error running Dispatch ->" + protocolsunlynxutils.AddRmServerProtocolName + " :" + err.Error())
+		}
+	}()
+	if err := pi.Start(); err != nil {
+		return proofs, err
+	}
+
+	select {
+	case <-addRmProtocol.FeedbackChannel:
+	case <-time.After(libunlynx.TIMEOUT):
+		return proofs, fmt.Errorf("%s didn't transform the ciphertexts on time", s.ServerIdentity())
+	}
+	return proofs, nil
+}
+
+// runRosterChange coordinates a roster change prepared on this server: it collects the ciphertexts of the other
+// servers, transforms them with the key of this server and sends them back with the proofs of the transformation. The
+// change is decided once every server verified and staged its new ciphertexts: the decision is persisted and the
+// servers that do not acknowledge it apply it once they learn it (see expireTransition).
+func (s *Service) runRosterChange(t *rosterTransition, own []SurveyCiphertexts) error {
+	participants := t.query.participants()
+	rosterID := t.query.Roster.ID.String()
+
+	// the servers that prepared the change have to be told if it is aborted
+	ciphertexts := map[string][]SurveyCiphertexts{s.ServerIdentity().String(): own}
+	abort := func(err error) error {
+		for _, si := range participants.List {
+			if _, ok := ciphertexts[si.String()]; ok && !si.Equal(s.ServerIdentity()) {
+				if tmpErr := s.SendRaw(si, &RosterChangeDecision{RosterID: rosterID}); tmpErr != nil {
+					log.Error(tmpErr)
+				}
+			}
+		}
+		if tmpErr := s.decideRosterChange(t, false); tmpErr != nil {
+			log.Error(tmpErr)
+		}
+		return err
+	}
+
+	err := libunlynxtools.SendISMOthers(s.ServiceProcessor, participants, &RosterChangePrepare{Query: t.query, Source: s.ServerIdentity()})
+	if err != nil {
+		return abort(err)
+	}
+	for len(ciphertexts) < len(participants.List) {
+		select {
+		case prepared := <-t.prepared:
+			if prepared.Refusal != "" {
+				return abort(errors.New(prepared.Refusal))
+			}
+			ciphertexts[prepared.Server] = prepared.Surveys
+		case <-time.After(libunlynx.TIMEOUT):
+			return abort(fmt.Errorf("the servers did not prepare the change of roster %s on time", rosterID))
+		}
+	}
+
+	// the servers of the roster must have the same surveys
+	// (the query of a server designates the root of the survey, unless the server is the root)
+	queries := make(map[SurveyID]SurveyCreationQuery)
+	for _, si := range participants.List {
+		for _, sc := range ciphertexts[si.String()] {
+			query := sc.Query
+			if query.Source == nil {
+				query.Source = si
+			}
+			queries[query.SurveyID] = query
+		}
+	}
+	ids := make([]SurveyID, 0, len(queries))
+	for sid := range queries {
+		ids = append(ids, sid)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, si := range t.query.Roster.List {
+		surveys := ciphertexts[si.String()]
+		for i, sid := range ids {
+			if i >= len(surveys) || surveys[i].Query.SurveyID != sid {
+				return abort(fmt.Errorf("%s does not have all the surveys of roster %s", si, rosterID))
+			}
+		}
+	}
+
+	// all the ciphertexts are transformed at once: the ones of the queries, then the ones of each server
+	target := make(libunlynx.CipherVector, 0)
+	for _, sid := range ids {
+		query := queries[sid]
+		target = append(target, query.ciphertexts()...)
+	}
+	for _, si := range participants.List {
+		for _, sc := range ciphertexts[si.String()] {
+			target = append(target, responsesCiphertexts(sc.Responses)...)
+		}
+	}
+	proofs, err := s.transformCiphertexts(target, t.query.Add)
+	if err != nil {
+		return abort(err)
+	}
+	if len(proofs.List) != len(target) {
+		return abort(fmt.Errorf("wrong number of add/rm proofs"))
+	}
+	next := func(n int) libunlynxaddrm.PublishedAddRmListProof {
+		list := libunlynxaddrm.PublishedAddRmListProof{List: proofs.List[:n], Krm: proofs.Krm, ToAdd: proofs.ToAdd}
+		proofs.List = proofs.List[n:]
+		return list
+	}
+
+	queryProofs := make(map[SurveyID]libunlynxaddrm.PublishedAddRmListProof, len(ids))
+	for _, sid := range ids {
+		query := queries[sid]
+		queryProofs[sid] = next(len(query.ciphertexts()))
+	}
+	commits := make(map[string]*RosterChangeCommit, len(participants.List))
+	for _, si := range participants.List {
+		commit := &RosterChangeCommit{RosterID: rosterID, Surveys: make([]SurveyTransformation, len(ids))}
+		for i, sid := range ids {
+			commit.Surveys[i] = SurveyTransformation{Query: queries[sid], QueryProofs: queryProofs[sid]}
+		}
+		for i, sc := range ciphertexts[si.String()] {
+			commit.Surveys[i].ResponsesProofs = next(len(responsesCiphertexts(sc.Responses)))
+		}
+		commits[si.String()] = commit
+	}
+
+	// the server removed hands its (transformed) data over to its successor
+	if !t.query.Add {
+		for i, sc := range own {
+			st := commits[s.ServerIdentity().String()].Surveys[i]
+			cv := make(libunlynx.CipherVector, len(st.ResponsesProofs.List))
+			for k, p := range st.ResponsesProofs.List {
+				cv[k] = p.CtAft
+			}
+			responses, err := replaceResponsesCiphertexts(sc.Responses, cv)
+			if err != nil {
+				return abort(err)
+			}
+			handover := sc
+			handover.Responses = responses
+			successor := commits[t.successor().String()]
+			successor.Surveys[i].Handover = &handover
+			successor.Surveys[i].HandoverProofs = st.ResponsesProofs
+		}
+	}
+
+	commit := func(si *network.ServerIdentity) interface{} {
+		return commits[si.String()]
+	}
+	err = s.collectAcks(t, participants, commit, func() error {
+		return s.commitRosterChange(t, commits[s.ServerIdentity().String()])
+	})
+	if err != nil {
+		return abort(err)
+	}
+
+	// every server staged its new ciphertexts, the change cannot be aborted anymore
+	if err := s.RosterChanges.Put(t.record(RosterChangeApplied)); err != nil {
+		return abort(err)
+	}
+	apply := func(*network.ServerIdentity) interface{} {
+		return &RosterChangeDecision{RosterID: rosterID, Apply: true}
+	}
+	// this server waits for the acknowledgements of the other servers before ending the change
+	var applyErr error
+	err = s.collectAcks(t, participants, apply, func() error {
+		applyErr = s.applyDecidedRosterChange(t)
+		return nil
+	})
+	if applyErr != nil {
+		return fmt.Errorf("%s could not apply the change of roster %s yet (it is retried): %v", s.ServerIdentity(), rosterID, applyErr)
+	}
+	s.endTransition(t)
+	if err != nil {
+		return fmt.Errorf("the change of roster %s is not applied by all the servers yet (they apply it once they are available): %v", rosterID, err)
+	}
+	return nil
+}
+
+// collectAcks sends a message of a roster change to the other servers and runs the corresponding step on this server,
+// it waits for the acknowledgements of the other servers
+func (s *Service) collectAcks(t *rosterTransition, participants *onet.Roster, msg func(*network.ServerIdentity) interface{}, local func() error) error {
+	for _, si := range participants.List {
+		if si.Equal(s.ServerIdentity()) {
+			continue
+		}
+		if err := s.SendRaw(si, msg(si)); err != nil {
+			return err
+		}
+	}
+	if err := local(); err != nil {
+		return err
+	}
+
+	for i := 0; i < len(participants.List)-1; i++ {
+		select {
+		case ack := <-t.acks:
+			if ack.Error != "" {
+				return fmt.Errorf("%s: %s", ack.Server, ack.Error)
+			}
+		case <-time.After(libunlynx.TIMEOUT):
+			return fmt.Errorf("the servers did not acknowledge the change of roster %s on time", t.query.Roster.ID.String())
+		}
+	}
+	return nil
+}
+
+// Query Handlers
+//______________________________________________________________________________________________________________________
+
+// HandleRosterChangeQuery handles the addition (or removal) of this server to (from) the roster of the surveys: the
+// surveys of the roster do not accept queries until all the servers have their new ciphertexts.
+func (s *Service) HandleRosterChangeQuery(query *RosterChangeQuery) (network.Message, error) {
+	log.Lvl1(s.ServerIdentity(), " received a roster change query")
+
+	if query.Server == nil || !query.Server.Equal(s.ServerIdentity()) {
+		return nil, fmt.Errorf("a roster change must be sent to the server added or removed")
+	}
+	t, own, err := s.prepareRosterChange(query)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.runRosterChange(t, own); err != nil {
+		return nil, err
+	}
+	return &RosterChangeResponse{Roster: *t.newRoster}, nil
+}
+
+// HandleRosterChangePrepare handles the message RosterChangePrepare: the server stops accepting queries for the surveys
+// of the roster and sends their ciphertexts to the server coordinating the change
+func (s *Service) HandleRosterChangePrepare(msg *RosterChangePrepare) (network.Message, error) {
+	prepared := RosterChangePrepared{RosterID: msg.Query.Roster.ID.String(), Server: s.ServerIdentity().String()}
+	if msg.Source == nil || msg.Query.Server == nil || !msg.Source.Equal(msg.Query.Server) {
+		return nil, fmt.Errorf("a roster change must be coordinated by the server added or removed")
+	}
+	_, surveys, err := s.prepareRosterChange(&msg.Query)
+	if err != nil {
+		prepared.Refusal = s.ServerIdentity().String() + " refused the roster change: " + err.Error()
+	}
+	prepared.Surveys = surveys
+	return nil, s.SendRaw(msg.Source, &prepared)
+}
+
+// HandleRosterChangePrepared handles the message RosterChangePrepared: one of the servers sent its ciphertexts
+func (s *Service) HandleRosterChangePrepared(msg *RosterChangePrepared) (network.Message, error) {
+	t, err := s.getTransition(msg.RosterID)
+	if err != nil {
+		return nil, err
+	}
+	t.prepared <- *msg
+	return nil, nil
+}
+
+// HandleRosterChangeCommit handles the message RosterChangeCommit sent by the server sender: the server verifies its new
+// ciphertexts
+func (s *Service) HandleRosterChangeCommit(msg *RosterChangeCommit, sender *network.ServerIdentity) (network.Message, error) {
+	t, err := s.getTransition(msg.RosterID)
+	if err != nil {
+		return nil, err
+	}
+	if !t.query.Server.Equal(sender) {
+		return nil, fmt.Errorf("the change of roster %s is not coordinated by %s", msg.RosterID, sender)
+	}
+	ack := RosterChangeAck{RosterID: msg.RosterID, Server: s.ServerIdentity().String()}
+	if err := s.commitRosterChange(t, msg); err != nil {
+		ack.Error = err.Error()
+	}
+	return nil, s.SendRaw(t.query.Server, &ack)
+}
+
+// HandleRosterChangeDecision handles the message RosterChangeDecision sent by the server sender: the server applies (or
+// aborts) the change
+func (s *Service) HandleRosterChangeDecision(msg *RosterChangeDecision, sender *network.ServerIdentity) (network.Message, error) {
+	t, err := s.getTransition(msg.RosterID)
+	if err != nil {
+		return nil, err
+	}
+	if !t.query.Server.Equal(sender) {
+		return nil, fmt.Errorf("the change of roster %s is not coordinated by %s", msg.RosterID, sender)
+	}
+	if !msg.Apply {
+		log.Lvl1(s.ServerIdentity(), " aborts the change of roster ", msg.RosterID)
+	}
+	ack := RosterChangeAck{RosterID: msg.RosterID, Server: s.ServerIdentity().String()}
+	if err := s.decideRosterChange(t, msg.Apply); err != nil {
+		ack.Error = err.Error()
+	}
+	if !msg.Apply {
+		return nil, nil
+	}
+	return nil, s.SendRaw(t.query.Server, &ack)
+}
+
+// HandleRosterChangeAck handles the message RosterChangeAck: one of the servers verified its new ciphertexts or applied
+// the change
+func (s *Service) HandleRosterChangeAck(msg *RosterChangeAck) (network.Message, error) {
+	t, err := s.getTransition(msg.RosterID)
+	if err != nil {
+		return nil, err
+	}
+	t.acks <- *msg
+	return nil, nil
+}
+
+// HandleRosterChangeStatusQuery handles the message RosterChangeStatusQuery sent by the server sender: the server sends
+// back the status of the change, it aborts the change first if it did not stage it
+func (s *Service) HandleRosterChangeStatusQuery(msg *RosterChangeStatusQuery, sender *network.ServerIdentity) (network.Message, error) {
+	s.mutex.Lock()
+	if t, ok := s.transitions[msg.RosterID]; ok && t.staged == nil {
+		if !rosterMember(t.query.participants(), sender) {
+			s.mutex.Unlock()
+			return nil, fmt.Errorf("%s does not take part in the change of roster %s", sender, msg.RosterID)
+		}
+		log.Lvl1(s.ServerIdentity(), " aborts the change of roster ", msg.RosterID, " (asked for its decision)")
+		s.endTransitionLocked(t)
+	}
+	s.mutex.Unlock()
+
+	reply := RosterChangeStatusReply{RosterID: msg.RosterID, Server: s.ServerIdentity().String()}
+	if record, ok := s.RosterChanges.Get(msg.RosterID); ok {
+		reply.Status = record.Status
+	}
+	return nil, s.SendRaw(sender, &reply)
+}
+
+// HandleRosterChangeStatusReply handles the message RosterChangeStatusReply: one of the servers sent the status of the
+// change
+func (s *Service) HandleRosterChangeStatusReply(msg *RosterChangeStatusReply) (network.Message, error) {
+	t, err := s.getTransition(msg.RosterID)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case t.statuses <- *msg:
+	default:
+		log.Warn(s.ServerIdentity(), " ignores the status of the change of roster ", msg.RosterID, " sent by ", msg.Server)
+	}
+	return nil, nil
+}
@@ -0,0 +1,141 @@
+package servicesunlynx_test
+
+import (
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3/util/encoding"
+	"go.dedis.ch/kyber/v3/util/key"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+)
+
+// setAdmin sets an access policy with a new administrator on servers and returns its key pair
+func setAdmin(t *testing.T, local *onet.LocalTest, servers []*onet.Server) *key.Pair {
+	admin := key.NewKeyPair(libunlynx.SuiTe)
+	public, err := encoding.PointToStringHex(libunlynx.SuiTe, admin.Public)
+	require.NoError(t, err)
+	policy, err := servicesunlynx.NewAccessPolicyWithAdmins(nil, []servicesunlynx.AdminKey{{Name: "admin", Public: public}})
+	require.NoError(t, err)
+	for _, service := range local.GetServices(servers, onet.ServiceFactory.ServiceID(servicesunlynx.ServiceName)) {
+		service.(*servicesunlynx.Service).Policy = policy
+	}
+	return admin
+}
+
+func TestServiceRosterChange(t *testing.T) {
+	log.Lvl1("***************************************************************************************************")
+	os.Remove("pre_compute_multiplications.gob")
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+	servers := local.GenServers(5)
+	el := local.GenRosterFromHost(servers[:4]...)
+	defer local.CloseAll()
+	adminKeys := setAdmin(t, local, servers)
+
+	nbrDPs := make(map[string]int64)
+	for _, server := range el.List {
+		nbrDPs[server.String()] = 1
+	}
+	querier := key.NewKeyPair(libunlynx.SuiTe)
+	client := servicesunlynx.NewUnLynxClientWithKeys(el.List[0], strconv.Itoa(0), querier)
+	surveyID, err := client.SendSurveySQLQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, "SELECT SUM(s1), COUNT(*) WHERE w1 = 1 GROUP BY g1", 8, servicesunlynx.SurveyOptions{})
+	require.NoError(t, err)
+
+	sendData := func(i int, server *onet.Server) {
+		dp := servicesunlynx.NewUnLynxClient(server.ServerIdentity, strconv.Itoa(i+1))
+		status, err := dp.SendSurveyDpStatusQuery(*surveyID)
+		require.NoError(t, err)
+		responses := []libunlynx.DpClearResponse{{
+			WhereEnc:                 map[string]int64{"w1": int64(i % 2)},
+			GroupByEnc:               map[string]int64{"g1": int64(i % 3)},
+			AggregatingAttributesEnc: map[string]int64{"s1": int64(i + 1)},
+		}}
+		require.NoError(t, dp.SendSurveyResponseQuery(*surveyID, responses, status.CollectiveKey, 1, status.Count, nil, nil, nil, nil))
+	}
+	for i, server := range servers[:4] {
+		sendData(i, server)
+	}
+
+	// the change must be signed by the server removed and by an administrator
+	admin := servicesunlynx.NewUnLynxClientWithKeys(el.List[3], "admin", adminKeys)
+	_, err = admin.SendRosterChangeQuery(el, local.GetPrivate(servers[0]), false)
+	assert.Error(t, err)
+	_, err = servicesunlynx.NewUnLynxClient(el.List[3], "admin").SendRosterChangeQuery(el, local.GetPrivate(servers[3]), false)
+	assert.Error(t, err)
+
+	// the data of the server removed is taken over by the first server
+	roster, err := admin.SendRosterChangeQuery(el, local.GetPrivate(servers[3]), false)
+	require.NoError(t, err)
+	assert.Equal(t, 3, len(roster.List))
+	_, err = admin.SendSurveyStatusQuery(*surveyID)
+	assert.Error(t, err)
+
+	_, err = servicesunlynx.NewUnLynxClientWithKeys(roster.List[0], "admin", adminKeys).SendRosterChangeQuery(roster, local.GetPrivate(servers[0]), true)
+	assert.Error(t, err, "the server is already in the roster")
+
+	admin = servicesunlynx.NewUnLynxClientWithKeys(servers[4].ServerIdentity, "admin", adminKeys)
+	roster, err = admin.SendRosterChangeQuery(roster, local.GetPrivate(servers[4]), true)
+	require.NoError(t, err)
+	assert.Equal(t, 4, len(roster.List))
+
+	for i, server := range roster.List {
+		status, err := servicesunlynx.NewUnLynxClientWithKeys(server, "status", querier).SendSurveyStatusQuery(*surveyID)
+		require.NoError(t, err)
+		assert.True(t, status.CollectiveKey.Equal(roster.Aggregate))
+		if i == 0 {
+			assert.Equal(t, int64(2), status.DpReceived)
+			assert.Equal(t, int64(2), status.DpExpected)
+		}
+	}
+
+	// the server added receives data encrypted under the new collective key
+	sendData(5, servers[4])
+
+	// the data providers 1, 3 and 5 (groups 1, 0 and 2) match the where condition
+	grp, aggr, err := client.SendSurveyResultsQuery(*surveyID)
+	require.NoError(t, err)
+	results := make(map[int64][]int64)
+	for i := range *grp {
+		results[(*grp)[i][0]] = (*aggr)[i]
+	}
+	assert.Equal(t, map[int64][]int64{0: {4, 1}, 1: {2, 1}, 2: {6, 1}}, results)
+}
+
+func TestServiceRosterChangeTimeout(t *testing.T) {
+	log.Lvl1("***************************************************************************************************")
+	os.Remove("pre_compute_multiplications.gob")
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+	servers := local.GenServers(3)
+	el := local.GenRosterFromHost(servers[:2]...)
+	defer local.CloseAll()
+
+	timeout := servicesunlynx.RosterChangeTimeout
+	servicesunlynx.RosterChangeTimeout = time.Second
+	defer func() { servicesunlynx.RosterChangeTimeout = timeout }()
+	admin := setAdmin(t, local, servers)
+
+	// the server added prepares the change on the first server of the roster and does not coordinate it
+	query := servicesunlynx.RosterChangeQuery{Roster: *el, Server: servers[2].ServerIdentity, Add: true}
+	require.NoError(t, query.Sign(local.GetPrivate(servers[2])))
+	require.NoError(t, query.SignAdmin(admin.Private))
+	_, err := servers[2].Send(servers[0].ServerIdentity, &servicesunlynx.RosterChangePrepare{Query: query, Source: servers[2].ServerIdentity})
+	require.NoError(t, err)
+
+	nbrDPs := map[string]int64{el.List[0].String(): 1, el.List[1].String(): 1}
+	client := servicesunlynx.NewUnLynxClient(el.List[0], strconv.Itoa(0))
+	require.Eventually(t, func() bool {
+		_, err := client.SendSurveySQLQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, "SELECT SUM(s1)", 8, servicesunlynx.SurveyOptions{})
+		return err != nil
+	}, time.Second, 10*time.Millisecond, "the roster is being changed")
+
+	// the first server ends the change at its deadline
+	time.Sleep(2 * servicesunlynx.RosterChangeTimeout)
+	_, err = client.SendSurveySQLQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, "SELECT SUM(s1)", 8, servicesunlynx.SurveyOptions{})
+	assert.NoError(t, err)
+}
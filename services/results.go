@@ -0,0 +1,160 @@
+package servicesunlynx
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ldsec/unlynx/lib"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/sign/schnorr"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+)
+
+// ResultTTL is the time during which the results of a survey are kept by the server once they are computed, if they
+// are not fetched before.
+var ResultTTL = time.Hour
+
+func init() {
+	network.RegisterMessage(&SurveyResultFetch{})
+}
+
+// SurveyResultFetch is used by the querier to get the results of a survey once they are computed (see
+// SurveyResultsQuery). It is signed with the private key of the key to which the results are switched, together with
+// the Timestamp (unix nanoseconds) at which it is signed: a server only accepts a fetch signed after the last one it
+// accepted for the survey, so that a fetch cannot be replayed.
+type SurveyResultFetch struct {
+	SurveyID  SurveyID
+	Timestamp int64
+	Signature []byte
+}
+
+// Asynchronous results
+//______________________________________________________________________________________________________________________
+
+// signedMessage returns the message signed by the querier: the survey whose results are fetched and the timestamp
+func (recq *SurveyResultFetch) signedMessage() ([]byte, error) {
+	h := newSignedMessageHash("results fetch")
+	h.writeString(string(recq.SurveyID))
+	h.writeInt(recq.Timestamp)
+	return h.sum()
+}
+
+// Sign signs the request with the private key matching the key to which the results are switched
+func (recq *SurveyResultFetch) Sign(private kyber.Scalar) error {
+	recq.Timestamp = time.Now().UnixNano()
+	msg, err := recq.signedMessage()
+	if err != nil {
+		return err
+	}
+	recq.Signature, err = schnorr.Sign(libunlynx.SuiTe, private, msg)
+	return err
+}
+
+// computeResults runs the protocols of a survey on the server that received its results query and keeps the results
+// (or the error) until they are fetched
+func (s *Service) computeResults(targetSurvey SurveyID) {
+	err := s.StartService(targetSurvey, true)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	survey, tmpErr := s.getSurvey(targetSurvey)
+	if tmpErr != nil {
+		// the survey was cancelled or removed in the meantime
+		log.Error(tmpErr)
+		return
+	}
+	var results []libunlynx.FilteredResponse
+	if err == nil {
+		results, err = survey.PullDeliverableResults(false, nil)
+	}
+	if err != nil {
+		log.Error(s.ServerIdentity(), " could not compute the results of survey ", targetSurvey, ": ", err)
+		survey.ResultError = err.Error()
+	} else {
+		log.Lvl1(s.ServerIdentity(), " completed the query processing...")
+		survey.Result = &ServiceResult{Results: results, Types: survey.Query.resultTypes(), Columns: survey.Query.Sum,
+			Operations: survey.Query.Operations, Participants: survey.Participants}
+	}
+	if err := s.putSurvey(targetSurvey, survey); err != nil {
+		log.Error(err)
+		return
+	}
+	s.scheduleResultsExpiration(targetSurvey)
+}
+
+// scheduleResultsExpiration releases the results of a survey that are not fetched ResultTTL after they are computed
+func (s *Service) scheduleResultsExpiration(sid SurveyID) {
+	time.AfterFunc(ResultTTL, func() {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		survey, err := s.getSurvey(sid)
+		if err != nil || survey.ResultReleased {
+			return
+		}
+		log.Lvl1(s.ServerIdentity(), " releases the expired results of survey ", sid)
+		survey.releaseResults()
+		if err := s.putSurvey(sid, survey); err != nil {
+			log.Error(err)
+		}
+	})
+}
+
+// releaseResults deletes the results of a survey, they cannot be fetched anymore
+func (surv *Survey) releaseResults() {
+	surv.Result = nil
+	surv.ResultError = ""
+	surv.ResultReleased = true
+}
+
+// HandleSurveyResultFetch handles the request for the results of a survey: the results if they are computed (they are
+// then released) or the phase of the survey if they are pending.
+func (s *Service) HandleSurveyResultFetch(recq *SurveyResultFetch) (network.Message, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	survey, err := s.getSurvey(recq.SurveyID)
+	if err != nil {
+		return nil, err
+	}
+	if survey.Query.ClientPubKey == nil {
+		return nil, fmt.Errorf("the results of survey %s were not requested", recq.SurveyID)
+	}
+	if err := checkTimestamp(recq.Timestamp); err != nil {
+		return nil, err
+	}
+	msg, err := recq.signedMessage()
+	if err != nil {
+		return nil, err
+	}
+	if err := schnorr.Verify(libunlynx.SuiTe, survey.Query.ClientPubKey, msg, recq.Signature); err != nil {
+		return nil, fmt.Errorf("wrong signature of the results fetch: %v", err)
+	}
+	if recq.Timestamp <= survey.LastFetch {
+		return nil, fmt.Errorf("the results fetch of survey %s was signed before the last one (it is replayed)", recq.SurveyID)
+	}
+	survey.LastFetch = recq.Timestamp
+
+	switch {
+	case survey.ResultReleased:
+		return nil, fmt.Errorf("the results of survey %s were already fetched or expired", recq.SurveyID)
+	case survey.ResultError != "":
+		return nil, fmt.Errorf("the results of survey %s could not be computed: %s", recq.SurveyID, survey.ResultError)
+	case survey.Result == nil:
+		if survey.Phase == PhaseAborted {
+			return nil, fmt.Errorf("survey %s was aborted", recq.SurveyID)
+		}
+		// the time of the last fetch is only kept in memory (see restoreSurveys)
+		if _, err := s.Survey.Put(string(recq.SurveyID), survey); err != nil {
+			return nil, err
+		}
+		return &ServiceResult{Pending: true, Phase: survey.Phase}, nil
+	}
+
+	result := *survey.Result
+	survey.releaseResults()
+	if err := s.putSurvey(recq.SurveyID, survey); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
@@ -0,0 +1,111 @@
+package servicesunlynx_test
+
+import (
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3/util/key"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+)
+
+func TestServiceResultFetch(t *testing.T) {
+	log.Lvl1("***************************************************************************************************")
+	os.Remove("pre_compute_multiplications.gob")
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+	_, el, _ := local.GenTree(3, true)
+	defer local.CloseAll()
+
+	ttl := servicesunlynx.ResultTTL
+	defer func() { servicesunlynx.ResultTTL = ttl }()
+
+	keys := key.NewKeyPair(libunlynx.SuiTe)
+	client := servicesunlynx.NewUnLynxClientWithKeys(el.List[0], strconv.Itoa(0), keys)
+	nbrDPs := make(map[string]int64)
+	for _, server := range el.List {
+		nbrDPs[server.String()] = 1
+	}
+	sendData := func(surveyID servicesunlynx.SurveyID, i int) {
+		dp := servicesunlynx.NewUnLynxClient(el.List[i], strconv.Itoa(i+1))
+		responses := []libunlynx.DpClearResponse{{AggregatingAttributesEnc: map[string]int64{"s1": int64(i + 1)}}}
+		require.NoError(t, dp.SendSurveyResponseQuery(surveyID, responses, el.Aggregate, 1, true, nil, nil, nil, nil))
+	}
+	newSurvey := func() servicesunlynx.SurveyID {
+		surveyID, err := client.SendSurveySQLQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, "SELECT SUM(s1), COUNT(*)", 8, servicesunlynx.SurveyOptions{})
+		require.NoError(t, err)
+		for i := range el.List {
+			sendData(*surveyID, i)
+		}
+		return *surveyID
+	}
+	fetch := func(surveyID servicesunlynx.SurveyID) (*servicesunlynx.ServiceResult, error) {
+		resp, err := client.SendSurveyResultFetch(surveyID)
+		for err == nil && resp.Pending {
+			time.Sleep(100 * time.Millisecond)
+			resp, err = client.SendSurveyResultFetch(surveyID)
+		}
+		return resp, err
+	}
+
+	surveyID := newSurvey()
+	_, err := client.SendSurveyResultFetch(surveyID)
+	assert.Error(t, err, "the results are not requested")
+
+	require.NoError(t, client.StartSurveyResultsQuery(surveyID))
+	assert.Error(t, client.StartSurveyResultsQuery(surveyID), "the results are already requested")
+
+	// only the owner of the key to which the results are switched can fetch them
+	_, err = servicesunlynx.NewUnLynxClient(el.List[0], "other").SendSurveyResultFetch(surveyID)
+	assert.Error(t, err)
+
+	resp, err := fetch(surveyID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), resp.Participants)
+	require.Len(t, resp.Results, 1)
+
+	// the results are released once fetched
+	_, err = client.SendSurveyResultFetch(surveyID)
+	assert.Error(t, err)
+
+	// a fetch cannot be replayed, e.g. to release the results once they are computed
+	replayed, err := client.SendSurveySQLQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, "SELECT SUM(s1), COUNT(*)", 8, servicesunlynx.SurveyOptions{})
+	require.NoError(t, err)
+	sendData(*replayed, 0)
+	sendData(*replayed, 1)
+	require.NoError(t, client.StartSurveyResultsQuery(*replayed))
+	older := servicesunlynx.SurveyResultFetch{SurveyID: *replayed}
+	require.NoError(t, older.Sign(keys.Private))
+	poll := servicesunlynx.SurveyResultFetch{SurveyID: *replayed}
+	require.NoError(t, poll.Sign(keys.Private))
+	pending := servicesunlynx.ServiceResult{}
+	require.NoError(t, client.SendProtobuf(el.List[0], &poll, &pending))
+	assert.True(t, pending.Pending, "the data of a data provider is missing")
+	sendData(*replayed, 2)
+	assert.Error(t, client.SendProtobuf(el.List[0], &poll, &pending))
+	assert.Error(t, client.SendProtobuf(el.List[0], &older, &pending), "signed before the last fetch")
+	resp, err = fetch(*replayed)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), resp.Participants)
+
+	// the results are also released once they expire
+	servicesunlynx.ResultTTL = 100 * time.Millisecond
+	surveyID = newSurvey()
+	require.NoError(t, client.StartSurveyResultsQuery(surveyID))
+	for {
+		status, err := client.SendSurveyStatusQuery(surveyID)
+		require.NoError(t, err)
+		if status.Phase == servicesunlynx.PhaseFinished {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	time.Sleep(time.Second)
+	_, err = client.SendSurveyResultFetch(surveyID)
+	assert.Error(t, err)
+}
@@ -0,0 +1,326 @@
+package servicesunlynx
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/ldsec/unlynx/data"
+	"github.com/ldsec/unlynx/lib"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/sign/schnorr"
+	"go.etcd.io/bbolt"
+)
+
+// schemaBucket is the name of the bucket, in the conode database, where the schemas of the datasets are persisted
+var schemaBucket = []byte("schemas")
+
+// SchemaRegistration is used to register (or replace) the schema of a dataset on a server. It must be signed by an
+// administrator of the server (see AccessPolicy): Admin is its public key and Signature its signature of the schema
+// and of the Timestamp (unix nanoseconds) at which it is signed.
+type SchemaRegistration struct {
+	Schema dataunlynx.Schema
+
+	Admin     kyber.Point
+	Timestamp int64
+	Signature []byte
+}
+
+// SchemaQuery is used to get the schema of a dataset from a server.
+type SchemaQuery struct {
+	Dataset string
+}
+
+// SchemaResponse contains the schema of a dataset.
+type SchemaResponse struct {
+	Schema dataunlynx.Schema
+}
+
+// SchemaRegistry keeps the schemas of the datasets known by a server, they are used to validate the surveys on these
+// datasets and the responses of the data providers.
+type SchemaRegistry struct {
+	mutex  sync.Mutex
+	db     *bbolt.DB
+	bucket []byte
+
+	schemas map[string]dataunlynx.Schema
+}
+
+// NewSchemaRegistry constructor of a SchemaRegistry, it is persisted (in TOML) in a BoltDB bucket (created if it does
+// not exist) or only kept in memory if db is nil.
+func NewSchemaRegistry(db *bbolt.DB, bucket []byte) (*SchemaRegistry, error) {
+	sr := &SchemaRegistry{db: db, bucket: bucket, schemas: make(map[string]dataunlynx.Schema)}
+	if db == nil {
+		return sr, nil
+	}
+
+	err := db.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(bucket)
+		if err != nil {
+			return err
+		}
+		return b.ForEach(func(k, v []byte) error {
+			schema := dataunlynx.Schema{}
+			if _, err := toml.Decode(string(v), &schema); err != nil {
+				return err
+			}
+			sr.schemas[string(k)] = schema
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not load the schemas: %v", err)
+	}
+	return sr, nil
+}
+
+// Register validates and registers the schema of a dataset, replacing the previous one
+func (sr *SchemaRegistry) Register(schema dataunlynx.Schema) error {
+	if schema.Dataset == "" {
+		return fmt.Errorf("the schema does not name its dataset")
+	}
+	if err := schema.Validate(); err != nil {
+		return err
+	}
+
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
+
+	if sr.db != nil {
+		var buf bytes.Buffer
+		if err := toml.NewEncoder(&buf).Encode(schema); err != nil {
+			return err
+		}
+		err := sr.db.Update(func(tx *bbolt.Tx) error {
+			return tx.Bucket(sr.bucket).Put([]byte(schema.Dataset), buf.Bytes())
+		})
+		if err != nil {
+			return fmt.Errorf("could not store the schema: %v", err)
+		}
+	}
+	sr.schemas[schema.Dataset] = schema
+	return nil
+}
+
+// Get returns the schema of a dataset, if it is registered
+func (sr *SchemaRegistry) Get(dataset string) (dataunlynx.Schema, bool) {
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
+	schema, ok := sr.schemas[dataset]
+	return schema, ok
+}
+
+// signedMessage returns the message signed by the administrator: the schema (in TOML) and the timestamp
+func (recq *SchemaRegistration) signedMessage() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(recq.Schema); err != nil {
+		return nil, err
+	}
+	h := newSignedMessageHash("schema registration")
+	h.writeBytes(buf.Bytes())
+	h.writeInt(recq.Timestamp)
+	return h.sum()
+}
+
+// Sign signs the registration with the long-term private key of an administrator
+func (recq *SchemaRegistration) Sign(private kyber.Scalar) error {
+	recq.Admin = libunlynx.SuiTe.Point().Mul(private, nil)
+	recq.Timestamp = time.Now().UnixNano()
+	msg, err := recq.signedMessage()
+	if err != nil {
+		return err
+	}
+	recq.Signature, err = schnorr.Sign(libunlynx.SuiTe, private, msg)
+	return err
+}
+
+// authorize checks that the registration was recently signed by an administrator of the policy
+func (recq *SchemaRegistration) authorize(policy *AccessPolicy) error {
+	if recq.Admin == nil || len(recq.Signature) == 0 {
+		return fmt.Errorf("the schema registration is not signed")
+	}
+	if _, ok := policy.admin(recq.Admin); !ok {
+		return fmt.Errorf("%s is not an administrator of the server", recq.Admin.String())
+	}
+	if err := checkTimestamp(recq.Timestamp); err != nil {
+		return err
+	}
+	msg, err := recq.signedMessage()
+	if err != nil {
+		return err
+	}
+	if err := schnorr.Verify(libunlynx.SuiTe, recq.Admin, msg, recq.Signature); err != nil {
+		return fmt.Errorf("wrong signature of the schema registration: %v", err)
+	}
+	return nil
+}
+
+// Lookup returns the schema of the dataset of a survey. Once a schema is registered, the surveys must be on a registered
+// dataset: ok is only false if no schema is registered at all.
+func (sr *SchemaRegistry) Lookup(dataset string) (schema dataunlynx.Schema, ok bool, err error) {
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
+	if len(sr.schemas) == 0 {
+		return dataunlynx.Schema{}, false, nil
+	}
+	schema, ok = sr.schemas[dataset]
+	if !ok {
+		return dataunlynx.Schema{}, false, fmt.Errorf("unknown dataset '%s' (the surveys must be on a registered dataset)", dataset)
+	}
+	return schema, true, nil
+}
+
+// Validation
+//______________________________________________________________________________________________________________________
+
+// schemaAttribute returns the attribute of a schema with a given name and checks its role
+func schemaAttribute(schema *dataunlynx.Schema, name, role string) (dataunlynx.SchemaAttribute, error) {
+	sa, ok := schema.Attribute(name)
+	if !ok {
+		return sa, fmt.Errorf("unknown attribute %s in dataset %s", name, schema.Dataset)
+	}
+	if sa.Role != role {
+		return sa, fmt.Errorf("attribute %s of dataset %s cannot be used as a %s attribute", name, schema.Dataset, role)
+	}
+	return sa, nil
+}
+
+// validateSchema checks that a query only uses the attributes of the schema of its dataset, in their role, with their
+// type and number of bits (ranges)
+func (query *SurveyCreationQuery) validateSchema(schema *dataunlynx.Schema) error {
+	for _, name := range query.GroupBy {
+		if _, err := schemaAttribute(schema, name, dataunlynx.RoleGroupBy); err != nil {
+			return err
+		}
+	}
+	for _, w := range query.Where {
+		if _, err := schemaAttribute(schema, w.Name, dataunlynx.RoleWhere); err != nil {
+			return err
+		}
+	}
+	for _, wr := range query.WhereRange {
+		sa, err := schemaAttribute(schema, wr.Name, dataunlynx.RoleWhere)
+		if err != nil {
+			return err
+		}
+		if sa.Bits != wr.Bits {
+			return fmt.Errorf("attribute %s is compared with ranges of %d bits", wr.Name, sa.Bits)
+		}
+	}
+
+	for i, column := range query.Sum {
+		if column == libunlynx.CountAttribute && query.Count {
+			continue
+		}
+		name, square := libunlynx.SquareOf(column)
+		if !square {
+			name = column
+		}
+		sa, err := schemaAttribute(schema, name, dataunlynx.RoleAggregate)
+		if err != nil {
+			return err
+		}
+		expected, err := sa.AttributeType()
+		if err != nil {
+			return err
+		}
+		if square {
+			expected = libunlynx.SquareType(expected)
+		}
+		actual := libunlynx.AttributeType{}
+		if len(query.Types) > 0 {
+			actual = query.Types[i]
+		}
+		if actual.String() != expected.String() {
+			return fmt.Errorf("attribute %s has the type %s, not %s", column, expected.String(), actual.String())
+		}
+	}
+	return nil
+}
+
+// checkResponseAttributes checks that the attributes of a map of a response are in the schema, with a given role and
+// protection (clear or encrypted). The clear values must be in the domain of their attribute.
+func checkResponseAttributes(schema *dataunlynx.Schema, role string, encrypted bool, names []string, clear map[string]int64) error {
+	for _, name := range names {
+		attribute := name
+		switch role {
+		case dataunlynx.RoleWhere:
+			// prefixes of an attribute compared with ranges
+			if i := strings.LastIndex(name, "#"); i >= 0 {
+				attribute = name[:i]
+			}
+		case dataunlynx.RoleAggregate:
+			if name == libunlynx.CountAttribute {
+				continue
+			}
+			if squared, ok := libunlynx.SquareOf(name); ok {
+				attribute = squared
+			}
+		}
+
+		sa, err := schemaAttribute(schema, attribute, role)
+		if err != nil {
+			return err
+		}
+		if sa.Encrypted != encrypted {
+			if sa.Encrypted {
+				return fmt.Errorf("attribute %s must be encrypted", attribute)
+			}
+			return fmt.Errorf("attribute %s must be in clear", attribute)
+		}
+		if v, ok := clear[name]; ok && attribute == name && !sa.InDomain(float64(v)) {
+			return fmt.Errorf("value %d is out of the domain of attribute %s", v, name)
+		}
+	}
+	return nil
+}
+
+// checkResponse checks that a response of a data provider conforms to the schema of the dataset and has a value for
+// each aggregated column (columns)
+func checkResponse(schema *dataunlynx.Schema, dr libunlynx.DpResponseToSend, columns []string) error {
+	for _, column := range columns {
+		_, clear := dr.AggregatingAttributesClear[column]
+		_, encrypted := dr.AggregatingAttributesEnc[column]
+		if !clear && !encrypted {
+			return fmt.Errorf("no value for the aggregated column %s", column)
+		}
+	}
+
+	keys := func(m map[string]int64) []string {
+		names := make([]string, 0, len(m))
+		for k := range m {
+			names = append(names, k)
+		}
+		return names
+	}
+	encKeys := func(m map[string][]byte) []string {
+		names := make([]string, 0, len(m))
+		for k := range m {
+			names = append(names, k)
+		}
+		return names
+	}
+
+	checks := []struct {
+		role      string
+		encrypted bool
+		names     []string
+		clear     map[string]int64
+	}{
+		{dataunlynx.RoleGroupBy, false, keys(dr.GroupByClear), dr.GroupByClear},
+		{dataunlynx.RoleGroupBy, true, encKeys(dr.GroupByEnc), nil},
+		{dataunlynx.RoleWhere, false, keys(dr.WhereClear), dr.WhereClear},
+		{dataunlynx.RoleWhere, true, encKeys(dr.WhereEnc), nil},
+		{dataunlynx.RoleAggregate, false, keys(dr.AggregatingAttributesClear), dr.AggregatingAttributesClear},
+		{dataunlynx.RoleAggregate, true, encKeys(dr.AggregatingAttributesEnc), nil},
+	}
+	for _, c := range checks {
+		if err := checkResponseAttributes(schema, c.role, c.encrypted, c.names, c.clear); err != nil {
+			return err
+		}
+	}
+	return nil
+}
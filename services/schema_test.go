@@ -0,0 +1,136 @@
+package servicesunlynx_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/ldsec/unlynx/data"
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3/util/encoding"
+	"go.dedis.ch/kyber/v3/util/key"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	"go.etcd.io/bbolt"
+)
+
+var testSchema = dataunlynx.Schema{
+	Dataset: "patients",
+	Attributes: []dataunlynx.SchemaAttribute{
+		{Name: "g1", Role: dataunlynx.RoleGroupBy, Encrypted: true, Domain: []int64{0, 1}},
+		{Name: "w1", Role: dataunlynx.RoleWhere, Encrypted: true, Bits: 8, Sensitive: true},
+		{Name: "w2", Role: dataunlynx.RoleWhere, Domain: []int64{0, 9}},
+		{Name: "s1", Role: dataunlynx.RoleAggregate, Encrypted: true, Type: "fixed:1"},
+	},
+}
+
+func TestSchemaRegistry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unlynx")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	db, err := bbolt.Open(filepath.Join(dir, "schema.db"), 0600, nil)
+	require.NoError(t, err)
+	defer db.Close()
+
+	registry, err := servicesunlynx.NewSchemaRegistry(db, []byte("schemas"))
+	require.NoError(t, err)
+	require.NoError(t, registry.Register(testSchema))
+	assert.Error(t, registry.Register(dataunlynx.Schema{Attributes: testSchema.Attributes}))
+	assert.Error(t, registry.Register(dataunlynx.Schema{Dataset: "wrong", Attributes: []dataunlynx.SchemaAttribute{{Name: "w1", Role: "select"}}}))
+
+	_, ok := registry.Get("wrong")
+	assert.False(t, ok)
+
+	// the schemas are restored from the database
+	registry, err = servicesunlynx.NewSchemaRegistry(db, []byte("schemas"))
+	require.NoError(t, err)
+	schema, ok := registry.Get("patients")
+	require.True(t, ok)
+	assert.Equal(t, testSchema, schema)
+}
+
+func TestServiceSchema(t *testing.T) {
+	log.Lvl1("***************************************************************************************************")
+	os.Remove("pre_compute_multiplications.gob")
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+	servers, el, _ := local.GenTree(3, true)
+	defer local.CloseAll()
+
+	// the schemas are registered by an administrator of the servers
+	admin := key.NewKeyPair(libunlynx.SuiTe)
+	public, err := encoding.PointToStringHex(libunlynx.SuiTe, admin.Public)
+	require.NoError(t, err)
+	policy, err := servicesunlynx.NewAccessPolicyWithAdmins(nil, []servicesunlynx.AdminKey{{Name: "admin", Public: public}})
+	require.NoError(t, err)
+	for _, service := range local.GetServices(servers, onet.ServiceFactory.ServiceID(servicesunlynx.ServiceName)) {
+		service.(*servicesunlynx.Service).Policy = policy
+	}
+
+	client := servicesunlynx.NewUnLynxClient(el.List[0], strconv.Itoa(0))
+	assert.Error(t, client.SendSchemaRegistration(el, testSchema))
+	require.NoError(t, servicesunlynx.NewUnLynxClientWithKeys(el.List[0], "admin", admin).SendSchemaRegistration(el, testSchema))
+
+	schema, err := servicesunlynx.NewUnLynxClient(el.List[2], strconv.Itoa(0)).SendSchemaQuery("patients")
+	require.NoError(t, err)
+	assert.Equal(t, testSchema, *schema)
+	_, err = client.SendSchemaQuery("unknown")
+	assert.Error(t, err)
+
+	nbrDPs := make(map[string]int64)
+	for _, server := range el.List {
+		nbrDPs[server.String()] = 1
+	}
+	types := map[string]libunlynx.AttributeType{"s1": {Kind: libunlynx.TypeFixed, Scale: 1}}
+
+	// unknown attribute, attribute used in another role, wrong type and wrong number of bits
+	for _, query := range []string{
+		"SELECT SUM(s1) FROM patients WHERE w3 = 1",
+		"SELECT SUM(s1) FROM patients GROUP BY w2",
+		"SELECT SUM(w1) FROM patients",
+		"SELECT SUM(s1) FROM unknown",
+		"SELECT SUM(s1)",
+	} {
+		_, err := client.SendSurveySQLQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, query, 8, servicesunlynx.SurveyOptions{Types: types})
+		assert.Error(t, err, query)
+	}
+	_, err = client.SendSurveySQLQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, "SELECT SUM(s1) FROM patients", 8, servicesunlynx.SurveyOptions{})
+	assert.Error(t, err)
+	_, err = client.SendSurveySQLQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, "SELECT SUM(s1) FROM patients WHERE w1 >= 30", 16, servicesunlynx.SurveyOptions{Types: types})
+	assert.Error(t, err)
+
+	surveyID, err := client.SendSurveySQLQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, "SELECT SUM(s1) FROM patients WHERE w1 >= 30 AND w2 = 3 GROUP BY g1", 8, servicesunlynx.SurveyOptions{Types: types})
+	require.NoError(t, err)
+
+	for i, server := range el.List {
+		dp := servicesunlynx.NewUnLynxClient(server, strconv.Itoa(i+1))
+		status, err := dp.SendSurveyDpStatusQuery(*surveyID)
+		require.NoError(t, err)
+
+		// sensitive attribute sent in clear, value out of the domain and missing aggregated attribute
+		for _, response := range []libunlynx.DpClearResponse{
+			{GroupByEnc: map[string]int64{"g1": 0}, WhereClear: map[string]int64{"w1": 42, "w2": 3}, AggregatingAttributesDec: map[string]float64{"s1": 71.5}},
+			{GroupByEnc: map[string]int64{"g1": 0}, WhereEnc: map[string]int64{"w1": 42}, WhereClear: map[string]int64{"w2": 10}, AggregatingAttributesDec: map[string]float64{"s1": 71.5}},
+			{GroupByEnc: map[string]int64{"g1": 0}, WhereEnc: map[string]int64{"w1": 42}, WhereClear: map[string]int64{"w2": 3}},
+		} {
+			err := dp.SendSurveyResponseQuery(*surveyID, []libunlynx.DpClearResponse{response}, el.Aggregate, 1, status.Count, status.TypesByName(), status.Operations, status.RangeBits, status.Bounds)
+			assert.Error(t, err)
+		}
+
+		responses := []libunlynx.DpClearResponse{
+			{GroupByEnc: map[string]int64{"g1": 0}, WhereEnc: map[string]int64{"w1": 42}, WhereClear: map[string]int64{"w2": 3}, AggregatingAttributesDec: map[string]float64{"s1": 71.5}},
+			{GroupByEnc: map[string]int64{"g1": 0}, WhereEnc: map[string]int64{"w1": 20}, WhereClear: map[string]int64{"w2": 3}, AggregatingAttributesDec: map[string]float64{"s1": 90}},
+		}
+		require.NoError(t, dp.SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, status.Count, status.TypesByName(), status.Operations, status.RangeBits, status.Bounds))
+	}
+
+	results, err := client.SendSurveyTypedResultsQuery(*surveyID)
+	require.NoError(t, err)
+	require.Len(t, results.Statistics, 1)
+	assert.InDeltaSlice(t, []float64{214.5}, results.Statistics[0], 1e-9)
+}
@@ -1,18 +1,21 @@
 package servicesunlynx
 
 import (
+	"errors"
 	"fmt"
 	"golang.org/x/xerrors"
 	"strconv"
+	"sync"
 	"time"
 
-	"github.com/Knetic/govaluate"
 	"github.com/fanliao/go-concurrentMap"
 	"github.com/ldsec/unlynx/data"
 	"github.com/ldsec/unlynx/lib"
 	"github.com/ldsec/unlynx/lib/aggregation"
+	"github.com/ldsec/unlynx/lib/deterministic_tag"
 	"github.com/ldsec/unlynx/lib/differential_privacy"
 	"github.com/ldsec/unlynx/lib/key_switch"
+	"github.com/ldsec/unlynx/lib/range"
 	"github.com/ldsec/unlynx/lib/shuffle"
 	"github.com/ldsec/unlynx/lib/store"
 	"github.com/ldsec/unlynx/lib/tools"
@@ -27,7 +30,8 @@ import (
 // ServiceName is the registered name for the unlynx service.
 const ServiceName = "UnLynx"
 
-const gobFile = "pre_compute_multiplications.gob"
+// SurveyTTL is the time after which a survey is removed from the servers, whatever its phase.
+var SurveyTTL = 24 * time.Hour
 
 // SurveyID unique ID for each survey.
 type SurveyID string
@@ -39,33 +43,99 @@ type SurveyCreationQuery struct {
 	ClientPubKey kyber.Point
 	MapDPs       map[string]int64
 	Proofs       bool
+	// Deadline is the time (in unix nanoseconds) after which the servers stop collecting data, if it is set, and Quorum
+	// the minimum number of data providers (of all the servers) that must have sent their data by then
+	Deadline int64
+	Quorum   int64
+	// ExpectedRows is the number of response rows that the data providers are expected to send (all together), the
+	// servers precompute the values needed to shuffle them during the collection (see expectedRows)
+	ExpectedRows int64
 	AppFlag      bool
 	IntraMessage bool
 	Source       *network.ServerIdentity
 
+	// Suite is the name of the suite of the keys and the ciphertexts of the survey (see libunlynx.SetSuite), the servers
+	// reject the queries built with another suite than theirs
+	Suite string
+
+	// CollectiveKey is the key under which the data is encrypted if it is generated by the servers with a DKG (see
+	// SendDKGQuery), the aggregate key of the roster is used if it is nil. The results are then switched to the key of
+	// the querier as soon as enough servers (the threshold of the key) contributed.
+	CollectiveKey kyber.Point
+
+	// Querier is the long-term public key of the querier and Signature its signature of the query (see Sign)
+	Querier   kyber.Point
+	Signature []byte
+
 	// query statement
+	Dataset   string
 	Sum       []string
 	Count     bool
 	Where     []libunlynx.WhereQueryAttribute
 	Predicate string
 	GroupBy   []string
+	// range conditions on where attributes, the k-th one is the boolean rk in the predicate
+	WhereRange []libunlynx.WhereQueryRange
+	// bounds of the (encoded) values of aggregating attributes, the data providers prove that their encrypted values are
+	// in these bounds (see EffectiveBounds)
+	Bounds []libunlynxrange.Bound
+	// types of the aggregating attributes, in the order of Sum (unsigned integers if it is empty)
+	Types []libunlynx.AttributeType
+	// aggregate operations computed by the querier from the aggregating attributes (the derived columns they need
+	// are in Sum)
+	Operations []libunlynx.Operation
+
+	// differential privacy (DRO phase), disabled if DiffPri.NoiseListSize is 0
+	DiffPri libunlynxdiffprivacy.Params
 }
 
 // Survey represents a survey with the corresponding params
 type Survey struct {
 	*libunlynxstore.Store
-	Query             SurveyCreationQuery
-	SurveySecretKey   kyber.Scalar
-	ShufflePrecompute []libunlynxshuffle.CipherVectorScalar
-	Lengths           [][]int
-	TargetOfSwitch    []libunlynx.ProcessResponse
+	Query           SurveyCreationQuery
+	SurveySecretKey kyber.Scalar
+	Lengths         [][]int
+	TargetOfSwitch  []libunlynx.ProcessResponse
+
+	// Phase is the step of the pipeline reached by the survey and DpReceived the number of data providers that
+	// already sent their data
+	Phase      SurveyPhase
+	DpReceived int64
+	// Participants is the number of data providers of all the servers whose data is used (once the collection is over)
+	Participants int64
+
+	// Result are the results of the survey kept (by the server that received the results query) until they are
+	// fetched, ResultError the reason why they could not be computed and ResultReleased is true once they are fetched
+	// or expired
+	Result         *ServiceResult
+	ResultError    string
+	ResultReleased bool
+	// LastFetch is the timestamp of the last results fetch accepted (see SurveyResultFetch)
+	LastFetch int64
+
+	// DpKeys are the public keys of the data providers that sent a signed submission and DpNonces the nonces of these
+	// submissions (hex)
+	DpKeys   []string
+	DpNonces []string
+
+	// CreationTime is the time (in unix nanoseconds) at which the survey was created on this server
+	CreationTime int64
 
 	// channels
-	SurveyChannel chan int // To wait for the survey to be created before loading data
-	DpChannel     chan int // To wait for all data to be read before starting unlynx service protocol
-	DDTChannel    chan int // To wait for all nodes to finish the tagging before continuing
-
-	Noise libunlynx.CipherText
+	SurveyChannel     chan int                // To wait for the survey to be created before loading data
+	RefusalChannel    chan string             // Receives the refusals of the servers that do not take part in the survey
+	DpChannel         chan int                // To wait for all data to be read before starting unlynx service protocol
+	DDTChannel        chan int                // To wait for all nodes to finish the tagging before continuing
+	CollectionChannel chan CollectionFinished // To wait for all nodes to stop collecting data
+	CancelChannel     chan int                // Closed when the survey is cancelled to unblock the waiting goroutines
+
+	// ProofsRecord keeps track of the proofs published by the servers (when Query.Proofs is set)
+	ProofsRecord *ProofsRecord
+
+	// NoiseValues are the noise values shuffled by the DRO phase and Noise the ones that are added to the results (one
+	// per aggregated value)
+	NoiseValues []float64
+	Noise       libunlynx.CipherVector
 }
 
 // MsgTypes defines the Message Type ID for all the service's intra-messages.
@@ -74,6 +144,16 @@ type MsgTypes struct {
 	msgSurveyResultsQuery     network.MessageTypeID
 	msgDDTfinished            network.MessageTypeID
 	msgQueryBroadcastFinished network.MessageTypeID
+	msgSurveyCancelQuery      network.MessageTypeID
+	msgProofsPublication      network.MessageTypeID
+	msgCollectionFinished     network.MessageTypeID
+	msgRosterChangePrepare    network.MessageTypeID
+	msgRosterChangePrepared   network.MessageTypeID
+	msgRosterChangeCommit     network.MessageTypeID
+	msgRosterChangeDecision   network.MessageTypeID
+	msgRosterChangeAck        network.MessageTypeID
+	msgRosterChangeStatus     network.MessageTypeID
+	msgRosterChangeStatusRep  network.MessageTypeID
 }
 
 var msgTypes = MsgTypes{}
@@ -86,15 +166,35 @@ func init() {
 	msgTypes.msgSurveyResultsQuery = network.RegisterMessage(&SurveyResultsQuery{})
 	msgTypes.msgDDTfinished = network.RegisterMessage(&DDTfinished{})
 	msgTypes.msgQueryBroadcastFinished = network.RegisterMessage(&QueryBroadcastFinished{})
+	msgTypes.msgSurveyCancelQuery = network.RegisterMessage(&SurveyCancelQuery{})
+	msgTypes.msgProofsPublication = network.RegisterMessage(&ProofsPublication{})
+	msgTypes.msgCollectionFinished = network.RegisterMessage(&CollectionFinished{})
+	msgTypes.msgRosterChangePrepare = network.RegisterMessage(&RosterChangePrepare{})
+	msgTypes.msgRosterChangePrepared = network.RegisterMessage(&RosterChangePrepared{})
+	msgTypes.msgRosterChangeCommit = network.RegisterMessage(&RosterChangeCommit{})
+	msgTypes.msgRosterChangeDecision = network.RegisterMessage(&RosterChangeDecision{})
+	msgTypes.msgRosterChangeAck = network.RegisterMessage(&RosterChangeAck{})
+	msgTypes.msgRosterChangeStatus = network.RegisterMessage(&RosterChangeStatusQuery{})
+	msgTypes.msgRosterChangeStatusRep = network.RegisterMessage(&RosterChangeStatusReply{})
 
 	network.RegisterMessage(&SurveyResponseQuery{})
 	network.RegisterMessage(&ServiceState{})
 	network.RegisterMessage(&ServiceResult{})
+	network.RegisterMessage(&SurveyListQuery{})
+	network.RegisterMessage(&SurveyList{})
+	network.RegisterMessage(&SurveyStatusQuery{})
+	network.RegisterMessage(&SurveyStatus{})
+	network.RegisterMessage(&SchemaRegistration{})
+	network.RegisterMessage(&SchemaQuery{})
+	network.RegisterMessage(&SchemaResponse{})
 }
 
-// QueryBroadcastFinished is used to ensure that all servers have received the query/survey
+// QueryBroadcastFinished is used to ensure that all servers have received (and accepted) the query/survey or the
+// results query
 type QueryBroadcastFinished struct {
 	SurveyID SurveyID
+	// Refusal is the reason why the server does not take part in the survey or its results (empty if it does)
+	Refusal string
 }
 
 // DDTfinished is used to ensure that all servers perform the shuffling+DDT before collectively aggregating the results
@@ -106,6 +206,15 @@ type DDTfinished struct {
 type SurveyResponseQuery struct {
 	SurveyID  SurveyID
 	Responses []libunlynx.DpResponseToSend
+	// Suite is the name of the suite in which the responses are encrypted
+	Suite string
+
+	// DpPublic is the long-term public key of the data provider and Signature its signature of the survey ID, the hash
+	// of the responses, the public key of the destination Server and the Nonce (see Sign)
+	DpPublic  kyber.Point
+	Server    kyber.Point
+	Nonce     []byte
+	Signature []byte
 }
 
 // SurveyResultsQuery is used by querier to ask for the response of the survey.
@@ -113,6 +222,8 @@ type SurveyResultsQuery struct {
 	IntraMessage bool
 	SurveyID     SurveyID
 	ClientPublic kyber.Point
+	// Signature is the signature of the querier of the survey (see Sign)
+	Signature []byte
 }
 
 // ServiceState represents the service "state".
@@ -123,36 +234,488 @@ type ServiceState struct {
 // ServiceResult will contain final results of a survey and be sent to querier.
 type ServiceResult struct {
 	Results []libunlynx.FilteredResponse
+	// Types are the types of the aggregating attributes of the results (in the order of the query)
+	Types []libunlynx.AttributeType
+	// Columns are the names of the aggregating attributes and Operations the aggregate operations of the query
+	Columns    []string
+	Operations []libunlynx.Operation
+	// Participants is the number of data providers whose data is in the results
+	Participants int64
+
+	// Pending is true if the results are not computed yet (see SurveyResultFetch), Phase is then the phase of the survey
+	Pending bool
+	Phase   SurveyPhase
+}
+
+// SurveyListQuery is used by a querier to list its surveys known by a server, it is signed by the querier.
+type SurveyListQuery struct {
+	Auth QuerierSignature
+}
+
+// SurveyList contains the status of all the surveys known by a server.
+type SurveyList struct {
+	Surveys []SurveyStatus
+}
+
+// SurveyStatusQuery is used to ask a server in which phase a survey is. The progress of the survey is only given to
+// its querier (the query is then signed by the querier), the data providers only get what they need to send their
+// data.
+type SurveyStatusQuery struct {
+	SurveyID SurveyID
+	Auth     QuerierSignature
+}
+
+// SurveyStatus describes the progress of a survey on a server.
+type SurveyStatus struct {
+	SurveyID SurveyID
+	// Progress is set if the progress of the survey (phase, data providers and creation time) is given, i.e. if the
+	// status is requested by the querier of the survey
+	Progress     bool
+	Phase        SurveyPhase
+	DpReceived   int64
+	DpExpected   int64
+	CreationTime int64
+	// Deadline is the time (in unix nanoseconds) after which the data is not accepted anymore (0 if there is none)
+	Deadline int64
+
+	// what the data providers need to encode their responses: the aggregating attributes (and their types), the
+	// aggregate operations, the number of bits of the where attributes compared with ranges and the bounds of the
+	// aggregating attributes
+	Count      bool
+	Sum        []string
+	Types      []libunlynx.AttributeType
+	Operations []libunlynx.Operation
+	RangeBits  map[string]int64
+	Bounds     []libunlynxrange.Bound
+	// CollectiveKey is the key with which the data providers encrypt their data
+	CollectiveKey kyber.Point
+}
+
+// SurveyCancelQuery is used to cancel a survey and delete it from all the servers of its roster, it is signed by the
+// querier of the survey (or sent by a server of its roster).
+type SurveyCancelQuery struct {
+	SurveyID     SurveyID
+	IntraMessage bool
+	Auth         QuerierSignature
 }
 
 // Service defines a service in unlynx with a survey.
 type Service struct {
 	*onet.ServiceProcessor
-	Survey *concurrent.ConcurrentMap
+	Survey  *concurrent.ConcurrentMap
+	Storage SurveyStorage
+	Budget  *BudgetLedger
+	Schemas *SchemaRegistry
+	// Keys are the shares of the collective keys generated with a DKG
+	Keys *KeyRegistry
+	// RosterChanges are the roster changes staged by this server
+	RosterChanges *RosterChangeLog
+	// Policy is the access policy enforced by this server (Policy by default)
+	Policy *AccessPolicy
+	// Precomputations are the precomputed values for shuffling of this server
+	Precomputations *libunlynxshuffle.PrecomputationPool
+
+	mutex sync.Mutex
+	// transitions are the roster changes in progress, by ID of the roster changed
+	transitions map[string]*rosterTransition
 }
 
+// surveyBucket is the name of the bucket, in the conode database, where the surveys are persisted
+var surveyBucket = []byte("surveys")
+
 func (s *Service) getSurvey(sid SurveyID) (Survey, error) {
 	surv, err := s.Survey.Get(string(sid))
 	if err != nil {
-		return Survey{}, fmt.Errorf("error while getting surveyID "+string(sid)+": %v", err)
+		return Survey{}, fmt.Errorf("error while getting surveyID %s: %v", sid, err)
 	}
 	if surv == nil {
-		return Survey{}, fmt.Errorf("empty map entry while getting surveyID " + string(sid))
+		return Survey{}, fmt.Errorf("empty map entry while getting surveyID %s", sid)
 	}
 	return surv.(Survey), nil
 }
 
 func (s *Service) putSurvey(sid SurveyID, surv Survey) error {
 	_, err := s.Survey.Put(string(sid), surv)
-	return err
+	if err != nil {
+		return err
+	}
+	if s.Storage != nil {
+		return s.Storage.Put(sid, surv.state())
+	}
+	return nil
+}
+
+// setPhase updates (and persists) the phase reached by a survey
+func (s *Service) setPhase(sid SurveyID, phase SurveyPhase) error {
+	survey, err := s.getSurvey(sid)
+	if err != nil {
+		return err
+	}
+	// an aborted survey cannot be resumed
+	if phase != PhaseAborted {
+		if err := survey.ProofsRecord.Failure(); err != nil {
+			return err
+		}
+		if survey.Phase == PhaseAborted {
+			return fmt.Errorf("survey %s was aborted", sid)
+		}
+	}
+	survey.Phase = phase
+	return s.putSurvey(sid, survey)
+}
+
+// status returns the status of the survey as seen by the server si, with its progress or only what the data providers
+// need to send their data
+func (surv *Survey) status(si *network.ServerIdentity, progress bool) SurveyStatus {
+	status := SurveyStatus{
+		SurveyID:   surv.Query.SurveyID,
+		DpExpected: surv.Query.MapDPs[si.String()],
+		Deadline:   surv.Query.Deadline,
+		Count:      surv.Query.Count,
+		Sum:        surv.Query.Sum,
+		Types:      surv.Query.Types,
+		Operations: surv.Query.Operations,
+		RangeBits:  surv.Query.rangeBits(),
+		Bounds:     surv.Query.rangeBounds(),
+
+		CollectiveKey: surv.Query.collectiveKey(),
+	}
+	if progress {
+		status.Progress = true
+		status.Phase = surv.Phase
+		status.DpReceived = surv.DpReceived
+		status.CreationTime = surv.CreationTime
+	}
+	return status
+}
+
+// TypesByName returns the types of the aggregating attributes of a survey by attribute name
+func (status *SurveyStatus) TypesByName() map[string]libunlynx.AttributeType {
+	types := make(map[string]libunlynx.AttributeType, len(status.Types))
+	for i, at := range status.Types {
+		types[status.Sum[i]] = at
+	}
+	return types
+}
+
+// removeSurvey deletes a survey from the server and unblocks the goroutines waiting on it
+func (s *Service) removeSurvey(sid SurveyID) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.deleteSurvey(sid)
+}
+
+// deleteSurvey deletes a survey (the caller holds the lock of the service)
+func (s *Service) deleteSurvey(sid SurveyID) error {
+	survey, err := s.getSurvey(sid)
+	if err != nil {
+		return err
+	}
+	close(survey.CancelChannel)
+	s.Precomputations.Release(string(sid))
+
+	if _, err := s.Survey.Remove(string(sid)); err != nil {
+		return err
+	}
+	if s.Storage != nil {
+		return s.Storage.Delete(sid)
+	}
+	return nil
+}
+
+// errSurveyCancelled is returned by the steps of a survey that is cancelled while they wait
+func errSurveyCancelled(sid SurveyID) error {
+	return fmt.Errorf("survey %s was cancelled", sid)
+}
+
+// state returns the persistable state of the survey
+func (surv *Survey) state() SurveyState {
+	return SurveyState{
+		Query:          surv.Query,
+		Phase:          surv.Phase,
+		DpReceived:     surv.DpReceived,
+		DpKeys:         surv.DpKeys,
+		DpNonces:       surv.DpNonces,
+		Result:         surv.Result,
+		ResultError:    surv.ResultError,
+		ResultReleased: surv.ResultReleased,
+		CreationTime:   surv.CreationTime,
+		Store:          surv.Snapshot(),
+	}
+}
+
+// validateTypes checks the types of the aggregating attributes of a query
+func (query *SurveyCreationQuery) validateTypes() error {
+	if len(query.Types) != 0 && len(query.Types) != len(query.Sum) {
+		return fmt.Errorf("the query has %d attribute types for %d aggregating attributes", len(query.Types), len(query.Sum))
+	}
+	for i, at := range query.Types {
+		if err := at.Validate(); err != nil {
+			return fmt.Errorf("attribute %s: %v", query.Sum[i], err)
+		}
+	}
+	return nil
+}
+
+// validateOperations checks that the aggregate operations of a query are valid and that their columns are aggregated
+func (query *SurveyCreationQuery) validateOperations() error {
+	if len(query.Operations) == 0 {
+		return nil
+	}
+	for _, op := range query.Operations {
+		if err := op.Validate(); err != nil {
+			return err
+		}
+	}
+	columns, count := libunlynx.OperationColumns(query.Sum, query.Count, query.Operations)
+	if len(columns) != len(query.Sum) || count != query.Count {
+		return fmt.Errorf("the aggregating attributes of the query do not include the columns of its operations")
+	}
+	return nil
+}
+
+// validateRanges checks the range conditions of a query
+func (query *SurveyCreationQuery) validateRanges() error {
+	for _, wr := range query.WhereRange {
+		if wr.Bits <= 0 || wr.Bits > libunlynx.MaxRangeBits || int64(len(wr.Cover)) != 2*wr.Bits {
+			return fmt.Errorf("wrong range condition on attribute %s", wr.Name)
+		}
+	}
+	return nil
+}
+
+// compilePredicate compiles the predicate of a query, it is nil if the responses are not filtered (no predicate or no
+// where attribute)
+func (query *SurveyCreationQuery) compilePredicate() (*Predicate, error) {
+	if query.Predicate == "" || len(query.Where)+len(query.WhereRange) == 0 {
+		return nil, nil
+	}
+	where := make([]string, len(query.Where))
+	for i, w := range query.Where {
+		where[i] = w.Name
+	}
+	ranges := make([]string, len(query.WhereRange))
+	for i, wr := range query.WhereRange {
+		ranges[i] = wr.Name
+	}
+	return CompilePredicate(query.Predicate, where, ranges)
+}
+
+// whereColumns returns the where attributes of the responses to a query: the attributes compared with the query values
+// followed by the prefixes of the attributes compared with ranges
+func (query *SurveyCreationQuery) whereColumns() []libunlynx.WhereQueryAttribute {
+	columns := append([]libunlynx.WhereQueryAttribute{}, query.Where...)
+	for _, wr := range query.WhereRange {
+		for _, name := range wr.Columns() {
+			columns = append(columns, libunlynx.WhereQueryAttribute{Name: name})
+		}
+	}
+	return columns
+}
+
+// rangeBits returns the number of bits of the where attributes compared with ranges
+func (query *SurveyCreationQuery) rangeBits() map[string]int64 {
+	bits := make(map[string]int64, len(query.WhereRange))
+	for _, wr := range query.WhereRange {
+		bits[wr.Name] = wr.Bits
+	}
+	return bits
+}
+
+// typesByName returns the types of the aggregating attributes of a query by attribute name
+func (query *SurveyCreationQuery) typesByName() map[string]libunlynx.AttributeType {
+	types := make(map[string]libunlynx.AttributeType, len(query.Types))
+	for i, at := range query.Types {
+		types[query.Sum[i]] = at
+	}
+	return types
+}
+
+// resultTypes returns the type of each aggregating attribute of the results of a query. With differential privacy all
+// the results can be negative because of the noise.
+func (query *SurveyCreationQuery) resultTypes() []libunlynx.AttributeType {
+	types := make([]libunlynx.AttributeType, len(query.Sum))
+	for i := range query.Sum {
+		if i < len(query.Types) {
+			types[i] = query.Types[i]
+		}
+		if query.DiffPri.Enabled() && !types[i].Signed() {
+			types[i].Kind = libunlynx.TypeSigned
+		}
+	}
+	return types
+}
+
+// newSurvey instantiates a survey and its channels
+func newSurvey(query SurveyCreationQuery, surveySecret kyber.Scalar, store *libunlynxstore.Store) Survey {
+	return Survey{
+		Store:           store,
+		Query:           query,
+		SurveySecretKey: surveySecret,
+		CreationTime:    time.Now().UnixNano(),
+
+		SurveyChannel:     make(chan int, 100),
+		RefusalChannel:    make(chan string, 100),
+		DpChannel:         make(chan int, 100),
+		DDTChannel:        make(chan int, 100),
+		CollectionChannel: make(chan CollectionFinished, 100),
+		CancelChannel:     make(chan int),
+
+		ProofsRecord: NewProofsRecord(),
+	}
+}
+
+// surveySecret derives the secret of this server for the deterministic tagging of a survey from its private key, so
+// that it never has to be stored
+func (s *Service) surveySecret(sid SurveyID) (kyber.Scalar, error) {
+	xof := libunlynx.SuiTe.XOF([]byte("unlynx survey secret"))
+	if _, err := s.ServerIdentity().ServicePrivate(ServiceName).MarshalTo(xof); err != nil {
+		return nil, err
+	}
+	if _, err := xof.Write([]byte(sid)); err != nil {
+		return nil, err
+	}
+	return libunlynx.SuiTe.Scalar().Pick(xof), nil
+}
+
+// restoreSurveys reloads the surveys kept in the storage (e.g. after a restart of the server). The surveys that were
+// still collecting data are resumed, the ones that were interrupted in the middle of the protocols are aborted. A
+// survey that cannot be reloaded is skipped (or aborted if its query can be read) without stopping the others.
+func (s *Service) restoreSurveys() error {
+	ids, err := s.Storage.List()
+	if err != nil {
+		return err
+	}
+
+	for _, sid := range ids {
+		if err := s.restoreSurvey(sid); err != nil {
+			log.Error(s.ServerIdentity(), " could not restore survey ", sid, ": ", err)
+		}
+	}
+	return nil
+}
+
+// restoreSurvey reloads a survey kept in the storage (see restoreSurveys)
+func (s *Service) restoreSurvey(sid SurveyID) error {
+	state, err := s.Storage.Get(sid)
+	if err != nil {
+		return err
+	}
+
+	surveySecret, err := s.surveySecret(sid)
+	if err != nil {
+		return err
+	}
+	survey := newSurvey(state.Query, surveySecret, libunlynxstore.NewStoreFromSnapshot(state.Store))
+	survey.Phase = state.Phase
+	survey.DpReceived = state.DpReceived
+	survey.DpKeys = state.DpKeys
+	survey.DpNonces = state.DpNonces
+	survey.Result = state.Result
+	survey.ResultError = state.ResultError
+	survey.ResultReleased = state.ResultReleased
+	survey.CreationTime = state.CreationTime
+	// the fetches of the results signed before the restart cannot be replayed
+	survey.LastFetch = time.Now().UnixNano()
+
+	switch state.Phase {
+	case PhaseCollecting:
+		// the submissions received since the state was written are inserted again
+		if err := s.restoreResponses(sid, &survey); err != nil {
+			log.Error(s.ServerIdentity(), " aborts survey ", sid, ", its data could not be restored: ", err)
+			survey.Phase = PhaseAborted
+			break
+		}
+		s.reservePrecomputations(sid, &survey.Query)
+		if survey.DpReceived > 0 {
+			survey.DpChannel <- int(survey.DpReceived)
+		}
+		log.Lvl1(s.ServerIdentity(), " resumes survey ", sid, " (", survey.DpReceived, " data providers already sent their data)")
+	case PhaseFinished, PhaseAborted:
+	default:
+		log.Warn(s.ServerIdentity(), " aborts survey ", sid, " interrupted during the ", state.Phase, " phase")
+		survey.Phase = PhaseAborted
+	}
+
+	if err := s.putSurvey(sid, survey); err != nil {
+		return err
+	}
+	s.scheduleRemoval(sid, survey.CreationTime)
+	return nil
+}
+
+// restoreResponses inserts again in a survey the submissions appended to the storage
+func (s *Service) restoreResponses(sid SurveyID, survey *Survey) error {
+	responses, err := s.Storage.Responses(sid)
+	if err != nil {
+		return err
+	}
+	for i := range responses {
+		if err := survey.insertResponses(&responses[i], survey.Query.Proofs); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // NewService constructor which registers the needed messages.
 func NewService(c *onet.Context) (onet.Service, error) {
+	// the keys of the server are the ones of the roster, under which the data is encrypted
+	if err := libunlynx.CheckSuite(c.Suite().String()); err != nil {
+		return nil, fmt.Errorf("the server cannot run with the suite of the library: %v", err)
+	}
+	libunlynx.FreezeSuite()
 	newUnLynxInstance := &Service{
 		ServiceProcessor: onet.NewServiceProcessor(c),
 		Survey:           concurrent.NewConcurrentMap(),
+		Policy:           Policy,
+		transitions:      make(map[string]*rosterTransition),
+	}
+
+	db, bucket := c.GetAdditionalBucket(surveyBucket)
+	storage, err := NewBoltStorage(db, bucket)
+	if err != nil {
+		return nil, err
+	}
+	newUnLynxInstance.Storage = storage
+
+	db, bucket = c.GetAdditionalBucket(budgetBucket)
+	newUnLynxInstance.Budget, err = NewBudgetLedger(db, bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	db, bucket = c.GetAdditionalBucket(schemaBucket)
+	newUnLynxInstance.Schemas, err = NewSchemaRegistry(db, bucket)
+	if err != nil {
+		return nil, err
 	}
+
+	db, bucket = c.GetAdditionalBucket(keyBucket)
+	newUnLynxInstance.Keys, err = NewKeyRegistry(db, bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	db, bucket = c.GetAdditionalBucket(rosterChangeBucket)
+	newUnLynxInstance.RosterChanges, err = NewRosterChangeLog(db, bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	newUnLynxInstance.Precomputations, err = newPrecomputationPool(c.ServerIdentity().ID.String())
+	if err != nil {
+		return nil, err
+	}
+	if err := newUnLynxInstance.restoreSurveys(); err != nil {
+		return nil, fmt.Errorf("could not restore the surveys: %v", err)
+	}
+	if err := newUnLynxInstance.restoreRosterChanges(); err != nil {
+		return nil, fmt.Errorf("could not restore the roster changes: %v", err)
+	}
+	// the precomputations that no restored survey reserves (e.g. for a former collective key) are removed
+	newUnLynxInstance.Precomputations.Collect()
+
 	var cerr error
 	if cerr = newUnLynxInstance.RegisterHandler(newUnLynxInstance.HandleSurveyCreationQuery); cerr != nil {
 		return nil, fmt.Errorf("wrong Handler: %v", cerr)
@@ -169,11 +732,49 @@ func NewService(c *onet.Context) (onet.Service, error) {
 	if cerr = newUnLynxInstance.RegisterHandler(newUnLynxInstance.HandleQueryBroadcastFinished); cerr != nil {
 		return nil, fmt.Errorf("wrong Handler: %v", cerr)
 	}
+	if cerr = newUnLynxInstance.RegisterHandler(newUnLynxInstance.HandleSurveyListQuery); cerr != nil {
+		return nil, fmt.Errorf("wrong Handler: %v", cerr)
+	}
+	if cerr = newUnLynxInstance.RegisterHandler(newUnLynxInstance.HandleSurveyStatusQuery); cerr != nil {
+		return nil, fmt.Errorf("wrong Handler: %v", cerr)
+	}
+	if cerr = newUnLynxInstance.RegisterHandler(newUnLynxInstance.HandleSurveyCancelQuery); cerr != nil {
+		return nil, fmt.Errorf("wrong Handler: %v", cerr)
+	}
+	if cerr = newUnLynxInstance.RegisterHandler(newUnLynxInstance.HandleSchemaRegistration); cerr != nil {
+		return nil, fmt.Errorf("wrong Handler: %v", cerr)
+	}
+	if cerr = newUnLynxInstance.RegisterHandler(newUnLynxInstance.HandleSchemaQuery); cerr != nil {
+		return nil, fmt.Errorf("wrong Handler: %v", cerr)
+	}
+	if cerr = newUnLynxInstance.RegisterHandler(newUnLynxInstance.HandleCollectionFinished); cerr != nil {
+		return nil, fmt.Errorf("wrong Handler: %v", cerr)
+	}
+	if cerr = newUnLynxInstance.RegisterHandler(newUnLynxInstance.HandleSurveyResultFetch); cerr != nil {
+		return nil, fmt.Errorf("wrong Handler: %v", cerr)
+	}
+	if cerr = newUnLynxInstance.RegisterHandler(newUnLynxInstance.HandleDKGQuery); cerr != nil {
+		return nil, fmt.Errorf("wrong Handler: %v", cerr)
+	}
+	if cerr = newUnLynxInstance.RegisterHandler(newUnLynxInstance.HandleRosterChangeQuery); cerr != nil {
+		return nil, fmt.Errorf("wrong Handler: %v", cerr)
+	}
 
 	c.RegisterProcessor(newUnLynxInstance, msgTypes.msgSurveyCreationQuery)
 	c.RegisterProcessor(newUnLynxInstance, msgTypes.msgSurveyResultsQuery)
 	c.RegisterProcessor(newUnLynxInstance, msgTypes.msgDDTfinished)
 	c.RegisterProcessor(newUnLynxInstance, msgTypes.msgQueryBroadcastFinished)
+	c.RegisterProcessor(newUnLynxInstance, msgTypes.msgSurveyCancelQuery)
+	c.RegisterProcessor(newUnLynxInstance, msgTypes.msgProofsPublication)
+	c.RegisterProcessor(newUnLynxInstance, msgTypes.msgCollectionFinished)
+	c.RegisterProcessor(newUnLynxInstance, msgTypes.msgRosterChangePrepare)
+	c.RegisterProcessor(newUnLynxInstance, msgTypes.msgRosterChangePrepared)
+	c.RegisterProcessor(newUnLynxInstance, msgTypes.msgRosterChangeCommit)
+	c.RegisterProcessor(newUnLynxInstance, msgTypes.msgRosterChangeDecision)
+	c.RegisterProcessor(newUnLynxInstance, msgTypes.msgRosterChangeAck)
+	c.RegisterProcessor(newUnLynxInstance, msgTypes.msgRosterChangeStatus)
+	c.RegisterProcessor(newUnLynxInstance, msgTypes.msgRosterChangeStatusRep)
+
 	return newUnLynxInstance, cerr
 }
 
@@ -187,7 +788,7 @@ func (s *Service) Process(msg *network.Envelope) {
 		}
 	} else if msg.MsgType.Equal(msgTypes.msgSurveyResultsQuery) {
 		msgSurveyResultsQuery := (msg.Msg).(*SurveyResultsQuery)
-		_, err := s.HandleSurveyResultsQuery(msgSurveyResultsQuery)
+		_, err := s.handleSurveyResultsQuery(msgSurveyResultsQuery, msg.ServerIdentity)
 		if err != nil {
 			log.Error(err)
 		}
@@ -203,32 +804,219 @@ func (s *Service) Process(msg *network.Envelope) {
 		if err != nil {
 			log.Error(err)
 		}
+	} else if msg.MsgType.Equal(msgTypes.msgSurveyCancelQuery) {
+		msgSurveyCancelQuery := (msg.Msg).(*SurveyCancelQuery)
+		err := s.handleIntraSurveyCancel(msgSurveyCancelQuery, msg.ServerIdentity)
+		if err != nil {
+			log.Error(err)
+		}
+	} else if msg.MsgType.Equal(msgTypes.msgProofsPublication) {
+		msgProofsPublication := (msg.Msg).(*ProofsPublication)
+		_, err := s.HandleProofsPublication(msgProofsPublication, msg.ServerIdentity)
+		if err != nil {
+			log.Error(err)
+		}
+	} else if msg.MsgType.Equal(msgTypes.msgCollectionFinished) {
+		msgCollectionFinished := (msg.Msg).(*CollectionFinished)
+		_, err := s.HandleCollectionFinished(msgCollectionFinished)
+		if err != nil {
+			log.Error(err)
+		}
+	} else if msg.MsgType.Equal(msgTypes.msgRosterChangePrepare) {
+		msgRosterChangePrepare := (msg.Msg).(*RosterChangePrepare)
+		_, err := s.HandleRosterChangePrepare(msgRosterChangePrepare)
+		if err != nil {
+			log.Error(err)
+		}
+	} else if msg.MsgType.Equal(msgTypes.msgRosterChangePrepared) {
+		msgRosterChangePrepared := (msg.Msg).(*RosterChangePrepared)
+		_, err := s.HandleRosterChangePrepared(msgRosterChangePrepared)
+		if err != nil {
+			log.Error(err)
+		}
+	} else if msg.MsgType.Equal(msgTypes.msgRosterChangeCommit) {
+		msgRosterChangeCommit := (msg.Msg).(*RosterChangeCommit)
+		_, err := s.HandleRosterChangeCommit(msgRosterChangeCommit, msg.ServerIdentity)
+		if err != nil {
+			log.Error(err)
+		}
+	} else if msg.MsgType.Equal(msgTypes.msgRosterChangeDecision) {
+		msgRosterChangeDecision := (msg.Msg).(*RosterChangeDecision)
+		_, err := s.HandleRosterChangeDecision(msgRosterChangeDecision, msg.ServerIdentity)
+		if err != nil {
+			log.Error(err)
+		}
+	} else if msg.MsgType.Equal(msgTypes.msgRosterChangeAck) {
+		msgRosterChangeAck := (msg.Msg).(*RosterChangeAck)
+		_, err := s.HandleRosterChangeAck(msgRosterChangeAck)
+		if err != nil {
+			log.Error(err)
+		}
+	} else if msg.MsgType.Equal(msgTypes.msgRosterChangeStatus) {
+		msgRosterChangeStatus := (msg.Msg).(*RosterChangeStatusQuery)
+		_, err := s.HandleRosterChangeStatusQuery(msgRosterChangeStatus, msg.ServerIdentity)
+		if err != nil {
+			log.Error(err)
+		}
+	} else if msg.MsgType.Equal(msgTypes.msgRosterChangeStatusRep) {
+		msgRosterChangeStatusRep := (msg.Msg).(*RosterChangeStatusReply)
+		_, err := s.HandleRosterChangeStatusReply(msgRosterChangeStatusRep)
+		if err != nil {
+			log.Error(err)
+		}
 	}
 }
 
 // PushData is used to store incoming data by servers
 func (s *Service) PushData(resp *SurveyResponseQuery, proofs bool) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
 	survey, err := s.getSurvey(resp.SurveyID)
 	if err != nil {
 		return err
 	}
+	if survey.Phase != PhaseCollecting {
+		return fmt.Errorf("survey %s does not accept data anymore (%s phase)", resp.SurveyID, survey.Phase.String())
+	}
+	if survey.Query.deadlinePassed() {
+		return fmt.Errorf("survey %s does not accept data anymore (deadline passed)", resp.SurveyID)
+	}
+	if err := s.checkTransition(&survey.Query.Roster); err != nil {
+		return err
+	}
 
-	for _, v := range resp.Responses {
-		dr := libunlynx.DpResponse{}
-		if err := dr.FromDpResponseToSend(v); err != nil {
-			return err
+	// the responses must conform to the schema of the dataset (once schemas are registered)
+	schema, ok, err := s.Schemas.Lookup(survey.Query.Dataset)
+	if err != nil {
+		return err
+	}
+	if ok {
+		columns, _ := libunlynx.OperationColumns(survey.Query.Sum, survey.Query.Count, survey.Query.Operations)
+		for _, v := range resp.Responses {
+			if err := checkResponse(&schema, v, columns); err != nil {
+				return fmt.Errorf("response not conforming to the schema: %v", err)
+			}
+		}
+	}
+
+	// the encrypted aggregating attributes must be proven to be in their bound
+	if bounds := survey.Query.rangeBounds(); len(bounds) > 0 {
+		for _, v := range resp.Responses {
+			if err := checkRangeProofs(v, survey.Query.collectiveKey(), bounds); err != nil {
+				return fmt.Errorf("response rejected: %v", err)
+			}
 		}
-		survey.InsertDpResponse(dr, proofs, survey.Query.GroupBy, survey.Query.Sum, survey.Query.Where)
 	}
-	err = s.putSurvey(resp.SurveyID, survey)
+
+	responses, err := survey.decodeResponses(resp)
 	if err != nil {
 		return err
 	}
+	// only the submission is written (before the survey is changed in memory), the state of the survey is written again
+	// with its next change
+	if s.Storage != nil {
+		if err := s.Storage.AppendResponse(resp.SurveyID, *resp); err != nil {
+			return err
+		}
+	}
+	survey.addResponses(resp, responses, proofs)
+	if _, err := s.Survey.Put(string(resp.SurveyID), survey); err != nil {
+		return err
+	}
 
 	log.Lvl1(s.ServerIdentity(), " uploaded response data for survey ", resp.SurveyID)
 	return nil
 }
 
+// insertResponses records the data provider of a submission and inserts its responses in the store of the survey, the
+// survey is not modified if the submission is rejected
+func (surv *Survey) insertResponses(resp *SurveyResponseQuery, proofs bool) error {
+	responses, err := surv.decodeResponses(resp)
+	if err != nil {
+		return err
+	}
+	surv.addResponses(resp, responses, proofs)
+	return nil
+}
+
+// decodeResponses checks that a submission can be inserted in the store of the survey and decodes its responses
+func (surv *Survey) decodeResponses(resp *SurveyResponseQuery) ([]libunlynx.DpResponse, error) {
+	if err := surv.checkDp(resp); err != nil {
+		return nil, err
+	}
+	responses := make([]libunlynx.DpResponse, len(resp.Responses))
+	for i, v := range resp.Responses {
+		if err := responses[i].FromDpResponseToSend(v); err != nil {
+			return nil, err
+		}
+	}
+	return responses, nil
+}
+
+// addResponses records the data provider of a submission and inserts its decoded responses (see decodeResponses)
+func (surv *Survey) addResponses(resp *SurveyResponseQuery, responses []libunlynx.DpResponse, proofs bool) {
+	surv.recordDp(resp)
+	for _, dr := range responses {
+		if proof := surv.InsertDpResponse(dr, proofs, surv.Query.GroupBy, surv.Query.Sum, surv.Query.whereColumns()); proof != nil {
+			surv.ProofsRecord.addAddition(*proof)
+		}
+	}
+	surv.DpReceived++
+}
+
+// checkSurveyCreationQuery checks that a survey can be created by this server: its querier must be allowed by the
+// access policy and the query must be valid (and conform to the schema of its dataset)
+func (s *Service) checkSurveyCreationQuery(recq *SurveyCreationQuery) error {
+	if err := libunlynx.CheckSuite(recq.Suite); err != nil {
+		return err
+	}
+	if err := recq.authorize(s.Policy); err != nil {
+		return err
+	}
+	if err := s.checkPrivacyBudget(recq); err != nil {
+		return err
+	}
+	if err := recq.DiffPri.Validate(); err != nil {
+		return fmt.Errorf("invalid differential privacy parameters: %v", err)
+	}
+	if err := recq.validateTypes(); err != nil {
+		return err
+	}
+	if err := recq.validateOperations(); err != nil {
+		return err
+	}
+	if err := recq.validateRanges(); err != nil {
+		return err
+	}
+	if err := recq.validateBounds(); err != nil {
+		return err
+	}
+	if err := recq.validateCollection(); err != nil {
+		return err
+	}
+	if err := s.checkCollectiveKey(recq); err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	err := s.checkTransition(&recq.Roster)
+	s.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	if _, err := recq.compilePredicate(); err != nil {
+		return fmt.Errorf("invalid predicate: %v", err)
+	}
+	schema, ok, err := s.Schemas.Lookup(recq.Dataset)
+	if err != nil {
+		return err
+	}
+	if ok {
+		return recq.validateSchema(&schema)
+	}
+	return nil
+}
+
 // Query Handlers
 //______________________________________________________________________________________________________________________
 
@@ -236,6 +1024,17 @@ func (s *Service) PushData(resp *SurveyResponseQuery, proofs bool) error {
 func (s *Service) HandleSurveyCreationQuery(recq *SurveyCreationQuery) (network.Message, error) {
 	log.Lvl1(s.ServerIdentity().String(), " received a Survey Creation Query")
 
+	if err := s.checkSurveyCreationQuery(recq); err != nil {
+		if recq.IntraMessage {
+			// the server receiving the query from the client stops waiting for this server
+			refusal := QueryBroadcastFinished{SurveyID: recq.SurveyID, Refusal: s.ServerIdentity().String() + " refused the survey: " + err.Error()}
+			if err := s.SendRaw(recq.Source, &refusal); err != nil {
+				log.Error(err)
+			}
+		}
+		return nil, err
+	}
+
 	// if this server is the one receiving the query from the client
 	if !recq.IntraMessage {
 		id := uuid.NewV4()
@@ -245,30 +1044,22 @@ func (s *Service) HandleSurveyCreationQuery(recq *SurveyCreationQuery) (network.
 
 	}
 
-	// chooses an ephemeral secret for this survey
-	surveySecret := libunlynx.SuiTe.Scalar().Pick(libunlynx.SuiTe.RandomStream())
-
-	// prepares the precomputation for shuffling
-	lineSize := int(len(recq.Sum)) + int(len(recq.Where)) + int(len(recq.GroupBy)) + 1 // + 1 is for the possible count attribute
-	precomputeShuffle, err := libunlynxshuffle.PrecomputationWritingForShuffling(recq.AppFlag, gobFile, s.ServerIdentity().String(), surveySecret, recq.Roster.Aggregate, lineSize)
+	// derives the secret of this server for this survey
+	surveySecret, err := s.surveySecret(recq.SurveyID)
 	if err != nil {
 		return nil, err
 	}
 
+	// the precomputations for shuffling are prepared while the data is collected
+	s.reservePrecomputations(recq.SurveyID, recq)
+
 	// survey instantiation
-	_, err = s.Survey.Put((string)(recq.SurveyID), Survey{
-		Store:             libunlynxstore.NewStore(),
-		Query:             *recq,
-		SurveySecretKey:   surveySecret,
-		ShufflePrecompute: precomputeShuffle,
-
-		SurveyChannel: make(chan int, 100),
-		DpChannel:     make(chan int, 100),
-		DDTChannel:    make(chan int, 100),
-	})
+	survey := newSurvey(*recq, surveySecret, libunlynxstore.NewStore())
+	err = s.putSurvey(recq.SurveyID, survey)
 	if err != nil {
 		return nil, err
 	}
+	s.scheduleRemoval(recq.SurveyID, survey.CreationTime)
 	log.Lvl1(s.ServerIdentity(), " initiated the survey ", recq.SurveyID)
 
 	if !recq.IntraMessage {
@@ -301,7 +1092,7 @@ func (s *Service) HandleSurveyCreationQuery(recq *SurveyCreationQuery) (network.
 			return nil, err
 		}
 
-		resp, err := EncryptDataToSurvey(s.ServerIdentity().String(), recq.SurveyID, testData[strconv.Itoa(index)], recq.Roster.Aggregate, 1, recq.Count)
+		resp, err := EncryptDataToSurvey(s.ServerIdentity().String(), recq.SurveyID, testData[strconv.Itoa(index)], recq.collectiveKey(), 1, recq.Count, recq.typesByName(), recq.Operations, recq.rangeBits(), recq.rangeBounds())
 		if err != nil {
 			return nil, err
 		}
@@ -324,9 +1115,8 @@ func (s *Service) HandleSurveyCreationQuery(recq *SurveyCreationQuery) (network.
 			return nil, err
 		}
 
-		counter := len(recq.Roster.List) - 1
-		for counter > 0 {
-			counter = counter - (<-survey.SurveyChannel)
+		if err := s.waitAcceptance(recq.SurveyID, &survey); err != nil {
+			return nil, err
 		}
 	}
 	return &ServiceState{recq.SurveyID}, nil
@@ -334,6 +1124,12 @@ func (s *Service) HandleSurveyCreationQuery(recq *SurveyCreationQuery) (network.
 
 // HandleSurveyResponseQuery handles a survey answers submission by a subject.
 func (s *Service) HandleSurveyResponseQuery(resp *SurveyResponseQuery) (network.Message, error) {
+	if err := libunlynx.CheckSuite(resp.Suite); err != nil {
+		return nil, err
+	}
+	if err := authenticateDp(resp, s.ServerIdentity()); err != nil {
+		return nil, err
+	}
 	survey, err := s.getSurvey(resp.SurveyID)
 	if err != nil {
 		return nil, err
@@ -347,14 +1143,64 @@ func (s *Service) HandleSurveyResponseQuery(resp *SurveyResponseQuery) (network.
 	return &ServiceState{"1"}, nil
 }
 
+// checkSurveyResultsQuery checks that the results of a survey can be computed: they were not requested yet, the
+// query is signed by the querier of the survey and the privacy budget of the querier allows it (the survey is then
+// charged)
+func (s *Service) checkSurveyResultsQuery(resq *SurveyResultsQuery, survey *Survey) error {
+	if survey.Phase == PhaseAborted {
+		return fmt.Errorf("survey %s was aborted", resq.SurveyID)
+	}
+	if survey.Phase != PhaseCollecting {
+		return fmt.Errorf("the results of survey %s were already requested", resq.SurveyID)
+	}
+	if err := resq.authorize(&survey.Query); err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	err := s.checkTransition(&survey.Query.Roster)
+	s.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// every server enforces the budget of the querier before it takes part in the protocols
+	if survey.Query.DiffPri.Enabled() {
+		return s.Budget.Spend(resq.SurveyID, survey.Query.Querier, survey.Query.Dataset, survey.Query.DiffPri.Epsilon)
+	}
+	return nil
+}
+
 // HandleSurveyResultsQuery handles the survey result query by the surveyor.
 func (s *Service) HandleSurveyResultsQuery(resq *SurveyResultsQuery) (network.Message, error) {
+	return s.handleSurveyResultsQuery(resq, nil)
+}
+
+// handleSurveyResultsQuery handles a survey result query, sent by the querier or (if it is an intra message) broadcast
+// by the server sender
+func (s *Service) handleSurveyResultsQuery(resq *SurveyResultsQuery, sender *network.ServerIdentity) (network.Message, error) {
 	log.Lvl1(s.ServerIdentity(), " received a survey result query")
 
+	if resq.IntraMessage && sender == nil {
+		return nil, fmt.Errorf("the results query of survey %s was not broadcast by a server", resq.SurveyID)
+	}
 	survey, err := s.getSurvey(resq.SurveyID)
 	if err != nil {
 		return nil, err
 	}
+	err = s.checkSurveyResultsQuery(resq, &survey)
+	if resq.IntraMessage {
+		// the server receiving the query from the querier waits for all the servers to accept it
+		reply := QueryBroadcastFinished{SurveyID: resq.SurveyID}
+		if err != nil {
+			reply.Refusal = s.ServerIdentity().String() + " refused the results query: " + err.Error()
+		}
+		if tmpErr := s.SendRaw(sender, &reply); tmpErr != nil {
+			log.Error(tmpErr)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
 
 	survey.Query.ClientPubKey = resq.ClientPublic
 	err = s.putSurvey(resq.SurveyID, survey)
@@ -362,36 +1208,55 @@ func (s *Service) HandleSurveyResultsQuery(resq *SurveyResultsQuery) (network.Me
 		return nil, err
 	}
 
+	// the protocols are run in the background, the querier fetches the results once they are computed
 	if !resq.IntraMessage {
 		resq.IntraMessage = true
 
 		err := libunlynxtools.SendISMOthers(s.ServiceProcessor, &survey.Query.Roster, resq)
 		if err != nil {
+			// the servers that accepted the query (and charged the survey) are refunded
+			if tmpErr := s.cancelSurvey(&SurveyCancelQuery{SurveyID: resq.SurveyID}); tmpErr != nil {
+				log.Error(tmpErr)
+			}
 			return nil, err
 		}
-		err = s.StartService(resq.SurveyID, true)
-		if err != nil {
-			return nil, err
-		}
-
-		log.Lvl1(s.ServerIdentity(), " completed the query processing...")
-
-		survey, err := s.getSurvey(resq.SurveyID)
-		if err != nil {
-			return nil, err
-		}
-		results := survey.PullDeliverableResults(false, libunlynx.CipherText{})
-		err = s.putSurvey(resq.SurveyID, survey)
-		if err != nil {
+		if err := s.waitAcceptance(resq.SurveyID, &survey); err != nil {
 			return nil, err
 		}
+		go s.computeResults(resq.SurveyID)
 
-		return &ServiceResult{Results: results}, nil
+		return &ServiceState{resq.SurveyID}, nil
 	}
 
 	return nil, s.StartService(resq.SurveyID, false)
 }
 
+// waitAcceptance waits for all the other servers of the roster of a survey to accept a query broadcast by this server
+// (see QueryBroadcastFinished), the survey is cancelled (and the servers that accepted it refunded) if one of them
+// refuses it or does not answer on time
+func (s *Service) waitAcceptance(sid SurveyID, survey *Survey) error {
+	counter := len(survey.Query.Roster.List) - 1
+	for counter > 0 {
+		select {
+		case nbr := <-survey.SurveyChannel:
+			counter = counter - nbr
+		case refusal := <-survey.RefusalChannel:
+			if err := s.cancelSurvey(&SurveyCancelQuery{SurveyID: sid}); err != nil {
+				log.Error(err)
+			}
+			return errors.New(refusal)
+		case <-time.After(libunlynx.TIMEOUT):
+			if err := s.cancelSurvey(&SurveyCancelQuery{SurveyID: sid}); err != nil {
+				log.Error(err)
+			}
+			return fmt.Errorf("%s didn't get the acceptance of all the servers for survey %s on time", s.ServerIdentity(), sid)
+		case <-survey.CancelChannel:
+			return errSurveyCancelled(sid)
+		}
+	}
+	return nil
+}
+
 // HandleDDTfinished handles the message DDTfinished: one of the nodes is ready to perform a collective aggregation
 func (s *Service) HandleDDTfinished(recq *DDTfinished) (network.Message, error) {
 	survey, err := s.getSurvey(recq.SurveyID)
@@ -408,15 +1273,136 @@ func (s *Service) HandleQueryBroadcastFinished(recq *QueryBroadcastFinished) (ne
 	if err != nil {
 		return nil, err
 	}
+	if recq.Refusal != "" {
+		survey.RefusalChannel <- recq.Refusal
+		return nil, nil
+	}
 	survey.SurveyChannel <- 1
 	return nil, nil
 }
 
+// HandleSurveyListQuery handles the listing of the surveys of a querier known by the server.
+func (s *Service) HandleSurveyListQuery(recq *SurveyListQuery) (network.Message, error) {
+	if err := recq.Auth.verify("survey listing", ""); err != nil {
+		return nil, err
+	}
+	list := SurveyList{Surveys: make([]SurveyStatus, 0)}
+	for _, entry := range s.Survey.ToSlice() {
+		survey := entry.Value().(Survey)
+		if survey.Query.Querier != nil && survey.Query.Querier.Equal(recq.Auth.Querier) {
+			list.Surveys = append(list.Surveys, survey.status(s.ServerIdentity(), true))
+		}
+	}
+	return &list, nil
+}
+
+// HandleSurveyStatusQuery handles the request for the status (phase, number of data providers...) of a survey, its
+// progress is only given to its querier.
+func (s *Service) HandleSurveyStatusQuery(recq *SurveyStatusQuery) (network.Message, error) {
+	survey, err := s.getSurvey(recq.SurveyID)
+	if err != nil {
+		return nil, err
+	}
+	progress := false
+	if recq.Auth.Querier != nil {
+		if err := recq.Auth.verifyFor("status query", &survey.Query); err != nil {
+			return nil, err
+		}
+		progress = true
+	}
+	status := survey.status(s.ServerIdentity(), progress)
+	return &status, nil
+}
+
+// HandleSchemaRegistration handles the registration of the schema of a dataset by an administrator of the server.
+func (s *Service) HandleSchemaRegistration(recq *SchemaRegistration) (network.Message, error) {
+	if err := recq.authorize(s.Policy); err != nil {
+		return nil, err
+	}
+	log.Lvl1(s.ServerIdentity(), " registers the schema of dataset ", recq.Schema.Dataset)
+	if err := s.Schemas.Register(recq.Schema); err != nil {
+		return nil, err
+	}
+	return &ServiceState{}, nil
+}
+
+// HandleSchemaQuery handles the request for the schema of a dataset.
+func (s *Service) HandleSchemaQuery(recq *SchemaQuery) (network.Message, error) {
+	schema, ok := s.Schemas.Get(recq.Dataset)
+	if !ok {
+		return nil, fmt.Errorf("no schema for dataset %s", recq.Dataset)
+	}
+	return &SchemaResponse{Schema: schema}, nil
+}
+
+// HandleSurveyCancelQuery handles the cancellation of a survey by its querier: the survey is deleted from every server
+// of its roster and the steps waiting for it are interrupted.
+func (s *Service) HandleSurveyCancelQuery(recq *SurveyCancelQuery) (network.Message, error) {
+	survey, err := s.getSurvey(recq.SurveyID)
+	if err != nil {
+		return nil, err
+	}
+	if err := recq.Auth.verifyFor("cancellation", &survey.Query); err != nil {
+		return nil, err
+	}
+	if err := s.cancelSurvey(recq); err != nil {
+		return nil, err
+	}
+	return &ServiceState{recq.SurveyID}, nil
+}
+
+// handleIntraSurveyCancel handles the cancellation of a survey broadcast by a server of its roster
+func (s *Service) handleIntraSurveyCancel(recq *SurveyCancelQuery, sender *network.ServerIdentity) error {
+	survey, err := s.getSurvey(recq.SurveyID)
+	if err != nil {
+		return err
+	}
+	if !rosterMember(&survey.Query.Roster, sender) {
+		return fmt.Errorf("survey %s can only be cancelled by a server of its roster", recq.SurveyID)
+	}
+	return s.cancelSurvey(recq)
+}
+
+// cancelSurvey deletes a survey from this server and, if the cancellation is not broadcast by another server, from the
+// other servers of its roster. The privacy budget charged for the survey is refunded if its results were not computed.
+func (s *Service) cancelSurvey(recq *SurveyCancelQuery) error {
+	log.Lvl1(s.ServerIdentity(), " cancels survey ", recq.SurveyID)
+
+	survey, err := s.getSurvey(recq.SurveyID)
+	if err != nil {
+		return err
+	}
+	if err := s.removeSurvey(recq.SurveyID); err != nil {
+		return err
+	}
+	// the results of the survey are not computed: the privacy budget it was charged is refunded
+	if survey.Phase == PhaseCollecting {
+		if err := s.Budget.Refund(recq.SurveyID); err != nil {
+			log.Error(err)
+		}
+	}
+
+	if !recq.IntraMessage {
+		recq.IntraMessage = true
+		err := libunlynxtools.SendISMOthers(s.ServiceProcessor, &survey.Query.Roster, recq)
+		recq.IntraMessage = false
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Protocol Handlers
 //______________________________________________________________________________________________________________________
 
 // NewProtocol creates a protocol instance executed by all nodes
 func (s *Service) NewProtocol(tn *onet.TreeNodeInstance, conf *onet.GenericConfig) (onet.ProtocolInstance, error) {
+	// the DKG is not related to a survey
+	if tn.ProtocolName() == protocolsunlynx.DKGProtocolName {
+		return s.newDKGProtocol(tn, string(conf.Data))
+	}
+
 	var pi onet.ProtocolInstance
 	target := SurveyID(string(conf.Data))
 	survey, err := s.getSurvey(SurveyID(conf.Data))
@@ -438,9 +1424,17 @@ func (s *Service) NewProtocol(tn *onet.TreeNodeInstance, conf *onet.GenericConfi
 			if err != nil {
 				log.Fatal(err)
 			}
+			pub, err := shufflingProofsPublication(PhaseShuffling, proof)
+			if err != nil {
+				log.Fatal(err)
+			}
+			s.publishProofsOrLog(target, pub)
 			return &proof
 		}
-		shuffle.Precomputed = survey.ShufflePrecompute
+		shuffle.PrecomputedFunc = func(rows int) []libunlynxshuffle.CipherVectorScalar {
+			return s.takePrecomputations(target, &survey.Query, rows)
+		}
+		shuffle.CollectiveKey = survey.Query.CollectiveKey
 		if tn.IsRoot() {
 			dpResponses := survey.PullDpResponses()
 			var toShuffleCV []libunlynx.CipherVector
@@ -462,7 +1456,30 @@ func (s *Service) NewProtocol(tn *onet.TreeNodeInstance, conf *onet.GenericConfi
 
 		aux := survey.SurveySecretKey
 		hashCreation.SurveySecretKey = &aux
+		if survey.Query.CollectiveKey != nil {
+			ks, ok := s.Keys.Get(survey.Query.CollectiveKey)
+			if !ok {
+				return nil, fmt.Errorf("no share of the collective key of survey %s", target)
+			}
+			hashCreation.SecretKey = ks.lagrangeSecret()
+		}
 		hashCreation.Proofs = survey.Query.Proofs
+		hashCreation.AdditionProofFunc = func(c1List []kyber.Point, sList []kyber.Scalar, c2List []kyber.Point, rList []kyber.Point) *libunlynxdetertag.PublishedDDTAdditionListProof {
+			proof, err := libunlynxdetertag.DeterministicTagAdditionListProofCreation(c1List, sList, c2List, rList)
+			if err != nil {
+				log.Fatal(err)
+			}
+			s.publishProofsOrLog(target, &ProofsPublication{Phase: PhaseTagging, DetTagAdditionProofs: []libunlynxdetertag.PublishedDDTAdditionListProof{proof}})
+			return &proof
+		}
+		hashCreation.CreationProofFunc = func(vBef, vAft libunlynx.CipherVector, pubKey kyber.Point, privKey, secretContrib kyber.Scalar) *libunlynxdetertag.PublishedDDTCreationListProof {
+			proof, err := libunlynxdetertag.DeterministicTagCrListProofCreation(vBef, vAft, pubKey, privKey, secretContrib)
+			if err != nil {
+				log.Fatal(err)
+			}
+			s.publishProofsOrLog(target, &ProofsPublication{Phase: PhaseTagging, DetTagCreationProofs: []libunlynxdetertag.PublishedDDTCreationListProof{proof}})
+			return &proof
+		}
 		if tn.IsRoot() {
 			shuffledClientResponses := survey.PullShuffledProcessResponses()
 
@@ -471,6 +1488,12 @@ func (s *Service) NewProtocol(tn *onet.TreeNodeInstance, conf *onet.GenericConfi
 				cv := libunlynx.CipherVector{v.Value}
 				queryWhereToTag = append(queryWhereToTag, libunlynx.ProcessResponse{WhereEnc: cv, GroupByEnc: nil, AggregatingAttributes: nil})
 			}
+			for _, wr := range survey.Query.WhereRange {
+				for _, v := range wr.Cover {
+					cv := libunlynx.CipherVector{v}
+					queryWhereToTag = append(queryWhereToTag, libunlynx.ProcessResponse{WhereEnc: cv, GroupByEnc: nil, AggregatingAttributes: nil})
+				}
+			}
 			shuffledClientResponses = append(queryWhereToTag, shuffledClientResponses...)
 			deterministicTOS := protocolsunlynx.ProcessResponseToCipherVector(shuffledClientResponses)
 			survey.TargetOfSwitch = shuffledClientResponses
@@ -497,15 +1520,22 @@ func (s *Service) NewProtocol(tn *onet.TreeNodeInstance, conf *onet.GenericConfi
 
 		collectiveAggr := pi.(*protocolsunlynx.CollectiveAggregationProtocol)
 		collectiveAggr.GroupedData = &groupedData
+		collectiveAggr.CollectiveKey = survey.Query.CollectiveKey
 		collectiveAggr.Proofs = survey.Query.Proofs
 		collectiveAggr.ProofFunc = func(data []libunlynx.CipherVector, res libunlynx.CipherVector) *libunlynxaggr.PublishedAggregationListProof {
 			proof := libunlynxaggr.AggregationListProofCreation(data, res)
+			s.publishProofsOrLog(target, &ProofsPublication{Phase: PhaseAggregation, AggregationProofs: []libunlynxaggr.PublishedAggregationListProof{proof}})
 			return &proof
 		}
 
 		counter := len(tn.Roster().List) - 1
 		for counter > 0 {
-			counter = counter - (<-survey.DDTChannel)
+			select {
+			case nbr := <-survey.DDTChannel:
+				counter = counter - nbr
+			case <-survey.CancelChannel:
+				return nil, errSurveyCancelled(target)
+			}
 		}
 
 	case protocolsunlynx.DROProtocolName:
@@ -521,19 +1551,29 @@ func (s *Service) NewProtocol(tn *onet.TreeNodeInstance, conf *onet.GenericConfi
 			if err != nil {
 				log.Fatal(err)
 			}
+			pub, err := shufflingProofsPublication(PhaseDRO, proof)
+			if err != nil {
+				log.Fatal(err)
+			}
+			s.publishProofsOrLog(target, pub)
 			return &proof
 		}
 		shuffle.Precomputed = nil
+		shuffle.CollectiveKey = survey.Query.CollectiveKey
 
 		if tn.IsRoot() {
 			clientResponses := make([]libunlynx.ProcessResponse, 0)
-			noiseArray := libunlynxdiffprivacy.GenerateNoiseValues(1000, 0, 1, 0.1, 0)
-			for _, v := range noiseArray {
+			for _, v := range survey.NoiseValues {
 				clientResponses = append(clientResponses, libunlynx.ProcessResponse{GroupByEnc: nil, AggregatingAttributes: libunlynx.IntArrayToCipherVector([]int64{int64(v)})})
 			}
 			var toShuffleCV []libunlynx.CipherVector
 			toShuffleCV, survey.Lengths = protocolsunlynx.ProcessResponseToMatrixCipherText(clientResponses)
 			shuffle.ShuffleTarget = &toShuffleCV
+
+			err = s.putSurvey(target, survey)
+			if err != nil {
+				return nil, err
+			}
 		}
 		return pi, nil
 
@@ -545,24 +1585,50 @@ func (s *Service) NewProtocol(tn *onet.TreeNodeInstance, conf *onet.GenericConfi
 
 		keySwitch := pi.(*protocolsunlynx.KeySwitchingProtocol)
 		keySwitch.Proofs = survey.Query.Proofs
-		keySwitch.ProofFunc = func(pubKey, targetPubKey kyber.Point, secretKey kyber.Scalar, ks2s, rBNegs []kyber.Point, vis []kyber.Scalar) *libunlynxkeyswitch.PublishedKSListProof {
-			proof, err := libunlynxkeyswitch.KeySwitchListProofCreation(pubKey, targetPubKey, secretKey, ks2s, rBNegs, vis)
+		keySwitch.ProofFunc = s.keySwitchingProofFunc(target)
+
+		if tn.IsRoot() {
+			cv, err := s.keySwitchingTarget(&survey)
 			if err != nil {
-				log.Fatal(err)
+				return nil, err
+			}
+			keySwitch.TargetOfSwitch = &cv
+			cpk := survey.Query.ClientPubKey
+			keySwitch.TargetPublicKey = &cpk
+
+			err = s.putSurvey(target, survey)
+			if err != nil {
+				return nil, err
 			}
-			return &proof
 		}
 
-		if tn.IsRoot() {
-			var coaggr []libunlynx.FilteredResponse
+	case protocolsunlynx.ThresholdKeySwitchingProtocolName:
+		pi, err = protocolsunlynx.NewThresholdKeySwitchingProtocol(tn)
+		if err != nil {
+			return nil, err
+		}
+
+		ks, ok := s.Keys.Get(survey.Query.collectiveKey())
+		if !ok {
+			return nil, fmt.Errorf("no share of the collective key of survey %s", target)
+		}
+		keySwitch := pi.(*protocolsunlynx.ThresholdKeySwitchingProtocol)
+		keySwitch.Share = ks.priShare()
+		keySwitch.Threshold = int(ks.Threshold)
+		keySwitch.Participants = ks.Participants
+		if len(ks.Commits) > 0 {
+			keySwitch.PubPoly = ks.pubPoly()
+		}
+		keySwitch.Proofs = survey.Query.Proofs
+		keySwitch.ProofFunc = func(proof libunlynxkeyswitch.PublishedKSListProof) {
+			s.publishKeySwitchingProof(target, proof)
+		}
 
-			if libunlynx.DIFFPRI {
-				coaggr = survey.PullCothorityAggregatedFilteredResponses(true, survey.Noise)
-			} else {
-				coaggr = survey.PullCothorityAggregatedFilteredResponses(false, libunlynx.CipherText{})
+		if tn.IsRoot() {
+			cv, err := s.keySwitchingTarget(&survey)
+			if err != nil {
+				return nil, err
 			}
-			var cv libunlynx.CipherVector
-			cv, survey.Lengths = protocolsunlynx.FilteredResponseToCipherVector(coaggr)
 			keySwitch.TargetOfSwitch = &cv
 			cpk := survey.Query.ClientPubKey
 			keySwitch.TargetPublicKey = &cpk
@@ -573,11 +1639,48 @@ func (s *Service) NewProtocol(tn *onet.TreeNodeInstance, conf *onet.GenericConfi
 			}
 		}
 	default:
-		return nil, fmt.Errorf("service attempts to start an unknown protocol: " + tn.ProtocolName())
+		return nil, fmt.Errorf("service attempts to start an unknown protocol: %s", tn.ProtocolName())
 	}
 	return pi, nil
 }
 
+// keySwitchingProofFunc returns the function that publishes the key switching proofs of a survey
+func (s *Service) keySwitchingProofFunc(target SurveyID) func(pubKey, targetPubKey kyber.Point, secretKey kyber.Scalar, ks2s, rBNegs []kyber.Point, vis []kyber.Scalar) *libunlynxkeyswitch.PublishedKSListProof {
+	return func(pubKey, targetPubKey kyber.Point, secretKey kyber.Scalar, ks2s, rBNegs []kyber.Point, vis []kyber.Scalar) *libunlynxkeyswitch.PublishedKSListProof {
+		proof, err := libunlynxkeyswitch.KeySwitchListProofCreation(pubKey, targetPubKey, secretKey, ks2s, rBNegs, vis)
+		if err != nil {
+			log.Fatal(err)
+		}
+		s.publishKeySwitchingProof(target, proof)
+		return &proof
+	}
+}
+
+// publishKeySwitchingProof publishes the key switching proof of this server, key switching is the last step of the
+// protocol in which every server creates proofs
+func (s *Service) publishKeySwitchingProof(target SurveyID, proof libunlynxkeyswitch.PublishedKSListProof) {
+	s.publishProofsOrLog(target, &ProofsPublication{Phase: PhaseKeySwitching, KeySwitchingProofs: []libunlynxkeyswitch.PublishedKSListProof{proof}, Last: true})
+}
+
+// keySwitchingTarget returns the aggregated results of a survey (with the noise if it is differentially private) to
+// switch to the key of the querier
+func (s *Service) keySwitchingTarget(survey *Survey) (libunlynx.CipherVector, error) {
+	var coaggr []libunlynx.FilteredResponse
+	var err error
+
+	if survey.Query.DiffPri.Enabled() {
+		coaggr, err = survey.PullCothorityAggregatedFilteredResponses(true, survey.Noise)
+	} else {
+		coaggr, err = survey.PullCothorityAggregatedFilteredResponses(false, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cv libunlynx.CipherVector
+	cv, survey.Lengths = protocolsunlynx.FilteredResponseToCipherVector(coaggr)
+	return cv, nil
+}
+
 // StartProtocol starts a specific protocol (Pipeline, Shuffling, etc.)
 func (s *Service) StartProtocol(name string, targetSurvey SurveyID) (onet.ProtocolInstance, error) {
 	survey, err := s.getSurvey(targetSurvey)
@@ -596,7 +1699,7 @@ func (s *Service) StartProtocol(name string, targetSurvey SurveyID) (onet.Protoc
 	}
 	pi, err := s.NewProtocol(tn, &conf)
 	if err != nil {
-		return nil, fmt.Errorf("error running "+name+" : %v", err)
+		return nil, fmt.Errorf("error running %s : %v", name, err)
 	}
 
 	err = s.RegisterProtocolInstance(pi)
@@ -622,7 +1725,16 @@ func (s *Service) StartProtocol(name string, targetSurvey SurveyID) (onet.Protoc
 //______________________________________________________________________________________________________________________
 
 // StartService starts the service (with all its different steps/protocols)
-func (s *Service) StartService(targetSurvey SurveyID, root bool) error {
+func (s *Service) StartService(targetSurvey SurveyID, root bool) (err error) {
+	// a survey that fails in the middle of the protocols cannot be completed anymore
+	defer func() {
+		if err != nil {
+			if tmpErr := s.setPhase(targetSurvey, PhaseAborted); tmpErr != nil {
+				log.Error(tmpErr)
+			}
+		}
+	}()
+
 	log.Lvl1(s.ServerIdentity(), " is waiting on channel")
 
 	survey, err := s.getSurvey(targetSurvey)
@@ -630,12 +1742,13 @@ func (s *Service) StartService(targetSurvey SurveyID, root bool) error {
 		return err
 	}
 
-	counter := survey.Query.MapDPs[s.ServerIdentity().String()]
-	for counter > int64(0) {
-		log.Lvl1(s.ServerIdentity(), " is waiting for ", counter, " data providers to send their data")
-		counter = counter - int64(<-survey.DpChannel)
+	if err = s.waitDataProviders(targetSurvey); err != nil {
+		return err
+	}
+	if _, err = s.agreeOnParticipants(targetSurvey); err != nil {
+		return err
 	}
-	log.Lvl1("All data providers (", survey.Query.MapDPs[s.ServerIdentity().String()], ") for server ", s.ServerIdentity(), " have sent their data")
+	log.Lvl1("The data providers for server ", s.ServerIdentity(), " have sent their data")
 
 	log.Lvl1(s.ServerIdentity(), " starts a UnLynx Protocol for survey ", targetSurvey)
 
@@ -644,6 +1757,13 @@ func (s *Service) StartService(targetSurvey SurveyID, root bool) error {
 		return err
 	}
 
+	if additions := target.ProofsRecord.takeAdditions(); len(additions) > 0 {
+		err = s.publishProofs(targetSurvey, &ProofsPublication{Phase: PhaseCollecting, SimpleAdditionProofs: additions})
+		if err != nil {
+			return err
+		}
+	}
+
 	// Shuffling Phase
 	start := libunlynx.StartTimer(s.ServerIdentity().String() + "_ShufflingPhase")
 
@@ -656,6 +1776,9 @@ func (s *Service) StartService(targetSurvey SurveyID, root bool) error {
 	// Tagging Phase
 	start = libunlynx.StartTimer(s.ServerIdentity().String() + "_TaggingPhase")
 
+	if err = s.setPhase(targetSurvey, PhaseTagging); err != nil {
+		return err
+	}
 	err = s.TaggingPhase(target.Query.SurveyID)
 	if err != nil {
 		return fmt.Errorf("error in the Tagging Phase: %v", err)
@@ -674,6 +1797,9 @@ func (s *Service) StartService(targetSurvey SurveyID, root bool) error {
 	if root {
 		start := libunlynx.StartTimer(s.ServerIdentity().String() + "_AggregationPhase")
 
+		if err = s.setPhase(targetSurvey, PhaseAggregation); err != nil {
+			return err
+		}
 		err = s.AggregationPhase(target.Query.SurveyID)
 		if err != nil {
 			return fmt.Errorf("error in the Aggregation Phase: %v", err)
@@ -683,10 +1809,13 @@ func (s *Service) StartService(targetSurvey SurveyID, root bool) error {
 	}
 
 	// DRO Phase
-	if root && libunlynx.DIFFPRI {
+	if root && target.Query.DiffPri.Enabled() {
 		start := libunlynx.StartTimer(s.ServerIdentity().String() + "_DROPhase")
 
-		err := s.DROPhase(target.Query.SurveyID)
+		if err = s.setPhase(targetSurvey, PhaseDRO); err != nil {
+			return err
+		}
+		err = s.DROPhase(target.Query.SurveyID, target.Query.DiffPri)
 		if err != nil {
 			return fmt.Errorf("error in the DRO Phase: %v", err)
 		}
@@ -698,7 +1827,10 @@ func (s *Service) StartService(targetSurvey SurveyID, root bool) error {
 	if root {
 		start := libunlynx.StartTimer(s.ServerIdentity().String() + "_KeySwitchingPhase")
 
-		err := s.KeySwitchingPhase(target.Query.SurveyID)
+		if err = s.setPhase(targetSurvey, PhaseKeySwitching); err != nil {
+			return err
+		}
+		err = s.KeySwitchingPhase(target.Query.SurveyID)
 		if err != nil {
 			return fmt.Errorf("error in the Key Switching Phase: %v", err)
 		}
@@ -706,7 +1838,15 @@ func (s *Service) StartService(targetSurvey SurveyID, root bool) error {
 		libunlynx.EndTimer(start)
 	}
 
-	return nil
+	// Proofs Verification
+	if root && target.Query.Proofs {
+		err = s.waitProofsVerification(targetSurvey)
+		if err != nil {
+			return fmt.Errorf("error in the verification of the proofs: %v", err)
+		}
+	}
+
+	return s.setPhase(targetSurvey, PhaseFinished)
 }
 
 // ShufflingPhase performs the shuffling of the ClientResponses
@@ -730,7 +1870,9 @@ func (s *Service) ShufflingPhase(targetSurvey SurveyID) error {
 	select {
 	case tmpShufflingResult = <-pi.(*protocolsunlynx.ShufflingProtocol).FeedbackChannel:
 	case <-time.After(libunlynx.TIMEOUT):
-		return fmt.Errorf(s.ServerIdentity().String() + " didn't get the <tmpShufflingResult> on time")
+		return fmt.Errorf("%s didn't get the <tmpShufflingResult> on time", s.ServerIdentity())
+	case <-survey.CancelChannel:
+		return errSurveyCancelled(targetSurvey)
 	}
 
 	survey, err = s.getSurvey(targetSurvey)
@@ -765,7 +1907,9 @@ func (s *Service) TaggingPhase(targetSurvey SurveyID) error {
 	select {
 	case tmpDeterministicTaggingResult = <-pi.(*protocolsunlynx.DeterministicTaggingProtocol).FeedbackChannel:
 	case <-time.After(libunlynx.TIMEOUT):
-		return fmt.Errorf(s.ServerIdentity().String() + " didn't get the <tmpDeterministicTaggingResult> on time")
+		return fmt.Errorf("%s didn't get the <tmpDeterministicTaggingResult> on time", s.ServerIdentity())
+	case <-survey.CancelChannel:
+		return errSurveyCancelled(targetSurvey)
 	}
 
 	survey, err = s.getSurvey(targetSurvey)
@@ -781,16 +1925,40 @@ func (s *Service) TaggingPhase(targetSurvey SurveyID) error {
 	}
 	deterministicTaggingResult = deterministicTaggingResult[len(survey.Query.Where):]
 
+	var queryRangeTag []libunlynx.WhereQueryRangeTagged
+	for _, wr := range survey.Query.WhereRange {
+		newElem := libunlynx.WhereQueryRangeTagged{Name: wr.Name, Cover: make([]libunlynx.GroupingKey, len(wr.Cover))}
+		for i, v := range deterministicTaggingResult[:len(wr.Cover)] {
+			newElem.Cover[i] = v.DetTagWhere[0]
+		}
+		queryRangeTag = append(queryRangeTag, newElem)
+		deterministicTaggingResult = deterministicTaggingResult[len(wr.Cover):]
+	}
+
+	predicate, err := survey.Query.compilePredicate()
+	if err != nil {
+		return err
+	}
 	var filteredResponses []libunlynx.FilteredResponseDet
-	if survey.Query.Predicate == "" || len(queryWhereTag) == 0 {
+	if predicate == nil {
 		filteredResponses = FilterNone(deterministicTaggingResult)
 	} else {
-		filteredResponses = FilterResponses(survey.Query.Predicate, queryWhereTag, deterministicTaggingResult)
+		filteredResponses, err = FilterResponses(predicate, queryWhereTag, queryRangeTag, deterministicTaggingResult)
+		if err != nil {
+			return err
+		}
 	}
 
-	survey.PushDeterministicFilteredResponses(filteredResponses, s.ServerIdentity().String(), survey.Query.Proofs)
+	aggregationProofs := survey.PushDeterministicFilteredResponses(filteredResponses, s.ServerIdentity().String(), survey.Query.Proofs)
 	err = s.putSurvey(targetSurvey, survey)
-	return err
+	if err != nil {
+		return err
+	}
+
+	if survey.Query.Proofs {
+		return s.publishProofs(targetSurvey, &ProofsPublication{Phase: PhaseTagging, AggregationProofs: aggregationProofs})
+	}
+	return nil
 }
 
 // AggregationPhase performs the per-group aggregation on the currently grouped data.
@@ -800,31 +1968,49 @@ func (s *Service) AggregationPhase(targetSurvey SurveyID) error {
 		return err
 	}
 
+	survey, err := s.getSurvey(targetSurvey)
+	if err != nil {
+		return err
+	}
+
 	var tmpAggreagtionResult protocolsunlynx.CothorityAggregatedData
 	select {
 	case tmpAggreagtionResult = <-pi.(*protocolsunlynx.CollectiveAggregationProtocol).FeedbackChannel:
 	case <-time.After(libunlynx.TIMEOUT):
-		return fmt.Errorf(s.ServerIdentity().String() + " didn't get the <tmpAggreagtionResult> on time")
+		return fmt.Errorf("%s didn't get the <tmpAggreagtionResult> on time", s.ServerIdentity())
+	case <-survey.CancelChannel:
+		return errSurveyCancelled(targetSurvey)
 	}
 
+	survey.PushCothorityAggregatedFilteredResponses(tmpAggreagtionResult.GroupedData)
+	err = s.putSurvey(targetSurvey, survey)
+	return err
+}
+
+// DROPhase generates the noise values defined by the differential privacy parameters and shuffles them: the list of
+// noise values is repeated for each aggregated value of the results (groups times aggregating attributes) and each of
+// them then gets its own noise value from the shuffled list.
+func (s *Service) DROPhase(targetSurvey SurveyID, diffPri libunlynxdiffprivacy.Params) error {
 	survey, err := s.getSurvey(targetSurvey)
 	if err != nil {
 		return err
 	}
+	cells := survey.NbrAggregatedCells()
+	if cells == 0 {
+		return nil
+	}
 
-	survey.PushCothorityAggregatedFilteredResponses(tmpAggreagtionResult.GroupedData)
+	// a single list is shuffled, each aggregated value gets a different value of it
+	survey.NoiseValues, err = diffPri.GenerateNoiseFor(cells)
+	if err != nil {
+		return err
+	}
 	err = s.putSurvey(targetSurvey, survey)
-	return err
-}
-
-// DROPhase shuffles the list of noise values.
-func (s *Service) DROPhase(targetSurvey SurveyID) error {
-	pi, err := s.StartProtocol(protocolsunlynx.DROProtocolName, targetSurvey)
 	if err != nil {
 		return err
 	}
 
-	survey, err := s.getSurvey(targetSurvey)
+	pi, err := s.StartProtocol(protocolsunlynx.DROProtocolName, targetSurvey)
 	if err != nil {
 		return err
 	}
@@ -833,33 +2019,83 @@ func (s *Service) DROPhase(targetSurvey SurveyID) error {
 	select {
 	case tmpShufflingResult = <-pi.(*protocolsunlynx.ShufflingProtocol).FeedbackChannel:
 	case <-time.After(libunlynx.TIMEOUT):
-		return fmt.Errorf(s.ServerIdentity().String() + " didn't get the <tmpShufflingResult> on time")
+		return fmt.Errorf("%s didn't get the <tmpShufflingResult> on time", s.ServerIdentity())
+	case <-survey.CancelChannel:
+		return errSurveyCancelled(targetSurvey)
 	}
 
+	survey, err = s.getSurvey(targetSurvey)
+	if err != nil {
+		return err
+	}
 	shufflingResult := protocolsunlynx.MatrixCipherTextToProcessResponse(tmpShufflingResult, survey.Lengths)
 
-	survey.Noise = shufflingResult[0].AggregatingAttributes[0]
+	survey.Noise = make(libunlynx.CipherVector, cells)
+	for i := range survey.Noise {
+		survey.Noise[i] = shufflingResult[i].AggregatingAttributes[0]
+	}
+	survey.NoiseValues = nil
 	err = s.putSurvey(targetSurvey, survey)
 	return err
 }
 
-// KeySwitchingPhase performs the switch to the querier's key on the currently aggregated data.
+// KeySwitchingPhase performs the switch to the querier's key on the currently aggregated data. If the data is encrypted
+// under a collective key generated with a DKG, the contributions of the first servers to answer (the threshold of the
+// key) are enough.
 func (s *Service) KeySwitchingPhase(targetSurvey SurveyID) error {
-	pi, err := s.StartProtocol(protocolsunlynx.KeySwitchingProtocolName, targetSurvey)
+	survey, err := s.getSurvey(targetSurvey)
 	if err != nil {
 		return err
 	}
 
-	survey, err := s.getSurvey(targetSurvey)
+	var feedback chan libunlynx.CipherVector
+	var target *libunlynx.CipherVector
+	var thresholdKeySwitch *protocolsunlynx.ThresholdKeySwitchingProtocol
+	if survey.Query.CollectiveKey != nil {
+		pi, err := s.StartProtocol(protocolsunlynx.ThresholdKeySwitchingProtocolName, targetSurvey)
+		if err != nil {
+			return err
+		}
+		thresholdKeySwitch = pi.(*protocolsunlynx.ThresholdKeySwitchingProtocol)
+		feedback, target = thresholdKeySwitch.FeedbackChannel, thresholdKeySwitch.TargetOfSwitch
+	} else {
+		pi, err := s.StartProtocol(protocolsunlynx.KeySwitchingProtocolName, targetSurvey)
+		if err != nil {
+			return err
+		}
+		keySwitch := pi.(*protocolsunlynx.KeySwitchingProtocol)
+		feedback, target = keySwitch.FeedbackChannel, keySwitch.TargetOfSwitch
+	}
+
+	survey, err = s.getSurvey(targetSurvey)
 	if err != nil {
 		return err
 	}
 
 	var tmpKeySwitchingResult libunlynx.CipherVector
 	select {
-	case tmpKeySwitchingResult = <-pi.(*protocolsunlynx.KeySwitchingProtocol).FeedbackChannel:
+	case tmpKeySwitchingResult = <-feedback:
 	case <-time.After(libunlynx.TIMEOUT):
-		return fmt.Errorf(s.ServerIdentity().String() + " didn't get the <tmpKeySwitchingResult> on time")
+		return fmt.Errorf("%s didn't get the <tmpKeySwitchingResult> on time", s.ServerIdentity())
+	case <-survey.CancelChannel:
+		return errSurveyCancelled(targetSurvey)
+	}
+	// only the servers whose contributions were combined have to publish their proofs, which must match the switched
+	// ciphertexts
+	if survey.Query.Proofs {
+		var shares map[string]int
+		if thresholdKeySwitch != nil {
+			survey.ProofsRecord.requireOnly(thresholdKeySwitch.Contributors)
+			shares = make(map[string]int)
+			for _, si := range thresholdKeySwitch.Contributors {
+				for i, public := range thresholdKeySwitch.Participants {
+					if public.Equal(si.Public) {
+						shares[si.String()] = i
+					}
+				}
+			}
+		}
+		survey.ProofsRecord.keySwitched(*target, tmpKeySwitchingResult, shares)
 	}
 
 	keySwitchedAggregatedResponses := protocolsunlynx.CipherVectorToFilteredResponse(tmpKeySwitchingResult, survey.Lengths)
@@ -869,35 +2105,65 @@ func (s *Service) KeySwitchingPhase(targetSurvey SurveyID) error {
 	return err
 }
 
+// Garbage Collection
+//______________________________________________________________________________________________________________________
+
+// scheduleRemoval removes a survey from the server once it expires (SurveyTTL after its creation).
+func (s *Service) scheduleRemoval(sid SurveyID, creationTime int64) {
+	time.AfterFunc(time.Until(time.Unix(0, creationTime).Add(SurveyTTL)), func() {
+		if _, err := s.getSurvey(sid); err != nil {
+			// already removed
+			return
+		}
+		log.Lvl1(s.ServerIdentity(), " removes expired survey ", sid)
+		if err := s.removeSurvey(sid); err != nil {
+			log.Error(err)
+		}
+	})
+}
+
 // Support Functions
 //______________________________________________________________________________________________________________________
 
-// FilterResponses evaluates the predicate and keeps the entries that satisfy the conditions
-func FilterResponses(pred string, whereQueryValues []libunlynx.WhereQueryAttributeTagged, responsesToFilter []libunlynx.ProcessResponseDet) []libunlynx.FilteredResponseDet {
+// FilterResponses evaluates the (compiled) predicate and keeps the entries that satisfy the conditions. A response is
+// in the k-th range if one of the tags of its prefixes is in the cover of the range.
+func FilterResponses(pred *Predicate, whereQueryValues []libunlynx.WhereQueryAttributeTagged, whereQueryRanges []libunlynx.WhereQueryRangeTagged, responsesToFilter []libunlynx.ProcessResponseDet) ([]libunlynx.FilteredResponseDet, error) {
 	var result []libunlynx.FilteredResponseDet
-	for _, v := range responsesToFilter {
-		expression, err := govaluate.NewEvaluableExpression(pred)
-		if err != nil {
-			return result
+
+	queryValues := make([]libunlynx.GroupingKey, len(whereQueryValues))
+	for i, w := range whereQueryValues {
+		queryValues[i] = w.Value
+	}
+	covers := make([]map[libunlynx.GroupingKey]bool, len(whereQueryRanges))
+	for k, wr := range whereQueryRanges {
+		covers[k] = make(map[libunlynx.GroupingKey]bool, len(wr.Cover))
+		for _, tag := range wr.Cover {
+			covers[k][tag] = true
 		}
-		parameters := make(map[string]interface{}, len(whereQueryValues)+len(responsesToFilter[0].DetTagWhere))
-		counter := 0
-		for i := 0; i < len(whereQueryValues)+len(responsesToFilter[0].DetTagWhere); i++ {
+	}
 
-			if i%2 == 0 {
-				parameters["v"+strconv.Itoa(i)] = string(whereQueryValues[counter].Value)
-			} else {
-				parameters["v"+strconv.Itoa(i)] = string(v.DetTagWhere[counter])
-				counter++
+	inRanges := make([]bool, len(whereQueryRanges))
+	for _, v := range responsesToFilter {
+		// the prefixes of the attributes compared with ranges follow the where attributes
+		offset := len(whereQueryValues)
+		for k, wr := range whereQueryRanges {
+			levels := len(wr.Cover)/2 + 1
+			inRanges[k] = false
+			for j := offset; j < offset+levels && j < len(v.DetTagWhere); j++ {
+				inRanges[k] = inRanges[k] || covers[k][v.DetTagWhere[j]]
 			}
+			offset += levels
+		}
 
+		keep, err := pred.Evaluate(queryValues, v.DetTagWhere, inRanges)
+		if err != nil {
+			return nil, err
 		}
-		keep, err := expression.Evaluate(parameters)
-		if keep.(bool) {
+		if keep {
 			result = append(result, libunlynx.FilteredResponseDet{DetTagGroupBy: v.DetTagGroupBy, Fr: libunlynx.FilteredResponse{GroupByEnc: v.PR.GroupByEnc, AggregatingAttributes: v.PR.AggregatingAttributes}})
 		}
 	}
-	return result
+	return result, nil
 }
 
 // FilterNone skips the filtering of attributes when there is no predicate (the number of where attributes == 0)
@@ -909,6 +2175,15 @@ func FilterNone(responsesToFilter []libunlynx.ProcessResponseDet) []libunlynx.Fi
 	return result
 }
 
+// rosterMember checks if a server (e.g. the sender of a message) is in a roster, with the same public key
+func rosterMember(roster *onet.Roster, si *network.ServerIdentity) bool {
+	if si == nil {
+		return false
+	}
+	_, member := roster.Search(si.ID)
+	return member != nil && member.Public.Equal(si.Public)
+}
+
 // CountDPs counts the number of data providers targeted by a query/survey
 func CountDPs(m map[string]int64) int64 {
 	result := int64(0)
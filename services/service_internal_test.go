@@ -0,0 +1,6 @@
+package servicesunlynx
+
+// TestClose stops the background worker of the precomputation pool (called when the servers of a test are closed)
+func (s *Service) TestClose() {
+	s.Precomputations.Close()
+}
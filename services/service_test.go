@@ -2,16 +2,22 @@ package servicesunlynx_test
 
 import (
 	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/lib/differential_privacy"
+	"github.com/ldsec/unlynx/lib/range"
 	"github.com/ldsec/unlynx/services"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3/util/key"
 	"go.dedis.ch/onet/v3"
 	"go.dedis.ch/onet/v3/log"
+	"io/ioutil"
+	"math"
 	"os"
 	"reflect"
 	"strconv"
 	"sync"
 	"testing"
+	"time"
 )
 
 // numberGrpAttr is the number of group attributes.
@@ -26,6 +32,23 @@ func TestMain(m *testing.M) {
 	log.MainTest(m)
 }
 
+// filterResponses compiles a predicate for the where attributes and the range conditions of a query and filters the
+// responses
+func filterResponses(t *testing.T, predicate string, whereAttributes []libunlynx.WhereQueryAttributeTagged, whereRanges []libunlynx.WhereQueryRangeTagged, data []libunlynx.ProcessResponseDet) []libunlynx.FilteredResponseDet {
+	var where, ranges []string
+	for _, w := range whereAttributes {
+		where = append(where, w.Name)
+	}
+	for _, wr := range whereRanges {
+		ranges = append(ranges, wr.Name)
+	}
+	pred, err := servicesunlynx.CompilePredicate(predicate, where, ranges)
+	require.NoError(t, err)
+	result, err := servicesunlynx.FilterResponses(pred, whereAttributes, whereRanges, data)
+	require.NoError(t, err)
+	return result
+}
+
 func TestFilterResponses(t *testing.T) {
 	// ****************************************
 	// simple predicate
@@ -45,14 +68,14 @@ func TestFilterResponses(t *testing.T) {
 	data = append(data, libunlynx.ProcessResponseDet{PR: libunlynx.ProcessResponse{}, DetTagGroupBy: "", DetTagWhere: whereTrue[:]})
 	data = append(data, libunlynx.ProcessResponseDet{PR: libunlynx.ProcessResponse{}, DetTagGroupBy: "", DetTagWhere: whereFalse[:]})
 
-	result := servicesunlynx.FilterResponses(predicate, whereAttributes, data)
+	result := filterResponses(t, predicate, whereAttributes, nil, data)
 
 	// 1 result(s) are true
 	assert.Equal(t, len(result), 1)
 
 	data = append(data, libunlynx.ProcessResponseDet{PR: libunlynx.ProcessResponse{}, DetTagGroupBy: "", DetTagWhere: whereTrue[:]})
 
-	result = servicesunlynx.FilterResponses(predicate, whereAttributes, data)
+	result = filterResponses(t, predicate, whereAttributes, nil, data)
 
 	// 2 result(s) are true
 	assert.Equal(t, len(result), 2)
@@ -78,7 +101,56 @@ func TestFilterResponses(t *testing.T) {
 	data = append(data, libunlynx.ProcessResponseDet{PR: libunlynx.ProcessResponse{}, DetTagGroupBy: "", DetTagWhere: whereTrue2[:]})
 	data = append(data, libunlynx.ProcessResponseDet{PR: libunlynx.ProcessResponse{}, DetTagGroupBy: "", DetTagWhere: whereFalse1[:]})
 
-	result = servicesunlynx.FilterResponses(predicate, whereAttributes, data)
+	result = filterResponses(t, predicate, whereAttributes, nil, data)
+
+	// 2 result(s) are true
+	assert.Equal(t, len(result), 2)
+
+	// ****************************************
+	// range predicate: w0 == 27 && 10 <= w1 <= 20
+	predicate = "v0 == v1 && r0"
+
+	whereAttributes = []libunlynx.WhereQueryAttributeTagged{{Name: "w0", Value: "27"}}
+	toTags := func(values []int64) []libunlynx.GroupingKey {
+		tags := make([]libunlynx.GroupingKey, len(values))
+		for i, v := range values {
+			tags[i] = libunlynx.GroupingKey(strconv.FormatInt(v, 10))
+		}
+		return tags
+	}
+	cover, err := libunlynx.RangeCover(8, 10, 20)
+	assert.NoError(t, err)
+	whereRanges := []libunlynx.WhereQueryRangeTagged{{Name: "w1", Cover: toTags(cover)}}
+
+	data = make([]libunlynx.ProcessResponseDet, 0)
+	for _, w := range [][2]int64{{27, 10}, {27, 20}, {27, 15}, {27, 9}, {27, 21}, {26, 15}} {
+		prefixes, err := libunlynx.RangePrefixes(8, w[1])
+		assert.NoError(t, err)
+		tags := append([]libunlynx.GroupingKey{libunlynx.GroupingKey(strconv.FormatInt(w[0], 10))}, toTags(prefixes)...)
+		data = append(data, libunlynx.ProcessResponseDet{PR: libunlynx.ProcessResponse{}, DetTagGroupBy: "", DetTagWhere: tags})
+	}
+
+	result = filterResponses(t, predicate, whereAttributes, whereRanges, data)
+
+	// 3 result(s) are true
+	assert.Equal(t, len(result), 3)
+
+	// same predicate on the names of the attributes
+	result = filterResponses(t, "w0 == :w0 and range(w1)", whereAttributes, whereRanges, data)
+	assert.Equal(t, len(result), 3)
+
+	// ****************************************
+	// named predicate with an IN-list: w0 IN (27, 26) && w1 != 5
+	predicate = "w0 IN (:w0, :w0[1]) && NOT (w1 == :w1)"
+
+	whereAttributes = []libunlynx.WhereQueryAttributeTagged{{Name: "w0", Value: "27"}, {Name: "w0", Value: "26"}, {Name: "w1", Value: "5"}}
+
+	data = make([]libunlynx.ProcessResponseDet, 0)
+	for _, w := range [][]libunlynx.GroupingKey{{"27", "27", "4"}, {"26", "26", "4"}, {"25", "25", "4"}, {"27", "27", "5"}} {
+		data = append(data, libunlynx.ProcessResponseDet{PR: libunlynx.ProcessResponse{}, DetTagGroupBy: "", DetTagWhere: w})
+	}
+
+	result = filterResponses(t, predicate, whereAttributes, nil, data)
 
 	// 2 result(s) are true
 	assert.Equal(t, len(result), 2)
@@ -103,6 +175,12 @@ func TestCountDPs(t *testing.T) {
 func TestServiceClearAttr(t *testing.T) {
 	log.Lvl1("***************************************************************************************************")
 	os.Remove("pre_compute_multiplications.gob")
+	archive, err := ioutil.TempDir("", "proofs")
+	require.NoError(t, err)
+	defer os.RemoveAll(archive)
+	servicesunlynx.ProofsArchiveDir = archive
+	defer func() { servicesunlynx.ProofsArchiveDir = "" }()
+
 	local := onet.NewLocalTest(libunlynx.SuiTe)
 	// generate 5 hosts, they don't connect, they process messages, and they
 	// don't register the tree or entitylist
@@ -124,7 +202,7 @@ func TestServiceClearAttr(t *testing.T) {
 		nbrDPs[server.String()] = 2 // 2 DPs for each server
 	}
 
-	surveyID, err := client.SendSurveyCreationQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, sum, count, whereQueryValues, predicate, groupBy)
+	surveyID, err := client.SendSurveyCreationQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, sum, count, whereQueryValues, predicate, groupBy, servicesunlynx.SurveyOptions{})
 
 	if err != nil {
 		t.Fatal("Service did not start.", err)
@@ -171,7 +249,7 @@ func TestServiceClearAttr(t *testing.T) {
 		responses := []libunlynx.DpClearResponse{{WhereClear: sliceWhere, GroupByClear: sliceGrp, AggregatingAttributesEnc: aggr}, {WhereClear: sliceWhere, GroupByClear: sliceGrp, AggregatingAttributesEnc: aggr}}
 
 		log.Lvl1(responses)
-		err := dataHolder[i].SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, count)
+		err := dataHolder[i].SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, count, nil, nil, nil, nil)
 		assert.NoError(t, err)
 
 	}
@@ -203,6 +281,18 @@ func TestServiceClearAttr(t *testing.T) {
 			t.Error("Not expected results, got ", (*aggr)[i], " when expected ", data)
 		}
 	}
+
+	// all the servers archived valid proofs
+	verdicts, err := servicesunlynx.AuditProofsArchive(archive, *surveyID, el.Aggregate)
+	require.NoError(t, err)
+	keySwitching := 0
+	for _, v := range verdicts {
+		assert.Empty(t, v.Failed)
+		if v.Phase == servicesunlynx.PhaseKeySwitching {
+			keySwitching++
+		}
+	}
+	assert.Equal(t, len(el.List), keySwitching)
 }
 
 //______________________________________________________________________________________________________________________
@@ -232,7 +322,7 @@ func TestServiceClearGrpEncWhereAttr(t *testing.T) {
 		nbrDPs[server.String()] = 2 // 2 DPs for each server
 	}
 
-	surveyID, err := client.SendSurveyCreationQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, sum, count, whereQueryValues, predicate, groupBy)
+	surveyID, err := client.SendSurveyCreationQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, sum, count, whereQueryValues, predicate, groupBy, servicesunlynx.SurveyOptions{})
 
 	if err != nil {
 		t.Fatal("Service did not start.", err)
@@ -275,7 +365,7 @@ func TestServiceClearGrpEncWhereAttr(t *testing.T) {
 		}
 
 		responses := []libunlynx.DpClearResponse{{WhereEnc: sliceWhere, GroupByClear: sliceGrp, AggregatingAttributesEnc: aggr}, {WhereEnc: sliceWhere, GroupByClear: sliceGrp, AggregatingAttributesEnc: aggr}, {WhereEnc: sliceWhere, GroupByClear: sliceGrp1, AggregatingAttributesEnc: aggr}}
-		err := dataHolder[i].SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, count)
+		err := dataHolder[i].SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, count, nil, nil, nil, nil)
 		assert.NoError(t, err)
 	}
 
@@ -336,7 +426,7 @@ func TestServiceEncGrpClearWhereAttr(t *testing.T) {
 		nbrDPs[server.String()] = 2 // 2 DPs for each server
 	}
 
-	surveyID, err := client.SendSurveyCreationQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, sum, count, whereQueryValues, predicate, groupBy)
+	surveyID, err := client.SendSurveyCreationQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, sum, count, whereQueryValues, predicate, groupBy, servicesunlynx.SurveyOptions{})
 
 	if err != nil {
 		t.Fatal("Service did not start.", err)
@@ -380,7 +470,7 @@ func TestServiceEncGrpClearWhereAttr(t *testing.T) {
 		}
 
 		responses := []libunlynx.DpClearResponse{{WhereClear: sliceWhere, GroupByEnc: sliceGrp, AggregatingAttributesEnc: aggr}, {WhereClear: sliceWhere, GroupByEnc: sliceGrp1, AggregatingAttributesEnc: aggr}}
-		err := dataHolder[i].SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, count)
+		err := dataHolder[i].SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, count, nil, nil, nil, nil)
 		assert.NoError(t, err)
 	}
 
@@ -441,7 +531,7 @@ func TestServiceEncGrpAndWhereAttr(t *testing.T) {
 		nbrDPs[server.String()] = 2 // 2 DPs for each server
 	}
 
-	surveyID, err := client.SendSurveyCreationQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, sum, count, whereQueryValues, predicate, groupBy)
+	surveyID, err := client.SendSurveyCreationQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, sum, count, whereQueryValues, predicate, groupBy, servicesunlynx.SurveyOptions{})
 
 	if err != nil {
 		t.Fatal("Service did not start.", err)
@@ -488,7 +578,7 @@ func TestServiceEncGrpAndWhereAttr(t *testing.T) {
 		}
 
 		responses := []libunlynx.DpClearResponse{{WhereEnc: sliceWhere, GroupByEnc: sliceGrp, AggregatingAttributesEnc: aggr}, {WhereEnc: sliceWhere, GroupByEnc: sliceGrp1, AggregatingAttributesEnc: aggr}}
-		err := dataHolder[i].SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, count)
+		err := dataHolder[i].SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, count, nil, nil, nil, nil)
 		assert.NoError(t, err)
 	}
 
@@ -549,7 +639,7 @@ func TestServiceEverything(t *testing.T) {
 		nbrDPs[server.String()] = 2 // 2 DPs for each server
 	}
 
-	surveyID, err := client.SendSurveyCreationQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, sum, count, whereQueryValues, predicate, groupBy)
+	surveyID, err := client.SendSurveyCreationQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, sum, count, whereQueryValues, predicate, groupBy, servicesunlynx.SurveyOptions{})
 
 	if err != nil {
 		t.Fatal("Service did not start.", err)
@@ -592,7 +682,7 @@ func TestServiceEverything(t *testing.T) {
 		}
 
 		responses := []libunlynx.DpClearResponse{{WhereClear: sliceWhere, WhereEnc: sliceWhere, GroupByClear: sliceGrp, GroupByEnc: sliceGrp, AggregatingAttributesEnc: aggr}, {WhereClear: sliceWhere, WhereEnc: sliceWhere, GroupByClear: sliceGrp, GroupByEnc: sliceGrp1, AggregatingAttributesEnc: aggr}}
-		err := dataHolder[i].SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, count)
+		err := dataHolder[i].SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, count, nil, nil, nil, nil)
 		assert.NoError(t, err)
 	}
 
@@ -653,7 +743,7 @@ func TestServiceEncGrpAndWhereAttrWithCount(t *testing.T) {
 		nbrDPs[server.String()] = 2 // 2 DPs for each server
 	}
 
-	surveyID, err := client.SendSurveyCreationQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, sum, count, whereQueryValues, predicate, groupBy)
+	surveyID, err := client.SendSurveyCreationQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, sum, count, whereQueryValues, predicate, groupBy, servicesunlynx.SurveyOptions{})
 
 	if err != nil {
 		t.Fatal("Service did not start.", err)
@@ -696,7 +786,7 @@ func TestServiceEncGrpAndWhereAttrWithCount(t *testing.T) {
 		}
 
 		responses := []libunlynx.DpClearResponse{{WhereClear: sliceWhere, WhereEnc: sliceWhere, GroupByClear: sliceGrp, GroupByEnc: sliceGrp, AggregatingAttributesEnc: aggr}, {WhereClear: sliceWhere, WhereEnc: sliceWhere, GroupByClear: sliceGrp, GroupByEnc: sliceGrp1, AggregatingAttributesEnc: aggr}}
-		err := dataHolder[i].SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, count)
+		err := dataHolder[i].SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, count, nil, nil, nil, nil)
 		assert.NoError(t, err)
 	}
 
@@ -764,7 +854,7 @@ func TestAllServersNoDPs(t *testing.T) {
 		}
 	}
 
-	surveyID, err := client.SendSurveyCreationQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, sum, count, whereQueryValues, predicate, groupBy)
+	surveyID, err := client.SendSurveyCreationQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, sum, count, whereQueryValues, predicate, groupBy, servicesunlynx.SurveyOptions{})
 	if err != nil {
 		t.Fatal("Service did not start:", err)
 	}
@@ -806,7 +896,7 @@ func TestAllServersNoDPs(t *testing.T) {
 		}
 
 		responses := []libunlynx.DpClearResponse{{WhereClear: sliceWhere, WhereEnc: sliceWhere, GroupByClear: sliceGrp, GroupByEnc: sliceGrp, AggregatingAttributesEnc: aggr}, {WhereClear: sliceWhere, WhereEnc: sliceWhere, GroupByClear: sliceGrp, GroupByEnc: sliceGrp1, AggregatingAttributesEnc: aggr}}
-		err := dataHolder[i].SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, count)
+		err := dataHolder[i].SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, count, nil, nil, nil, nil)
 		assert.NoError(t, err)
 	}
 
@@ -869,7 +959,7 @@ func TestAllServersRandomDPs(t *testing.T) {
 	predicate := "(v0 == v1 || v2 == v3) && v4 == v5"
 	groupBy := []string{"g1", "g2", "g3"}
 
-	surveyID, err := client.SendSurveyCreationQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, sum, count, whereQueryValues, predicate, groupBy)
+	surveyID, err := client.SendSurveyCreationQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, sum, count, whereQueryValues, predicate, groupBy, servicesunlynx.SurveyOptions{})
 
 	if err != nil {
 		t.Fatal("Service did not start.")
@@ -921,7 +1011,7 @@ func TestAllServersRandomDPs(t *testing.T) {
 		}
 
 		responses := []libunlynx.DpClearResponse{{WhereClear: sliceWhere, WhereEnc: sliceWhere, GroupByClear: sliceGrp, GroupByEnc: sliceGrp, AggregatingAttributesEnc: aggr}, {WhereClear: sliceWhere, WhereEnc: sliceWhere, GroupByClear: sliceGrp, GroupByEnc: sliceGrp1, AggregatingAttributesEnc: aggr}}
-		err := dataHolder[i].SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, count)
+		err := dataHolder[i].SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, count, nil, nil, nil, nil)
 		assert.NoError(t, err)
 	}
 	expectedResults[[3]int64{0, 1, 2}] = []int64{0, 9}
@@ -994,7 +1084,7 @@ func TestConcurrentSurveys(t *testing.T) {
 			predicate := "(v0 == v1 || v2 == v3) && v4 == v5"
 			groupBy := []string{"g1", "g2", "g3"}
 
-			surveyID, err := client.SendSurveyCreationQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, sum, count, whereQueryValues, predicate, groupBy)
+			surveyID, err := client.SendSurveyCreationQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, sum, count, whereQueryValues, predicate, groupBy, servicesunlynx.SurveyOptions{})
 			require.NoError(t, err, "Service did not start.")
 
 			//save values in a map to verify them at the end
@@ -1043,7 +1133,7 @@ func TestConcurrentSurveys(t *testing.T) {
 				}
 
 				responses := []libunlynx.DpClearResponse{{WhereClear: sliceWhere, WhereEnc: sliceWhere, GroupByClear: sliceGrp, GroupByEnc: sliceGrp, AggregatingAttributesEnc: aggr}, {WhereClear: sliceWhere, WhereEnc: sliceWhere, GroupByClear: sliceGrp, GroupByEnc: sliceGrp1, AggregatingAttributesEnc: aggr}}
-				err := dataHolder[i].SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, count)
+				err := dataHolder[i].SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, count, nil, nil, nil, nil)
 				assert.NoError(t, err)
 			}
 			expectedResults[[3]int64{0, 1, 2}] = []int64{0, 9}
@@ -1083,5 +1173,501 @@ func TestFilteringFunc(t *testing.T) {
 	log.Lvl1(predicate)
 	log.Lvl1(responsesToFilter)
 	log.Lvl1(whereQueryValues)
-	log.Lvl1(servicesunlynx.FilterResponses(predicate, whereQueryValues, responsesToFilter))
+	log.Lvl1(filterResponses(t, predicate, whereQueryValues, nil, responsesToFilter))
+}
+
+//______________________________________________________________________________________________________________________
+// Test the listing, status and cancellation of a survey
+func TestSurveyLifecycle(t *testing.T) {
+	log.Lvl1("***************************************************************************************************")
+	os.Remove("pre_compute_multiplications.gob")
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+	_, el, _ := local.GenTree(3, true)
+	defer local.CloseAll()
+
+	querier := key.NewKeyPair(libunlynx.SuiTe)
+	client := servicesunlynx.NewUnLynxClientWithKeys(el.List[0], strconv.Itoa(0), querier)
+	stranger := servicesunlynx.NewUnLynxClient(el.List[0], "stranger")
+
+	nbrDPs := make(map[string]int64)
+	for _, server := range el.List {
+		nbrDPs[server.String()] = 1
+	}
+
+	sum := []string{"s1"}
+	groupBy := []string{"g1"}
+	surveyID, err := client.SendSurveyCreationQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, false, false, sum, false, nil, "", groupBy, servicesunlynx.SurveyOptions{})
+	require.NoError(t, err)
+
+	list, err := client.SendSurveyListQuery()
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, *surveyID, list[0].SurveyID)
+	assert.Equal(t, servicesunlynx.PhaseCollecting, list[0].Phase)
+
+	// the other queriers do not see the survey and cannot cancel it
+	list, err = stranger.SendSurveyListQuery()
+	require.NoError(t, err)
+	assert.Empty(t, list)
+	_, err = stranger.SendSurveyStatusQuery(*surveyID)
+	assert.Error(t, err)
+	assert.Error(t, stranger.SendSurveyCancelQuery(*surveyID))
+
+	// only the data provider of the second server sends its data so that the other servers keep waiting
+	dp := servicesunlynx.NewUnLynxClient(el.List[1], strconv.Itoa(1))
+	responses := []libunlynx.DpClearResponse{{GroupByClear: map[string]int64{"g1": 1}, AggregatingAttributesEnc: map[string]int64{"s1": 3}}}
+	require.NoError(t, dp.SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, false, nil, nil, nil, nil))
+
+	// the data providers do not get the progress of the survey
+	status, err := dp.SendSurveyDpStatusQuery(*surveyID)
+	require.NoError(t, err)
+	assert.False(t, status.Progress)
+	assert.Equal(t, int64(0), status.DpReceived)
+
+	status, err = servicesunlynx.NewUnLynxClientWithKeys(el.List[1], strconv.Itoa(0), querier).SendSurveyStatusQuery(*surveyID)
+	require.NoError(t, err)
+	assert.True(t, status.Progress)
+	assert.Equal(t, int64(1), status.DpReceived)
+	assert.Equal(t, int64(1), status.DpExpected)
+
+	status, err = client.SendSurveyStatusQuery(*surveyID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), status.DpReceived)
+
+	resultErr := make(chan error)
+	go func() {
+		_, _, err := client.SendSurveyResultsQuery(*surveyID)
+		resultErr <- err
+	}()
+	time.Sleep(500 * time.Millisecond)
+
+	require.NoError(t, client.SendSurveyCancelQuery(*surveyID))
+
+	select {
+	case err := <-resultErr:
+		assert.Error(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("the results query was not unblocked by the cancellation")
+	}
+
+	for i, server := range el.List {
+		list, err := servicesunlynx.NewUnLynxClientWithKeys(server, strconv.Itoa(i), querier).SendSurveyListQuery()
+		require.NoError(t, err)
+		assert.Empty(t, list)
+	}
+	_, err = client.SendSurveyStatusQuery(*surveyID)
+	assert.Error(t, err)
+}
+
+//______________________________________________________________________________________________________________________
+// Test the removal of expired surveys
+func TestSurveyExpiration(t *testing.T) {
+	log.Lvl1("***************************************************************************************************")
+	ttl := servicesunlynx.SurveyTTL
+	servicesunlynx.SurveyTTL = 200 * time.Millisecond
+	defer func() { servicesunlynx.SurveyTTL = ttl }()
+
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+	_, el, _ := local.GenTree(3, true)
+	defer local.CloseAll()
+
+	querier := key.NewKeyPair(libunlynx.SuiTe)
+	client := servicesunlynx.NewUnLynxClientWithKeys(el.List[0], strconv.Itoa(0), querier)
+	nbrDPs := map[string]int64{el.List[0].String(): 1}
+	_, err := client.SendSurveyCreationQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, false, false, []string{"s1"}, false, nil, "", []string{"g1"}, servicesunlynx.SurveyOptions{})
+	require.NoError(t, err)
+
+	for i, server := range el.List {
+		api := servicesunlynx.NewUnLynxClientWithKeys(server, strconv.Itoa(i), querier)
+		var list []servicesunlynx.SurveyStatus
+		for j := 0; j < 20; j++ {
+			list, err = api.SendSurveyListQuery()
+			require.NoError(t, err)
+			if len(list) == 0 {
+				break
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		assert.Empty(t, list)
+	}
+}
+
+//______________________________________________________________________________________________________________________
+// Test the obfuscation of the results with differential privacy
+func TestServiceDiffPrivacy(t *testing.T) {
+	log.Lvl1("***************************************************************************************************")
+	os.Remove("pre_compute_multiplications.gob")
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+	_, el, _ := local.GenTree(3, true)
+	defer local.CloseAll()
+
+	client := servicesunlynx.NewUnLynxClient(el.List[0], strconv.Itoa(0))
+
+	nbrDPs := make(map[string]int64)
+	for _, server := range el.List {
+		nbrDPs[server.String()] = 1
+	}
+
+	sum := []string{"s1", "s2"}
+	groupBy := []string{"g1"}
+
+	// wrong parameters are refused
+	_, err := client.SendSurveyCreationQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, sum, false, nil, "", groupBy, servicesunlynx.SurveyOptions{DiffPri: libunlynxdiffprivacy.Params{NoiseListSize: 10}})
+	assert.Error(t, err)
+
+	// the noise values are in [-1, 2]: 5 times 0, twice 1 and -1 and once 2
+	diffPri := libunlynxdiffprivacy.Params{Epsilon: 1, Sensitivity: 1, NoiseListSize: 10, Quanta: 0.1, Scale: 1}
+	surveyID, err := client.SendSurveyCreationQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, sum, false, nil, "", groupBy, servicesunlynx.SurveyOptions{DiffPri: diffPri})
+	require.NoError(t, err)
+
+	for i, server := range el.List {
+		dp := servicesunlynx.NewUnLynxClient(server, strconv.Itoa(i+1))
+		responses := []libunlynx.DpClearResponse{{GroupByClear: map[string]int64{"g1": int64(i % 2)}, AggregatingAttributesEnc: map[string]int64{"s1": 10, "s2": 20}}}
+		require.NoError(t, dp.SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, false, nil, nil, nil, nil))
+	}
+
+	grp, aggr, err := client.SendSurveyResultsQuery(*surveyID)
+	require.NoError(t, err)
+	require.Len(t, *grp, 2)
+
+	expected := map[int64][]int64{0: {20, 40}, 1: {10, 20}}
+	for i := range *grp {
+		// each aggregated value gets its own noise
+		for j, v := range expected[(*grp)[i][0]] {
+			noise := (*aggr)[i][j] - v
+			assert.True(t, noise >= -1 && noise <= 2)
+		}
+	}
+}
+
+//______________________________________________________________________________________________________________________
+// Test the aggregation of negative and fixed-point values
+func TestServiceAttributeTypes(t *testing.T) {
+	log.Lvl1("***************************************************************************************************")
+	os.Remove("pre_compute_multiplications.gob")
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+	_, el, _ := local.GenTree(3, true)
+	defer local.CloseAll()
+
+	client := servicesunlynx.NewUnLynxClient(el.List[0], strconv.Itoa(0))
+
+	nbrDPs := make(map[string]int64)
+	for _, server := range el.List {
+		nbrDPs[server.String()] = 1
+	}
+
+	sum := []string{"s1", "s2", "s3"}
+	groupBy := []string{"g1"}
+	types := map[string]libunlynx.AttributeType{"s2": {Kind: libunlynx.TypeSigned}, "s3": {Kind: libunlynx.TypeFixed, Scale: 2}}
+
+	// the types must be valid and only given for the aggregated attributes
+	_, err := client.SendSurveyCreationQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, sum, false, nil, "", groupBy, servicesunlynx.SurveyOptions{Types: map[string]libunlynx.AttributeType{"s4": {Kind: libunlynx.TypeSigned}}})
+	assert.Error(t, err)
+	_, err = client.SendSurveyCreationQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, sum, false, nil, "", groupBy, servicesunlynx.SurveyOptions{Types: map[string]libunlynx.AttributeType{"s1": {Kind: libunlynx.TypeFixed, Scale: -1}}})
+	assert.Error(t, err)
+
+	surveyID, err := client.SendSurveyCreationQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, sum, false, nil, "", groupBy, servicesunlynx.SurveyOptions{Types: types})
+	require.NoError(t, err)
+
+	for i, server := range el.List {
+		dp := servicesunlynx.NewUnLynxClient(server, strconv.Itoa(i+1))
+		responses := []libunlynx.DpClearResponse{{GroupByClear: map[string]int64{"g1": int64(i % 2)},
+			AggregatingAttributesEnc: map[string]int64{"s1": int64(i), "s2": int64(-5 * i)},
+			AggregatingAttributesDec: map[string]float64{"s3": 1.25 - float64(i)}}}
+		require.NoError(t, dp.SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, false, types, nil, nil, nil))
+	}
+
+	results, err := client.SendSurveyTypedResultsQuery(*surveyID)
+	require.NoError(t, err)
+	require.Len(t, results.GroupBy, 2)
+	assert.Equal(t, []libunlynx.AttributeType{{}, types["s2"], types["s3"]}, results.Types)
+
+	expected := map[int64][]float64{0: {2, -10, 0.5}, 1: {1, -5, 0.25}}
+	for i := range results.GroupBy {
+		assert.Equal(t, expected[results.GroupBy[i][0]], results.Aggregates[i])
+	}
+}
+
+//______________________________________________________________________________________________________________________
+// Test the computation of the aggregate operations (mean, variance...) by the querier
+func TestServiceAggregateOperations(t *testing.T) {
+	log.Lvl1("***************************************************************************************************")
+	os.Remove("pre_compute_multiplications.gob")
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+	_, el, _ := local.GenTree(3, true)
+	defer local.CloseAll()
+
+	client := servicesunlynx.NewUnLynxClient(el.List[0], strconv.Itoa(0))
+
+	nbrDPs := make(map[string]int64)
+	for _, server := range el.List {
+		nbrDPs[server.String()] = 1
+	}
+
+	groupBy := []string{"g1"}
+	types := map[string]libunlynx.AttributeType{"s2": {Kind: libunlynx.TypeFixed, Scale: 1}}
+	operations := []libunlynx.Operation{{Op: libunlynx.OpMean, Attribute: "s1"}, {Op: libunlynx.OpVariance, Attribute: "s1"},
+		{Op: libunlynx.OpStdDev, Attribute: "s1"}, {Op: libunlynx.OpCount}, {Op: libunlynx.OpMean, Attribute: "s2"}}
+
+	// the squared attributes must be bounded
+	_, err := client.SendSurveyCreationQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, nil, false, nil, "", groupBy, servicesunlynx.SurveyOptions{Operations: operations, Types: types})
+	assert.Error(t, err)
+	_, err = client.SendSurveyCreationQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, nil, false, nil, "", groupBy, servicesunlynx.SurveyOptions{Operations: operations, Types: types,
+		Bounds: []libunlynxrange.Bound{{Attribute: "s1", Min: 0, Max: libunlynx.MaxHomomorphicInt}}})
+	assert.Error(t, err)
+
+	bounds := []libunlynxrange.Bound{{Attribute: "s1", Min: 0, Max: 10}}
+	surveyID, err := client.SendSurveyCreationQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, nil, false, nil, "", groupBy, servicesunlynx.SurveyOptions{Operations: operations, Types: types, Bounds: bounds})
+	require.NoError(t, err)
+
+	for i, server := range el.List {
+		dp := servicesunlynx.NewUnLynxClient(server, strconv.Itoa(i+1))
+		var responses []libunlynx.DpClearResponse
+		for _, v := range []int64{int64(i), int64(i + 2)} {
+			responses = append(responses, libunlynx.DpClearResponse{GroupByClear: map[string]int64{"g1": int64(i % 2)},
+				AggregatingAttributesEnc: map[string]int64{"s1": v}, AggregatingAttributesDec: map[string]float64{"s2": 0.5}})
+		}
+		status, err := dp.SendSurveyDpStatusQuery(*surveyID)
+		require.NoError(t, err)
+		require.NoError(t, dp.SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, false, types, operations, nil, status.Bounds))
+	}
+
+	results, err := client.SendSurveyTypedResultsQuery(*surveyID)
+	require.NoError(t, err)
+	require.Len(t, results.GroupBy, 2)
+	assert.Equal(t, []string{"s1", "s1^2", "s2", "count"}, results.Columns)
+	assert.Equal(t, operations, results.Operations)
+
+	// group 0: 0, 2, 2, 4 and group 1: 1, 3
+	expected := map[int64][]float64{0: {2, 2, math.Sqrt(2), 4, 0.5}, 1: {2, 1, 1, 2, 0.5}}
+	for i := range results.GroupBy {
+		assert.InDeltaSlice(t, expected[results.GroupBy[i][0]], results.Statistics[i], 1e-9)
+	}
+}
+
+//______________________________________________________________________________________________________________________
+// Test a query with range conditions on encrypted where attributes
+func TestServiceRangePredicate(t *testing.T) {
+	log.Lvl1("***************************************************************************************************")
+	os.Remove("pre_compute_multiplications.gob")
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+	_, el, _ := local.GenTree(3, true)
+	defer local.CloseAll()
+
+	client := servicesunlynx.NewUnLynxClient(el.List[0], strconv.Itoa(0))
+
+	nbrDPs := make(map[string]int64)
+	for _, server := range el.List {
+		nbrDPs[server.String()] = 1
+	}
+
+	// SELECT SUM(s1) ... WHERE w1 >= 3 AND w2 BETWEEN 2 AND 5 GROUP BY g1
+	bits := int64(8)
+	r1, err := libunlynx.NewWhereQueryRange("w1", bits, 3, math.MaxInt64, el.Aggregate)
+	require.NoError(t, err)
+	r2, err := libunlynx.NewWhereQueryRange("w2", bits, 2, 5, el.Aggregate)
+	require.NoError(t, err)
+	whereRange := []libunlynx.WhereQueryRange{r1, r2}
+
+	sum := []string{"s1"}
+	groupBy := []string{"g1"}
+	surveyID, err := client.SendSurveyCreationQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, sum, false, nil, "r0 && r1", groupBy, servicesunlynx.SurveyOptions{WhereRange: whereRange})
+	require.NoError(t, err)
+
+	ranges := map[string]int64{"w1": bits, "w2": bits}
+	expected := make(map[int64]int64)
+	for i, server := range el.List {
+		dp := servicesunlynx.NewUnLynxClient(server, strconv.Itoa(i+1))
+		var responses []libunlynx.DpClearResponse
+		for j := int64(0); j < 6; j++ {
+			w1, w2 := j+int64(i), 7-j
+			responses = append(responses, libunlynx.DpClearResponse{GroupByClear: map[string]int64{"g1": j % 2},
+				WhereEnc: map[string]int64{"w1": w1, "w2": w2}, AggregatingAttributesEnc: map[string]int64{"s1": j + 1}})
+			if w1 >= 3 && w2 >= 2 && w2 <= 5 {
+				expected[j%2] += j + 1
+			}
+		}
+		require.NoError(t, dp.SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, false, nil, nil, ranges, nil))
+	}
+
+	grp, aggr, err := client.SendSurveyResultsQuery(*surveyID)
+	require.NoError(t, err)
+	require.Len(t, *grp, len(expected))
+	for i, v := range *grp {
+		assert.Equal(t, []int64{expected[v[0]]}, (*aggr)[i])
+	}
+}
+
+//______________________________________________________________________________________________________________________
+// Test a survey created from an SQL-like query
+func TestServiceSQLQuery(t *testing.T) {
+	log.Lvl1("***************************************************************************************************")
+	os.Remove("pre_compute_multiplications.gob")
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+	_, el, _ := local.GenTree(3, true)
+	defer local.CloseAll()
+
+	client := servicesunlynx.NewUnLynxClient(el.List[0], strconv.Itoa(0))
+
+	nbrDPs := make(map[string]int64)
+	for _, server := range el.List {
+		nbrDPs[server.String()] = 1
+	}
+
+	query := "SELECT SUM(s1), COUNT(*) WHERE w1 = 1 AND (w2 = 27 OR w3 >= 4) GROUP BY g1"
+	surveyID, err := client.SendSurveySQLQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, query, 8, servicesunlynx.SurveyOptions{})
+	require.NoError(t, err)
+
+	expected := make(map[int64][]int64)
+	for i, server := range el.List {
+		dp := servicesunlynx.NewUnLynxClient(server, strconv.Itoa(i+1))
+		var responses []libunlynx.DpClearResponse
+		for j := int64(0); j < 6; j++ {
+			w1, w2, w3 := j%2, 27-j, j+int64(i)
+			responses = append(responses, libunlynx.DpClearResponse{GroupByClear: map[string]int64{"g1": j % 3},
+				WhereEnc: map[string]int64{"w1": w1, "w2": w2, "w3": w3}, AggregatingAttributesEnc: map[string]int64{"s1": j}})
+			if w1 == 1 && (w2 == 27 || w3 >= 4) {
+				if expected[j%3] == nil {
+					expected[j%3] = []int64{0, 0}
+				}
+				expected[j%3][0] += j
+				expected[j%3][1]++
+			}
+		}
+		require.NoError(t, dp.SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, true, nil, nil, map[string]int64{"w3": 8}, nil))
+	}
+
+	grp, aggr, err := client.SendSurveyResultsQuery(*surveyID)
+	require.NoError(t, err)
+	require.Len(t, *grp, len(expected))
+	for i, v := range *grp {
+		assert.Equal(t, expected[v[0]], (*aggr)[i])
+	}
+}
+
+//______________________________________________________________________________________________________________________
+// Test that a survey with a wrong predicate is rejected when it is created
+func TestServiceInvalidPredicate(t *testing.T) {
+	log.Lvl1("***************************************************************************************************")
+	os.Remove("pre_compute_multiplications.gob")
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+	_, el, _ := local.GenTree(3, true)
+	defer local.CloseAll()
+
+	client := servicesunlynx.NewUnLynxClient(el.List[0], strconv.Itoa(0))
+
+	nbrDPs := make(map[string]int64)
+	for _, server := range el.List {
+		nbrDPs[server.String()] = 1
+	}
+
+	where := []libunlynx.WhereQueryAttribute{{Name: "w1", Value: *libunlynx.EncryptInt(el.Aggregate, 1)}}
+	for _, predicate := range []string{"w1 == :w2", "w1 ==", "v0 == v1 + 1"} {
+		_, err := client.SendSurveyCreationQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, []string{"s1"}, false, where, predicate, []string{"g1"}, servicesunlynx.SurveyOptions{})
+		assert.Error(t, err, predicate)
+	}
+
+	surveyID, err := client.SendSurveyCreationQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, []string{"s1"}, false, where, "w1 == :w1", []string{"g1"}, servicesunlynx.SurveyOptions{})
+	require.NoError(t, err)
+
+	for i, server := range el.List {
+		dp := servicesunlynx.NewUnLynxClient(server, strconv.Itoa(i+1))
+		responses := []libunlynx.DpClearResponse{
+			{GroupByClear: map[string]int64{"g1": 0}, WhereEnc: map[string]int64{"w1": 1}, AggregatingAttributesEnc: map[string]int64{"s1": 2}},
+			{GroupByClear: map[string]int64{"g1": 0}, WhereEnc: map[string]int64{"w1": 2}, AggregatingAttributesEnc: map[string]int64{"s1": 5}},
+		}
+		require.NoError(t, dp.SendSurveyResponseQuery(*surveyID, responses, el.Aggregate, 1, false, nil, nil, nil, nil))
+	}
+
+	grp, aggr, err := client.SendSurveyResultsQuery(*surveyID)
+	require.NoError(t, err)
+	assert.Equal(t, [][]int64{{0}}, *grp)
+	assert.Equal(t, [][]int64{{6}}, *aggr)
+}
+
+//______________________________________________________________________________________________________________________
+// Test that the queries and the responses built with another suite than the one of the servers are rejected
+func TestServiceWrongSuite(t *testing.T) {
+	log.Lvl1("***************************************************************************************************")
+	os.Remove("pre_compute_multiplications.gob")
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+	_, el, _ := local.GenTree(3, true)
+	defer local.CloseAll()
+
+	client := servicesunlynx.NewUnLynxClient(el.List[0], strconv.Itoa(0))
+	nbrDPs := make(map[string]int64)
+	for _, server := range el.List {
+		nbrDPs[server.String()] = 1
+	}
+	other := libunlynx.SupportedSuites[0]
+	if libunlynx.CheckSuite(other) == nil {
+		other = libunlynx.SupportedSuites[1]
+	}
+
+	scq := servicesunlynx.SurveyCreationQuery{Roster: *el, MapDPs: nbrDPs, Sum: []string{"s1"}, Count: true, GroupBy: []string{"g1"}, Suite: other}
+	assert.Error(t, client.SendProtobuf(el.List[0], &scq, &servicesunlynx.ServiceState{}))
+
+	surveyID, err := client.SendSurveyCreationQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, false, false, []string{"s1"}, true, nil, "", []string{"g1"}, servicesunlynx.SurveyOptions{})
+	require.NoError(t, err)
+
+	responses := []libunlynx.DpClearResponse{{GroupByClear: map[string]int64{"g1": 0}, AggregatingAttributesEnc: map[string]int64{"s1": 2}}}
+	s, err := servicesunlynx.EncryptDataToSurvey("dp", *surveyID, responses, el.Aggregate, 1, true, nil, nil, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, libunlynx.SuiTe.String(), s.Suite)
+	s.Suite = other
+	assert.Error(t, client.SendEncryptedSurveyResponseQuery(s))
+	s.Suite = libunlynx.SuiTe.String()
+	assert.NoError(t, client.SendEncryptedSurveyResponseQuery(s))
+}
+
+//______________________________________________________________________________________________________________________
+// Test the data providers encoding their responses as given by the status of the survey and sending them in a bundle
+func TestServiceDpBundle(t *testing.T) {
+	log.Lvl1("***************************************************************************************************")
+	os.Remove("pre_compute_multiplications.gob")
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+	_, el, _ := local.GenTree(3, true)
+	defer local.CloseAll()
+
+	client := servicesunlynx.NewUnLynxClient(el.List[0], strconv.Itoa(0))
+
+	nbrDPs := make(map[string]int64)
+	for _, server := range el.List {
+		nbrDPs[server.String()] = 1
+	}
+
+	types := map[string]libunlynx.AttributeType{"s1": {Kind: libunlynx.TypeFixed, Scale: 1}}
+	surveyID, err := client.SendSurveySQLQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, proofsService, false, "SELECT AVG(s1) WHERE w1 >= 30 GROUP BY g1", 8, servicesunlynx.SurveyOptions{Types: types})
+	require.NoError(t, err)
+
+	dir, err := ioutil.TempDir("", "unlynx")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for i, server := range el.List {
+		dp := servicesunlynx.NewUnLynxClient(server, strconv.Itoa(i+1))
+		status, err := dp.SendSurveyDpStatusQuery(*surveyID)
+		require.NoError(t, err)
+		assert.True(t, status.Count)
+		assert.Equal(t, map[string]int64{"w1": 8}, status.RangeBits)
+
+		responses := []libunlynx.DpClearResponse{
+			{GroupByEnc: map[string]int64{"g1": 0}, WhereEnc: map[string]int64{"w1": 42}, AggregatingAttributesDec: map[string]float64{"s1": 71.5}},
+			{GroupByEnc: map[string]int64{"g1": 0}, WhereEnc: map[string]int64{"w1": 35}, AggregatingAttributesDec: map[string]float64{"s1": 60.5}},
+			{GroupByEnc: map[string]int64{"g1": 0}, WhereEnc: map[string]int64{"w1": 20}, AggregatingAttributesDec: map[string]float64{"s1": 90}},
+		}
+		s, err := servicesunlynx.EncryptDataToSurvey(dp.String(), *surveyID, responses, el.Aggregate, 1, status.Count, status.TypesByName(), status.Operations, status.RangeBits, status.Bounds)
+		require.NoError(t, err)
+
+		filename := dir + "/bundle" + strconv.Itoa(i)
+		require.NoError(t, servicesunlynx.SaveSurveyResponseQuery(filename, s))
+		bundle, err := servicesunlynx.LoadSurveyResponseQuery(filename)
+		require.NoError(t, err)
+		require.NoError(t, dp.SendEncryptedSurveyResponseQuery(bundle))
+	}
+
+	results, err := client.SendSurveyTypedResultsQuery(*surveyID)
+	require.NoError(t, err)
+	require.Len(t, results.Statistics, 1)
+	assert.InDeltaSlice(t, []float64{66}, results.Statistics[0], 1e-9)
 }
@@ -0,0 +1,318 @@
+package servicesunlynx
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/lib/store"
+	"go.dedis.ch/onet/v3/network"
+	"go.etcd.io/bbolt"
+)
+
+// SurveyPhase is the step of the unlynx pipeline a survey has reached.
+type SurveyPhase int
+
+const (
+	// PhaseCollecting means that the survey is waiting for the data providers to send their data
+	PhaseCollecting SurveyPhase = iota
+	// PhaseShuffling means that the survey is in the shuffling phase
+	PhaseShuffling
+	// PhaseTagging means that the survey is in the deterministic tagging phase
+	PhaseTagging
+	// PhaseAggregation means that the survey is in the collective aggregation phase
+	PhaseAggregation
+	// PhaseDRO means that the survey is in the distributed results obfuscation phase
+	PhaseDRO
+	// PhaseKeySwitching means that the survey is in the key switching phase
+	PhaseKeySwitching
+	// PhaseFinished means that the results of the survey are available
+	PhaseFinished
+	// PhaseAborted means that the survey was interrupted and cannot be completed
+	PhaseAborted
+)
+
+var phaseNames = []string{"collecting", "shuffling", "tagging", "aggregation", "DRO", "key switching", "finished", "aborted"}
+
+// String returns the name of the phase.
+func (p SurveyPhase) String() string {
+	if p < 0 || int(p) >= len(phaseNames) {
+		return "unknown"
+	}
+	return phaseNames[p]
+}
+
+// SurveyState is the part of a survey that is persisted by a SurveyStorage (channels and precomputed values are
+// rebuilt when the survey is restored, the secret of the survey is derived again from the key of the server).
+type SurveyState struct {
+	Query          SurveyCreationQuery
+	Phase          SurveyPhase
+	DpReceived     int64
+	DpKeys         []string
+	DpNonces       []string
+	Result         *ServiceResult
+	ResultError    string
+	ResultReleased bool
+	CreationTime   int64
+	Store          libunlynxstore.StoreSnapshot
+}
+
+// SurveyStorage is a backend where the service keeps the state of its surveys. The submissions of the data providers
+// are appended one by one to the state of a survey, until the next Put of the state (which includes them) replaces them.
+type SurveyStorage interface {
+	// Put stores (or replaces) the state of a survey and removes the submissions appended to the previous one
+	Put(sid SurveyID, state SurveyState) error
+	// Get returns the state of a survey
+	Get(sid SurveyID) (SurveyState, error)
+	// AppendResponse appends the submission of a data provider to the stored state of a survey
+	AppendResponse(sid SurveyID, resp SurveyResponseQuery) error
+	// Responses returns the submissions appended to the stored state of a survey, in order
+	Responses(sid SurveyID) ([]SurveyResponseQuery, error)
+	// Delete removes a survey (and its submissions) from the storage
+	Delete(sid SurveyID) error
+	// List returns the IDs of all the stored surveys
+	List() ([]SurveyID, error)
+}
+
+func init() {
+	network.RegisterMessage(&SurveyState{})
+}
+
+// Memory storage
+//______________________________________________________________________________________________________________________
+
+// MemoryStorage is a volatile SurveyStorage (nothing survives a restart of the server).
+type MemoryStorage struct {
+	mutex     sync.Mutex
+	surveys   map[SurveyID]SurveyState
+	responses map[SurveyID][]SurveyResponseQuery
+}
+
+// NewMemoryStorage constructor of a MemoryStorage.
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{surveys: make(map[SurveyID]SurveyState), responses: make(map[SurveyID][]SurveyResponseQuery)}
+}
+
+// Put stores the state of a survey in memory
+func (ms *MemoryStorage) Put(sid SurveyID, state SurveyState) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	ms.surveys[sid] = state
+	delete(ms.responses, sid)
+	return nil
+}
+
+// AppendResponse appends the submission of a data provider to a survey in memory
+func (ms *MemoryStorage) AppendResponse(sid SurveyID, resp SurveyResponseQuery) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if _, ok := ms.surveys[sid]; !ok {
+		return fmt.Errorf("no stored state for surveyID %s", sid)
+	}
+	ms.responses[sid] = append(ms.responses[sid], resp)
+	return nil
+}
+
+// Responses returns the submissions appended to a survey in memory
+func (ms *MemoryStorage) Responses(sid SurveyID) ([]SurveyResponseQuery, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	return append([]SurveyResponseQuery{}, ms.responses[sid]...), nil
+}
+
+// Get returns the state of a survey
+func (ms *MemoryStorage) Get(sid SurveyID) (SurveyState, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	state, ok := ms.surveys[sid]
+	if !ok {
+		return SurveyState{}, fmt.Errorf("no stored state for surveyID %s", sid)
+	}
+	return state, nil
+}
+
+// Delete removes a survey from memory
+func (ms *MemoryStorage) Delete(sid SurveyID) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	delete(ms.surveys, sid)
+	delete(ms.responses, sid)
+	return nil
+}
+
+// List returns the IDs of all the surveys in memory
+func (ms *MemoryStorage) List() ([]SurveyID, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	ids := make([]SurveyID, 0, len(ms.surveys))
+	for sid := range ms.surveys {
+		ids = append(ids, sid)
+	}
+	return ids, nil
+}
+
+// BoltDB storage
+//______________________________________________________________________________________________________________________
+
+// BoltStorage is a SurveyStorage backed by a BoltDB bucket (e.g. the database of the conode in its data directory).
+// The submissions appended to a survey are kept in a nested bucket per survey, under responsesBucket, so that each one is
+// written once.
+type BoltStorage struct {
+	db     *bbolt.DB
+	bucket []byte
+}
+
+// responsesBucket is the name of the bucket, nested in the bucket of a BoltStorage, of the appended submissions
+var responsesBucket = []byte("responses")
+
+// NewBoltStorage constructor of a BoltStorage, the bucket is created if it does not exist.
+func NewBoltStorage(db *bbolt.DB, bucket []byte) (*BoltStorage, error) {
+	err := db.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(bucket)
+		if err != nil {
+			return err
+		}
+		_, err = b.CreateBucketIfNotExists(responsesBucket)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not create bucket %s: %v", bucket, err)
+	}
+	return &BoltStorage{db: db, bucket: bucket}, nil
+}
+
+// Put marshals the state of a survey and writes it in the database
+func (bs *BoltStorage) Put(sid SurveyID, state SurveyState) error {
+	buf, err := network.Marshal(&state)
+	if err != nil {
+		return fmt.Errorf("could not marshal survey %s: %v", sid, err)
+	}
+	return bs.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bs.bucket)
+		if err := b.Put([]byte(sid), buf); err != nil {
+			return err
+		}
+		return deleteNestedBucket(b.Bucket(responsesBucket), []byte(sid))
+	})
+}
+
+// AppendResponse marshals the submission of a data provider and appends it to a survey in the database
+func (bs *BoltStorage) AppendResponse(sid SurveyID, resp SurveyResponseQuery) error {
+	buf, err := network.Marshal(&resp)
+	if err != nil {
+		return fmt.Errorf("could not marshal a response to survey %s: %v", sid, err)
+	}
+	return bs.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bs.bucket)
+		if b.Get([]byte(sid)) == nil {
+			return fmt.Errorf("no stored state for surveyID %s", sid)
+		}
+		responses, err := b.Bucket(responsesBucket).CreateBucketIfNotExists([]byte(sid))
+		if err != nil {
+			return err
+		}
+		seq, err := responses.NextSequence()
+		if err != nil {
+			return err
+		}
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, seq)
+		return responses.Put(key, buf)
+	})
+}
+
+// Responses reads the submissions appended to a survey from the database
+func (bs *BoltStorage) Responses(sid SurveyID) ([]SurveyResponseQuery, error) {
+	bufs := make([][]byte, 0)
+	err := bs.db.View(func(tx *bbolt.Tx) error {
+		responses := tx.Bucket(bs.bucket).Bucket(responsesBucket).Bucket([]byte(sid))
+		if responses == nil {
+			return nil
+		}
+		return responses.ForEach(func(_, v []byte) error {
+			bufs = append(bufs, append([]byte{}, v...))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]SurveyResponseQuery, len(bufs))
+	for i, buf := range bufs {
+		_, msg, err := network.Unmarshal(buf, libunlynx.SuiTe)
+		if err != nil {
+			return nil, fmt.Errorf("could not unmarshal a response to survey %s: %v", sid, err)
+		}
+		resp, ok := msg.(*SurveyResponseQuery)
+		if !ok {
+			return nil, fmt.Errorf("wrong type stored for a response to surveyID %s", sid)
+		}
+		list[i] = *resp
+	}
+	return list, nil
+}
+
+// deleteNestedBucket deletes the nested bucket name of b if it exists
+func deleteNestedBucket(b *bbolt.Bucket, name []byte) error {
+	if b.Bucket(name) == nil {
+		return nil
+	}
+	return b.DeleteBucket(name)
+}
+
+// Get reads the state of a survey from the database
+func (bs *BoltStorage) Get(sid SurveyID) (SurveyState, error) {
+	var buf []byte
+	err := bs.db.View(func(tx *bbolt.Tx) error {
+		v := tx.Bucket(bs.bucket).Get([]byte(sid))
+		if v != nil {
+			buf = make([]byte, len(v))
+			copy(buf, v)
+		}
+		return nil
+	})
+	if err != nil {
+		return SurveyState{}, err
+	}
+	if buf == nil {
+		return SurveyState{}, fmt.Errorf("no stored state for surveyID %s", sid)
+	}
+
+	_, msg, err := network.Unmarshal(buf, libunlynx.SuiTe)
+	if err != nil {
+		return SurveyState{}, fmt.Errorf("could not unmarshal survey %s: %v", sid, err)
+	}
+	state, ok := msg.(*SurveyState)
+	if !ok {
+		return SurveyState{}, fmt.Errorf("wrong type stored for surveyID %s", sid)
+	}
+	return *state, nil
+}
+
+// Delete removes a survey from the database
+func (bs *BoltStorage) Delete(sid SurveyID) error {
+	return bs.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bs.bucket)
+		if err := b.Delete([]byte(sid)); err != nil {
+			return err
+		}
+		return deleteNestedBucket(b.Bucket(responsesBucket), []byte(sid))
+	})
+}
+
+// List returns the IDs of all the surveys in the database
+func (bs *BoltStorage) List() ([]SurveyID, error) {
+	ids := make([]SurveyID, 0)
+	err := bs.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bs.bucket).ForEach(func(k, v []byte) error {
+			// the nested buckets have no value
+			if v != nil {
+				ids = append(ids, SurveyID(k))
+			}
+			return nil
+		})
+	})
+	return ids, err
+}
@@ -0,0 +1,117 @@
+package servicesunlynx_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/lib/store"
+	"github.com/ldsec/unlynx/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/onet/v3"
+	"go.etcd.io/bbolt"
+)
+
+func testStorage(t *testing.T, storage servicesunlynx.SurveyStorage) {
+	local := onet.NewLocalTest(libunlynx.SuiTe)
+	_, el, _ := local.GenTree(3, true)
+	defer local.CloseAll()
+
+	_, pubKey := libunlynx.GenKey()
+	aggr := *libunlynx.EncryptIntVector(el.Aggregate, []int64{1, 2})
+
+	store := libunlynxstore.NewStore()
+	store.InsertDpResponse(libunlynx.DpResponse{GroupByClear: map[string]int64{"g1": 1}, AggregatingAttributesEnc: map[string]libunlynx.CipherText{"s1": aggr[0], "s2": aggr[1]}}, false, []string{"g1"}, []string{"s1", "s2"}, nil)
+
+	state := servicesunlynx.SurveyState{
+		Query: servicesunlynx.SurveyCreationQuery{
+			SurveyID:     "test",
+			Roster:       *el,
+			ClientPubKey: pubKey,
+			MapDPs:       map[string]int64{el.List[0].String(): 2},
+			Sum:          []string{"s1", "s2"},
+			Where:        []libunlynx.WhereQueryAttribute{{Name: "w1", Value: *libunlynx.EncryptInt(el.Aggregate, 1)}},
+			Predicate:    "v0 == v1",
+			GroupBy:      []string{"g1"},
+		},
+		Phase:      servicesunlynx.PhaseShuffling,
+		DpReceived: 1,
+		Store:      store.Snapshot(),
+	}
+
+	require.NoError(t, storage.Put("test", state))
+	require.NoError(t, storage.Put("other", servicesunlynx.SurveyState{Query: servicesunlynx.SurveyCreationQuery{Roster: *el}}))
+
+	ids, err := storage.List()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []servicesunlynx.SurveyID{"test", "other"}, ids)
+
+	restored, err := storage.Get("test")
+	require.NoError(t, err)
+	assert.Equal(t, servicesunlynx.PhaseShuffling, restored.Phase)
+	assert.Equal(t, int64(1), restored.DpReceived)
+	assert.True(t, pubKey.Equal(restored.Query.ClientPubKey))
+	assert.True(t, el.Aggregate.Equal(restored.Query.Roster.Aggregate))
+	assert.Equal(t, state.Query.Sum, restored.Query.Sum)
+	assert.Equal(t, state.Query.MapDPs, restored.Query.MapDPs)
+	assert.True(t, state.Query.Where[0].Value.Equal(&restored.Query.Where[0].Value))
+
+	restoredResponses := libunlynxstore.NewStoreFromSnapshot(restored.Store).PullDpResponses()
+	require.Len(t, restoredResponses, 1)
+	assert.True(t, aggr.Equal(&restoredResponses[0].AggregatingAttributes))
+
+	// the submissions are appended until the next state replaces them
+	dp := libunlynx.DpResponseToSend{AggregatingAttributesClear: map[string]int64{"s1": 3}}
+	assert.Error(t, storage.AppendResponse("unknown", servicesunlynx.SurveyResponseQuery{SurveyID: "unknown"}))
+	require.NoError(t, storage.AppendResponse("test", servicesunlynx.SurveyResponseQuery{SurveyID: "test", Responses: []libunlynx.DpResponseToSend{dp}}))
+	require.NoError(t, storage.AppendResponse("test", servicesunlynx.SurveyResponseQuery{SurveyID: "test", Nonce: []byte{1}}))
+	responses, err := storage.Responses("test")
+	require.NoError(t, err)
+	require.Len(t, responses, 2)
+	assert.Equal(t, int64(3), responses[0].Responses[0].AggregatingAttributesClear["s1"])
+	assert.Equal(t, []byte{1}, responses[1].Nonce)
+
+	ids, err = storage.List()
+	require.NoError(t, err)
+	assert.Len(t, ids, 2)
+
+	require.NoError(t, storage.Put("test", state))
+	responses, err = storage.Responses("test")
+	require.NoError(t, err)
+	assert.Empty(t, responses)
+
+	require.NoError(t, storage.AppendResponse("test", servicesunlynx.SurveyResponseQuery{SurveyID: "test"}))
+	require.NoError(t, storage.Delete("test"))
+	_, err = storage.Get("test")
+	assert.Error(t, err)
+	responses, err = storage.Responses("test")
+	require.NoError(t, err)
+	assert.Empty(t, responses)
+}
+
+func TestMemoryStorage(t *testing.T) {
+	testStorage(t, servicesunlynx.NewMemoryStorage())
+}
+
+func TestBoltStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unlynx")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	db, err := bbolt.Open(filepath.Join(dir, "surveys.db"), 0600, nil)
+	require.NoError(t, err)
+	defer db.Close()
+
+	storage, err := servicesunlynx.NewBoltStorage(db, []byte("surveys"))
+	require.NoError(t, err)
+	testStorage(t, storage)
+}
+
+func TestSurveyPhaseString(t *testing.T) {
+	assert.Equal(t, "collecting", servicesunlynx.PhaseCollecting.String())
+	assert.Equal(t, "key switching", servicesunlynx.PhaseKeySwitching.String())
+	assert.Equal(t, "unknown", servicesunlynx.SurveyPhase(42).String())
+}
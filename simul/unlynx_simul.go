@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/ldsec/unlynx/data"
 	"github.com/ldsec/unlynx/lib"
+	"github.com/ldsec/unlynx/lib/differential_privacy"
 	"github.com/ldsec/unlynx/lib/tools"
 	"github.com/ldsec/unlynx/services"
 	"strconv"
@@ -38,6 +39,7 @@ type SimulationUnLynx struct {
 	RandomGroups         bool    //generate data randomly or num entries == num groups (deterministically)
 	DataRepetitions      int     //repeat the number of entries x times (e.g. 1 no repetition; 1000 repetitions)
 	Proofs               bool    //with proofs of correctness everywhere
+	NoiseListSize        int64   //size of the list of noise values of the DRO phase (0 disables the differential privacy)
 }
 
 // NewSimulationUnLynx constructs a full UnLynx service simulation.
@@ -74,7 +76,7 @@ func (sim *SimulationUnLynx) Run(config *onet.SimulationConfig) error {
 
 	// Does not make sense to have more servers than clients!!
 	if nbrHosts > sim.NbrDPs {
-		return fmt.Errorf("hosts: " + strconv.FormatInt(int64(nbrHosts), 10) + " must be the same or lower as num_clients " + strconv.FormatInt(int64(sim.NbrDPs), 10))
+		return fmt.Errorf("hosts: %d must be the same or lower as num_clients %d", nbrHosts, sim.NbrDPs)
 	}
 	el := (*config.Tree).Roster
 
@@ -122,7 +124,10 @@ func (sim *SimulationUnLynx) Run(config *onet.SimulationConfig) error {
 			groupBy[i] = "g" + strconv.Itoa(i)
 		}
 
-		surveyID, err := client.SendSurveyCreationQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, sim.Proofs, false, sum, count, whereQueryValues, predicate, groupBy)
+		// Differential privacy
+		diffPri := libunlynxdiffprivacy.Params{Epsilon: 1, Sensitivity: 1, NoiseListSize: sim.NoiseListSize, Quanta: 0.1, Scale: 1}
+
+		surveyID, err := client.SendSurveyCreationQuery(el, servicesunlynx.SurveyID(""), nil, nbrDPs, sim.Proofs, false, sum, count, whereQueryValues, predicate, groupBy, servicesunlynx.SurveyOptions{DiffPri: diffPri})
 		if err != nil {
 			return err
 		}
@@ -153,9 +158,9 @@ func (sim *SimulationUnLynx) Run(config *onet.SimulationConfig) error {
 				server := el.List[i%nbrHosts]
 
 				client = servicesunlynx.NewUnLynxClient(server, strconv.Itoa(i+1))
-				if tmpErr := client.SendSurveyResponseQuery(*surveyID, dataCollection, el.Aggregate, sim.DataRepetitions, count); tmpErr != nil {
+				if tmpErr := client.SendSurveyResponseQuery(*surveyID, dataCollection, el.Aggregate, sim.DataRepetitions, count, nil, nil, nil, nil); tmpErr != nil {
 					mutex.Lock()
-					err = fmt.Errorf("Error while sending DP ("+client.String()+") responses: %v", err)
+					err = fmt.Errorf("Error while sending DP (%s) responses: %v", client.String(), err)
 					log.Error(err)
 					mutex.Unlock()
 				}